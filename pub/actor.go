@@ -42,6 +42,10 @@ type Actor interface {
 	// http.StatusMethodNotAllowed status code in the response. No side
 	// effects occur.
 	//
+	// If the Actor was constructed with the WithAsyncInbox option, the
+	// side effects occur after the http.StatusAccepted status code has
+	// been written in the response.
+	//
 	// The request and data of your application will be interpreted as
 	// having an HTTPS protocol scheme.
 	PostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error)
@@ -63,7 +67,17 @@ type Actor interface {
 	// the resulting OrderedCollection to respond with. The Actor handles
 	// serializing this OrderedCollection and responding with the correct
 	// headers and http.StatusOK.
+	//
+	// The OrderedCollection links to its first and last pages, which are
+	// requested with the "page" query parameter.
+	//
+	// The request and data of your application will be interpreted as
+	// having an HTTPS protocol scheme.
 	GetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error)
+	// GetInboxScheme is similar to GetInbox, except clients are able to
+	// specify which protocol scheme to handle the incoming request and the
+	// data stored within the application (HTTP, HTTPS, etc).
+	GetInboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (bool, error)
 	// PostOutbox returns true if the request was handled as an ActivityPub
 	// POST to an actor's outbox. If false, the request was not an
 	// ActivityPub request and may still be handled by the caller in another
@@ -103,7 +117,16 @@ type Actor interface {
 	// the resulting OrderedCollection to respond with. The Actor handles
 	// serializing this OrderedCollection and responding with the correct
 	// headers and http.StatusOK.
+	//
+	// The OrderedCollection links to its first and last pages, which are
+	// requested with the "page" query parameter.
+	//
+	// The request will be interpreted as having an HTTPS scheme.
 	GetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error)
+	// GetOutboxScheme is similar to GetOutbox, except clients are able to
+	// specify which protocol scheme to handle the incoming request and the
+	// data stored within the application (HTTP, HTTPS, etc).
+	GetOutboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (bool, error)
 }
 
 // FederatingActor is an Actor that allows programmatically delivering an
@@ -0,0 +1,280 @@
+package pub
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const (
+	// PersonActorType is the ActivityStreams type of actors that are
+	// people, and the default type of actor documents.
+	PersonActorType = "Person"
+	// ServiceActorType is the ActivityStreams type of actors that are
+	// automated services.
+	ServiceActorType = "Service"
+	// ApplicationActorType is the ActivityStreams type of actors that are
+	// software applications, such as an InstanceActor.
+	ApplicationActorType = "Application"
+	// GroupActorType is the ActivityStreams type of actors that are groups.
+	GroupActorType = "Group"
+	// OrganizationActorType is the ActivityStreams type of actors that are
+	// organizations.
+	OrganizationActorType = "Organization"
+	// endpointsProperty is the 'endpoints' property of an actor, which is
+	// not part of the generated vocabulary.
+	endpointsProperty = "endpoints"
+	// defaultPublicKeyFragment is the fragment of an actor's id
+	// identifying its public key when no PublicKeyId is given.
+	defaultPublicKeyFragment = "main-key"
+)
+
+// ActorConfig describes an actor on this server, from which NewActorDocument
+// creates a consistent ActivityStreams document.
+//
+// Only Id and PublicKey are required. The collections of the actor default to
+// its Id with a path segment appended, such as "https://example.com/addison/inbox"
+// for "https://example.com/addison".
+type ActorConfig struct {
+	// Type is the ActivityStreams type of the actor, such as
+	// PersonActorType. If empty, PersonActorType is used.
+	Type string
+	// Id is the IRI of the actor.
+	Id *url.URL
+	// PreferredUsername is the username of the actor, such as "addison".
+	PreferredUsername string
+	// Name is the display name of the actor.
+	Name string
+	// Summary is the HTML biography of the actor.
+	Summary string
+	// URL is the IRI of the actor's profile web page.
+	URL *url.URL
+	// Inbox is the IRI of the actor's inbox. If nil, "inbox" is appended
+	// to Id.
+	Inbox *url.URL
+	// Outbox is the IRI of the actor's outbox. If nil, "outbox" is
+	// appended to Id.
+	Outbox *url.URL
+	// Followers is the IRI of the actor's followers collection. If nil,
+	// "followers" is appended to Id.
+	Followers *url.URL
+	// Following is the IRI of the actor's following collection. If nil,
+	// "following" is appended to Id.
+	Following *url.URL
+	// Liked is the IRI of the actor's liked collection. If nil, "liked" is
+	// appended to Id.
+	Liked *url.URL
+	// PublicKey is the public key verifying the HTTP Signatures of the
+	// actor's requests.
+	PublicKey crypto.PublicKey
+	// PublicKeyId is the IRI of the public key. If nil, Id with a
+	// "main-key" fragment is used.
+	PublicKeyId *url.URL
+	// Endpoints are the server endpoints advertised in the 'endpoints'
+	// property of the actor. If nil, the property is omitted.
+	Endpoints *ActorEndpoints
+}
+
+// ActorEndpoints are the endpoints of the server useful to an actor's clients,
+// served in the 'endpoints' property of its document.
+//
+// Nil endpoints are omitted.
+type ActorEndpoints struct {
+	// OAuthAuthorizationEndpoint is the IRI where clients obtain the
+	// actor's authorization to use the Social API, with OAuth 2.0.
+	OAuthAuthorizationEndpoint *url.URL
+	// OAuthTokenEndpoint is the IRI where clients exchange an OAuth 2.0
+	// authorization grant for an access token.
+	OAuthTokenEndpoint *url.URL
+	// UploadMedia is the IRI where clients upload media files, such as
+	// the handler created by NewMediaUploadHandler.
+	UploadMedia *url.URL
+	// ProxyURL is the IRI where clients fetch remote objects through this
+	// server, such as the handler created by NewProxyHandler.
+	ProxyURL *url.URL
+}
+
+// toMap returns the JSON representation of the set endpoints.
+func (e ActorEndpoints) toMap() map[string]interface{} {
+	m := make(map[string]interface{})
+	if e.OAuthAuthorizationEndpoint != nil {
+		m["oauthAuthorizationEndpoint"] = e.OAuthAuthorizationEndpoint.String()
+	}
+	if e.OAuthTokenEndpoint != nil {
+		m["oauthTokenEndpoint"] = e.OAuthTokenEndpoint.String()
+	}
+	if e.UploadMedia != nil {
+		m["uploadMedia"] = e.UploadMedia.String()
+	}
+	if e.ProxyURL != nil {
+		m["proxyUrl"] = e.ProxyURL.String()
+	}
+	return m
+}
+
+// actorDocument is the ActivityStreams actor types created by
+// NewActorDocument.
+type actorDocument interface {
+	vocab.Type
+	SetActivityStreamsPreferredUsername(i vocab.ActivityStreamsPreferredUsernameProperty)
+	SetActivityStreamsName(i vocab.ActivityStreamsNameProperty)
+	SetActivityStreamsSummary(i vocab.ActivityStreamsSummaryProperty)
+	SetActivityStreamsUrl(i vocab.ActivityStreamsUrlProperty)
+	SetActivityStreamsInbox(i vocab.ActivityStreamsInboxProperty)
+	SetActivityStreamsOutbox(i vocab.ActivityStreamsOutboxProperty)
+	SetActivityStreamsFollowers(i vocab.ActivityStreamsFollowersProperty)
+	SetActivityStreamsFollowing(i vocab.ActivityStreamsFollowingProperty)
+	SetActivityStreamsLiked(i vocab.ActivityStreamsLikedProperty)
+	publicKeyer
+	GetUnknownProperties() map[string]interface{}
+}
+
+// publicKeyer is an ActivityStreams type with a 'publicKey' property.
+type publicKeyer interface {
+	GetW3IDSecurityV1PublicKey() vocab.W3IDSecurityV1PublicKeyProperty
+	SetW3IDSecurityV1PublicKey(i vocab.W3IDSecurityV1PublicKeyProperty)
+}
+
+// NewActorDocument creates the ActivityStreams document of the actor, with its
+// collections and public key.
+func NewActorDocument(cfg ActorConfig) (vocab.Type, error) {
+	if cfg.Id == nil {
+		return nil, fmt.Errorf("cannot create actor document without an id")
+	}
+	var a actorDocument
+	switch cfg.Type {
+	case "", PersonActorType:
+		a = streams.NewActivityStreamsPerson()
+	case ServiceActorType:
+		a = streams.NewActivityStreamsService()
+	case ApplicationActorType:
+		a = streams.NewActivityStreamsApplication()
+	case GroupActorType:
+		a = streams.NewActivityStreamsGroup()
+	case OrganizationActorType:
+		a = streams.NewActivityStreamsOrganization()
+	default:
+		return nil, fmt.Errorf("cannot create actor document of unknown type %q", cfg.Type)
+	}
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(cfg.Id)
+	a.SetJSONLDId(idProp)
+	if len(cfg.PreferredUsername) > 0 {
+		username := streams.NewActivityStreamsPreferredUsernameProperty()
+		username.SetXMLSchemaString(cfg.PreferredUsername)
+		a.SetActivityStreamsPreferredUsername(username)
+	}
+	if len(cfg.Name) > 0 {
+		name := streams.NewActivityStreamsNameProperty()
+		name.AppendXMLSchemaString(cfg.Name)
+		a.SetActivityStreamsName(name)
+	}
+	if len(cfg.Summary) > 0 {
+		summary := streams.NewActivityStreamsSummaryProperty()
+		summary.AppendXMLSchemaString(cfg.Summary)
+		a.SetActivityStreamsSummary(summary)
+	}
+	if cfg.URL != nil {
+		u := streams.NewActivityStreamsUrlProperty()
+		u.AppendIRI(cfg.URL)
+		a.SetActivityStreamsUrl(u)
+	}
+	inbox := streams.NewActivityStreamsInboxProperty()
+	inbox.SetIRI(iriOrAppendPath(cfg.Inbox, cfg.Id, "inbox"))
+	a.SetActivityStreamsInbox(inbox)
+	outbox := streams.NewActivityStreamsOutboxProperty()
+	outbox.SetIRI(iriOrAppendPath(cfg.Outbox, cfg.Id, "outbox"))
+	a.SetActivityStreamsOutbox(outbox)
+	followers := streams.NewActivityStreamsFollowersProperty()
+	followers.SetIRI(iriOrAppendPath(cfg.Followers, cfg.Id, "followers"))
+	a.SetActivityStreamsFollowers(followers)
+	following := streams.NewActivityStreamsFollowingProperty()
+	following.SetIRI(iriOrAppendPath(cfg.Following, cfg.Id, "following"))
+	a.SetActivityStreamsFollowing(following)
+	liked := streams.NewActivityStreamsLikedProperty()
+	liked.SetIRI(iriOrAppendPath(cfg.Liked, cfg.Id, "liked"))
+	a.SetActivityStreamsLiked(liked)
+	keyId := cfg.PublicKeyId
+	if keyId == nil {
+		keyId = publicKeyIdOf(cfg.Id)
+	}
+	if err := AddPublicKey(a, keyId, cfg.Id, cfg.PublicKey); err != nil {
+		return nil, err
+	}
+	if cfg.Endpoints != nil {
+		// The vocabulary has no 'endpoints' property, so it is
+		// serialized as an unknown property instead, as it would be
+		// had the document been deserialized.
+		if m := cfg.Endpoints.toMap(); len(m) > 0 {
+			a.GetUnknownProperties()[endpointsProperty] = m
+		}
+	}
+	return a, nil
+}
+
+// AddPublicKey attaches the public key to the 'publicKey' property of an actor,
+// with its id, its owner, and its PEM encoding.
+//
+// Returns an error if the type has no 'publicKey' property, or if the key is of
+// an unsupported kind.
+func AddPublicKey(t vocab.Type, keyId, owner *url.URL, pubKey crypto.PublicKey) error {
+	a, ok := t.(publicKeyer)
+	if !ok {
+		return fmt.Errorf("cannot add public key to type %T", t)
+	}
+	keyPem, err := PublicKeyPEM(pubKey)
+	if err != nil {
+		return err
+	}
+	key := streams.NewW3IDSecurityV1PublicKey()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(keyId)
+	key.SetJSONLDId(idProp)
+	ownerProp := streams.NewW3IDSecurityV1OwnerProperty()
+	ownerProp.Set(owner)
+	key.SetW3IDSecurityV1Owner(ownerProp)
+	pemProp := streams.NewW3IDSecurityV1PublicKeyPemProperty()
+	pemProp.Set(keyPem)
+	key.SetW3IDSecurityV1PublicKeyPem(pemProp)
+	keys := a.GetW3IDSecurityV1PublicKey()
+	if keys == nil {
+		keys = streams.NewW3IDSecurityV1PublicKeyProperty()
+		a.SetW3IDSecurityV1PublicKey(keys)
+	}
+	keys.AppendW3IDSecurityV1PublicKey(key)
+	return nil
+}
+
+// PublicKeyPEM encodes the public key, such as an *rsa.PublicKey, in the PEM
+// format used by the 'publicKeyPem' property.
+func PublicKeyPEM(pubKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	})), nil
+}
+
+// publicKeyIdOf returns the default IRI of an actor's public key.
+func publicKeyIdOf(actorIRI *url.URL) *url.URL {
+	id := *actorIRI
+	id.Fragment = defaultPublicKeyFragment
+	return &id
+}
+
+// iriOrAppendPath returns the IRI if it is not nil, otherwise a copy of the
+// base IRI with the segment appended to its path.
+func iriOrAppendPath(iri, base *url.URL, segment string) *url.URL {
+	if iri != nil {
+		return iri
+	}
+	return appendPath(base, segment)
+}
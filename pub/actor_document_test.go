@@ -0,0 +1,116 @@
+package pub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+)
+
+// mustPublicKey generates a new public key.
+func mustPublicKey() *ecdsa.PublicKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return &key.PublicKey
+}
+
+// TestNewActorDocument tests creating the documents of actors.
+func TestNewActorDocument(t *testing.T) {
+	t.Run("CreatesPersonWithDefaults", func(t *testing.T) {
+		// Setup
+		pubKey := mustPublicKey()
+		keyPem, err := PublicKeyPEM(pubKey)
+		assertEqual(t, err, nil)
+		// Run
+		a, err := NewActorDocument(ActorConfig{
+			Id:                mustParse("https://example.com/addison"),
+			PreferredUsername: "addison",
+			Name:              "Addison",
+			PublicKey:         pubKey,
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		m, err := streams.Serialize(a)
+		assertEqual(t, err, nil)
+		assertEqual(t, m["type"], "Person")
+		assertEqual(t, m["preferredUsername"], "addison")
+		assertEqual(t, m["name"], "Addison")
+		assertEqual(t, m["inbox"], "https://example.com/addison/inbox")
+		assertEqual(t, m["outbox"], "https://example.com/addison/outbox")
+		assertEqual(t, m["followers"], "https://example.com/addison/followers")
+		assertEqual(t, m["following"], "https://example.com/addison/following")
+		assertEqual(t, m["liked"], "https://example.com/addison/liked")
+		key := m["publicKey"].(map[string]interface{})
+		assertEqual(t, key["id"], "https://example.com/addison#main-key")
+		assertEqual(t, key["owner"], "https://example.com/addison")
+		assertEqual(t, key["publicKeyPem"], keyPem)
+	})
+	t.Run("CreatesServiceWithCustomIRIs", func(t *testing.T) {
+		// Run
+		a, err := NewActorDocument(ActorConfig{
+			Type:        ServiceActorType,
+			Id:          mustParse("https://example.com/bot"),
+			Inbox:       mustParse("https://example.com/inbox"),
+			PublicKey:   mustPublicKey(),
+			PublicKeyId: mustParse("https://example.com/bot/key"),
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		m, err := streams.Serialize(a)
+		assertEqual(t, err, nil)
+		assertEqual(t, m["type"], "Service")
+		assertEqual(t, m["inbox"], "https://example.com/inbox")
+		assertEqual(t, m["publicKey"].(map[string]interface{})["id"], "https://example.com/bot/key")
+	})
+	t.Run("AdvertisesEndpoints", func(t *testing.T) {
+		// Run
+		a, err := NewActorDocument(ActorConfig{
+			Id:        mustParse("https://example.com/addison"),
+			PublicKey: mustPublicKey(),
+			Endpoints: &ActorEndpoints{
+				OAuthAuthorizationEndpoint: mustParse("https://example.com/oauth/authorize"),
+				OAuthTokenEndpoint:         mustParse("https://example.com/oauth/token"),
+				UploadMedia:                mustParse("https://example.com/addison/uploadMedia"),
+				ProxyURL:                   mustParse("https://example.com/addison/proxy"),
+			},
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		m, err := streams.Serialize(a)
+		assertEqual(t, err, nil)
+		endpoints := m["endpoints"].(map[string]interface{})
+		assertEqual(t, endpoints["oauthAuthorizationEndpoint"], "https://example.com/oauth/authorize")
+		assertEqual(t, endpoints["oauthTokenEndpoint"], "https://example.com/oauth/token")
+		assertEqual(t, endpoints["uploadMedia"], "https://example.com/addison/uploadMedia")
+		assertEqual(t, endpoints["proxyUrl"], "https://example.com/addison/proxy")
+	})
+	t.Run("ReturnsErrorForUnknownType", func(t *testing.T) {
+		// Run
+		_, err := NewActorDocument(ActorConfig{
+			Type:      "Note",
+			Id:        mustParse("https://example.com/addison"),
+			PublicKey: mustPublicKey(),
+		})
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+	t.Run("AddsPublicKeyToExistingActor", func(t *testing.T) {
+		// Setup
+		p := streams.NewActivityStreamsPerson()
+		// Run
+		err := AddPublicKey(p, mustParse("https://example.com/addison#main-key"), mustParse("https://example.com/addison"), mustPublicKey())
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, p.GetW3IDSecurityV1PublicKey().Len(), 1)
+	})
+	t.Run("ReturnsErrorAddingPublicKeyToNonActor", func(t *testing.T) {
+		// Run
+		err := AddPublicKey(streams.NewActivityStreamsNote(), mustParse("https://example.com/note#key"), mustParse("https://example.com/addison"), mustPublicKey())
+		// Verify
+		assertNotEqual(t, err, nil)
+	})
+}
@@ -0,0 +1,441 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+)
+
+const (
+	// defaultAsyncInboxBackoff is the delay before the first retry of a
+	// failed inbox work item when no Backoff function is provided.
+	defaultAsyncInboxBackoff = 10 * time.Second
+	// maxAsyncInboxBackoff caps the default exponential backoff.
+	maxAsyncInboxBackoff = time.Hour
+	// asyncInboxPushTimeout bounds how long a worker waits to push work
+	// back onto a full queue, so that workers cannot all block on their
+	// own queue.
+	asyncInboxPushTimeout = 10 * time.Second
+	// asyncInboxPollInterval is the longest a worker waits after pushing
+	// back work that is not due yet, so that it does not spin on a queue
+	// holding only delayed work.
+	asyncInboxPollInterval = time.Second
+)
+
+// InboxWork is an activity delivered to an inbox whose side effects have not
+// yet been applied.
+type InboxWork struct {
+	// InboxIRI is the inbox the activity was delivered to.
+	InboxIRI *url.URL
+	// Activity is the JSON body of the activity as it was received.
+	Activity []byte
+	// Attempts is the number of times applying the side effects has
+	// failed so far.
+	Attempts int
+	// Forwarding is true once the inbox side effects have succeeded, and
+	// only inbox forwarding remains to be done.
+	Forwarding bool
+	// NotBefore is the earliest time at which the work may be attempted.
+	// The zero value means the work may be attempted immediately.
+	NotBefore time.Time
+	// Context carries the request-scoped values set by the application
+	// hooks, such as AuthenticatePostInbox and PostInboxRequestBodyHook,
+	// without the request's deadline or cancellation.
+	//
+	// It cannot be persisted, so durable InboxQueue implementations may
+	// drop it. It is nil in that case, and the work will be processed
+	// with the context given to AsyncInbox.Run.
+	Context context.Context
+}
+
+// InboxQueue persists inbox deliveries that have been authenticated,
+// authorized, and accepted by an Actor, but whose side effects have not yet
+// been applied.
+//
+// Implementations must be safe for concurrent use. A durable implementation
+// lets accepted activities survive a restart of the application.
+type InboxQueue interface {
+	// Push adds the work to the queue. Once Push returns without error,
+	// the work must eventually be returned by Pop.
+	Push(c context.Context, w *InboxWork) error
+	// Pop blocks until work is available or the context is done. In the
+	// latter case, the context's error is returned.
+	//
+	// Pop should not return work before its NotBefore time. Work returned
+	// early is pushed back onto the queue by the worker that popped it.
+	Pop(c context.Context) (*InboxWork, error)
+}
+
+// InboxQueue must be implemented by memoryInboxQueue.
+var _ InboxQueue = &memoryInboxQueue{}
+
+// memoryInboxQueue is an InboxQueue backed by a buffered channel, with the
+// work that is not due yet held aside.
+type memoryInboxQueue struct {
+	ch    chan *InboxWork
+	clock Clock
+	// mu protects delayed.
+	mu      sync.Mutex
+	delayed []*InboxWork
+}
+
+// NewMemoryInboxQueue returns an InboxQueue that holds at most size work
+// items in memory. Push blocks while the queue is full.
+//
+// At most size more work items whose NotBefore time is in the future, according
+// to the clock, are held aside until they are due, and only then take up room
+// in the queue. Pushing delayed work fails while that many are held aside.
+// Work is lost if the application exits before it is processed.
+func NewMemoryInboxQueue(size int, clock Clock) InboxQueue {
+	return &memoryInboxQueue{
+		ch:    make(chan *InboxWork, size),
+		clock: clock,
+	}
+}
+
+// Push adds the work to the channel, blocking if it is full. Work that is not
+// due yet is held aside without blocking, or refused if too much already is.
+func (m *memoryInboxQueue) Push(c context.Context, w *InboxWork) error {
+	if w.NotBefore.After(m.clock.Now()) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if len(m.delayed) >= cap(m.ch) {
+			return fmt.Errorf("inbox queue already holds %d delayed work items", len(m.delayed))
+		}
+		m.delayed = append(m.delayed, w)
+		return nil
+	}
+	select {
+	case m.ch <- w:
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
+
+// Pop takes the delayed work that is due first, if any, otherwise the next
+// work from the channel. While work is held aside, the clock is checked again
+// at least every asyncInboxPollInterval.
+func (m *memoryInboxQueue) Pop(c context.Context) (*InboxWork, error) {
+	for {
+		w, waiting := m.popDue()
+		if w != nil {
+			return w, nil
+		}
+		if w, err := m.wait(c, waiting); w != nil || err != nil {
+			return w, err
+		}
+	}
+}
+
+// wait takes the next work from the channel. If delayed work is waiting, it
+// returns no work after asyncInboxPollInterval, for it to be checked again.
+func (m *memoryInboxQueue) wait(c context.Context, waiting bool) (*InboxWork, error) {
+	var poll <-chan time.Time
+	if waiting {
+		t := time.NewTimer(asyncInboxPollInterval)
+		defer t.Stop()
+		poll = t.C
+	}
+	select {
+	case w := <-m.ch:
+		return w, nil
+	case <-poll:
+		return nil, nil
+	case <-c.Done():
+		return nil, c.Err()
+	}
+}
+
+// popDue removes the delayed work that has been due the longest, if any, and
+// reports whether delayed work remains.
+func (m *memoryInboxQueue) popDue() (*InboxWork, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	due := -1
+	for i, w := range m.delayed {
+		if !w.NotBefore.After(now) && (due < 0 || w.NotBefore.Before(m.delayed[due].NotBefore)) {
+			due = i
+		}
+	}
+	if due < 0 {
+		return nil, len(m.delayed) > 0
+	}
+	w := m.delayed[due]
+	m.delayed = append(m.delayed[:due], m.delayed[due+1:]...)
+	return w, len(m.delayed) > 0
+}
+
+// AsyncInbox applies the side effects of inbox deliveries on a pool of
+// workers, so that an Actor is able to respond to a federated peer with
+// http.StatusAccepted as soon as the activity is authenticated, authorized,
+// and stored in an InboxQueue.
+//
+// The side effects are the same ones applied synchronously without an
+// AsyncInbox: the DelegateActor's PostInbox followed by its InboxForwarding.
+// Work that fails is pushed back onto the queue to be retried later, up to a
+// maximum number of attempts. Retries run the side effects of an activity again
+// even though the default DelegateActor already stored it in the inbox. Since a
+// retry calls PostInbox again, a custom DelegateActor must tolerate being given
+// an activity whose side effects were partially applied, and may call
+// IsInboxRetry to tell retries from peers delivering the activity twice.
+//
+// An AsyncInbox is given to exactly one Actor with the WithAsyncInbox option,
+// after which Run must be called to begin processing work.
+type AsyncInbox struct {
+	// Backoff determines how long to wait before retrying work that has
+	// failed the given number of times. If nil, an exponential backoff
+	// starting at ten seconds and capped at one hour is used.
+	Backoff func(attempts int) time.Duration
+	// OnFailure is called when work is dropped, either because it failed
+	// with a client error such as a MalformedError, or because it failed
+	// the maximum number of attempts. It may be nil.
+	OnFailure func(c context.Context, w *InboxWork, err error)
+
+	queue       InboxQueue
+	workers     int
+	maxAttempts int
+	// delegate and clock are set by the Actor given this AsyncInbox.
+	delegate DelegateActor
+	clock    Clock
+}
+
+// NewAsyncInbox creates an AsyncInbox that processes work from the queue with
+// the given number of workers.
+//
+// Work is attempted at most maxAttempts times. Zero or negative numbers retry
+// work indefinitely.
+func NewAsyncInbox(q InboxQueue, workers, maxAttempts int) *AsyncInbox {
+	if workers < 1 {
+		workers = 1
+	}
+	return &AsyncInbox{
+		queue:       q,
+		workers:     workers,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// WithAsyncInbox makes an Actor apply the side effects of POST requests to
+// inboxes asynchronously. Such requests are responded to with
+// http.StatusAccepted once the activity has been pushed onto the
+// AsyncInbox's queue.
+//
+// It has no effect on Actors without the Federated Protocol enabled.
+func WithAsyncInbox(a *AsyncInbox) ActorOption {
+	return func(b *baseActor) {
+		a.delegate = b.delegate
+		a.clock = b.clock
+		b.asyncInbox = a
+	}
+}
+
+// Run processes work on the queue until the context is done. It blocks until
+// all workers have stopped.
+//
+// The context is used for processing work that does not carry its own.
+func (a *AsyncInbox) Run(c context.Context) error {
+	if a.delegate == nil {
+		return fmt.Errorf("async inbox is not used by any actor")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < a.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.work(c)
+		}()
+	}
+	wg.Wait()
+	return c.Err()
+}
+
+// enqueue pushes a newly received activity onto the queue.
+func (a *AsyncInbox) enqueue(c context.Context, inboxIRI *url.URL, raw []byte) error {
+	return a.queue.Push(c, &InboxWork{
+		InboxIRI: inboxIRI,
+		Activity: raw,
+		Context:  detachedContext{c},
+	})
+}
+
+// work is a single worker's loop, popping and processing work until the
+// context is done.
+func (a *AsyncInbox) work(c context.Context) {
+	for {
+		w, err := a.queue.Pop(c)
+		if err != nil {
+			// Avoid spinning on a queue that keeps failing.
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-c.Done():
+				return
+			}
+		}
+		if d := a.delay(c, w); d > 0 {
+			if d > asyncInboxPollInterval {
+				d = asyncInboxPollInterval
+			}
+			select {
+			case <-time.After(d):
+				continue
+			case <-c.Done():
+				return
+			}
+		}
+		a.process(c, w)
+	}
+}
+
+// delay pushes the work back onto the queue if it is not due yet, leaving the
+// worker free to process the work queued behind it. It returns how long until
+// the work is due.
+func (a *AsyncInbox) delay(c context.Context, w *InboxWork) time.Duration {
+	d := w.NotBefore.Sub(a.clock.Now())
+	if d <= 0 {
+		return 0
+	}
+	if err := a.push(c, w); err != nil {
+		a.fail(a.context(c, w), w, fmt.Errorf("cannot delay work: %s", err))
+	}
+	return d
+}
+
+// process applies the side effects of the work, retrying or dropping it on
+// failure.
+func (a *AsyncInbox) process(c context.Context, w *InboxWork) {
+	ctx := a.context(c, w)
+	activity, err := a.decode(ctx, w.Activity)
+	if err != nil {
+		a.fail(ctx, w, err)
+		return
+	}
+	if !w.Forwarding {
+		err = a.delegate.PostInbox(ctx, w.InboxIRI, activity)
+		if isClientError(err) {
+			// Retrying will never fix a malformed or forbidden
+			// activity.
+			a.fail(ctx, w, err)
+			return
+		} else if err != nil {
+			a.retry(c, w, err)
+			return
+		}
+		w.Forwarding = true
+	}
+	if err = a.delegate.InboxForwarding(ctx, w.InboxIRI, activity); err != nil {
+		a.retry(c, w, err)
+	}
+}
+
+// context returns the context to process the work with, given the context of
+// Run. It is marked as a retry if the work failed before.
+func (a *AsyncInbox) context(c context.Context, w *InboxWork) context.Context {
+	ctx := w.Context
+	if ctx == nil {
+		ctx = c
+	}
+	if w.Attempts > 0 {
+		ctx = context.WithValue(ctx, inboxRetryContextKey{}, true)
+	}
+	return ctx
+}
+
+// push pushes work back onto the queue, giving up if the queue stays full or
+// the context of Run is done.
+func (a *AsyncInbox) push(c context.Context, w *InboxWork) error {
+	pc, cancel := context.WithTimeout(c, asyncInboxPushTimeout)
+	defer cancel()
+	return a.queue.Push(pc, w)
+}
+
+// decode deserializes the activity of the work.
+func (a *AsyncInbox) decode(c context.Context, raw []byte) (Activity, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	asValue, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	activity, ok := asValue.(Activity)
+	if !ok {
+		return nil, malformedf("activity streams value is not an Activity: %T", asValue)
+	}
+	return activity, nil
+}
+
+// retry pushes failed work back onto the queue, unless it has failed too many
+// times or the queue is full. The context is the one given to Run.
+func (a *AsyncInbox) retry(c context.Context, w *InboxWork, err error) {
+	w.Attempts++
+	if a.maxAttempts > 0 && w.Attempts >= a.maxAttempts {
+		a.fail(a.context(c, w), w, err)
+		return
+	}
+	w.NotBefore = a.clock.Now().Add(a.backoff(w.Attempts))
+	if pushErr := a.push(c, w); pushErr != nil {
+		a.fail(a.context(c, w), w, fmt.Errorf("cannot retry after error %q: %s", err, pushErr))
+	}
+}
+
+// backoff determines the delay before the next attempt.
+func (a *AsyncInbox) backoff(attempts int) time.Duration {
+	if a.Backoff != nil {
+		return a.Backoff(attempts)
+	}
+	d := defaultAsyncInboxBackoff
+	for i := 1; i < attempts && d < maxAsyncInboxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxAsyncInboxBackoff {
+		d = maxAsyncInboxBackoff
+	}
+	return d
+}
+
+// fail drops the work.
+func (a *AsyncInbox) fail(c context.Context, w *InboxWork, err error) {
+	if a.OnFailure != nil {
+		a.OnFailure(c, w, err)
+	}
+}
+
+// inboxRetryContextKey is the context key marking a retry of inbox work.
+type inboxRetryContextKey struct{}
+
+// IsInboxRetry determines whether the DelegateActor's PostInbox or
+// InboxForwarding is called by an AsyncInbox to retry work that failed, in
+// which case the activity may already be stored.
+func IsInboxRetry(c context.Context) bool {
+	retry, _ := c.Value(inboxRetryContextKey{}).(bool)
+	return retry
+}
+
+// detachedContext keeps the values of a context, but is never done.
+type detachedContext struct {
+	context.Context
+}
+
+// Deadline returns no deadline.
+func (detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+// Done returns a nil channel, which is never closed.
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+// Err always returns nil.
+func (detachedContext) Err() error {
+	return nil
+}
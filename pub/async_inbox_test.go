@@ -0,0 +1,299 @@
+package pub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+// TestMemoryInboxQueue tests the in-memory InboxQueue.
+func TestMemoryInboxQueue(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	t.Run("PopsInPushOrder", func(t *testing.T) {
+		// Setup
+		q := NewMemoryInboxQueue(2, &fakeClock{now: now})
+		first := &InboxWork{InboxIRI: mustParse(testMyInboxIRI)}
+		second := &InboxWork{InboxIRI: mustParse(testFederatedInboxIRI)}
+		// Run & Verify
+		assertEqual(t, q.Push(ctx, first), nil)
+		assertEqual(t, q.Push(ctx, second), nil)
+		w, err := q.Pop(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, w, first)
+		w, err = q.Pop(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, w, second)
+	})
+	t.Run("HoldsWorkUntilDue", func(t *testing.T) {
+		// Setup
+		clock := &fakeClock{now: now}
+		q := NewMemoryInboxQueue(1, clock)
+		delayed := &InboxWork{NotBefore: now.Add(time.Minute)}
+		due := &InboxWork{}
+		// Run & Verify
+		assertEqual(t, q.Push(ctx, delayed), nil)
+		assertEqual(t, q.Push(ctx, due), nil)
+		w, err := q.Pop(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, w, due)
+		clock.set(now.Add(time.Minute))
+		w, err = q.Pop(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, w, delayed)
+	})
+	t.Run("RefusesDelayedWorkWhenFull", func(t *testing.T) {
+		// Setup
+		q := NewMemoryInboxQueue(1, &fakeClock{now: now})
+		delayed := &InboxWork{NotBefore: now.Add(time.Minute)}
+		// Run & Verify
+		assertEqual(t, q.Push(ctx, delayed), nil)
+		if err := q.Push(ctx, &InboxWork{NotBefore: now.Add(time.Hour)}); err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+	t.Run("PopWaitingForDelayedWorkReturnsContextError", func(t *testing.T) {
+		// Setup
+		q := NewMemoryInboxQueue(1, &fakeClock{now: now})
+		assertEqual(t, q.Push(ctx, &InboxWork{NotBefore: now.Add(time.Minute)}), nil)
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		// Run & Verify
+		w, err := q.Pop(cctx)
+		assertEqual(t, w, (*InboxWork)(nil))
+		assertEqual(t, err, context.DeadlineExceeded)
+	})
+	t.Run("PopReturnsContextErrorWhenDone", func(t *testing.T) {
+		// Setup
+		q := NewMemoryInboxQueue(1, &fakeClock{now: now})
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		// Run & Verify
+		w, err := q.Pop(cctx)
+		assertEqual(t, w, (*InboxWork)(nil))
+		assertEqual(t, err, context.Canceled)
+	})
+}
+
+// fakeClock is a Clock whose time is set by the test.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// set sets the time returned by Now.
+func (f *fakeClock) set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+// TestAsyncInbox tests applying inbox side effects asynchronously.
+func TestAsyncInbox(t *testing.T) {
+	// Set up test case
+	setupData()
+	ctx := context.Background()
+	retryCtx := context.WithValue(ctx, inboxRetryContextKey{}, true)
+	setupFn := func(ctl *gomock.Controller) (delegate *MockDelegateActor, clock *MockClock, q InboxQueue, ai *AsyncInbox, a Actor) {
+		delegate = NewMockDelegateActor(ctl)
+		clock = NewMockClock(ctl)
+		// Retried work is due at once for the queue.
+		q = NewMemoryInboxQueue(1, &fakeClock{now: now().Add(maxAsyncInboxBackoff)})
+		ai = NewAsyncInbox(q, 1, 2)
+		a = NewCustomActor(
+			delegate,
+			/*enableSocialProtocol=*/ false,
+			/*enableFederatedProtocol=*/ true,
+			clock,
+			WithAsyncInbox(ai))
+		return
+	}
+	newWork := func() *InboxWork {
+		return &InboxWork{
+			InboxIRI: mustParse(testMyInboxIRI),
+			Activity: mustSerializeToBytes(testCreate),
+		}
+	}
+	// Run tests
+	t.Run("PostInboxRespondsWithAccepted", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, q, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		// Run the test
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusAccepted)
+		w, err := q.Pop(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, w.InboxIRI.String(), testMyInboxIRI)
+		assertEqual(t, w.Attempts, 0)
+		assertEqual(t, w.Forwarding, false)
+	})
+	t.Run("ProcessesWork", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, _, ai, _ := setupFn(ctl)
+		w := newWork()
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		// Run the test
+		ai.process(ctx, w)
+		// Verify results
+		assertEqual(t, w.Forwarding, true)
+		assertEqual(t, w.Attempts, 0)
+	})
+	t.Run("RetriesFailedWork", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, clock, q, ai, _ := setupFn(ctl)
+		w := newWork()
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(testErr)
+		clock.EXPECT().Now().Return(now())
+		// Run the test
+		ai.process(ctx, w)
+		// Verify results
+		retried, err := q.Pop(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, retried, w)
+		assertEqual(t, retried.Attempts, 1)
+		assertEqual(t, retried.NotBefore.Equal(now().Add(defaultAsyncInboxBackoff)), true)
+	})
+	t.Run("RetriesOnlyForwardingAfterSideEffects", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, clock, q, ai, _ := setupFn(ctl)
+		w := newWork()
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(testErr)
+		delegate.EXPECT().InboxForwarding(retryCtx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		clock.EXPECT().Now().Return(now())
+		// Run the test
+		ai.process(ctx, w)
+		retried, err := q.Pop(ctx)
+		assertEqual(t, err, nil)
+		ai.process(ctx, retried)
+		// Verify results
+		assertEqual(t, retried.Forwarding, true)
+		assertEqual(t, retried.Attempts, 1)
+	})
+	t.Run("MarksRetries", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, _, ai, _ := setupFn(ctl)
+		w := newWork()
+		w.Attempts = 1
+		delegate.EXPECT().PostInbox(retryCtx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().InboxForwarding(retryCtx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		// Run the test
+		ai.process(ctx, w)
+		// Verify results
+		assertEqual(t, IsInboxRetry(retryCtx), true)
+		assertEqual(t, IsInboxRetry(ctx), false)
+	})
+	t.Run("DropsRetriesWhenQueueStaysFull", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, clock, q, ai, _ := setupFn(ctl)
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		assertEqual(t, q.Push(ctx, newWork()), nil)
+		w := newWork()
+		var dropped error
+		ai.OnFailure = func(c context.Context, w *InboxWork, err error) {
+			dropped = err
+		}
+		delegate.EXPECT().PostInbox(cctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(testErr)
+		clock.EXPECT().Now().Return(now())
+		ai.Backoff = func(int) time.Duration { return 0 }
+		// Run the test
+		ai.process(cctx, w)
+		// Verify results
+		if dropped == nil {
+			t.Fatalf("expected the retry to be dropped")
+		}
+	})
+	t.Run("PushesBackWorkNotDue", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, clock, q, ai, _ := setupFn(ctl)
+		w := newWork()
+		w.NotBefore = now().Add(time.Minute)
+		clock.EXPECT().Now().Return(now())
+		// Run the test
+		d := ai.delay(ctx, w)
+		// Verify results
+		assertEqual(t, d, time.Minute)
+		delayed, err := q.Pop(ctx)
+		assertEqual(t, err, nil)
+		assertEqual(t, delayed, w)
+	})
+	t.Run("DropsMalformedWork", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, _, ai, _ := setupFn(ctl)
+		w := newWork()
+		var dropped error
+		ai.OnFailure = func(c context.Context, w *InboxWork, err error) {
+			dropped = err
+		}
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(ErrObjectRequired)
+		// Run the test
+		ai.process(ctx, w)
+		// Verify results
+		assertEqual(t, dropped, ErrObjectRequired)
+	})
+	t.Run("DropsWorkAfterMaxAttempts", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, _, ai, _ := setupFn(ctl)
+		w := newWork()
+		w.Attempts = 1
+		var dropped error
+		ai.OnFailure = func(c context.Context, w *InboxWork, err error) {
+			dropped = err
+		}
+		delegate.EXPECT().PostInbox(retryCtx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(testErr)
+		// Run the test
+		ai.process(ctx, w)
+		// Verify results
+		assertEqual(t, dropped, testErr)
+		assertEqual(t, w.Attempts, 2)
+	})
+	t.Run("BacksOffExponentially", func(t *testing.T) {
+		// Setup
+		ai := NewAsyncInbox(NewMemoryInboxQueue(1, &fakeClock{}), 1, 0)
+		// Run & Verify
+		assertEqual(t, ai.backoff(1), defaultAsyncInboxBackoff)
+		assertEqual(t, ai.backoff(3), 4*defaultAsyncInboxBackoff)
+		assertEqual(t, ai.backoff(100), maxAsyncInboxBackoff)
+		ai.Backoff = func(int) time.Duration { return time.Minute }
+		assertEqual(t, ai.backoff(1), time.Minute)
+	})
+}
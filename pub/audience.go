@@ -0,0 +1,255 @@
+package pub
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// ObjectHandlerConfig configures the HandlerFunc returned by
+// NewAuthorizedActivityStreamsHandler.
+type ObjectHandlerConfig struct {
+	// AuthenticateGet authenticates the GET request, such as by verifying
+	// its HTTP Signature, in the same manner as CommonBehavior's
+	// AuthenticateGetInbox. The returned context should carry the
+	// requester set with WithRequester. If nil, all requests are
+	// anonymous and only public values are served.
+	AuthenticateGet func(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error)
+	// Owner determines the IRI of the actor owning a followers collection
+	// addressed by a value. If nil, the collection's IRI without its last
+	// path segment is used, such as "https://example.com/addison" for
+	// "https://example.com/addison/followers".
+	Owner func(c context.Context, collectionIRI *url.URL) (*url.URL, error)
+	// Actors describes the actors on this server, whose documents are
+	// created with NewActorDocument instead of being obtained from the
+	// Database. It returns a nil config for IRIs that are not actors. If
+	// nil, actors are obtained from the Database like any other value.
+	Actors func(c context.Context, id *url.URL) (cfg *ActorConfig, err error)
+	// Scheme is the protocol scheme of the identifiers served. If empty,
+	// "https" is used.
+	Scheme string
+}
+
+// NewAuthorizedActivityStreamsHandler creates a HandlerFunc to serve
+// ActivityStreams data only to the requesters in its audience.
+//
+// A value is served if it is addressed to the Public collection, if it is
+// addressed to the requester or was authored by them, or if the requester is
+// in a followers collection owned by this server that it is addressed to. The
+// 'to', 'bto', 'cc', 'bcc', and 'audience' properties are all considered.
+// Actors, collections, and Tombstones that are not addressed at all are served
+// to everyone. Any other value that is not addressed at all is only served to
+// its authors, named by its 'attributedTo' or 'actor'.
+//
+// Returns ErrNotFound for anonymous requests of values that are not public, so
+// that their existence is not revealed, and a ForbiddenError for authenticated
+// requesters outside of the audience.
+//
+// Otherwise behaves as the HandlerFunc returned by NewActivityStreamsHandler.
+func NewAuthorizedActivityStreamsHandler(db Database, clock Clock, cfg ObjectHandlerConfig) HandlerFunc {
+	if cfg.Owner == nil {
+		cfg.Owner = ownerFromParentPath
+	}
+	if len(cfg.Scheme) == 0 {
+		cfg.Scheme = "https"
+	}
+	return newActivityStreamsHandler(db, clock, cfg.Scheme, cfg.AuthenticateGet, cfg.Actors, func(c context.Context, t vocab.Type) error {
+		return authorizeAudience(c, db, cfg.Owner, t)
+	})
+}
+
+// authorizeAudience determines whether the requester in the context is in the
+// audience of the value.
+func authorizeAudience(c context.Context,
+	db Database,
+	owner func(c context.Context, collectionIRI *url.URL) (*url.URL, error),
+	t vocab.Type) error {
+	if streams.IsOrExtendsActivityStreamsTombstone(t) {
+		return nil
+	}
+	recipients, err := audienceIds(t)
+	if err != nil {
+		return err
+	} else if len(recipients) == 0 && isUnaddressedPublic(t) {
+		return nil
+	}
+	for _, iri := range recipients {
+		if IsPublic(iri.String()) {
+			return nil
+		}
+	}
+	requester := RequesterFromContext(c)
+	if requester == nil {
+		return ErrNotFound
+	}
+	authors, err := authorIds(t)
+	if err != nil {
+		return err
+	}
+	if containsIRI(recipients, requester) || containsIRI(authors, requester) {
+		return nil
+	}
+	// Check the followers collections owned by this server.
+	for _, iri := range recipients {
+		if in, err := inOwnedFollowers(c, db, owner, iri, requester); err != nil {
+			return err
+		} else if in {
+			return nil
+		}
+	}
+	id, err := GetId(t)
+	if err != nil {
+		return err
+	}
+	return forbiddenf("%s is not in the audience of %s", requester, id)
+}
+
+// isUnaddressedPublic determines whether the value is one that is public
+// without being addressed: an actor or a collection. Any other value without
+// an audience is only served to its authors.
+func isUnaddressedPublic(t vocab.Type) bool {
+	if _, ok := t.(inboxer); ok {
+		return true
+	}
+	return streams.IsOrExtendsActivityStreamsCollection(t)
+}
+
+// inOwnedFollowers determines whether the requester is in the collection, if
+// it is the followers collection of an actor on this server.
+func inOwnedFollowers(c context.Context,
+	db Database,
+	owner func(c context.Context, collectionIRI *url.URL) (*url.URL, error),
+	collectionIRI, requester *url.URL) (bool, error) {
+	err := db.Lock(c, collectionIRI)
+	if err != nil {
+		return false, err
+	}
+	// WARNING: Unlock is not deferred
+	if owns, err := db.Owns(c, collectionIRI); err != nil {
+		db.Unlock(c, collectionIRI)
+		return false, err
+	} else if !owns {
+		db.Unlock(c, collectionIRI)
+		return false, nil
+	}
+	db.Unlock(c, collectionIRI)
+	// Unlock by this point and in every branch above.
+	actorIRI, err := owner(c, collectionIRI)
+	if err != nil {
+		return false, err
+	}
+	err = db.Lock(c, actorIRI)
+	if err != nil {
+		return false, err
+	}
+	// WARNING: Unlock is not deferred
+	followers, err := db.Followers(c, actorIRI)
+	if err != nil {
+		db.Unlock(c, actorIRI)
+		return false, err
+	}
+	db.Unlock(c, actorIRI)
+	// Unlock by this point and in every branch above.
+	if followers == nil {
+		return false, nil
+	}
+	id, err := GetId(followers)
+	if err != nil {
+		return false, err
+	} else if id.String() != collectionIRI.String() {
+		return false, nil
+	}
+	ids, _, err := collectionItemIds(followers)
+	if err != nil {
+		return false, err
+	}
+	return containsIRI(ids, requester), nil
+}
+
+// audienceIds returns the ids in the 'to', 'bto', 'cc', 'bcc', and 'audience'
+// properties of the value.
+func audienceIds(t vocab.Type) (ids []*url.URL, err error) {
+	var props []IdProperty
+	if v, ok := t.(toer); ok {
+		if to := v.GetActivityStreamsTo(); to != nil {
+			for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
+				props = append(props, iter)
+			}
+		}
+	}
+	if v, ok := t.(btoer); ok {
+		if bto := v.GetActivityStreamsBto(); bto != nil {
+			for iter := bto.Begin(); iter != bto.End(); iter = iter.Next() {
+				props = append(props, iter)
+			}
+		}
+	}
+	if v, ok := t.(ccer); ok {
+		if cc := v.GetActivityStreamsCc(); cc != nil {
+			for iter := cc.Begin(); iter != cc.End(); iter = iter.Next() {
+				props = append(props, iter)
+			}
+		}
+	}
+	if v, ok := t.(bccer); ok {
+		if bcc := v.GetActivityStreamsBcc(); bcc != nil {
+			for iter := bcc.Begin(); iter != bcc.End(); iter = iter.Next() {
+				props = append(props, iter)
+			}
+		}
+	}
+	if v, ok := t.(audiencer); ok {
+		if audience := v.GetActivityStreamsAudience(); audience != nil {
+			for iter := audience.Begin(); iter != audience.End(); iter = iter.Next() {
+				props = append(props, iter)
+			}
+		}
+	}
+	return propertyIds(props)
+}
+
+// authorIds returns the ids in the 'attributedTo' and 'actor' properties of the
+// value.
+func authorIds(t vocab.Type) (ids []*url.URL, err error) {
+	var props []IdProperty
+	if v, ok := t.(attributedToer); ok {
+		if attr := v.GetActivityStreamsAttributedTo(); attr != nil {
+			for iter := attr.Begin(); iter != attr.End(); iter = iter.Next() {
+				props = append(props, iter)
+			}
+		}
+	}
+	if v, ok := t.(actorer); ok {
+		if actor := v.GetActivityStreamsActor(); actor != nil {
+			for iter := actor.Begin(); iter != actor.End(); iter = iter.Next() {
+				props = append(props, iter)
+			}
+		}
+	}
+	return propertyIds(props)
+}
+
+// propertyIds returns the ids of the property values.
+func propertyIds(props []IdProperty) (ids []*url.URL, err error) {
+	for _, p := range props {
+		var id *url.URL
+		if id, err = ToId(p); err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	return
+}
+
+// containsIRI determines whether the IRI is one of the entries.
+func containsIRI(entries []*url.URL, iri *url.URL) bool {
+	for _, e := range entries {
+		if e.String() == iri.String() {
+			return true
+		}
+	}
+	return false
+}
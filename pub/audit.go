@@ -0,0 +1,320 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// AuditOperation is the kind of change made to the Database.
+type AuditOperation string
+
+const (
+	// AuditCreate is a call to Database.Create.
+	AuditCreate AuditOperation = "create"
+	// AuditUpdate is a call to Database.Update.
+	AuditUpdate AuditOperation = "update"
+	// AuditDelete is a call to Database.Delete.
+	AuditDelete AuditOperation = "delete"
+)
+
+// AuditEvent records a change the side effects of an activity made to the
+// Database.
+type AuditEvent struct {
+	// Time is when the change was made, according to the Actor's Clock.
+	Time time.Time
+	// Operation is the kind of change.
+	Operation AuditOperation
+	// Object is the id of the value created, updated, or deleted.
+	Object *url.URL
+	// ObjectType is the type of the value created or updated. It is empty
+	// for deletions.
+	ObjectType string
+	// Box is the box the activity was posted to.
+	Box Box
+	// BoxIRI is the IRI of the inbox or outbox the activity was posted to.
+	BoxIRI *url.URL
+	// Activity is the id of the activity whose side effects made the
+	// change.
+	Activity *url.URL
+	// ActivityType is the type of the activity.
+	ActivityType string
+	// Requester is the actor that made the request, as set with
+	// WithRequester when authenticating it. It is nil if the application
+	// does not set it.
+	Requester *url.URL
+	// Added and Removed are the ids of the items added to and removed
+	// from a collection updated, such as the followers updated by an
+	// Accept or the likes updated by a Like. They are nil for other
+	// changes, and when the previous value of the collection could not be
+	// read.
+	Added   []*url.URL
+	Removed []*url.URL
+}
+
+// MarshalJSON encodes the event as a JSON object with the IRIs as strings and
+// the empty fields omitted.
+func (e AuditEvent) MarshalJSON() ([]byte, error) {
+	str := func(u *url.URL) string {
+		if u == nil {
+			return ""
+		}
+		return u.String()
+	}
+	strs := func(us []*url.URL) []string {
+		var s []string
+		for _, u := range us {
+			s = append(s, u.String())
+		}
+		return s
+	}
+	return json.Marshal(struct {
+		Time         time.Time      `json:"time"`
+		Operation    AuditOperation `json:"operation"`
+		Object       string         `json:"object,omitempty"`
+		ObjectType   string         `json:"objectType,omitempty"`
+		Box          Box            `json:"box"`
+		BoxIRI       string         `json:"boxIRI,omitempty"`
+		Activity     string         `json:"activity,omitempty"`
+		ActivityType string         `json:"activityType,omitempty"`
+		Requester    string         `json:"requester,omitempty"`
+		Added        []string       `json:"added,omitempty"`
+		Removed      []string       `json:"removed,omitempty"`
+	}{
+		Time:         e.Time,
+		Operation:    e.Operation,
+		Object:       str(e.Object),
+		ObjectType:   e.ObjectType,
+		Box:          e.Box,
+		BoxIRI:       str(e.BoxIRI),
+		Activity:     str(e.Activity),
+		ActivityType: e.ActivityType,
+		Requester:    str(e.Requester),
+		Added:        strs(e.Added),
+		Removed:      strs(e.Removed),
+	})
+}
+
+// AuditSink receives the AuditEvents of an Actor.
+//
+// Audit is called synchronously after each successful change, and concurrently
+// for concurrent requests. Returning an error fails the side effects, so that
+// no change goes unrecorded. With a TxDatabase, the events of a transaction
+// are buffered and only sent once it is committed, so that changes rolled back
+// are never audited; an error returned then fails the request, but the changes
+// stay committed.
+type AuditSink interface {
+	Audit(c context.Context, e AuditEvent) error
+}
+
+// WithAuditSink sends an AuditEvent to the sink for each change made to the
+// Database by the side effects of the activities posted to the inbox and
+// outbox, including those of the wrapped callbacks. It has no effect on an
+// Actor created with NewCustomActor.
+//
+// To record which remote actor caused a change, applications set the
+// requester with WithRequester when authenticating POST requests.
+func WithAuditSink(s AuditSink) ActorOption {
+	return func(b *baseActor) {
+		if a, ok := b.delegate.(*sideEffectActor); ok {
+			a.audit = s
+		}
+	}
+}
+
+// JSONLinesAuditSink is an AuditSink writing each AuditEvent as a line of
+// JSON.
+type JSONLinesAuditSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// JSONLinesAuditSink is an AuditSink.
+var _ AuditSink = &JSONLinesAuditSink{}
+
+// NewJSONLinesAuditSink returns a JSONLinesAuditSink writing to w.
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: w}
+}
+
+// OpenJSONLinesAuditFile returns a JSONLinesAuditSink appending to the file at
+// the path, which is created if it does not exist. Close closes the file.
+func OpenJSONLinesAuditFile(path string) (*JSONLinesAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditSink{w: f, closer: f}, nil
+}
+
+// Audit writes the event as a line of JSON.
+func (s *JSONLinesAuditSink) Audit(c context.Context, e AuditEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(b)
+	return err
+}
+
+// Close closes the file opened by OpenJSONLinesAuditFile. It does nothing if
+// the sink was created with NewJSONLinesAuditSink.
+func (s *JSONLinesAuditSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// auditDatabase returns the Database the side effects of the activity posted
+// to the box are run with, which audits its changes if there is an AuditSink.
+func (a *sideEffectActor) auditDatabase(box Box, boxIRI *url.URL, activity Activity) Database {
+	if a.audit == nil {
+		return a.db
+	}
+	return &auditingDatabase{
+		Database: a.db,
+		actor:    a,
+		sink:     a.audit,
+		clock:    a.clock,
+		box:      box,
+		boxIRI:   boxIRI,
+		activity: activity,
+	}
+}
+
+// auditingDatabase is a Database sending an AuditEvent to an AuditSink for each
+// change made with it.
+type auditingDatabase struct {
+	Database
+	// actor is the side-effect actor of the transaction, if any, the
+	// events are sent after.
+	actor    *sideEffectActor
+	sink     AuditSink
+	clock    Clock
+	box      Box
+	boxIRI   *url.URL
+	activity Activity
+}
+
+// Create creates the value and audits it.
+func (d *auditingDatabase) Create(c context.Context, asType vocab.Type) error {
+	if err := d.Database.Create(c, asType); err != nil {
+		return err
+	}
+	return d.auditType(c, AuditCreate, asType)
+}
+
+// Update updates the value and audits it, with the items added and removed if
+// it is a collection.
+func (d *auditingDatabase) Update(c context.Context, asType vocab.Type) error {
+	var before vocab.Type
+	if _, ok := itemIds(asType); ok {
+		if id, err := GetId(asType); err == nil {
+			before, _ = d.Database.Get(c, id)
+		}
+	}
+	if err := d.Database.Update(c, asType); err != nil {
+		return err
+	}
+	id, _ := GetId(asType)
+	e := d.event(c, AuditUpdate, id, asType.GetTypeName())
+	if before != nil {
+		old, _ := itemIds(before)
+		now, _ := itemIds(asType)
+		e.Added = missingIds(now, old)
+		e.Removed = missingIds(old, now)
+	}
+	return d.send(c, e)
+}
+
+// Delete deletes the value and audits it.
+func (d *auditingDatabase) Delete(c context.Context, id *url.URL) error {
+	if err := d.Database.Delete(c, id); err != nil {
+		return err
+	}
+	return d.send(c, d.event(c, AuditDelete, id, ""))
+}
+
+// auditType sends the event of a change to the value to the sink. The Database
+// has accepted the value, so it is audited even if it has no id.
+func (d *auditingDatabase) auditType(c context.Context, op AuditOperation, asType vocab.Type) error {
+	id, _ := GetId(asType)
+	return d.send(c, d.event(c, op, id, asType.GetTypeName()))
+}
+
+// event returns the event of a change.
+func (d *auditingDatabase) event(c context.Context, op AuditOperation, id *url.URL, typeName string) AuditEvent {
+	e := AuditEvent{
+		Time:         d.clock.Now(),
+		Operation:    op,
+		Object:       id,
+		ObjectType:   typeName,
+		Box:          d.box,
+		BoxIRI:       d.boxIRI,
+		ActivityType: d.activity.GetTypeName(),
+		Requester:    RequesterFromContext(c),
+	}
+	if idProp := d.activity.GetJSONLDId(); idProp != nil {
+		e.Activity = idProp.Get()
+	}
+	return e
+}
+
+// send sends the event to the sink, once the transaction it was made in, if
+// any, is committed.
+func (d *auditingDatabase) send(c context.Context, e AuditEvent) error {
+	return d.actor.afterCommit(func(*sideEffectActor) error {
+		return d.sink.Audit(c, e)
+	})
+}
+
+// itemIds returns the ids of the items of the value, and whether it has items
+// or ordered items. Items without an id are left out.
+func itemIds(t vocab.Type) (ids []*url.URL, ok bool) {
+	if oi, ok := t.(orderedItemser); ok {
+		if p := oi.GetActivityStreamsOrderedItems(); p != nil {
+			for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+				if id, err := ToId(iter); err == nil {
+					ids = append(ids, id)
+				}
+			}
+		}
+		return ids, true
+	} else if i, ok := t.(itemser); ok {
+		if p := i.GetActivityStreamsItems(); p != nil {
+			for iter := p.Begin(); iter != p.End(); iter = iter.Next() {
+				if id, err := ToId(iter); err == nil {
+					ids = append(ids, id)
+				}
+			}
+		}
+		return ids, true
+	}
+	return nil, false
+}
+
+// missingIds returns the ids that are not in the others, in order.
+func missingIds(ids, others []*url.URL) []*url.URL {
+	seen := make(map[string]bool, len(others))
+	for _, id := range others {
+		seen[id.String()] = true
+	}
+	var missing []*url.URL
+	for _, id := range ids {
+		if !seen[id.String()] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
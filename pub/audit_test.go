@@ -0,0 +1,238 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+// fakeAuditSink records the AuditEvents it receives, and fails with its err.
+type fakeAuditSink struct {
+	events []AuditEvent
+	err    error
+}
+
+func (s *fakeAuditSink) Audit(c context.Context, e AuditEvent) error {
+	s.events = append(s.events, e)
+	return s.err
+}
+
+// TestAuditSink tests that the changes made by side effects are audited.
+func TestAuditSink(t *testing.T) {
+	ctx := WithRequester(context.Background(), mustParse(testFederatedActorIRI))
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	setupFn := func(ctl *gomock.Controller, sink AuditSink) (fp *MockFederatingProtocol, db *MockDatabase, a *sideEffectActor) {
+		setupData()
+		fp = NewMockFederatingProtocol(ctl)
+		db = NewMockDatabase(ctl)
+		clock := NewMockClock(ctl)
+		clock.EXPECT().Now().Return(now).AnyTimes()
+		a = &sideEffectActor{s2s: fp, db: db, clock: clock, audit: sink}
+		inboxIRI := mustParse(testMyInboxIRI)
+		db.EXPECT().Lock(ctx, inboxIRI)
+		db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		db.EXPECT().AppendInbox(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(nil)
+		db.EXPECT().Unlock(ctx, inboxIRI)
+		fp.EXPECT().FederatingCallbacks(ctx).Return(FederatingWrappedCallbacks{
+			Create: func(c context.Context, a vocab.ActivityStreamsCreate) error {
+				return nil
+			},
+		}, nil, nil)
+		db.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		db.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		return
+	}
+	t.Run("AuditsInboxChanges", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		sink := &fakeAuditSink{}
+		_, db, a := setupFn(ctl, sink)
+		db.EXPECT().Create(ctx, testFederatedNote).Return(nil)
+		// Run
+		err := a.PostInbox(ctx, mustParse(testMyInboxIRI), testCreate)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(sink.events), 1)
+		assertEqual(t, fmt.Sprint(sink.events[0]), fmt.Sprint(AuditEvent{
+			Time:         now,
+			Operation:    AuditCreate,
+			Object:       mustParse(testNoteId1),
+			ObjectType:   "Note",
+			Box:          BoxInbox,
+			BoxIRI:       mustParse(testMyInboxIRI),
+			Activity:     mustParse(testFederatedActivityIRI),
+			ActivityType: "Create",
+			Requester:    mustParse(testFederatedActorIRI),
+		}))
+	})
+	t.Run("DoesNotAuditFailedChanges", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		sink := &fakeAuditSink{}
+		_, db, a := setupFn(ctl, sink)
+		testErr := errors.New("test")
+		db.EXPECT().Create(ctx, testFederatedNote).Return(testErr)
+		// Run
+		err := a.PostInbox(ctx, mustParse(testMyInboxIRI), testCreate)
+		// Verify
+		assertEqual(t, err, testErr)
+		assertEqual(t, len(sink.events), 0)
+	})
+	t.Run("FailsWhenSinkFails", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		sink := &fakeAuditSink{err: errors.New("test")}
+		_, db, a := setupFn(ctl, sink)
+		db.EXPECT().Create(ctx, testFederatedNote).Return(nil)
+		// Run
+		err := a.PostInbox(ctx, mustParse(testMyInboxIRI), testCreate)
+		// Verify
+		assertEqual(t, err, sink.err)
+	})
+	t.Run("AuditsItemsOfUpdatedCollections", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		setupData()
+		db := NewMockDatabase(ctl)
+		clock := NewMockClock(ctl)
+		clock.EXPECT().Now().Return(now)
+		sink := &fakeAuditSink{}
+		a := &sideEffectActor{db: db, clock: clock, audit: sink}
+		followersIRI := mustParse(testMyInboxIRI + "/followers")
+		collection := func(items ...string) vocab.ActivityStreamsOrderedCollection {
+			col := streams.NewActivityStreamsOrderedCollection()
+			id := streams.NewJSONLDIdProperty()
+			id.Set(followersIRI)
+			col.SetJSONLDId(id)
+			oi := streams.NewActivityStreamsOrderedItemsProperty()
+			for _, item := range items {
+				oi.AppendIRI(mustParse(item))
+			}
+			col.SetActivityStreamsOrderedItems(oi)
+			return col
+		}
+		before := collection(testFederatedActorIRI, testFederatedActorIRI2)
+		after := collection(testFederatedActorIRI2, testFederatedActorIRI3)
+		db.EXPECT().Get(ctx, followersIRI).Return(before, nil)
+		db.EXPECT().Update(ctx, after).Return(nil)
+		// Run
+		err := a.auditDatabase(BoxInbox, mustParse(testMyInboxIRI), testCreate).Update(ctx, after)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, len(sink.events), 1)
+		assertEqual(t, sink.events[0].Operation, AuditUpdate)
+		assertEqual(t, fmt.Sprint(sink.events[0].Added), fmt.Sprint([]*url.URL{mustParse(testFederatedActorIRI3)}))
+		assertEqual(t, fmt.Sprint(sink.events[0].Removed), fmt.Sprint([]*url.URL{mustParse(testFederatedActorIRI)}))
+	})
+}
+
+// TestAuditSinkTransactions tests that the changes made in a transaction are
+// audited once it is committed, and never if it is rolled back.
+func TestAuditSinkTransactions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	setupFn := func(ctl *gomock.Controller, callbackErr error) (db *fakeTxDatabase, sink *committedAuditSink, a *sideEffectActor) {
+		setupData()
+		fp := NewMockFederatingProtocol(ctl)
+		tx := NewMockDatabase(ctl)
+		db = &fakeTxDatabase{
+			MockDatabase: NewMockDatabase(ctl),
+			tx:           &fakeTx{MockDatabase: tx},
+		}
+		clock := NewMockClock(ctl)
+		clock.EXPECT().Now().Return(now).AnyTimes()
+		sink = &committedAuditSink{tx: db.tx}
+		a = &sideEffectActor{s2s: fp, db: db, clock: clock, audit: sink}
+		inboxIRI := mustParse(testMyInboxIRI)
+		tx.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		tx.EXPECT().AppendInbox(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(nil)
+		fp.EXPECT().FederatingCallbacks(ctx).Return(FederatingWrappedCallbacks{
+			Create: func(c context.Context, a vocab.ActivityStreamsCreate) error {
+				return callbackErr
+			},
+		}, nil, nil)
+		tx.EXPECT().Create(ctx, testFederatedNote).Return(nil)
+		return
+	}
+	t.Run("AuditsAfterCommit", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, sink, a := setupFn(ctl, nil)
+		// Run
+		err := a.PostInbox(ctx, mustParse(testMyInboxIRI), testCreate)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, db.tx.committed, true)
+		assertEqual(t, len(sink.events), 1)
+		assertEqual(t, sink.afterCommit, true)
+	})
+	t.Run("DoesNotAuditRolledBackChanges", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		testErr := errors.New("test")
+		db, sink, a := setupFn(ctl, testErr)
+		// Run
+		err := a.PostInbox(ctx, mustParse(testMyInboxIRI), testCreate)
+		// Verify
+		assertEqual(t, err, testErr)
+		assertEqual(t, db.tx.rolledBack, true)
+		assertEqual(t, len(sink.events), 0)
+	})
+}
+
+// committedAuditSink is a fakeAuditSink recording whether the transaction was
+// committed when it received its events.
+type committedAuditSink struct {
+	fakeAuditSink
+	tx          *fakeTx
+	afterCommit bool
+}
+
+func (s *committedAuditSink) Audit(c context.Context, e AuditEvent) error {
+	s.afterCommit = s.tx.committed
+	return s.fakeAuditSink.Audit(c, e)
+}
+
+// TestJSONLinesAuditSink tests the lines written by the JSONLinesAuditSink.
+func TestJSONLinesAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewJSONLinesAuditSink(&buf)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := s.Audit(context.Background(), AuditEvent{
+		Time:         now,
+		Operation:    AuditDelete,
+		Object:       mustParse(testNoteId1),
+		Box:          BoxInbox,
+		BoxIRI:       mustParse(testMyInboxIRI),
+		Activity:     mustParse(testFederatedActivityIRI),
+		ActivityType: "Delete",
+	})
+	assertEqual(t, err, nil)
+	err = s.Audit(context.Background(), AuditEvent{
+		Time:       now,
+		Operation:  AuditUpdate,
+		Object:     mustParse(testNoteId1),
+		ObjectType: "Note",
+		Box:        BoxOutbox,
+		Requester:  mustParse(testFederatedActorIRI),
+	})
+	assertEqual(t, err, nil)
+	assertEqual(t, buf.String(),
+		`{"time":"2020-01-02T03:04:05Z","operation":"delete","object":"`+testNoteId1+`","box":"inbox","boxIRI":"`+testMyInboxIRI+`","activity":"`+testFederatedActivityIRI+`","activityType":"Delete"}`+"\n"+
+			`{"time":"2020-01-02T03:04:05Z","operation":"update","object":"`+testNoteId1+`","objectType":"Note","box":"outbox","requester":"`+testFederatedActorIRI+`"}`+"\n")
+	assertEqual(t, s.Close(), nil)
+}
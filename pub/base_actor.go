@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 // baseActor must satisfy the Actor interface.
@@ -35,6 +36,17 @@ type baseActor struct {
 	enableFederatedProtocol bool
 	// clock simply tracks the current time.
 	clock Clock
+	// asyncInbox, if set, applies the side effects of inbox deliveries
+	// after the peer has been responded to.
+	asyncInbox *AsyncInbox
+	// instanceActor, if set, is the actor representing the server itself.
+	instanceActor *InstanceActor
+	// idempotency, if set, remembers the activities created by outbox
+	// POST requests with an Idempotency-Key for idempotencyTTL.
+	idempotency    IdempotencyStore
+	idempotencyTTL time.Duration
+	// observer, if set, is notified of the requests handled.
+	observer Observer
 }
 
 // baseActorFederating must satisfy the FederatingActor interface.
@@ -64,17 +76,21 @@ type baseActorFederating struct {
 func NewSocialActor(c CommonBehavior,
 	c2s SocialProtocol,
 	db Database,
-	clock Clock) Actor {
-	return &baseActor{
+	clock Clock,
+	opts ...ActorOption) Actor {
+	b := &baseActor{
 		delegate: &sideEffectActor{
-			common: c,
-			c2s:    c2s,
-			db:     db,
-			clock:  clock,
+			common:   c,
+			c2s:      c2s,
+			db:       db,
+			clock:    clock,
+			pageSize: defaultCollectionPageSize,
 		},
 		enableSocialProtocol: true,
 		clock:                clock,
 	}
+	b.applyOptions(opts)
+	return b
 }
 
 // NewFederatingActor builds a new Actor concept that handles only the Federating
@@ -92,19 +108,24 @@ func NewSocialActor(c CommonBehavior,
 func NewFederatingActor(c CommonBehavior,
 	s2s FederatingProtocol,
 	db Database,
-	clock Clock) FederatingActor {
-	return &baseActorFederating{
+	clock Clock,
+	opts ...ActorOption) FederatingActor {
+	b := &baseActorFederating{
 		baseActor{
 			delegate: &sideEffectActor{
-				common: c,
-				s2s:    s2s,
-				db:     db,
-				clock:  clock,
+				common:   c,
+				s2s:      s2s,
+				db:       db,
+				clock:    clock,
+				pageSize: defaultCollectionPageSize,
+				fanOuts:  make(chan struct{}, maxRelayFanOuts),
 			},
 			enableFederatedProtocol: true,
 			clock:                   clock,
 		},
 	}
+	b.applyOptions(opts)
+	return b
 }
 
 // NewActor builds a new Actor concept that handles both the Social and
@@ -120,21 +141,26 @@ func NewActor(c CommonBehavior,
 	c2s SocialProtocol,
 	s2s FederatingProtocol,
 	db Database,
-	clock Clock) FederatingActor {
-	return &baseActorFederating{
+	clock Clock,
+	opts ...ActorOption) FederatingActor {
+	b := &baseActorFederating{
 		baseActor{
 			delegate: &sideEffectActor{
-				common: c,
-				c2s:    c2s,
-				s2s:    s2s,
-				db:     db,
-				clock:  clock,
+				common:   c,
+				c2s:      c2s,
+				s2s:      s2s,
+				db:       db,
+				clock:    clock,
+				pageSize: defaultCollectionPageSize,
+				fanOuts:  make(chan struct{}, maxRelayFanOuts),
 			},
 			enableSocialProtocol:    true,
 			enableFederatedProtocol: true,
 			clock:                   clock,
 		},
 	}
+	b.applyOptions(opts)
+	return b
 }
 
 // NewCustomActor allows clients to create a custom ActivityPub implementation
@@ -148,8 +174,9 @@ func NewActor(c CommonBehavior,
 // Use with due care.
 func NewCustomActor(delegate DelegateActor,
 	enableSocialProtocol, enableFederatedProtocol bool,
-	clock Clock) FederatingActor {
-	return &baseActorFederating{
+	clock Clock,
+	opts ...ActorOption) FederatingActor {
+	b := &baseActorFederating{
 		baseActor{
 			delegate:                delegate,
 			enableSocialProtocol:    enableSocialProtocol,
@@ -157,6 +184,8 @@ func NewCustomActor(delegate DelegateActor,
 			clock:                   clock,
 		},
 	}
+	b.applyOptions(opts)
+	return b
 }
 
 // PostInbox implements the generic algorithm for handling a POST request to an
@@ -174,11 +203,13 @@ func (b *baseActor) PostInbox(c context.Context, w http.ResponseWriter, r *http.
 //
 // Specifying the "scheme" allows for retrieving ActivityStreams content with
 // identifiers such as HTTP, HTTPS, or other protocol schemes.
-func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (bool, error) {
+func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (handled bool, err error) {
 	// Do nothing if it is not an ActivityPub POST request.
 	if !isActivityPubPost(r) {
 		return false, nil
 	}
+	c, done := b.observeRequest(c, BoxInbox, r)
+	defer func() { done(c, err) }()
 	// If the Federated Protocol is not enabled, then this endpoint is not
 	// enabled.
 	if !b.enableFederatedProtocol {
@@ -187,6 +218,7 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 	}
 	// Check the peer request is authentic.
 	c, authenticated, err := b.delegate.AuthenticatePostInbox(c, w, r)
+	b.observeAuthentication(c, BoxInbox, r, authenticated)
 	if err != nil {
 		return true, err
 	} else if !authenticated {
@@ -201,7 +233,9 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 	}
 	var m map[string]interface{}
 	if err = json.Unmarshal(raw, &m); err != nil {
-		return true, err
+		// Respond with bad request -- the body is not JSON.
+		writeClientError(w, &MalformedError{Err: err})
+		return true, nil
 	}
 	asValue, err := streams.ToType(c, m)
 	if err != nil && !streams.IsUnmatchedErr(err) {
@@ -213,7 +247,9 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 	}
 	activity, ok := asValue.(Activity)
 	if !ok {
-		return true, fmt.Errorf("activity streams value is not an Activity: %T", asValue)
+		// Respond with bad request -- only activities are delivered.
+		writeClientError(w, malformedf("activity streams value is not an Activity: %T", asValue))
+		return true, nil
 	}
 	if activity.GetJSONLDId() == nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -221,12 +257,16 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 	}
 	// Allow server implementations to set context data with a hook.
 	c, err = b.delegate.PostInboxRequestBodyHook(c, r, activity)
-	if err != nil {
+	if writeClientError(w, err) {
+		return true, nil
+	} else if err != nil {
 		return true, err
 	}
 	// Check authorization of the activity.
 	authorized, err := b.delegate.AuthorizePostInbox(c, w, activity)
-	if err != nil {
+	if writeClientError(w, err) {
+		return true, nil
+	} else if err != nil {
 		return true, err
 	} else if !authorized {
 		return true, nil
@@ -235,14 +275,23 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 	// that particular Activity type. It is up to the delegate to resolve
 	// the given map.
 	inboxId := requestId(r, scheme)
+	// If the side effects are applied asynchronously, persist the activity
+	// in the queue and let the peer know it has been accepted.
+	if b.asyncInbox != nil {
+		if err = b.asyncInbox.enqueue(c, inboxId, raw); err != nil {
+			return true, err
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return true, nil
+	}
 	err = b.delegate.PostInbox(c, inboxId, activity)
 	if err != nil {
-		// Special case: We know it is a bad request if the object or
-		// target properties needed to be populated, but weren't.
+		// We know it is the peer's fault if the error is a client error,
+		// such as the object or target properties needing to be
+		// populated but weren't.
 		//
 		// Send the rejection to the peer.
-		if err == ErrObjectRequired || err == ErrTargetRequired {
-			w.WriteHeader(http.StatusBadRequest)
+		if writeClientError(w, err) {
 			return true, nil
 		}
 		return true, err
@@ -262,31 +311,50 @@ func (b *baseActor) PostInboxScheme(c context.Context, w http.ResponseWriter, r
 // GetInbox implements the generic algorithm for handling a GET request to an
 // actor's inbox independent on an application. It relies on a delegate to
 // implement application specific functionality.
+//
+// Only supports serving data with identifiers having the HTTPS scheme.
 func (b *baseActor) GetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+	return b.GetInboxScheme(c, w, r, "https")
+}
+
+// GetInboxScheme implements the generic algorithm for handling a GET request
+// to an actor's inbox independent on an application. It relies on a delegate
+// to implement application specific functionality.
+//
+// Specifying the "scheme" allows for retrieving ActivityStreams content with
+// identifiers such as HTTP, HTTPS, or other protocol schemes.
+func (b *baseActor) GetInboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (handled bool, err error) {
 	// Do nothing if it is not an ActivityPub GET request.
 	if !isActivityPubGet(r) {
 		return false, nil
 	}
+	c, done := b.observeRequest(c, BoxInbox, r)
+	defer func() { done(c, err) }()
 	// Delegate authenticating and authorizing the request.
 	c, authenticated, err := b.delegate.AuthenticateGetInbox(c, w, r)
+	b.observeAuthentication(c, BoxInbox, r, authenticated)
 	if err != nil {
 		return true, err
 	} else if !authenticated {
 		return true, nil
 	}
 	// Everything is good to begin processing the request.
-	oc, err := b.delegate.GetInbox(c, r)
+	inboxId := collectionId(requestId(r, scheme))
+	oc, err := b.delegate.GetInbox(c, inboxId, r)
 	if err != nil {
 		return true, err
 	}
-	// Deduplicate the 'orderedItems' property by ID.
-	err = dedupeOrderedItems(oc)
-	if err != nil {
-		return true, err
+	// Deduplicate the 'orderedItems' property by ID, if a page was
+	// requested.
+	if oi, ok := oc.(orderedItemser); ok {
+		err = dedupeOrderedItems(oi)
+		if err != nil {
+			return true, err
+		}
 	}
 	// Request has been processed. Begin responding to the request.
 	//
-	// Serialize the OrderedCollection.
+	// Serialize the OrderedCollection or OrderedCollectionPage.
 	m, err := streams.Serialize(oc)
 	if err != nil {
 		return true, err
@@ -322,11 +390,13 @@ func (b *baseActor) PostOutbox(c context.Context, w http.ResponseWriter, r *http
 //
 // Specifying the "scheme" allows for retrieving ActivityStreams content with
 // identifiers such as HTTP, HTTPS, or other protocol schemes.
-func (b *baseActor) PostOutboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (bool, error) {
+func (b *baseActor) PostOutboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (handled bool, err error) {
 	// Do nothing if it is not an ActivityPub POST request.
 	if !isActivityPubPost(r) {
 		return false, nil
 	}
+	c, done := b.observeRequest(c, BoxOutbox, r)
+	defer func() { done(c, err) }()
 	// If the Social API is not enabled, then this endpoint is not enabled.
 	if !b.enableSocialProtocol {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -334,11 +404,37 @@ func (b *baseActor) PostOutboxScheme(c context.Context, w http.ResponseWriter, r
 	}
 	// Delegate authenticating and authorizing the request.
 	c, authenticated, err := b.delegate.AuthenticatePostOutbox(c, w, r)
+	b.observeAuthentication(c, BoxOutbox, r, authenticated)
 	if err != nil {
 		return true, err
 	} else if !authenticated {
 		return true, nil
 	}
+	// Respond to a retried request as the original one was, reserving the
+	// key of a new request before it has any side effect.
+	var idempotencyKey string
+	if h := r.Header.Get(idempotencyKeyHeader); b.idempotency != nil && len(h) > 0 {
+		key := idempotencyStoreKey(requestId(r, scheme), h)
+		location, reserved, err := b.idempotency.Reserve(c, key, b.idempotencyTTL)
+		if err != nil {
+			return true, err
+		} else if location != nil {
+			w.Header().Set(locationHeader, location.String())
+			w.WriteHeader(http.StatusCreated)
+			return true, nil
+		} else if !reserved {
+			// The original request is still being processed.
+			w.WriteHeader(http.StatusConflict)
+			return true, nil
+		}
+		idempotencyKey = key
+		// Release the key unless an activity is posted for it.
+		defer func() {
+			if len(idempotencyKey) > 0 {
+				b.idempotency.Release(c, idempotencyKey)
+			}
+		}()
+	}
 	// Everything is good to begin processing the request.
 	raw, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -346,7 +442,9 @@ func (b *baseActor) PostOutboxScheme(c context.Context, w http.ResponseWriter, r
 	}
 	var m map[string]interface{}
 	if err = json.Unmarshal(raw, &m); err != nil {
-		return true, err
+		// Respond with bad request -- the body is not JSON.
+		writeClientError(w, &MalformedError{Err: err})
+		return true, nil
 	}
 	// Note that converting to a Type will NOT successfully convert types
 	// not known to go-fed. This prevents accidentally wrapping an Activity
@@ -362,25 +460,42 @@ func (b *baseActor) PostOutboxScheme(c context.Context, w http.ResponseWriter, r
 	}
 	// Allow server implementations to set context data with a hook.
 	c, err = b.delegate.PostOutboxRequestBodyHook(c, r, asValue)
-	if err != nil {
+	if writeClientError(w, err) {
+		return true, nil
+	} else if err != nil {
 		return true, err
 	}
 	// The HTTP request steps are complete, complete the rest of the outbox
 	// and delivery process.
 	outboxId := requestId(r, scheme)
-	activity, err := b.deliver(c, outboxId, asValue, m)
-	// Special case: We know it is a bad request if the object or
-	// target properties needed to be populated, but weren't.
+	activity, deliverable, err := b.post(c, outboxId, asValue, m)
+	// We know it is the client's fault if the error is a client error,
+	// such as the object or target properties needing to be populated but
+	// weren't.
 	//
 	// Send the rejection to the client.
-	if err == ErrObjectRequired || err == ErrTargetRequired {
-		w.WriteHeader(http.StatusBadRequest)
+	if writeClientError(w, err) {
+		return true, nil
+	} else if err != nil {
+		return true, err
+	}
+	// Remember the new Activity for retries of the request, even if
+	// delivering it fails below. The activity is posted, so it is still
+	// delivered if remembering it fails: the key is then released rather
+	// than left reserved, which would refuse every retry.
+	location := activity.GetJSONLDId().Get()
+	if len(idempotencyKey) > 0 {
+		if b.idempotency.Put(c, idempotencyKey, location, b.idempotencyTTL) == nil {
+			idempotencyKey = ""
+		}
+	}
+	if err = b.deliverPosted(c, outboxId, activity, deliverable); writeClientError(w, err) {
 		return true, nil
 	} else if err != nil {
 		return true, err
 	}
 	// Respond to the request with the new Activity's IRI location.
-	w.Header().Set(locationHeader, activity.GetJSONLDId().Get().String())
+	w.Header().Set(locationHeader, location.String())
 	w.WriteHeader(http.StatusCreated)
 	return true, nil
 }
@@ -388,26 +503,42 @@ func (b *baseActor) PostOutboxScheme(c context.Context, w http.ResponseWriter, r
 // GetOutbox implements the generic algorithm for handling a Get request to an
 // actor's outbox independent on an application. It relies on a delegate to
 // implement application specific functionality.
+//
+// Only supports serving data with identifiers having the HTTPS scheme.
 func (b *baseActor) GetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+	return b.GetOutboxScheme(c, w, r, "https")
+}
+
+// GetOutboxScheme implements the generic algorithm for handling a Get request
+// to an actor's outbox independent on an application. It relies on a delegate
+// to implement application specific functionality.
+//
+// Specifying the "scheme" allows for retrieving ActivityStreams content with
+// identifiers such as HTTP, HTTPS, or other protocol schemes.
+func (b *baseActor) GetOutboxScheme(c context.Context, w http.ResponseWriter, r *http.Request, scheme string) (handled bool, err error) {
 	// Do nothing if it is not an ActivityPub GET request.
 	if !isActivityPubGet(r) {
 		return false, nil
 	}
+	c, done := b.observeRequest(c, BoxOutbox, r)
+	defer func() { done(c, err) }()
 	// Delegate authenticating and authorizing the request.
 	c, authenticated, err := b.delegate.AuthenticateGetOutbox(c, w, r)
+	b.observeAuthentication(c, BoxOutbox, r, authenticated)
 	if err != nil {
 		return true, err
 	} else if !authenticated {
 		return true, nil
 	}
 	// Everything is good to begin processing the request.
-	oc, err := b.delegate.GetOutbox(c, r)
+	outboxId := collectionId(requestId(r, scheme))
+	oc, err := b.delegate.GetOutbox(c, outboxId, r)
 	if err != nil {
 		return true, err
 	}
 	// Request has been processed. Begin responding to the request.
 	//
-	// Serialize the OrderedCollection.
+	// Serialize the OrderedCollection or OrderedCollectionPage.
 	m, err := streams.Serialize(oc)
 	if err != nil {
 		return true, err
@@ -437,6 +568,18 @@ func (b *baseActor) GetOutbox(c context.Context, w http.ResponseWriter, r *http.
 //
 // Note: 'm' is nilable.
 func (b *baseActor) deliver(c context.Context, outbox *url.URL, asValue vocab.Type, m map[string]interface{}) (activity Activity, err error) {
+	activity, deliverable, err := b.post(c, outbox, asValue, m)
+	if err != nil {
+		return
+	}
+	err = b.deliverPosted(c, outbox, activity, deliverable)
+	return
+}
+
+// post wraps the value in a Create if it is not an Activity, gives it new ids,
+// and posts it to the outbox, applying its side effects. It determines whether
+// the activity is to be delivered.
+func (b *baseActor) post(c context.Context, outbox *url.URL, asValue vocab.Type, m map[string]interface{}) (activity Activity, deliverable bool, err error) {
 	// If the value is not an Activity or type extending from Activity, then
 	// we need to wrap it in a Create Activity.
 	if !streams.IsOrExtendsActivityStreamsActivity(asValue) {
@@ -470,10 +613,13 @@ func (b *baseActor) deliver(c context.Context, outbox *url.URL, asValue vocab.Ty
 			return
 		}
 	}
-	deliverable, err := b.delegate.PostOutbox(c, activity, outbox, m)
-	if err != nil {
-		return
-	}
+	deliverable, err = b.delegate.PostOutbox(c, activity, outbox, m)
+	return
+}
+
+// deliverPosted delivers the activity posted to the outbox to federating
+// peers, if it is deliverable.
+func (b *baseActor) deliverPosted(c context.Context, outbox *url.URL, activity Activity, deliverable bool) error {
 	// Request has been processed and all side effects internal to this
 	// application server have finished. Begin side effects affecting other
 	// servers and/or the client who sent this request.
@@ -481,11 +627,9 @@ func (b *baseActor) deliver(c context.Context, outbox *url.URL, asValue vocab.Ty
 	// If we are federating and the type is a deliverable one, then deliver
 	// the activity to federating peers.
 	if b.enableFederatedProtocol && deliverable {
-		if err = b.delegate.Deliver(c, outbox, activity); err != nil {
-			return
-		}
+		return b.delegate.Deliver(c, outbox, activity)
 	}
-	return
+	return nil
 }
 
 // Send is programmatically accessible if the federated protocol is enabled.
@@ -1,6 +1,7 @@
 package pub
 
 import (
+	"bytes"
 	"context"
 	"github.com/go-fed/activity/streams/vocab"
 	"github.com/golang/mock/gomock"
@@ -96,7 +97,7 @@ func TestBaseActorSocialProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toGetInboxRequest())
 		delegate.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().GetInbox(ctx, req).Return(testOrderedCollectionUniqueElems, nil)
+		delegate.EXPECT().GetInbox(ctx, mustParse(testMyInboxIRI), req).Return(testOrderedCollectionUniqueElems, nil)
 		clock.EXPECT().Now().Return(now())
 		// Run the test
 		handled, err := a.GetInbox(ctx, resp, req)
@@ -120,7 +121,7 @@ func TestBaseActorSocialProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toGetInboxRequest())
 		delegate.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().GetInbox(ctx, req).Return(testOrderedCollectionDupedElems, nil)
+		delegate.EXPECT().GetInbox(ctx, mustParse(testMyInboxIRI), req).Return(testOrderedCollectionDupedElems, nil)
 		clock.EXPECT().Now().Return(now())
 		// Run the test
 		_, err := a.GetInbox(ctx, resp, req)
@@ -327,7 +328,7 @@ func TestBaseActorSocialProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toGetOutboxRequest())
 		delegate.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().GetOutbox(ctx, req).Return(testOrderedCollectionUniqueElems, nil)
+		delegate.EXPECT().GetOutbox(ctx, mustParse(testMyOutboxIRI), req).Return(testOrderedCollectionUniqueElems, nil)
 		clock.EXPECT().Now().Return(now())
 		// Run the test
 		handled, err := a.GetOutbox(ctx, resp, req)
@@ -499,6 +500,57 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		assertEqual(t, handled, true)
 		assertEqual(t, resp.Code, http.StatusBadRequest)
 	})
+	t.Run("PostInboxBadRequestIfMalformedJSON", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("POST", testMyInboxIRI, bytes.NewBufferString("{")))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run the test
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("PostInboxForbiddenForForbiddenError", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(&ForbiddenError{Err: testErr})
+		// Run the test
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+	t.Run("PostInboxReturnsServerErrors", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, _, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		dbErr := &DatabaseError{Err: testErr}
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(dbErr)
+		// Run the test
+		handled, err := a.PostInbox(ctx, resp, req)
+		// Verify results
+		assertEqual(t, err, dbErr)
+		assertEqual(t, handled, true)
+	})
 	t.Run("GetInboxIgnoresNonActivityPubRequest", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -539,7 +591,7 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toGetInboxRequest())
 		delegate.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().GetInbox(ctx, req).Return(testOrderedCollectionUniqueElems, nil)
+		delegate.EXPECT().GetInbox(ctx, mustParse(testMyInboxIRI), req).Return(testOrderedCollectionUniqueElems, nil)
 		clock.EXPECT().Now().Return(now())
 		// Run the test
 		handled, err := a.GetInbox(ctx, resp, req)
@@ -563,7 +615,7 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toGetInboxRequest())
 		delegate.EXPECT().AuthenticateGetInbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().GetInbox(ctx, req).Return(testOrderedCollectionDupedElems, nil)
+		delegate.EXPECT().GetInbox(ctx, mustParse(testMyInboxIRI), req).Return(testOrderedCollectionDupedElems, nil)
 		clock.EXPECT().Now().Return(now())
 		// Run the test
 		_, err := a.GetInbox(ctx, resp, req)
@@ -642,7 +694,7 @@ func TestBaseActorFederatingProtocol(t *testing.T) {
 		resp := httptest.NewRecorder()
 		req := toAPRequest(toGetOutboxRequest())
 		delegate.EXPECT().AuthenticateGetOutbox(ctx, resp, req).Return(ctx, true, nil)
-		delegate.EXPECT().GetOutbox(ctx, req).Return(testOrderedCollectionUniqueElems, nil)
+		delegate.EXPECT().GetOutbox(ctx, mustParse(testMyOutboxIRI), req).Return(testOrderedCollectionUniqueElems, nil)
 		clock.EXPECT().Now().Return(now())
 		// Run the test
 		handled, err := a.GetOutbox(ctx, resp, req)
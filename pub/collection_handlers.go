@@ -0,0 +1,437 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// CollectionHandlerConfig configures the HandlerFuncs serving the followers,
+// following, liked, likes, and shares collections.
+//
+// If the Database is a CollectionPager, these collections are paged in its
+// storage with the opaque cursors of a PageQuery, like inboxes and outboxes.
+// Otherwise they are obtained in full from the Database on every request, even
+// for a single page, and are sliced into pages numbered with the "page" query
+// parameter, so that the cost of each request grows with the size of the
+// collection.
+//
+// The zero value serves every collection in full to anyone.
+type CollectionHandlerConfig struct {
+	// AuthenticateGet authenticates the GET request in the same manner as
+	// CommonBehavior's AuthenticateGetInbox. The returned context should
+	// carry the requester set with WithRequester. If nil, all requests are
+	// served anonymously.
+	AuthenticateGet func(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error)
+	// Owner determines the IRI of the actor owning the collection, or of
+	// the object for likes and shares. If nil, the collection's IRI
+	// without its last path segment is used, such as
+	// "https://example.com/addison" for
+	// "https://example.com/addison/followers".
+	Owner func(c context.Context, collectionIRI *url.URL) (*url.URL, error)
+	// HideItems determines whether only the number of items in the owner's
+	// collection is shown to the requester, which is nil for anonymous
+	// requests. If nil, the items are always shown.
+	HideItems func(c context.Context, owner, requester *url.URL) (bool, error)
+	// PageSize is the maximum number of items on a page. If zero, twenty
+	// items are on a page.
+	PageSize int
+	// Scheme is the protocol scheme of the identifiers served. If empty,
+	// "https" is used.
+	Scheme string
+}
+
+// CollectionPager is implemented by a Database able to page the followers,
+// following, liked, likes, and shares collections in its storage. The
+// HandlerFuncs serving these collections use it in place of obtaining them in
+// full.
+type CollectionPager interface {
+	// CollectionTotalItems returns the number of items in the collection
+	// with the id. It returns an error satisfying errors.Is(err,
+	// ErrNotFound) if there is no such collection.
+	//
+	// The library makes this call only after acquiring a lock on the
+	// owner of the collection first.
+	CollectionTotalItems(c context.Context, collectionIRI *url.URL) (n int, err error)
+	// GetCollectionPage returns the page of the items of the collection
+	// with the id selected by the query, most recent first, as
+	// GetInboxPage does for inboxes.
+	//
+	// The library makes this call only after acquiring a lock on the
+	// owner of the collection first.
+	GetCollectionPage(c context.Context, collectionIRI *url.URL, q PageQuery) (page CollectionPage, err error)
+}
+
+// NewFollowersHandler creates a HandlerFunc serving the followers collection
+// of an actor, as obtained from the Database's Followers.
+func NewFollowersHandler(db Database, clock Clock, cfg CollectionHandlerConfig) HandlerFunc {
+	return newCollectionHandler(db, clock, cfg, func(c context.Context, owner *url.URL) (vocab.Type, error) {
+		return db.Followers(c, owner)
+	})
+}
+
+// NewFollowingHandler creates a HandlerFunc serving the following collection
+// of an actor, as obtained from the Database's Following.
+func NewFollowingHandler(db Database, clock Clock, cfg CollectionHandlerConfig) HandlerFunc {
+	return newCollectionHandler(db, clock, cfg, func(c context.Context, owner *url.URL) (vocab.Type, error) {
+		return db.Following(c, owner)
+	})
+}
+
+// NewLikedHandler creates a HandlerFunc serving the liked collection of an
+// actor, as obtained from the Database's Liked.
+func NewLikedHandler(db Database, clock Clock, cfg CollectionHandlerConfig) HandlerFunc {
+	return newCollectionHandler(db, clock, cfg, func(c context.Context, owner *url.URL) (vocab.Type, error) {
+		return db.Liked(c, owner)
+	})
+}
+
+// NewLikesHandler creates a HandlerFunc serving the likes collection of an
+// object obtained from the Database, either embedded in it or obtained from the
+// Database by its IRI.
+func NewLikesHandler(db Database, clock Clock, cfg CollectionHandlerConfig) HandlerFunc {
+	return newCollectionHandler(db, clock, cfg, func(c context.Context, owner *url.URL) (vocab.Type, error) {
+		t, err := db.Get(c, owner)
+		if err != nil || t == nil {
+			return nil, err
+		}
+		l, ok := t.(likeser)
+		if !ok {
+			return nil, nil
+		}
+		likes := l.GetActivityStreamsLikes()
+		if likes == nil {
+			return streams.NewActivityStreamsCollection(), nil
+		} else if likes.IsIRI() {
+			return db.Get(c, likes.GetIRI())
+		}
+		return likes.GetType(), nil
+	})
+}
+
+// NewSharesHandler creates a HandlerFunc serving the shares collection of an
+// object obtained from the Database, either embedded in it or obtained from the
+// Database by its IRI.
+func NewSharesHandler(db Database, clock Clock, cfg CollectionHandlerConfig) HandlerFunc {
+	return newCollectionHandler(db, clock, cfg, func(c context.Context, owner *url.URL) (vocab.Type, error) {
+		t, err := db.Get(c, owner)
+		if err != nil || t == nil {
+			return nil, err
+		}
+		s, ok := t.(shareser)
+		if !ok {
+			return nil, nil
+		}
+		shares := s.GetActivityStreamsShares()
+		if shares == nil {
+			return streams.NewActivityStreamsCollection(), nil
+		} else if shares.IsIRI() {
+			return db.Get(c, shares.GetIRI())
+		}
+		return shares.GetType(), nil
+	})
+}
+
+// newCollectionHandler creates a HandlerFunc serving the collection obtained
+// with the function, either as a whole or one page at a time. Unless the
+// Database is a CollectionPager, the whole collection is obtained for every
+// request.
+//
+// Returns ErrNotFound when the function does not obtain a Collection or
+// OrderedCollection.
+func newCollectionHandler(db Database, clock Clock, cfg CollectionHandlerConfig, get func(c context.Context, owner *url.URL) (vocab.Type, error)) HandlerFunc {
+	if cfg.Owner == nil {
+		cfg.Owner = ownerFromParentPath
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = defaultCollectionPageSize
+	}
+	if len(cfg.Scheme) == 0 {
+		cfg.Scheme = "https"
+	}
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
+		// Do nothing if it is not an ActivityPub GET request
+		if !isActivityPubGet(r) {
+			return
+		}
+		isASRequest = true
+		// Delegate authenticating the request.
+		if cfg.AuthenticateGet != nil {
+			var authenticated bool
+			c, authenticated, err = cfg.AuthenticateGet(c, w, r)
+			if err != nil || !authenticated {
+				return
+			}
+		}
+		q, page := parsePageQuery(r, cfg.PageSize)
+		id := collectionId(requestId(r, cfg.Scheme))
+		owner, err := cfg.Owner(c, id)
+		if err != nil {
+			return
+		}
+		var t vocab.Type
+		if pager, ok := db.(CollectionPager); ok {
+			t, err = getPagedCollection(c, db, pager, cfg, id, owner, q, page)
+			if err != nil {
+				return
+			}
+			err = writeCollection(w, clock, t)
+			return
+		}
+		// Lock and obtain a copy of the collection.
+		err = db.Lock(c, owner)
+		if err != nil {
+			return
+		}
+		// WARNING: Unlock not deferred
+		col, err := get(c, owner)
+		if err != nil {
+			db.Unlock(c, owner)
+			return
+		}
+		db.Unlock(c, owner)
+		// Unlock must have been called by this point and in every
+		// branch above
+		if col == nil {
+			err = ErrNotFound
+			return
+		}
+		ids, ordered, err := collectionItemIds(col)
+		if err != nil {
+			return
+		}
+		// Determine whether the requester may see the items.
+		hide := false
+		if cfg.HideItems != nil {
+			hide, err = cfg.HideItems(c, owner, RequesterFromContext(c))
+			if err != nil {
+				return
+			}
+		}
+		if len(page) == 0 {
+			t = toCollection(id, len(ids), ordered, hide, cfg.PageSize)
+		} else if hide {
+			err = forbiddenf("items of collection %s are hidden", id)
+			return
+		} else {
+			t, err = toCollectionPage(id, ids, ordered, page, cfg.PageSize)
+			if err != nil {
+				return
+			}
+		}
+		err = writeCollection(w, clock, t)
+		return
+	}
+}
+
+// getPagedCollection obtains the collection, or the requested page of it, from
+// the CollectionPager.
+func getPagedCollection(c context.Context, db Database, pager CollectionPager, cfg CollectionHandlerConfig, id, owner *url.URL, q PageQuery, page string) (vocab.Type, error) {
+	// Determine whether the requester may see the items.
+	hide := false
+	if cfg.HideItems != nil {
+		var err error
+		if hide, err = cfg.HideItems(c, owner, RequesterFromContext(c)); err != nil {
+			return nil, err
+		}
+	}
+	if len(page) > 0 && hide {
+		return nil, forbiddenf("items of collection %s are hidden", id)
+	}
+	// Acquire a lock to read the collection. Defer release.
+	if err := db.Lock(c, owner); err != nil {
+		return nil, err
+	}
+	defer db.Unlock(c, owner)
+	if len(page) == 0 {
+		n, err := pager.CollectionTotalItems(c, id)
+		if err != nil {
+			return nil, err
+		}
+		oc := toOrderedCollection(id, n)
+		if hide {
+			oc.SetActivityStreamsFirst(nil)
+			oc.SetActivityStreamsLast(nil)
+		}
+		return oc, nil
+	}
+	p, err := pager.GetCollectionPage(c, id, q)
+	if err != nil {
+		return nil, err
+	}
+	return toOrderedCollectionPage(id, page, p), nil
+}
+
+// writeCollection writes the collection as the response.
+func writeCollection(w http.ResponseWriter, clock Clock, t vocab.Type) error {
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	addResponseHeaders(w.Header(), clock, raw)
+	w.WriteHeader(http.StatusOK)
+	n, err := w.Write(raw)
+	if err != nil {
+		return err
+	} else if n != len(raw) {
+		return fmt.Errorf("only wrote %d of %d bytes", n, len(raw))
+	}
+	return nil
+}
+
+// ownerFromParentPath determines the owner of a collection by removing the last
+// segment of its path.
+func ownerFromParentPath(c context.Context, collectionIRI *url.URL) (*url.URL, error) {
+	owner := *collectionIRI
+	owner.Path = path.Dir(path.Clean(owner.Path))
+	owner.RawPath = ""
+	return &owner, nil
+}
+
+// collectionItemIds returns the ids of the items of a Collection or
+// OrderedCollection, and whether it is ordered.
+func collectionItemIds(t vocab.Type) (ids []*url.URL, ordered bool, err error) {
+	if col, ok := t.(itemser); ok {
+		items := col.GetActivityStreamsItems()
+		if items == nil {
+			return
+		}
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			var id *url.URL
+			if id, err = ToId(iter); err != nil {
+				return
+			}
+			ids = append(ids, id)
+		}
+	} else if oCol, ok := t.(orderedItemser); ok {
+		ordered = true
+		oItems := oCol.GetActivityStreamsOrderedItems()
+		if oItems == nil {
+			return
+		}
+		for iter := oItems.Begin(); iter != oItems.End(); iter = iter.Next() {
+			var id *url.URL
+			if id, err = ToId(iter); err != nil {
+				return
+			}
+			ids = append(ids, id)
+		}
+	} else {
+		err = fmt.Errorf("collection type is neither a Collection nor an OrderedCollection: %T", t)
+	}
+	return
+}
+
+// lastPageNumber returns the number of the last page of a collection with the
+// given number of items.
+func lastPageNumber(totalItems, pageSize int) int {
+	if totalItems == 0 {
+		return 1
+	}
+	return (totalItems + pageSize - 1) / pageSize
+}
+
+// toCollection creates the top-level Collection or OrderedCollection, linking
+// to its first and last pages unless its items are hidden.
+func toCollection(id *url.URL, totalItems int, ordered, hide bool, pageSize int) vocab.Type {
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(id)
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(totalItems)
+	var first vocab.ActivityStreamsFirstProperty
+	var last vocab.ActivityStreamsLastProperty
+	if !hide {
+		first = streams.NewActivityStreamsFirstProperty()
+		first.SetIRI(collectionPageId(id, "1"))
+		last = streams.NewActivityStreamsLastProperty()
+		last.SetIRI(collectionPageId(id, strconv.Itoa(lastPageNumber(totalItems, pageSize))))
+	}
+	if ordered {
+		oc := streams.NewActivityStreamsOrderedCollection()
+		oc.SetJSONLDId(idProp)
+		oc.SetActivityStreamsTotalItems(total)
+		oc.SetActivityStreamsFirst(first)
+		oc.SetActivityStreamsLast(last)
+		return oc
+	}
+	col := streams.NewActivityStreamsCollection()
+	col.SetJSONLDId(idProp)
+	col.SetActivityStreamsTotalItems(total)
+	col.SetActivityStreamsFirst(first)
+	col.SetActivityStreamsLast(last)
+	return col
+}
+
+// toCollectionPage creates the requested CollectionPage or
+// OrderedCollectionPage of the collection's items.
+func toCollectionPage(id *url.URL, ids []*url.URL, ordered bool, page string, pageSize int) (vocab.Type, error) {
+	last := lastPageNumber(len(ids), pageSize)
+	var n int
+	switch page {
+	case firstPageValue, firstPageAltValue:
+		n = 1
+	case lastPageValue:
+		n = last
+	default:
+		var err error
+		if n, err = strconv.Atoi(page); err != nil {
+			return nil, &MalformedError{Err: err}
+		} else if n < 1 || n > last {
+			return nil, ErrNotFound
+		}
+	}
+	start := (n - 1) * pageSize
+	end := start + pageSize
+	if end > len(ids) {
+		end = len(ids)
+	}
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(collectionPageId(id, strconv.Itoa(n)))
+	partOf := streams.NewActivityStreamsPartOfProperty()
+	partOf.SetIRI(id)
+	var next vocab.ActivityStreamsNextProperty
+	if n < last {
+		next = streams.NewActivityStreamsNextProperty()
+		next.SetIRI(collectionPageId(id, strconv.Itoa(n+1)))
+	}
+	var prev vocab.ActivityStreamsPrevProperty
+	if n > 1 {
+		prev = streams.NewActivityStreamsPrevProperty()
+		prev.SetIRI(collectionPageId(id, strconv.Itoa(n-1)))
+	}
+	if ordered {
+		ocp := streams.NewActivityStreamsOrderedCollectionPage()
+		ocp.SetJSONLDId(idProp)
+		ocp.SetActivityStreamsPartOf(partOf)
+		ocp.SetActivityStreamsNext(next)
+		ocp.SetActivityStreamsPrev(prev)
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		for _, item := range ids[start:end] {
+			oi.AppendIRI(item)
+		}
+		ocp.SetActivityStreamsOrderedItems(oi)
+		return ocp, nil
+	}
+	cp := streams.NewActivityStreamsCollectionPage()
+	cp.SetJSONLDId(idProp)
+	cp.SetActivityStreamsPartOf(partOf)
+	cp.SetActivityStreamsNext(next)
+	cp.SetActivityStreamsPrev(prev)
+	items := streams.NewActivityStreamsItemsProperty()
+	for _, item := range ids[start:end] {
+		items.AppendIRI(item)
+	}
+	cp.SetActivityStreamsItems(items)
+	return cp, nil
+}
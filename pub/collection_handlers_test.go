@@ -0,0 +1,265 @@
+package pub
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+// TestCollectionHandlers tests serving the followers, following, liked, likes,
+// and shares collections.
+func TestCollectionHandlers(t *testing.T) {
+	ctx := context.Background()
+	const (
+		actorIRI     = "https://example.com/addison"
+		followersIRI = "https://example.com/addison/followers"
+		likesIRI     = "https://example.com/note/1/likes"
+	)
+	followers := func() vocab.ActivityStreamsCollection {
+		col := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI))
+		items.AppendIRI(mustParse(testFederatedActorIRI2))
+		items.AppendIRI(mustParse(testFederatedActorIRI3))
+		col.SetActivityStreamsItems(items)
+		return col
+	}
+	serve := func(hf HandlerFunc, rawurl string) (resp *httptest.ResponseRecorder, isASRequest bool, err error) {
+		resp = httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", rawurl, nil))
+		isASRequest, err = hf(ctx, resp, req)
+		return
+	}
+	body := func(resp *httptest.ResponseRecorder) []byte {
+		b, err := ioutil.ReadAll(resp.Result().Body)
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+	t.Run("IgnoresIfNotActivityPubGetRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		hf := NewFollowersHandler(NewMockDatabase(ctl), NewMockClock(ctl), CollectionHandlerConfig{})
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", followersIRI, nil)
+		// Run & Verify
+		isASRequest, err := hf(ctx, resp, req)
+		assertEqual(t, isASRequest, false)
+		assertEqual(t, err, nil)
+	})
+	t.Run("ServesCollection", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock := NewMockDatabase(ctl), NewMockClock(ctl)
+		hf := NewFollowersHandler(db, clock, CollectionHandlerConfig{PageSize: 2})
+		db.EXPECT().Lock(ctx, mustParse(actorIRI))
+		db.EXPECT().Followers(ctx, mustParse(actorIRI)).Return(followers(), nil)
+		db.EXPECT().Unlock(ctx, mustParse(actorIRI))
+		clock.EXPECT().Now().Return(now())
+		// Run
+		resp, isASRequest, err := serve(hf, followersIRI)
+		// Verify
+		assertEqual(t, isASRequest, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertByteEqual(t, body(resp), []byte(`{"@context":"https://www.w3.org/ns/activitystreams","first":"https://example.com/addison/followers?page=1","id":"https://example.com/addison/followers","last":"https://example.com/addison/followers?page=2","totalItems":3,"type":"Collection"}`))
+	})
+	t.Run("ServesPage", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock := NewMockDatabase(ctl), NewMockClock(ctl)
+		hf := NewFollowersHandler(db, clock, CollectionHandlerConfig{PageSize: 2})
+		db.EXPECT().Lock(ctx, mustParse(actorIRI))
+		db.EXPECT().Followers(ctx, mustParse(actorIRI)).Return(followers(), nil)
+		db.EXPECT().Unlock(ctx, mustParse(actorIRI))
+		clock.EXPECT().Now().Return(now())
+		// Run
+		resp, _, err := serve(hf, followersIRI+"?page=last")
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, body(resp), []byte(`{"@context":"https://www.w3.org/ns/activitystreams","id":"https://example.com/addison/followers?page=2","items":"https://other.example.com/sam","partOf":"https://example.com/addison/followers","prev":"https://example.com/addison/followers?page=1","type":"CollectionPage"}`))
+	})
+	t.Run("ReturnsErrorForPageOutOfRange", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock := NewMockDatabase(ctl), NewMockClock(ctl)
+		hf := NewFollowersHandler(db, clock, CollectionHandlerConfig{PageSize: 2})
+		db.EXPECT().Lock(ctx, mustParse(actorIRI))
+		db.EXPECT().Followers(ctx, mustParse(actorIRI)).Return(followers(), nil)
+		db.EXPECT().Unlock(ctx, mustParse(actorIRI))
+		// Run
+		_, _, err := serve(hf, followersIRI+"?page=3")
+		// Verify
+		assertEqual(t, err, ErrNotFound)
+	})
+	t.Run("HidesItemsFromRequester", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock := NewMockDatabase(ctl), NewMockClock(ctl)
+		var hiddenFrom *url.URL
+		hf := NewFollowingHandler(db, clock, CollectionHandlerConfig{
+			AuthenticateGet: func(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+				return WithRequester(c, mustParse(testFederatedActorIRI)), true, nil
+			},
+			HideItems: func(c context.Context, owner, requester *url.URL) (bool, error) {
+				hiddenFrom = requester
+				return owner.String() != requester.String(), nil
+			},
+		})
+		db.EXPECT().Lock(gomock.Any(), mustParse(actorIRI))
+		db.EXPECT().Following(gomock.Any(), mustParse(actorIRI)).Return(followers(), nil)
+		db.EXPECT().Unlock(gomock.Any(), mustParse(actorIRI))
+		clock.EXPECT().Now().Return(now())
+		// Run
+		resp, _, err := serve(hf, "https://example.com/addison/following")
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, hiddenFrom.String(), testFederatedActorIRI)
+		assertByteEqual(t, body(resp), []byte(`{"@context":"https://www.w3.org/ns/activitystreams","id":"https://example.com/addison/following","totalItems":3,"type":"Collection"}`))
+	})
+	t.Run("ForbidsPagesOfHiddenItems", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock := NewMockDatabase(ctl), NewMockClock(ctl)
+		hf := NewLikedHandler(db, clock, CollectionHandlerConfig{
+			HideItems: func(c context.Context, owner, requester *url.URL) (bool, error) {
+				return requester == nil, nil
+			},
+		})
+		db.EXPECT().Lock(ctx, mustParse(actorIRI))
+		db.EXPECT().Liked(ctx, mustParse(actorIRI)).Return(followers(), nil)
+		db.EXPECT().Unlock(ctx, mustParse(actorIRI))
+		// Run
+		_, _, err := serve(hf, "https://example.com/addison/liked?page=1")
+		// Verify
+		assertEqual(t, ErrorStatusCode(err), http.StatusForbidden)
+	})
+	t.Run("ServesLikesOfObject", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock := NewMockDatabase(ctl), NewMockClock(ctl)
+		hf := NewLikesHandler(db, clock, CollectionHandlerConfig{})
+		note := streams.NewActivityStreamsNote()
+		likes := streams.NewActivityStreamsLikesProperty()
+		oc := streams.NewActivityStreamsOrderedCollection()
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		oi.AppendIRI(mustParse(testFederatedActivityIRI))
+		oc.SetActivityStreamsOrderedItems(oi)
+		likes.SetActivityStreamsOrderedCollection(oc)
+		note.SetActivityStreamsLikes(likes)
+		db.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		db.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		clock.EXPECT().Now().Return(now())
+		// Run
+		resp, _, err := serve(hf, likesIRI+"?page=first")
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, body(resp), []byte(`{"@context":"https://www.w3.org/ns/activitystreams","id":"https://example.com/note/1/likes?page=1","orderedItems":"https://other.example.com/activity/1","partOf":"https://example.com/note/1/likes","type":"OrderedCollectionPage"}`))
+	})
+	t.Run("ServesLikesStoredByIRI", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock := NewMockDatabase(ctl), NewMockClock(ctl)
+		hf := NewLikesHandler(db, clock, CollectionHandlerConfig{})
+		note := streams.NewActivityStreamsNote()
+		likes := streams.NewActivityStreamsLikesProperty()
+		likes.SetIRI(mustParse(likesIRI))
+		note.SetActivityStreamsLikes(likes)
+		oc := streams.NewActivityStreamsOrderedCollection()
+		oi := streams.NewActivityStreamsOrderedItemsProperty()
+		oi.AppendIRI(mustParse(testFederatedActivityIRI))
+		oc.SetActivityStreamsOrderedItems(oi)
+		db.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		db.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		db.EXPECT().Get(ctx, mustParse(likesIRI)).Return(oc, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		clock.EXPECT().Now().Return(now())
+		// Run
+		resp, _, err := serve(hf, likesIRI+"?page=first")
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, body(resp), []byte(`{"@context":"https://www.w3.org/ns/activitystreams","id":"https://example.com/note/1/likes?page=1","orderedItems":"https://other.example.com/activity/1","partOf":"https://example.com/note/1/likes","type":"OrderedCollectionPage"}`))
+	})
+	t.Run("PagesWithCollectionPager", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db := &fakeCollectionPager{
+			MockDatabase: NewMockDatabase(ctl),
+			page: CollectionPage{
+				Items: []*url.URL{mustParse(testFederatedActorIRI3)},
+				Prev:  "before",
+			},
+		}
+		clock := NewMockClock(ctl)
+		hf := NewFollowersHandler(db, clock, CollectionHandlerConfig{PageSize: 2})
+		db.EXPECT().Lock(ctx, mustParse(actorIRI))
+		db.EXPECT().Unlock(ctx, mustParse(actorIRI))
+		clock.EXPECT().Now().Return(now())
+		// Run
+		resp, _, err := serve(hf, followersIRI+"?page=after")
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, db.collection.String(), followersIRI)
+		assertEqual(t, db.query, PageQuery{Cursor: "after", Limit: 2})
+		assertByteEqual(t, body(resp), []byte(`{"@context":"https://www.w3.org/ns/activitystreams","id":"https://example.com/addison/followers?page=after","orderedItems":"https://other.example.com/sam","partOf":"https://example.com/addison/followers","prev":"https://example.com/addison/followers?page=before","type":"OrderedCollectionPage"}`))
+	})
+	t.Run("ReturnsNotFoundWithoutShares", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, clock := NewMockDatabase(ctl), NewMockClock(ctl)
+		hf := NewSharesHandler(db, clock, CollectionHandlerConfig{})
+		db.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		db.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(nil, nil)
+		db.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		// Run
+		_, _, err := serve(hf, "https://example.com/note/1/shares")
+		// Verify
+		assertEqual(t, err, ErrNotFound)
+	})
+}
+
+// fakeCollectionPager is a Database paging collections with its page.
+type fakeCollectionPager struct {
+	*MockDatabase
+	total      int
+	page       CollectionPage
+	collection *url.URL
+	query      PageQuery
+}
+
+func (f *fakeCollectionPager) CollectionTotalItems(c context.Context, collectionIRI *url.URL) (int, error) {
+	f.collection = collectionIRI
+	return f.total, nil
+}
+
+func (f *fakeCollectionPager) GetCollectionPage(c context.Context, collectionIRI *url.URL, q PageQuery) (CollectionPage, error) {
+	f.collection, f.query = collectionIRI, q
+	return f.page, nil
+}
+
+// TestRequesterFromContext tests carrying the requester in a context.
+func TestRequesterFromContext(t *testing.T) {
+	ctx := context.Background()
+	assertEqual(t, RequesterFromContext(ctx), (*url.URL)(nil))
+	iri := mustParse(testFederatedActorIRI)
+	assertEqual(t, RequesterFromContext(WithRequester(ctx, iri)), iri)
+}
@@ -0,0 +1,142 @@
+package pub
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const (
+	// pageQueryParam is the query parameter selecting a page of an inbox or
+	// outbox.
+	pageQueryParam = "page"
+	// firstPageValue selects the page with the most recent items.
+	firstPageValue = "first"
+	// firstPageAltValue also selects the page with the most recent items,
+	// as requested by some other implementations.
+	firstPageAltValue = "true"
+	// lastPageValue selects the page with the oldest items.
+	lastPageValue = "last"
+	// defaultCollectionPageSize is the number of items on a page of an
+	// inbox or outbox when no WithCollectionPageSize option is given.
+	defaultCollectionPageSize = 20
+)
+
+// PageQuery selects a page of an inbox or outbox from the Database.
+type PageQuery struct {
+	// Cursor is an opaque value previously returned by the Database as
+	// the Next or Prev of a CollectionPage. If empty, the first page,
+	// holding the most recent items, is selected.
+	Cursor string
+	// Last selects the page holding the oldest items instead. Cursor is
+	// always empty when Last is true.
+	Last bool
+	// Limit is the maximum number of items on the page.
+	Limit int
+}
+
+// CollectionPage is a page of the items in an inbox or outbox, as returned by
+// the Database.
+type CollectionPage struct {
+	// Items are the ids of the items on the page, most recent first.
+	Items []*url.URL
+	// Next is the cursor of the page with the items immediately older
+	// than these, or empty if there are none.
+	Next string
+	// Prev is the cursor of the page with the items immediately more
+	// recent than these, or empty if there are none.
+	Prev string
+}
+
+// WithCollectionPageSize sets the maximum number of items on each page of the
+// inboxes and outboxes served by an Actor.
+//
+// It has no effect on Actors created with NewCustomActor.
+func WithCollectionPageSize(n int) ActorOption {
+	return func(b *baseActor) {
+		if s, ok := b.delegate.(*sideEffectActor); ok && n > 0 {
+			s.pageSize = n
+		}
+	}
+}
+
+// parsePageQuery determines which page of an inbox or outbox is requested. The
+// page is the value of the query parameter, and is empty if the request is for
+// the collection itself.
+func parsePageQuery(r *http.Request, limit int) (q PageQuery, page string) {
+	page = r.URL.Query().Get(pageQueryParam)
+	q.Limit = limit
+	switch page {
+	case "", firstPageValue, firstPageAltValue:
+	case lastPageValue:
+		q.Last = true
+	default:
+		q.Cursor = page
+	}
+	return
+}
+
+// collectionId returns the id of an inbox or outbox requested at the IRI,
+// without any query or fragment.
+func collectionId(iri *url.URL) *url.URL {
+	id := *iri
+	id.RawQuery = ""
+	id.Fragment = ""
+	return &id
+}
+
+// collectionPageId returns the id of a page of an inbox or outbox.
+func collectionPageId(collection *url.URL, page string) *url.URL {
+	id := *collection
+	id.RawQuery = url.Values{pageQueryParam: []string{page}}.Encode()
+	return &id
+}
+
+// toOrderedCollection creates the top-level OrderedCollection of an inbox or
+// outbox, linking to its first and last pages.
+func toOrderedCollection(id *url.URL, totalItems int) vocab.ActivityStreamsOrderedCollection {
+	oc := streams.NewActivityStreamsOrderedCollection()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(id)
+	oc.SetJSONLDId(idProp)
+	total := streams.NewActivityStreamsTotalItemsProperty()
+	total.Set(totalItems)
+	oc.SetActivityStreamsTotalItems(total)
+	first := streams.NewActivityStreamsFirstProperty()
+	first.SetIRI(collectionPageId(id, firstPageValue))
+	oc.SetActivityStreamsFirst(first)
+	last := streams.NewActivityStreamsLastProperty()
+	last.SetIRI(collectionPageId(id, lastPageValue))
+	oc.SetActivityStreamsLast(last)
+	return oc
+}
+
+// toOrderedCollectionPage creates a page of an inbox or outbox, linking to the
+// pages before and after it.
+func toOrderedCollectionPage(collection *url.URL, page string, p CollectionPage) vocab.ActivityStreamsOrderedCollectionPage {
+	ocp := streams.NewActivityStreamsOrderedCollectionPage()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(collectionPageId(collection, page))
+	ocp.SetJSONLDId(idProp)
+	partOf := streams.NewActivityStreamsPartOfProperty()
+	partOf.SetIRI(collection)
+	ocp.SetActivityStreamsPartOf(partOf)
+	oi := streams.NewActivityStreamsOrderedItemsProperty()
+	for _, item := range p.Items {
+		oi.AppendIRI(item)
+	}
+	ocp.SetActivityStreamsOrderedItems(oi)
+	if len(p.Next) > 0 {
+		next := streams.NewActivityStreamsNextProperty()
+		next.SetIRI(collectionPageId(collection, p.Next))
+		ocp.SetActivityStreamsNext(next)
+	}
+	if len(p.Prev) > 0 {
+		prev := streams.NewActivityStreamsPrevProperty()
+		prev.SetIRI(collectionPageId(collection, p.Prev))
+		ocp.SetActivityStreamsPrev(prev)
+	}
+	return ocp
+}
@@ -0,0 +1,56 @@
+package pub
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParsePageQuery tests determining the page of an inbox or outbox
+// requested.
+func TestParsePageQuery(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expected     PageQuery
+		expectedPage string
+	}{
+		{
+			"Collection",
+			"",
+			PageQuery{Limit: 10},
+			"",
+		},
+		{
+			"First Page",
+			"?page=first",
+			PageQuery{Limit: 10},
+			"first",
+		},
+		{
+			"First Page Alternative",
+			"?page=true",
+			PageQuery{Limit: 10},
+			"true",
+		},
+		{
+			"Last Page",
+			"?page=last",
+			PageQuery{Last: true, Limit: 10},
+			"last",
+		},
+		{
+			"Cursor",
+			"?page=abc%3D",
+			PageQuery{Cursor: "abc=", Limit: 10},
+			"abc=",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", testMyInboxIRI+test.query, nil)
+			q, page := parsePageQuery(r, 10)
+			assertEqual(t, q, test.expected)
+			assertEqual(t, page, test.expectedPage)
+		})
+	}
+}
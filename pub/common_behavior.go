@@ -2,7 +2,6 @@ package pub
 
 import (
 	"context"
-	"github.com/go-fed/activity/streams/vocab"
 	"net/http"
 	"net/url"
 )
@@ -32,6 +31,9 @@ type CommonBehavior interface {
 	// Finally, if the authentication and authorization succeeds, then
 	// authenticated must be true and error nil. The request will continue
 	// to be processed.
+	//
+	// The returned context is given to the Database's GetInboxPage, which
+	// may use it to only return the items visible to the requester.
 	AuthenticateGetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error)
 	// AuthenticateGetOutbox delegates the authentication of a GET to an
 	// outbox.
@@ -52,16 +54,10 @@ type CommonBehavior interface {
 	// Finally, if the authentication and authorization succeeds, then
 	// authenticated must be true and error nil. The request will continue
 	// to be processed.
-	AuthenticateGetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error)
-	// GetOutbox returns the OrderedCollection inbox of the actor for this
-	// context. It is up to the implementation to provide the correct
-	// collection for the kind of authorization given in the request.
-	//
-	// AuthenticateGetOutbox will be called prior to this.
 	//
-	// Always called, regardless whether the Federated Protocol or Social
-	// API is enabled.
-	GetOutbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error)
+	// The returned context is given to the Database's GetOutboxPage, which
+	// may use it to only return the items visible to the requester.
+	AuthenticateGetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error)
 	// NewTransport returns a new Transport on behalf of a specific actor.
 	//
 	// The actorBoxIRI will be either the inbox or outbox of an actor who is
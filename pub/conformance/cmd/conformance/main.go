@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-fed/activity/pub/conformance"
+)
+
+const (
+	outFlag    = "o"
+	strictFlag = "strict"
+	helpText   = `
+Usage: conformance [-o=<file>] [-strict]
+
+The conformance tool checks the Actor of the go-fed/activity library against
+the MUST and SHOULD statements of the ActivityPub specification, and writes a
+report of the outcome of each statement as JSON:
+
+    conformance -o report.json
+
+The Actor stores its data in memory. To check an Actor with another Database or
+other options, call conformance.Run or conformance.Test from Go instead.
+
+The tool exits with status 1 if a MUST statement fails, or with -strict if any
+statement fails.
+`
+)
+
+func main() {
+	out := flag.String(outFlag, "", "File to write the report to, instead of standard output.")
+	strict := flag.Bool(strictFlag, false, "Exit with an error if a SHOULD statement fails.")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), helpText)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	r := conformance.Run(context.Background(), conformance.Config{})
+	var w io.Writer = os.Stdout
+	if len(*out) > 0 {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	s := r.Summary
+	fmt.Fprintf(os.Stderr, "%d passed, %d failed (%d MUST), %d skipped\n", s.Passed, s.Failed, s.MustFailed, s.Skipped)
+	if !r.Conforms() || (*strict && s.Failed > 0) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,202 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/pub/memdb"
+)
+
+// Spec is the part of the ActivityPub specification a Statement belongs to.
+type Spec string
+
+const (
+	// C2S is the Social API, between clients and servers.
+	C2S Spec = "C2S"
+	// S2S is the Federation Protocol, between servers.
+	S2S Spec = "S2S"
+)
+
+// Level is the requirement level of a Statement.
+type Level string
+
+const (
+	// Must statements are required for conformance.
+	Must Level = "MUST"
+	// Should statements are recommended.
+	Should Level = "SHOULD"
+)
+
+// Outcome is the outcome of checking a Statement.
+type Outcome string
+
+const (
+	// Pass indicates the Actor satisfies the statement.
+	Pass Outcome = "pass"
+	// Fail indicates the Actor does not satisfy the statement, or that
+	// checking it failed.
+	Fail Outcome = "fail"
+	// Skip indicates the statement does not apply to the Actor as
+	// configured.
+	Skip Outcome = "skip"
+)
+
+// Statement is a requirement of the ActivityPub specification.
+type Statement struct {
+	// ID identifies the statement in reports, such as "s2s-inbox-dedupe".
+	ID string `json:"id"`
+	// Spec is the part of the specification of the statement.
+	Spec Spec `json:"spec"`
+	// Level is the requirement level of the statement.
+	Level Level `json:"level"`
+	// Section is the section of the specification stating it, such as
+	// "7.1.2".
+	Section string `json:"section"`
+	// Text summarizes the statement.
+	Text string `json:"text"`
+
+	check func(e *env) error
+}
+
+// Result is the outcome of checking a Statement.
+type Result struct {
+	Statement
+	// Outcome is the outcome of the check.
+	Outcome Outcome `json:"outcome"`
+	// Detail explains why the check failed or was skipped.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Summary counts the outcomes of a Report.
+type Summary struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	// MustFailed is the number of failed MUST statements.
+	MustFailed int `json:"mustFailed"`
+}
+
+// Report is the outcome of checking the Statements.
+type Report struct {
+	// Library is the version of go-fed/activity checked.
+	Library string `json:"library"`
+	// Summary counts the outcomes of the Results.
+	Summary Summary `json:"summary"`
+	// Results are the outcomes of the statements, in order.
+	Results []Result `json:"results"`
+}
+
+// Conforms determines whether all MUST statements passed or were skipped.
+func (r *Report) Conforms() bool {
+	return r.Summary.MustFailed == 0
+}
+
+// Config configures the Actor the statements are checked against.
+type Config struct {
+	// NewDatabase returns an empty Database owning the IRIs of the host.
+	// If nil, a memdb.Database is used.
+	NewDatabase func(host string) (pub.Database, error)
+	// CommonBehavior, FederatingProtocol, and SocialProtocol are the
+	// behaviors of the Actor checked. If nil, a pubtest.Delegate is used,
+	// which authenticates every request, blocks no one, and accepts Follow
+	// requests automatically. They must authenticate the requests of the
+	// statements, which are not signed. NewTransport is never called: the
+	// Actor reaches its peers through a Transport simulating them.
+	CommonBehavior     pub.CommonBehavior
+	FederatingProtocol pub.FederatingProtocol
+	SocialProtocol     pub.SocialProtocol
+	// Options are passed to pub.NewActor. Options delaying side effects,
+	// such as pub.WithAsyncInbox, make statements fail, since side effects
+	// are expected once a request is responded to.
+	Options []pub.ActorOption
+}
+
+// newDatabase returns the Database of a new environment.
+func (cfg Config) newDatabase(host string) (pub.Database, error) {
+	if cfg.NewDatabase == nil {
+		return memdb.New(memdb.Config{Hosts: []string{host}}), nil
+	}
+	return cfg.NewDatabase(host)
+}
+
+// skipError indicates a statement does not apply.
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+// skipf returns an error skipping the statement.
+func skipf(format string, a ...interface{}) error {
+	return &skipError{reason: fmt.Sprintf(format, a...)}
+}
+
+// Statements returns the statements checked, in the order of the
+// specification.
+func Statements() []Statement {
+	return append([]Statement(nil), statements...)
+}
+
+// Check checks the statement against a new Actor.
+func Check(c context.Context, cfg Config, s Statement) Result {
+	r := Result{Statement: s, Outcome: Pass}
+	e, err := newEnv(c, cfg)
+	if err == nil {
+		err = s.check(e)
+	}
+	var skip *skipError
+	if errors.As(err, &skip) {
+		r.Outcome = Skip
+		r.Detail = skip.reason
+	} else if err != nil {
+		r.Outcome = Fail
+		r.Detail = err.Error()
+	}
+	return r
+}
+
+// Run checks all statements, each against a new Actor, and reports their
+// outcomes.
+func Run(c context.Context, cfg Config) *Report {
+	r := &Report{Library: "go-fed/activity " + pub.Version}
+	for _, s := range statements {
+		res := Check(c, cfg, s)
+		switch res.Outcome {
+		case Pass:
+			r.Summary.Passed++
+		case Skip:
+			r.Summary.Skipped++
+		case Fail:
+			r.Summary.Failed++
+			if s.Level == Must {
+				r.Summary.MustFailed++
+			}
+		}
+		r.Results = append(r.Results, res)
+	}
+	return r
+}
+
+// Test checks each statement in a subtest named after its id. Failed MUST
+// statements fail the test, while failed SHOULD statements are only logged.
+func Test(t *testing.T, cfg Config) {
+	for _, s := range statements {
+		s := s
+		t.Run(s.ID, func(t *testing.T) {
+			res := Check(context.Background(), cfg, s)
+			switch {
+			case res.Outcome == Skip:
+				t.Skip(res.Detail)
+			case res.Outcome == Fail && s.Level == Must:
+				t.Errorf("%s %s %s: %s", s.Spec, s.Section, s.Text, res.Detail)
+			case res.Outcome == Fail:
+				t.Logf("%s %s %s: %s", s.Spec, s.Section, s.Text, res.Detail)
+			}
+		})
+	}
+}
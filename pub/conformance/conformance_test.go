@@ -0,0 +1,71 @@
+package conformance
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-fed/activity/pub/pubtest"
+)
+
+// knownFailures are the statements the library does not satisfy yet, with the
+// reason.
+var knownFailures = map[string]string{
+	"s2s-forward-from-inbox": "forwarded activities are delivered to the ids of the collection's members rather than to their inboxes",
+}
+
+// knownSkips are the statements that cannot be checked yet, with the reason.
+var knownSkips = map[string]string{
+	"s2s-forward-only-owned-objects": "it depends on s2s-forward-from-inbox passing",
+}
+
+// TestConformance checks the library's Actor with the default Config.
+func TestConformance(t *testing.T) {
+	r := Run(context.Background(), Config{})
+	if len(r.Results) != len(statements) {
+		t.Fatalf("got %d results, want %d", len(r.Results), len(statements))
+	}
+	for _, res := range r.Results {
+		reason, known := knownFailures[res.ID]
+		skipReason, skipped := knownSkips[res.ID]
+		switch {
+		case known && res.Outcome != Fail:
+			t.Errorf("%s is known to fail (%s) but got %s", res.ID, reason, res.Outcome)
+		case skipped && res.Outcome != Skip:
+			t.Errorf("%s is known to be skipped (%s) but got %s", res.ID, skipReason, res.Outcome)
+		case !known && !skipped && res.Outcome != Pass:
+			t.Errorf("%s: got %s: %s", res.ID, res.Outcome, res.Detail)
+		}
+	}
+	s := r.Summary
+	if s.Passed+s.Failed+s.Skipped != len(statements) {
+		t.Fatalf("got summary %+v for %d statements", s, len(statements))
+	}
+	if want := len(knownFailures); s.MustFailed != want || r.Conforms() != (want == 0) {
+		t.Fatalf("got %d failed MUST statements, want %d", s.MustFailed, want)
+	}
+}
+
+// countingProtocol counts the deliveries it authenticates.
+type countingProtocol struct {
+	pubtest.Delegate
+	authenticated int
+}
+
+func (p *countingProtocol) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	p.authenticated++
+	return c, true, nil
+}
+
+// TestConfigProtocols checks the statements against the behaviors of the
+// Config.
+func TestConfigProtocols(t *testing.T) {
+	p := &countingProtocol{}
+	res := Check(context.Background(), Config{FederatingProtocol: p}, statements[2])
+	if res.Outcome != Pass {
+		t.Fatalf("%s: got %s: %s", res.ID, res.Outcome, res.Detail)
+	}
+	if p.authenticated == 0 {
+		t.Fatalf("the FederatingProtocol of the Config authenticated no delivery")
+	}
+}
@@ -0,0 +1,14 @@
+// Package conformance checks a pub.Actor against the requirements of the
+// ActivityPub specification, and reports the outcome in a machine-readable
+// form.
+//
+// Each Statement is a MUST or SHOULD statement of the Social API (C2S) or the
+// Federation Protocol (S2S), such as de-duplicating activities in the inbox or
+// removing bto and bcc before delivery. It is checked end to end by sending
+// HTTP requests to an Actor created with pub.NewActor, and by observing what it
+// delivers to peers. The Config determines the Database and options of the
+// Actor.
+//
+// Applications run the statements as tests with Test, and tools generate a
+// Report with Run. The conformance command writes a Report as JSON.
+package conformance
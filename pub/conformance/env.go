@@ -0,0 +1,392 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/pub/pubtest"
+)
+
+const (
+	// localHost is the host of the Actor checked.
+	localHost = "local.example"
+	// remoteHost is the host of the peers of the Actor.
+	remoteHost = "remote.example"
+	// activityStreamsContext is the JSON-LD context of the documents.
+	activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	// contentType is the media type of requests to the Actor.
+	contentType = "application/activity+json"
+)
+
+var (
+	// alex is the actor of the local server.
+	alex = "https://" + localHost + "/alex"
+	// sam and kai are actors of the remote server.
+	sam = "https://" + remoteHost + "/sam"
+	kai = "https://" + remoteHost + "/kai"
+)
+
+// env is the environment a statement is checked in: a pub.Actor serving the
+// local actor alex, and a Transport standing in for the peers sam and kai.
+type env struct {
+	c       context.Context
+	db      pub.Database
+	handler http.Handler
+	// remote holds the documents of the peers.
+	remote map[string]map[string]interface{}
+	// mu protects deliveries.
+	mu         sync.Mutex
+	deliveries []delivery
+}
+
+// delivery is an activity delivered to a peer.
+type delivery struct {
+	to       string
+	activity map[string]interface{}
+}
+
+// newEnv creates the local actor and its peers.
+func newEnv(c context.Context, cfg Config) (*env, error) {
+	db, err := cfg.newDatabase(localHost)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := pub.NewActorDocument(pub.ActorConfig{
+		Id:                mustParse(alex),
+		PreferredUsername: "alex",
+		PublicKey:         &key.PublicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Create(c, doc); err != nil {
+		return nil, err
+	}
+	e := &env{
+		c:  c,
+		db: db,
+		remote: map[string]map[string]interface{}{
+			sam: remoteActor(sam),
+			kai: remoteActor(kai),
+		},
+	}
+	d := &pubtest.Delegate{
+		Transport: func(c context.Context, actorBoxIRI *url.URL) (pub.Transport, error) {
+			return e, nil
+		},
+	}
+	common, s2s, c2s := pub.CommonBehavior(d), pub.FederatingProtocol(d), pub.SocialProtocol(d)
+	if cfg.CommonBehavior != nil {
+		common = cfg.CommonBehavior
+	}
+	if cfg.FederatingProtocol != nil {
+		s2s = cfg.FederatingProtocol
+	}
+	if cfg.SocialProtocol != nil {
+		c2s = cfg.SocialProtocol
+	}
+	actor := pub.NewActor(peerBehavior{CommonBehavior: common, e: e}, c2s, s2s, db, clock{}, cfg.Options...)
+	e.handler = pub.NewActorHandler(actor, pub.ActorHandlerConfig{
+		// The environment serves every value to anyone; real servers
+		// should use pub.NewAuthorizedActivityStreamsHandler.
+		Objects: pub.NewActivityStreamsHandler(db, clock{}),
+	})
+	return e, nil
+}
+
+// remoteActor returns the document of a peer.
+func remoteActor(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"@context": activityStreamsContext,
+		"id":       id,
+		"type":     "Person",
+		"inbox":    id + "/inbox",
+		"outbox":   id + "/outbox",
+	}
+}
+
+// mustParse parses the IRI, panicking on failure.
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// do sends a request to the Actor, with the document as JSON body if it is not
+// nil.
+func (e *env) do(method, iri string, doc map[string]interface{}) (*httptest.ResponseRecorder, error) {
+	var body bytes.Buffer
+	if doc != nil {
+		if err := json.NewEncoder(&body).Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	r := httptest.NewRequest(method, iri, &body)
+	r = r.WithContext(e.c)
+	if doc != nil {
+		r.Header.Set("Content-Type", contentType)
+	}
+	r.Header.Set("Accept", contentType)
+	w := httptest.NewRecorder()
+	e.handler.ServeHTTP(w, r)
+	return w, nil
+}
+
+// postInbox delivers the activity to alex's inbox.
+func (e *env) postInbox(activity map[string]interface{}) error {
+	w, err := e.do(http.MethodPost, alex+"/inbox", activity)
+	if err != nil {
+		return err
+	}
+	if w.Code < 200 || w.Code > 299 {
+		return fmt.Errorf("delivering %s to the inbox: got %d: %s", activity["type"], w.Code, w.Body)
+	}
+	return nil
+}
+
+// postOutbox posts the value to alex's outbox, returning the Location of the
+// new activity.
+func (e *env) postOutbox(doc map[string]interface{}) (string, error) {
+	w, err := e.do(http.MethodPost, alex+"/outbox", doc)
+	if err != nil {
+		return "", err
+	}
+	if w.Code != http.StatusCreated {
+		return "", fmt.Errorf("posting %s to the outbox: got %d, want 201: %s", doc["type"], w.Code, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if len(location) == 0 {
+		return "", errors.New("posting to the outbox: no Location header")
+	}
+	return location, nil
+}
+
+// get fetches the document at the IRI from the Actor, returning the status code
+// and the document, if any.
+func (e *env) get(iri string) (int, map[string]interface{}, error) {
+	w, err := e.do(http.MethodGet, iri, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	var doc map[string]interface{}
+	if w.Code == http.StatusOK || w.Code == http.StatusGone {
+		if err = json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+			return w.Code, nil, fmt.Errorf("fetching %s: %v", iri, err)
+		}
+	}
+	return w.Code, doc, nil
+}
+
+// getOK fetches the document at the IRI, which must exist.
+func (e *env) getOK(iri string) (map[string]interface{}, error) {
+	code, doc, err := e.get(iri)
+	if err != nil {
+		return nil, err
+	} else if code != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: got %d, want 200", iri, code)
+	}
+	return doc, nil
+}
+
+// items returns the ids of the items of the collection at the IRI, reading its
+// first page if its items are not inlined. Collections of the actor that are
+// not found, such as one nothing was ever added to, have no items.
+func (e *env) items(iri string) ([]string, error) {
+	code, doc, err := e.get(iri)
+	if err != nil {
+		return nil, err
+	} else if code == http.StatusNotFound {
+		return nil, nil
+	} else if code != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: got %d, want 200", iri, code)
+	}
+	if _, ok := doc["orderedItems"]; !ok {
+		if _, ok := doc["items"]; !ok {
+			if first := idOf(doc["first"]); len(first) > 0 {
+				if doc, err = e.getOK(first); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	var ids []string
+	for _, p := range []string{"orderedItems", "items"} {
+		for _, v := range values(doc[p]) {
+			ids = append(ids, idOf(v))
+		}
+	}
+	return ids, nil
+}
+
+// publish posts a Note addressed to the recipients to alex's outbox, returning
+// the ids of the Note and of its Create.
+func (e *env) publish(to ...string) (note, create string, err error) {
+	create, err = e.postOutbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"type":     "Note",
+		"content":  "Hello",
+		"to":       toValues(to),
+	})
+	if err != nil {
+		return
+	}
+	doc, err := e.getOK(create)
+	if err != nil {
+		return
+	}
+	note = idOf(doc["object"])
+	if len(note) == 0 {
+		err = fmt.Errorf("the Create %s has no object", create)
+	}
+	return
+}
+
+// follow has the peer follow alex, and clears the deliveries made in response.
+func (e *env) follow(peer string) error {
+	err := e.postInbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"id":       peer + "/follow/alex",
+		"type":     "Follow",
+		"actor":    peer,
+		"object":   alex,
+		"to":       alex,
+	})
+	e.mu.Lock()
+	e.deliveries = nil
+	e.mu.Unlock()
+	return err
+}
+
+// deliveredTo returns the activities delivered to the inbox.
+func (e *env) deliveredTo(inbox string) []map[string]interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var activities []map[string]interface{}
+	for _, d := range e.deliveries {
+		if d.to == inbox {
+			activities = append(activities, d.activity)
+		}
+	}
+	return activities
+}
+
+// Dereference fetches local IRIs from the Actor and remote IRIs from the
+// documents of the peers.
+func (e *env) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	var doc map[string]interface{}
+	if iri.Host == localHost {
+		code, d, err := e.get(iri.String())
+		if err != nil {
+			return nil, err
+		} else if code != http.StatusOK {
+			return nil, &pub.RemoteError{IRI: iri, StatusCode: code, Err: fmt.Errorf("GET %s: %d", iri, code)}
+		}
+		doc = d
+	} else if d, ok := e.remote[iri.String()]; ok {
+		doc = d
+	} else {
+		return nil, &pub.RemoteError{IRI: iri, StatusCode: http.StatusNotFound, Err: fmt.Errorf("GET %s: 404", iri)}
+	}
+	return json.Marshal(doc)
+}
+
+// Deliver records the delivery.
+func (e *env) Deliver(c context.Context, b []byte, to *url.URL) error {
+	var activity map[string]interface{}
+	if err := json.Unmarshal(b, &activity); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.deliveries = append(e.deliveries, delivery{to: to.String(), activity: activity})
+	return nil
+}
+
+// BatchDeliver records the delivery to each recipient.
+func (e *env) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	for _, to := range recipients {
+		if err := e.Deliver(c, b, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// values returns the values of a JSON property, which may be a single value or
+// an array.
+func values(v interface{}) []interface{} {
+	if a, ok := v.([]interface{}); ok {
+		return a
+	} else if v == nil {
+		return nil
+	}
+	return []interface{}{v}
+}
+
+// idOf returns the id of a JSON value, which is either an IRI or an object.
+func idOf(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case map[string]interface{}:
+		id, _ := t["id"].(string)
+		return id
+	}
+	return ""
+}
+
+// hasValue determines whether the JSON property holds the id.
+func hasValue(v interface{}, id string) bool {
+	for _, e := range values(v) {
+		if idOf(e) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// toValues returns the recipients as a JSON array.
+func toValues(to []string) []interface{} {
+	v := make([]interface{}, len(to))
+	for i, s := range to {
+		v[i] = s
+	}
+	return v
+}
+
+// clock is the pub.Clock of the Actor.
+type clock struct{}
+
+func (clock) Now() time.Time {
+	return time.Now()
+}
+
+// peerBehavior is the pub.CommonBehavior of the Actor, reaching the peers
+// through the environment.
+type peerBehavior struct {
+	pub.CommonBehavior
+	e *env
+}
+
+// NewTransport returns the environment, which simulates the peers.
+func (p peerBehavior) NewTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (pub.Transport, error) {
+	return p.e, nil
+}
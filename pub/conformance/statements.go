@@ -0,0 +1,599 @@
+package conformance
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// statements are the statements checked, in the order of the specification.
+var statements = []Statement{
+	{
+		ID:      "c2s-outbox-ordered-collection",
+		Spec:    C2S,
+		Level:   Must,
+		Section: "5.1",
+		Text:    "The outbox MUST be an OrderedCollection.",
+		check:   checkOrderedCollection("/outbox"),
+	},
+	{
+		ID:      "s2s-inbox-ordered-collection",
+		Spec:    S2S,
+		Level:   Must,
+		Section: "5.2",
+		Text:    "The inbox MUST be an OrderedCollection.",
+		check:   checkOrderedCollection("/inbox"),
+	},
+	{
+		ID:      "s2s-inbox-dedupe",
+		Spec:    S2S,
+		Level:   Must,
+		Section: "5.2",
+		Text:    "The server MUST perform de-duplication of activities returned by the inbox.",
+		check:   checkInboxDedupe,
+	},
+	{
+		ID:      "c2s-outbox-created",
+		Spec:    C2S,
+		Level:   Must,
+		Section: "6",
+		Text:    "Servers MUST respond to outbox posts with 201 Created and the id of the new activity in the Location header.",
+		check:   checkOutboxCreated,
+	},
+	{
+		ID:      "c2s-outbox-new-id",
+		Spec:    C2S,
+		Level:   Must,
+		Section: "6",
+		Text:    "Servers MUST ignore the id of a submitted activity and generate a new one.",
+		check:   checkOutboxNewId,
+	},
+	{
+		ID:      "c2s-wrap-in-create",
+		Spec:    C2S,
+		Level:   Must,
+		Section: "6.2.1",
+		Text:    "The server MUST wrap an object submitted without an activity in a Create.",
+		check:   checkWrapInCreate,
+	},
+	{
+		ID:      "c2s-delete-tombstone",
+		Spec:    C2S,
+		Level:   Should,
+		Section: "6.4",
+		Text:    "Requests for deleted objects SHOULD be responded to with 410 Gone and a Tombstone, or with 404 Not Found.",
+		check:   checkDeleteTombstone,
+	},
+	{
+		ID:      "c2s-follow-following-after-accept",
+		Spec:    C2S,
+		Level:   Should,
+		Section: "6.5",
+		Text:    "The object of a Follow SHOULD only be added to the following collection once the Follow is accepted.",
+		check:   checkFollowNotFollowingYet,
+	},
+	{
+		ID:      "c2s-like-liked",
+		Spec:    C2S,
+		Level:   Should,
+		Section: "6.8",
+		Text:    "The server SHOULD add the object of a Like to the actor's liked collection.",
+		check:   checkLikeLiked,
+	},
+	{
+		ID:      "c2s-block-not-delivered",
+		Spec:    C2S,
+		Level:   Should,
+		Section: "6.9",
+		Text:    "Servers SHOULD NOT deliver Block activities to their object.",
+		check:   checkBlockNotDelivered,
+	},
+	{
+		ID:      "s2s-deliver-to-collections",
+		Spec:    S2S,
+		Level:   Must,
+		Section: "7.1",
+		Text:    "The server MUST deliver to the members of the collections owned by the actor that are addressed, such as its followers.",
+		check:   checkDeliverToFollowers,
+	},
+	{
+		ID:      "s2s-strip-bto-bcc",
+		Spec:    S2S,
+		Level:   Must,
+		Section: "7.1",
+		Text:    "The server MUST remove bto and bcc before delivery, but MUST deliver to their recipients.",
+		check:   checkStripBtoBcc,
+	},
+	{
+		ID:      "s2s-forward-from-inbox",
+		Spec:    S2S,
+		Level:   Must,
+		Section: "7.1.2",
+		Text:    "Activities seen for the first time that address a collection owned by the server and reference an object it owns MUST be forwarded to the collection's members.",
+		check:   checkForwardFromInbox,
+	},
+	{
+		ID:      "s2s-forward-only-owned-objects",
+		Spec:    S2S,
+		Level:   Must,
+		Section: "7.1.2",
+		Text:    "Activities MUST only be forwarded from the inbox if they reference an object owned by the server.",
+		check:   checkForwardOnlyOwned,
+	},
+	{
+		ID:      "s2s-delete-removes-object",
+		Spec:    S2S,
+		Level:   Should,
+		Section: "7.4",
+		Text:    "The receiving server SHOULD remove its representation of an object deleted by its owner.",
+		check:   checkDeleteRemovesObject,
+	},
+	{
+		ID:      "s2s-follow-response",
+		Spec:    S2S,
+		Level:   Should,
+		Section: "7.5",
+		Text:    "The server SHOULD respond to a Follow with an Accept or Reject delivered to its actor.",
+		check:   checkFollowResponse,
+	},
+	{
+		ID:      "s2s-accept-following",
+		Spec:    S2S,
+		Level:   Should,
+		Section: "7.6",
+		Text:    "On an Accept of a Follow it sent, the server SHOULD add the accepting actor to the following collection.",
+		check:   checkAcceptFollowing,
+	},
+	{
+		ID:      "s2s-like-likes",
+		Spec:    S2S,
+		Level:   Should,
+		Section: "7.10",
+		Text:    "The server SHOULD add a Like of an object it owns to the object's likes collection.",
+		check:   checkLikeLikes,
+	},
+}
+
+// checkOrderedCollection checks the type of alex's box with the path suffix.
+func checkOrderedCollection(suffix string) func(e *env) error {
+	return func(e *env) error {
+		doc, err := e.getOK(alex + suffix)
+		if err != nil {
+			return err
+		}
+		if doc["type"] != "OrderedCollection" {
+			return fmt.Errorf("got type %v, want OrderedCollection", doc["type"])
+		}
+		return nil
+	}
+}
+
+// remoteCreate returns a Create by sam of a Note, addressed to the recipients.
+func remoteCreate(n int, to []string, note map[string]interface{}) map[string]interface{} {
+	id := fmt.Sprintf("%s/note/%d", sam, n)
+	note["id"] = id
+	note["type"] = "Note"
+	note["attributedTo"] = sam
+	note["content"] = "Hi"
+	return map[string]interface{}{
+		"@context": activityStreamsContext,
+		"id":       id + "/activity",
+		"type":     "Create",
+		"actor":    sam,
+		"object":   note,
+		"to":       toValues(to),
+	}
+}
+
+func checkInboxDedupe(e *env) error {
+	create := remoteCreate(1, []string{alex}, map[string]interface{}{})
+	for i := 0; i < 2; i++ {
+		if err := e.postInbox(create); err != nil {
+			return err
+		}
+	}
+	items, err := e.items(alex + "/inbox")
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, id := range items {
+		if id == create["id"] {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("the inbox holds an activity delivered twice %d times", n)
+	}
+	return nil
+}
+
+func checkOutboxCreated(e *env) error {
+	location, err := e.postOutbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"type":     "Create",
+		"actor":    alex,
+		"object": map[string]interface{}{
+			"type":    "Note",
+			"content": "Hello",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	doc, err := e.getOK(location)
+	if err != nil {
+		return err
+	}
+	if doc["id"] != location {
+		return fmt.Errorf("the Location %s serves the document of %v", location, doc["id"])
+	}
+	return nil
+}
+
+func checkOutboxNewId(e *env) error {
+	submitted := alex + "/chosen-by-client"
+	location, err := e.postOutbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"id":       submitted,
+		"type":     "Create",
+		"actor":    alex,
+		"object": map[string]interface{}{
+			"type":    "Note",
+			"content": "Hello",
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if location == submitted {
+		return fmt.Errorf("the activity kept the submitted id %s", submitted)
+	}
+	return nil
+}
+
+func checkWrapInCreate(e *env) error {
+	note, create, err := e.publish(sam)
+	if err != nil {
+		return err
+	}
+	doc, err := e.getOK(create)
+	if err != nil {
+		return err
+	}
+	if doc["type"] != "Create" {
+		return fmt.Errorf("got a %v, want a Create", doc["type"])
+	}
+	if _, err = e.getOK(note); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkDeleteTombstone(e *env) error {
+	note, _, err := e.publish(sam)
+	if err != nil {
+		return err
+	}
+	if _, err = e.postOutbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"type":     "Delete",
+		"actor":    alex,
+		"object":   note,
+		"to":       sam,
+	}); err != nil {
+		return err
+	}
+	code, doc, err := e.get(note)
+	if err != nil {
+		return err
+	}
+	switch {
+	case code == http.StatusNotFound:
+		return nil
+	case code != http.StatusGone:
+		return fmt.Errorf("got %d for the deleted object, want 410 or 404", code)
+	case doc["type"] != "Tombstone":
+		return fmt.Errorf("got a %v with 410 Gone, want a Tombstone", doc["type"])
+	}
+	return nil
+}
+
+// sendFollow has alex follow sam, returning the id of the Follow.
+func sendFollow(e *env) (string, error) {
+	return e.postOutbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"type":     "Follow",
+		"actor":    alex,
+		"object":   sam,
+		"to":       sam,
+	})
+}
+
+func checkFollowNotFollowingYet(e *env) error {
+	if _, err := sendFollow(e); err != nil {
+		return err
+	}
+	following, err := e.items(alex + "/following")
+	if err != nil {
+		return err
+	}
+	for _, id := range following {
+		if id == sam {
+			return fmt.Errorf("the followed actor is in the following collection before accepting")
+		}
+	}
+	return nil
+}
+
+func checkLikeLiked(e *env) error {
+	note := sam + "/note/1"
+	if _, err := e.postOutbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"type":     "Like",
+		"actor":    alex,
+		"object":   note,
+		"to":       sam,
+	}); err != nil {
+		return err
+	}
+	liked, err := e.items(alex + "/liked")
+	if err != nil {
+		return err
+	}
+	for _, id := range liked {
+		if id == note {
+			return nil
+		}
+	}
+	return fmt.Errorf("the liked collection does not contain %s", note)
+}
+
+func checkBlockNotDelivered(e *env) error {
+	if _, err := e.postOutbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"type":     "Block",
+		"actor":    alex,
+		"object":   sam,
+		"to":       sam,
+	}); err != nil {
+		return err
+	}
+	if n := len(e.deliveredTo(sam + "/inbox")); n > 0 {
+		return fmt.Errorf("the Block was delivered to its object")
+	}
+	return nil
+}
+
+func checkDeliverToFollowers(e *env) error {
+	if err := e.follow(sam); err != nil {
+		return err
+	}
+	_, create, err := e.publish(alex + "/followers")
+	if err != nil {
+		return err
+	}
+	for _, a := range e.deliveredTo(sam + "/inbox") {
+		if a["id"] == create {
+			return nil
+		}
+	}
+	return fmt.Errorf("the activity was not delivered to a follower")
+}
+
+func checkStripBtoBcc(e *env) error {
+	location, err := e.postOutbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"type":     "Create",
+		"actor":    alex,
+		"bto":      sam,
+		"bcc":      kai,
+		"object": map[string]interface{}{
+			"type":    "Note",
+			"content": "Hello",
+			"bto":     sam,
+			"bcc":     kai,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, inbox := range []string{sam + "/inbox", kai + "/inbox"} {
+		var found bool
+		for _, a := range e.deliveredTo(inbox) {
+			if a["id"] != location {
+				continue
+			}
+			found = true
+			if _, ok := a["bto"]; ok {
+				return fmt.Errorf("the activity delivered has bto")
+			} else if _, ok := a["bcc"]; ok {
+				return fmt.Errorf("the activity delivered has bcc")
+			}
+			if obj, ok := a["object"].(map[string]interface{}); ok {
+				if _, ok := obj["bto"]; ok {
+					return fmt.Errorf("the object delivered has bto")
+				} else if _, ok := obj["bcc"]; ok {
+					return fmt.Errorf("the object delivered has bcc")
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("the activity was not delivered to %s", inbox)
+		}
+	}
+	return nil
+}
+
+// forwardReply has kai follow alex and sam deliver to alex and its followers a
+// Note replying to a Note of alex, returning the id of the Create.
+func forwardReply(e *env) (string, error) {
+	if err := e.follow(kai); err != nil {
+		return "", err
+	}
+	original, _, err := e.publish(kai)
+	if err != nil {
+		return "", err
+	}
+	create := remoteCreate(1, []string{alex, alex + "/followers"}, map[string]interface{}{
+		"inReplyTo": original,
+	})
+	if err := e.postInbox(create); err != nil {
+		return "", err
+	}
+	return create["id"].(string), nil
+}
+
+// forwarded determines whether the activity was forwarded to kai.
+func forwarded(e *env, id string) bool {
+	for _, a := range e.deliveredTo(kai + "/inbox") {
+		if a["id"] == id {
+			return true
+		}
+	}
+	return false
+}
+
+func checkForwardFromInbox(e *env) error {
+	id, err := forwardReply(e)
+	if err != nil {
+		return err
+	}
+	if !forwarded(e, id) {
+		return fmt.Errorf("the activity was not forwarded to a follower")
+	}
+	return nil
+}
+
+// checkForwardOnlyOwned first checks that an activity referencing a local
+// object is forwarded, since otherwise nothing being forwarded proves nothing.
+func checkForwardOnlyOwned(e *env) error {
+	if err := checkForwardFromInbox(e); err != nil {
+		return skipf("activities referencing local objects are not forwarded either: %v", err)
+	}
+	create := remoteCreate(2, []string{alex, alex + "/followers"}, map[string]interface{}{})
+	if err := e.postInbox(create); err != nil {
+		return err
+	}
+	if forwarded(e, create["id"].(string)) {
+		return fmt.Errorf("an activity referencing no local object was forwarded")
+	}
+	return nil
+}
+
+func checkDeleteRemovesObject(e *env) error {
+	create := remoteCreate(1, []string{alex}, map[string]interface{}{})
+	if err := e.postInbox(create); err != nil {
+		return err
+	}
+	note := mustParse(create["object"].(map[string]interface{})["id"].(string))
+	if exists, err := e.db.Exists(e.c, note); err != nil {
+		return err
+	} else if !exists {
+		return skipf("the server does not store objects delivered to it")
+	}
+	if err := e.postInbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"id":       sam + "/delete/1",
+		"type":     "Delete",
+		"actor":    sam,
+		"object":   note.String(),
+		"to":       alex,
+	}); err != nil {
+		return err
+	}
+	if exists, err := e.db.Exists(e.c, note); err != nil {
+		return err
+	} else if exists {
+		t, err := e.db.Get(e.c, note)
+		if err != nil {
+			return err
+		}
+		if t.GetTypeName() != "Tombstone" {
+			return fmt.Errorf("the deleted object is still stored as a %s", t.GetTypeName())
+		}
+	}
+	return nil
+}
+
+func checkFollowResponse(e *env) error {
+	follow := sam + "/follow/alex"
+	if err := e.postInbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"id":       follow,
+		"type":     "Follow",
+		"actor":    sam,
+		"object":   alex,
+		"to":       alex,
+	}); err != nil {
+		return err
+	}
+	for _, a := range e.deliveredTo(sam + "/inbox") {
+		if (a["type"] == "Accept" || a["type"] == "Reject") && hasValue(a["object"], follow) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no Accept or Reject of the Follow was delivered to its actor")
+}
+
+func checkAcceptFollowing(e *env) error {
+	follow, err := sendFollow(e)
+	if err != nil {
+		return err
+	}
+	if err = e.postInbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"id":       sam + "/accept/1",
+		"type":     "Accept",
+		"actor":    sam,
+		"object":   follow,
+		"to":       alex,
+	}); err != nil {
+		return err
+	}
+	following, err := e.items(alex + "/following")
+	if err != nil {
+		return err
+	}
+	for _, id := range following {
+		if id == sam {
+			return nil
+		}
+	}
+	return fmt.Errorf("the following collection does not contain the accepting actor")
+}
+
+func checkLikeLikes(e *env) error {
+	note, _, err := e.publish(sam)
+	if err != nil {
+		return err
+	}
+	like := sam + "/like/1"
+	if err = e.postInbox(map[string]interface{}{
+		"@context": activityStreamsContext,
+		"id":       like,
+		"type":     "Like",
+		"actor":    sam,
+		"object":   note,
+		"to":       alex,
+	}); err != nil {
+		return err
+	}
+	doc, err := e.getOK(note)
+	if err != nil {
+		return err
+	}
+	likes, ok := doc["likes"]
+	if !ok {
+		return fmt.Errorf("the liked object has no likes collection")
+	}
+	if likesId, ok := likes.(string); ok {
+		if likes, err = e.getOK(likesId); err != nil {
+			return err
+		}
+	}
+	col, _ := likes.(map[string]interface{})
+	if !hasValue(col["items"], like) && !hasValue(col["orderedItems"], like) {
+		return fmt.Errorf("the likes collection does not contain the Like")
+	}
+	return nil
+}
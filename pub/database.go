@@ -29,17 +29,27 @@ type Database interface {
 	//
 	// The library makes this call only after acquiring a lock first.
 	InboxContains(c context.Context, inbox, id *url.URL) (contains bool, err error)
-	// GetInbox returns the first ordered collection page of the outbox at
-	// the specified IRI, for prepending new items.
+	// AppendInbox adds the id to the OrderedCollection at 'inbox' as its
+	// most recent item. Note that the item must not be added as an
+	// independent database entry. Separate calls to Create will do that.
 	//
 	// The library makes this call only after acquiring a lock first.
-	GetInbox(c context.Context, inboxIRI *url.URL) (inbox vocab.ActivityStreamsOrderedCollectionPage, err error)
-	// SetInbox saves the inbox value given from GetInbox, with new items
-	// prepended. Note that the new items must not be added as independent
-	// database entries. Separate calls to Create will do that.
+	AppendInbox(c context.Context, inbox, id *url.URL) error
+	// InboxTotalItems returns the number of items in the OrderedCollection
+	// at 'inbox'.
 	//
 	// The library makes this call only after acquiring a lock first.
-	SetInbox(c context.Context, inbox vocab.ActivityStreamsOrderedCollectionPage) error
+	InboxTotalItems(c context.Context, inbox *url.URL) (n int, err error)
+	// GetInboxPage returns a page of the ids in the OrderedCollection at
+	// 'inbox', most recent first, holding at most the query's Limit. The
+	// cursors of the pages before and after it are opaque to the library,
+	// which only returns them in later queries.
+	//
+	// The context is the one returned by AuthenticateGetInbox, so the
+	// implementation may omit items not visible to the requester.
+	//
+	// The library makes this call only after acquiring a lock first.
+	GetInboxPage(c context.Context, inbox *url.URL, q PageQuery) (page CollectionPage, err error)
 	// Owns returns true if the database has an entry for the IRI and it
 	// exists in the database.
 	//
@@ -104,17 +114,27 @@ type Database interface {
 	//
 	// The library makes this call only after acquiring a lock first.
 	Delete(c context.Context, id *url.URL) error
-	// GetOutbox returns the first ordered collection page of the outbox
-	// at the specified IRI, for prepending new items.
+	// AppendOutbox adds the id to the OrderedCollection at 'outbox' as its
+	// most recent item. Note that the item must not be added as an
+	// independent database entry. Separate calls to Create will do that.
+	//
+	// The library makes this call only after acquiring a lock first.
+	AppendOutbox(c context.Context, outbox, id *url.URL) error
+	// OutboxTotalItems returns the number of items in the
+	// OrderedCollection at 'outbox'.
 	//
 	// The library makes this call only after acquiring a lock first.
-	GetOutbox(c context.Context, outboxIRI *url.URL) (outbox vocab.ActivityStreamsOrderedCollectionPage, err error)
-	// SetOutbox saves the outbox value given from GetOutbox, with new items
-	// prepended. Note that the new items must not be added as independent
-	// database entries. Separate calls to Create will do that.
+	OutboxTotalItems(c context.Context, outbox *url.URL) (n int, err error)
+	// GetOutboxPage returns a page of the ids in the OrderedCollection at
+	// 'outbox', most recent first, holding at most the query's Limit. The
+	// cursors of the pages before and after it are opaque to the library,
+	// which only returns them in later queries.
+	//
+	// The context is the one returned by AuthenticateGetOutbox, so the
+	// implementation may omit items not visible to the requester.
 	//
 	// The library makes this call only after acquiring a lock first.
-	SetOutbox(c context.Context, outbox vocab.ActivityStreamsOrderedCollectionPage) error
+	GetOutboxPage(c context.Context, outbox *url.URL, q PageQuery) (page CollectionPage, err error)
 	// NewID creates a new IRI id for the provided activity or object. The
 	// implementation does not need to set the 'id' property and simply
 	// needs to determine the value.
@@ -144,3 +164,81 @@ type Database interface {
 	// The library makes this call only after acquiring a lock first.
 	Liked(c context.Context, actorIRI *url.URL) (liked vocab.ActivityStreamsCollection, err error)
 }
+
+// TxDatabase is a Database that groups the library's reads and writes into
+// transactions, such as one backed by a SQL store.
+//
+// When the Database given to the library implements TxDatabase, the
+// side-effect actor begins a transaction for each of its operations in place
+// of taking locks: Lock and Unlock are never called on the Tx. Instead, the
+// transaction must provide the isolation the locks would have, for example
+// with a serializable isolation level or unique constraints.
+//
+// Transactions are never open while the library waits on peers. When an
+// operation dereferences a value it has not fetched yet, its transaction is
+// rolled back, the value is fetched, and the operation is tried again in a new
+// transaction. It is also tried again when a Tx method, including Commit,
+// returns an error satisfying errors.Is(err, ErrTxConflict). Deliveries are made once the transaction is committed, and the
+// recipients of deliveries are determined by reading the TxDatabase outside of
+// any transaction, with Lock and Unlock, as they require dereferencing peers.
+//
+// Since an operation may be tried more than once, the callbacks it calls, such
+// as the FederatingWrappedCallbacks, SocialWrappedCallbacks, and those of the
+// application, may run more than once for one activity. Their effects on
+// anything other than the Tx they are given must be safe to repeat, or be
+// deferred until the operation returns.
+type TxDatabase interface {
+	Database
+	// Begin starts a new transaction. If an error is returned, no
+	// transaction must have been started.
+	Begin(c context.Context) (Tx, error)
+}
+
+// Tx is a transaction begun by a TxDatabase. Its read and write methods
+// behave as the Database methods of the same name, but are only visible to
+// others once Commit succeeds.
+type Tx interface {
+	// Commit makes the transaction's writes visible. The transaction is
+	// finished even if an error is returned.
+	Commit(c context.Context) error
+	// Rollback discards the transaction's writes. The transaction is
+	// finished even if an error is returned.
+	Rollback(c context.Context) error
+	InboxContains(c context.Context, inbox, id *url.URL) (contains bool, err error)
+	AppendInbox(c context.Context, inbox, id *url.URL) error
+	InboxTotalItems(c context.Context, inbox *url.URL) (n int, err error)
+	GetInboxPage(c context.Context, inbox *url.URL, q PageQuery) (page CollectionPage, err error)
+	Owns(c context.Context, id *url.URL) (owns bool, err error)
+	ActorForOutbox(c context.Context, outboxIRI *url.URL) (actorIRI *url.URL, err error)
+	ActorForInbox(c context.Context, inboxIRI *url.URL) (actorIRI *url.URL, err error)
+	OutboxForInbox(c context.Context, inboxIRI *url.URL) (outboxIRI *url.URL, err error)
+	InboxForActor(c context.Context, actorIRI *url.URL) (inboxIRI *url.URL, err error)
+	Exists(c context.Context, id *url.URL) (exists bool, err error)
+	Get(c context.Context, id *url.URL) (value vocab.Type, err error)
+	Create(c context.Context, asType vocab.Type) error
+	Update(c context.Context, asType vocab.Type) error
+	Delete(c context.Context, id *url.URL) error
+	AppendOutbox(c context.Context, outbox, id *url.URL) error
+	OutboxTotalItems(c context.Context, outbox *url.URL) (n int, err error)
+	GetOutboxPage(c context.Context, outbox *url.URL, q PageQuery) (page CollectionPage, err error)
+	NewID(c context.Context, t vocab.Type) (id *url.URL, err error)
+	Followers(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error)
+	Following(c context.Context, actorIRI *url.URL) (following vocab.ActivityStreamsCollection, err error)
+	Liked(c context.Context, actorIRI *url.URL) (liked vocab.ActivityStreamsCollection, err error)
+}
+
+// txDatabase adapts a Tx to a Database whose locks are no-ops, as the
+// transaction provides the isolation instead.
+type txDatabase struct {
+	Tx
+}
+
+// Lock does nothing within a transaction.
+func (txDatabase) Lock(c context.Context, id *url.URL) error {
+	return nil
+}
+
+// Unlock does nothing within a transaction.
+func (txDatabase) Unlock(c context.Context, id *url.URL) error {
+	return nil
+}
@@ -124,8 +124,9 @@ type DelegateActor interface {
 	// later) must decide whether it has seen this activity before in order
 	// to determine whether to do the forwarding algorithm.
 	//
-	// If the error is ErrObjectRequired or ErrTargetRequired, then a Bad
-	// Request status is sent in the response.
+	// If the error is a client error, such as ErrObjectRequired,
+	// ErrTargetRequired, or any MalformedError or ForbiddenError, then its
+	// suggested status is sent in the response.
 	PostInbox(c context.Context, inboxIRI *url.URL, activity Activity) error
 	// InboxForwarding delegates inbox forwarding logic when a POST request
 	// is received in the Actor's inbox.
@@ -157,8 +158,9 @@ type DelegateActor interface {
 	// general storage for independent retrieval, and not just within the
 	// actor's outbox.
 	//
-	// If the error is ErrObjectRequired or ErrTargetRequired, then a Bad
-	// Request status is sent in the response.
+	// If the error is a client error, such as ErrObjectRequired,
+	// ErrTargetRequired, or any MalformedError or ForbiddenError, then its
+	// suggested status is sent in the response.
 	//
 	// Note that 'rawJSON' is an unfortunate consequence where an 'Update'
 	// Activity is the only one that explicitly cares about 'null' values in
@@ -227,22 +229,24 @@ type DelegateActor interface {
 	//
 	// Only called if the Social API is enabled.
 	WrapInCreate(c context.Context, value vocab.Type, outboxIRI *url.URL) (vocab.ActivityStreamsCreate, error)
-	// GetOutbox returns the OrderedCollection inbox of the actor for this
-	// context. It is up to the implementation to provide the correct
-	// collection for the kind of authorization given in the request.
+	// GetOutbox returns the OrderedCollection outbox at the IRI, or the
+	// OrderedCollectionPage of it selected by the "page" query parameter
+	// of the request. It is up to the implementation to provide the
+	// correct items for the kind of authorization given in the request.
 	//
 	// AuthenticateGetOutbox will be called prior to this.
 	//
 	// Always called, regardless whether the Federated Protocol or Social
 	// API is enabled.
-	GetOutbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error)
-	// GetInbox returns the OrderedCollection inbox of the actor for this
-	// context. It is up to the implementation to provide the correct
-	// collection for the kind of authorization given in the request.
+	GetOutbox(c context.Context, outboxIRI *url.URL, r *http.Request) (vocab.Type, error)
+	// GetInbox returns the OrderedCollection inbox at the IRI, or the
+	// OrderedCollectionPage of it selected by the "page" query parameter
+	// of the request. It is up to the implementation to provide the
+	// correct items for the kind of authorization given in the request.
 	//
 	// AuthenticateGetInbox will be called prior to this.
 	//
 	// Always called, regardless whether the Federated Protocol or Social
 	// API is enabled.
-	GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error)
+	GetInbox(c context.Context, inboxIRI *url.URL, r *http.Request) (vocab.Type, error)
 }
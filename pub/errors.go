@@ -0,0 +1,215 @@
+package pub
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+var (
+	// ErrObjectRequired indicates the activity needs its object property
+	// set. Can be returned by DelegateActor's PostInbox or PostOutbox so a
+	// Bad Request response is set.
+	ErrObjectRequired error = &MalformedError{Err: errors.New("object property required on the provided activity")}
+	// ErrTargetRequired indicates the activity needs its target property
+	// set. Can be returned by DelegateActor's PostInbox or PostOutbox so a
+	// Bad Request response is set.
+	ErrTargetRequired error = &MalformedError{Err: errors.New("target property required on the provided activity")}
+	// ErrNotFound indicates the requested ActivityStreams data does not
+	// exist.
+	ErrNotFound error = &NotFoundError{Err: errors.New("go-fed/activity: ActivityStreams data not found")}
+	// ErrTxConflict indicates a transaction of a TxDatabase conflicted with
+	// a concurrent one, for example by failing to serialize or by
+	// deadlocking. A Tx returns an error satisfying
+	// errors.Is(err, ErrTxConflict) so that the operation is tried again in
+	// a new transaction.
+	ErrTxConflict = errors.New("go-fed/activity: transaction conflicts with a concurrent one")
+)
+
+// HTTPStatuser is an error that suggests the HTTP status code to respond with
+// when a request fails because of it.
+//
+// All error types in this package implement it. Applications may implement it
+// in their own errors returned to this library, for example from the Database.
+type HTTPStatuser interface {
+	error
+	// HTTPStatus returns the suggested HTTP status code.
+	HTTPStatus() int
+}
+
+var (
+	// HTTPStatuser must be implemented by the error types.
+	_ HTTPStatuser = &MalformedError{}
+	_ HTTPStatuser = &ForbiddenError{}
+	_ HTTPStatuser = &NotFoundError{}
+	_ HTTPStatuser = &RemoteError{}
+	_ HTTPStatuser = &DatabaseError{}
+)
+
+// MalformedError indicates an activity or request is invalid, such as missing
+// required properties. Retrying the same request will not succeed.
+//
+// It suggests the http.StatusBadRequest status code.
+type MalformedError struct {
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the underlying error.
+func (e *MalformedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *MalformedError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns http.StatusBadRequest.
+func (e *MalformedError) HTTPStatus() int {
+	return http.StatusBadRequest
+}
+
+// ForbiddenError indicates a well-formed activity or request is not permitted,
+// such as a peer attempting to modify data it does not own.
+//
+// It suggests the http.StatusForbidden status code.
+type ForbiddenError struct {
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the underlying error.
+func (e *ForbiddenError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ForbiddenError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns http.StatusForbidden.
+func (e *ForbiddenError) HTTPStatus() int {
+	return http.StatusForbidden
+}
+
+// NotFoundError indicates the requested data does not exist.
+//
+// It suggests the http.StatusNotFound status code.
+type NotFoundError struct {
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the underlying error.
+func (e *NotFoundError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *NotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns http.StatusNotFound.
+func (e *NotFoundError) HTTPStatus() int {
+	return http.StatusNotFound
+}
+
+// RemoteError indicates a request to a federated peer failed, either because
+// the peer could not be reached or because it responded with an unsuccessful
+// status code.
+//
+// It suggests the http.StatusBadGateway status code.
+type RemoteError struct {
+	// IRI is the IRI the request was sent to. It is nil if the error
+	// concerns requests to many IRIs.
+	IRI *url.URL
+	// StatusCode is the status code the peer responded with, or zero if no
+	// response was received.
+	StatusCode int
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the underlying error.
+func (e *RemoteError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *RemoteError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns http.StatusBadGateway.
+func (e *RemoteError) HTTPStatus() int {
+	return http.StatusBadGateway
+}
+
+// DatabaseError indicates the Database failed. Database implementations may
+// wrap their errors with it, though any error without a suggested status code
+// is treated the same way.
+//
+// It suggests the http.StatusInternalServerError status code.
+type DatabaseError struct {
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the message of the underlying error.
+func (e *DatabaseError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *DatabaseError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns http.StatusInternalServerError.
+func (e *DatabaseError) HTTPStatus() int {
+	return http.StatusInternalServerError
+}
+
+// ErrorStatusCode determines the HTTP status code to respond with for an error
+// returned by this library.
+//
+// Errors that are or wrap an HTTPStatuser map to their suggested status code.
+// All other errors map to http.StatusInternalServerError.
+func ErrorStatusCode(err error) int {
+	var s HTTPStatuser
+	if errors.As(err, &s) {
+		return s.HTTPStatus()
+	}
+	return http.StatusInternalServerError
+}
+
+// isClientError returns true if the error is the fault of the sender of the
+// request, and retrying the same request will not succeed.
+func isClientError(err error) bool {
+	code := ErrorStatusCode(err)
+	return code >= 400 && code < 500
+}
+
+// writeClientError writes the status code of a client error as the response,
+// returning true if it did. Other errors are left for the caller to handle.
+func writeClientError(w http.ResponseWriter, err error) bool {
+	if err == nil || !isClientError(err) {
+		return false
+	}
+	w.WriteHeader(ErrorStatusCode(err))
+	return true
+}
+
+// malformedf creates a MalformedError with a formatted message.
+func malformedf(format string, a ...interface{}) error {
+	return &MalformedError{Err: fmt.Errorf(format, a...)}
+}
+
+// forbiddenf creates a ForbiddenError with a formatted message.
+func forbiddenf(format string, a ...interface{}) error {
+	return &ForbiddenError{Err: fmt.Errorf(format, a...)}
+}
@@ -0,0 +1,118 @@
+package pub
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/go-fed/activity/streams"
+)
+
+// TestErrorStatusCode tests mapping errors to HTTP status codes.
+func TestErrorStatusCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    error
+		expected int
+	}{
+		{
+			"Not Found",
+			ErrNotFound,
+			http.StatusNotFound,
+		},
+		{
+			"Object Required",
+			ErrObjectRequired,
+			http.StatusBadRequest,
+		},
+		{
+			"Target Required",
+			ErrTargetRequired,
+			http.StatusBadRequest,
+		},
+		{
+			"Malformed",
+			&MalformedError{Err: testErr},
+			http.StatusBadRequest,
+		},
+		{
+			"Forbidden",
+			&ForbiddenError{Err: testErr},
+			http.StatusForbidden,
+		},
+		{
+			"Remote",
+			&RemoteError{Err: testErr},
+			http.StatusBadGateway,
+		},
+		{
+			"Database",
+			&DatabaseError{Err: testErr},
+			http.StatusInternalServerError,
+		},
+		{
+			"Wrapped",
+			fmt.Errorf("wrapped: %w", &ForbiddenError{Err: testErr}),
+			http.StatusForbidden,
+		},
+		{
+			"Other Error",
+			testErr,
+			http.StatusInternalServerError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := ErrorStatusCode(test.input); actual != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+// TestErrorTypes tests the error types are compatible with errors.Is and
+// errors.As.
+func TestErrorTypes(t *testing.T) {
+	t.Run("UnwrapsUnderlyingError", func(t *testing.T) {
+		// Setup
+		err := fmt.Errorf("wrapped: %w", &RemoteError{
+			IRI:        mustParse(testFederatedInboxIRI),
+			StatusCode: http.StatusServiceUnavailable,
+			Err:        testErr,
+		})
+		// Run & Verify
+		assertEqual(t, errors.Is(err, testErr), true)
+		var remote *RemoteError
+		assertEqual(t, errors.As(err, &remote), true)
+		assertEqual(t, remote.IRI.String(), testFederatedInboxIRI)
+		assertEqual(t, remote.StatusCode, http.StatusServiceUnavailable)
+		assertEqual(t, err.Error(), "wrapped: "+testErr.Error())
+	})
+	t.Run("SentinelsAreTyped", func(t *testing.T) {
+		// Setup
+		var malformed *MalformedError
+		var notFound *NotFoundError
+		// Run & Verify
+		assertEqual(t, errors.Is(fmt.Errorf("wrapped: %w", ErrObjectRequired), ErrObjectRequired), true)
+		assertEqual(t, errors.As(ErrTargetRequired, &malformed), true)
+		assertEqual(t, errors.As(ErrNotFound, &notFound), true)
+	})
+	t.Run("LibraryErrorsAreTyped", func(t *testing.T) {
+		// Setup
+		var malformed *MalformedError
+		var forbidden *ForbiddenError
+		// Run & Verify
+		_, err := GetId(streams.NewActivityStreamsNote())
+		assertEqual(t, errors.As(err, &malformed), true)
+		create := streams.NewActivityStreamsCreate()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse("https://example.com/activity/1"))
+		create.SetJSONLDId(id)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendIRI(mustParse("https://other.example.com/note/1"))
+		create.SetActivityStreamsObject(op)
+		err = mustHaveActivityOriginMatchObjects(create)
+		assertEqual(t, errors.As(err, &forbidden), true)
+	})
+}
@@ -0,0 +1,99 @@
+package pub
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ExpvarObserver is an Observer counting what an Actor does in an expvar.Map,
+// which makes the counts available at the "/debug/vars" endpoint of
+// applications serving expvar.Handler.
+//
+// The counters of requests are named after the box and method, such as
+// "inbox.POST.requests", "inbox.POST.unauthenticated", "inbox.POST.errors",
+// and "inbox.POST.nanos", the total time spent handling them. The counters of
+// side effects are named after the box and the type of activity, such as
+// "inbox.sideEffects.Create" and "inbox.sideEffectErrors.Create". Forwarding
+// decisions are counted in "forwarded" and "notForwarded", and calls to
+// Transports in "deliveries", "deliveryErrors", "deliveryNanos",
+// "dereferences", "dereferenceErrors", and "dereferenceNanos".
+type ExpvarObserver struct {
+	NoopObserver
+	m *expvar.Map
+}
+
+// ExpvarObserver is an Observer.
+var _ Observer = &ExpvarObserver{}
+
+// NewExpvarObserver returns an ExpvarObserver counting in the map, such as one
+// created with expvar.NewMap("gofed").
+func NewExpvarObserver(m *expvar.Map) *ExpvarObserver {
+	return &ExpvarObserver{m: m}
+}
+
+// requestKey returns the name of a counter of the requests to the box.
+func requestKey(box Box, r *http.Request, name string) string {
+	return string(box) + "." + r.Method + "." + name
+}
+
+// RequestReceived counts the request.
+func (o *ExpvarObserver) RequestReceived(c context.Context, box Box, r *http.Request) context.Context {
+	o.m.Add(requestKey(box, r, "requests"), 1)
+	return c
+}
+
+// RequestAuthenticated counts the request if it is not authenticated.
+func (o *ExpvarObserver) RequestAuthenticated(c context.Context, box Box, r *http.Request, authenticated bool) {
+	if !authenticated {
+		o.m.Add(requestKey(box, r, "unauthenticated"), 1)
+	}
+}
+
+// RequestHandled adds the duration of the request, and counts it if it failed.
+func (o *ExpvarObserver) RequestHandled(c context.Context, box Box, r *http.Request, d time.Duration, err error) {
+	o.m.Add(requestKey(box, r, "nanos"), int64(d))
+	if err != nil {
+		o.m.Add(requestKey(box, r, "errors"), 1)
+	}
+}
+
+// SideEffectRun counts the side effects of the activity, and whether they
+// failed.
+func (o *ExpvarObserver) SideEffectRun(c context.Context, box Box, activityType string, d time.Duration, err error) {
+	o.m.Add(string(box)+".sideEffects."+activityType, 1)
+	if err != nil {
+		o.m.Add(string(box)+".sideEffectErrors."+activityType, 1)
+	}
+}
+
+// ForwardingDecided counts whether the activity is forwarded.
+func (o *ExpvarObserver) ForwardingDecided(c context.Context, activity *url.URL, recipients []*url.URL) {
+	if len(recipients) > 0 {
+		o.m.Add("forwarded", 1)
+	} else {
+		o.m.Add("notForwarded", 1)
+	}
+}
+
+// DeliveryFinished counts the deliveries to each recipient, adds their
+// duration, and counts the failure of the delivery.
+func (o *ExpvarObserver) DeliveryFinished(c context.Context, recipients []*url.URL, d time.Duration, err error) {
+	o.m.Add("deliveries", int64(len(recipients)))
+	o.m.Add("deliveryNanos", int64(d))
+	if err != nil {
+		o.m.Add("deliveryErrors", 1)
+	}
+}
+
+// DereferenceFinished counts the dereference, adds its duration, and counts its
+// failure.
+func (o *ExpvarObserver) DereferenceFinished(c context.Context, iri *url.URL, d time.Duration, err error) {
+	o.m.Add("dereferences", 1)
+	o.m.Add("dereferenceNanos", int64(d))
+	if err != nil {
+		o.m.Add("dereferenceErrors", 1)
+	}
+}
@@ -2,7 +2,6 @@ package pub
 
 import (
 	"context"
-	"github.com/go-fed/activity/streams/vocab"
 	"net/http"
 	"net/url"
 )
@@ -112,13 +111,4 @@ type FederatingProtocol interface {
 	// The activity is provided as a reference for more intelligent
 	// logic to be used, but the implementation must not modify it.
 	FilterForwarding(c context.Context, potentialRecipients []*url.URL, a Activity) (filteredRecipients []*url.URL, err error)
-	// GetInbox returns the OrderedCollection inbox of the actor for this
-	// context. It is up to the implementation to provide the correct
-	// collection for the kind of authorization given in the request.
-	//
-	// AuthenticateGetInbox will be called prior to this.
-	//
-	// Always called, regardless whether the Federated Protocol or Social
-	// API is enabled.
-	GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error)
 }
@@ -123,6 +123,25 @@ type FederatingWrappedCallbacks struct {
 	// received from a federated peer, as delivering Blocks explicitly
 	// deviates from the original ActivityPub specification.
 	Block func(context.Context, vocab.ActivityStreamsBlock) error
+	// Relay makes the actor of this inbox act as a LitePub or Mastodon
+	// relay.
+	//
+	// A Follow of the Public collection is then treated as a Follow of the
+	// actor, subscribing the sending server according to OnFollow. Each
+	// public Create, Update, Delete, or Announce delivered by a subscribed
+	// server is Announced to the shared inboxes of the other subscribed
+	// servers. The Announce is added to the outbox, and delivered in the
+	// background once the side effects are committed.
+	Relay bool
+	// Relays are the relays the actor of this inbox subscribed to by
+	// sending the Follow created by NewRelayFollow.
+	//
+	// The objects of their Announces are fetched again from their origin,
+	// since a relay cannot vouch for what other servers sent it. Announced
+	// Update and Delete activities have the side effects of the Update and
+	// Delete callbacks, and other objects are created in the database.
+	// They are not added to any 'shares' collection.
+	Relays []*url.URL
 
 	// Sidechannel data -- this is set at request handling time. These must
 	// be set before the callbacks are used.
@@ -138,6 +157,9 @@ type FederatingWrappedCallbacks struct {
 	deliver func(c context.Context, outboxIRI *url.URL, activity Activity) error
 	// newTransport creates a new Transport.
 	newTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error)
+	// fanOut delivers the Announce of a relay to the shared inboxes of the
+	// given subscribers in the background.
+	fanOut func(c context.Context, outboxIRI *url.URL, announce Activity, subscribers []*url.URL) error
 }
 
 // callbacks returns the WrappedCallbacks members into a single interface slice
@@ -256,7 +278,7 @@ func (w FederatingWrappedCallbacks) create(c context.Context, a vocab.ActivitySt
 				return err
 			}
 		} else if t == nil {
-			return fmt.Errorf("cannot handle federated create: object is neither a value nor IRI")
+			return malformedf("cannot handle federated create: object is neither a value nor IRI")
 		}
 		id, err := GetId(t)
 		if err != nil {
@@ -297,7 +319,7 @@ func (w FederatingWrappedCallbacks) update(c context.Context, a vocab.ActivitySt
 	loopFn := func(iter vocab.ActivityStreamsObjectPropertyIterator) error {
 		t := iter.GetType()
 		if t == nil {
-			return fmt.Errorf("update requires an object to be wholly provided")
+			return malformedf("update requires an object to be wholly provided")
 		}
 		id, err := GetId(t)
 		if err != nil {
@@ -390,7 +412,7 @@ func (w FederatingWrappedCallbacks) follow(c context.Context, a vocab.ActivitySt
 			if err != nil {
 				return err
 			}
-			if id.String() == actorIRI.String() {
+			if id.String() == actorIRI.String() || (w.Relay && IsPublic(id.String())) {
 				isMe = true
 				break
 			}
@@ -520,7 +542,7 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 					return err
 				}
 			} else if t == nil {
-				return fmt.Errorf("cannot handle federated create: object is neither a value nor IRI")
+				return malformedf("cannot handle federated create: object is neither a value nor IRI")
 			}
 			// Ensure it is a Follow.
 			if !streams.IsOrExtendsActivityStreamsFollow(t) {
@@ -528,7 +550,7 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 			}
 			follow, ok := t.(Activity)
 			if !ok {
-				return fmt.Errorf("a Follow in an Accept does not satisfy the Activity interface")
+				return malformedf("a Follow in an Accept does not satisfy the Activity interface")
 			}
 			followId, err := GetId(follow)
 			if err != nil {
@@ -558,7 +580,7 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 			// fabricate it.
 			activityActors := a.GetActivityStreamsActor()
 			if activityActors == nil || activityActors.Len() == 0 {
-				return fmt.Errorf("an Accept with a Follow has no actors")
+				return malformedf("an Accept with a Follow has no actors")
 			}
 			// This may be a duplicate check if we dereferenced the
 			// Follow above. TODO: Separate this logic to avoid
@@ -576,11 +598,11 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 					return err
 				}
 				if !streams.IsOrExtendsActivityStreamsFollow(t) {
-					return fmt.Errorf("peer gave an Accept wrapping a Follow but provided a non-Follow id")
+					return malformedf("peer gave an Accept wrapping a Follow but provided a non-Follow id")
 				}
 				follow, ok := t.(Activity)
 				if !ok {
-					return fmt.Errorf("a Follow in an Accept does not satisfy the Activity interface")
+					return malformedf("a Follow in an Accept does not satisfy the Activity interface")
 				}
 				// Ensure that we are one of the actors on the Follow.
 				ok = false
@@ -596,7 +618,7 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 					}
 				}
 				if !ok {
-					return fmt.Errorf("peer gave an Accept wrapping a Follow but we are not the actor on that Follow")
+					return forbiddenf("peer gave an Accept wrapping a Follow but we are not the actor on that Follow")
 				}
 				// Build map of original Accept actors
 				acceptActors := make(map[string]bool)
@@ -618,9 +640,24 @@ func (w FederatingWrappedCallbacks) accept(c context.Context, a vocab.ActivitySt
 						acceptActors[id.String()] = true
 					}
 				}
+				// A Follow of the Public collection is accepted by
+				// the relay it was sent to.
+				if relayFollow, err := isRelayFollow(follow); err != nil {
+					return err
+				} else if to := follow.GetActivityStreamsTo(); relayFollow && to != nil {
+					for iter := to.Begin(); iter != to.End(); iter = iter.Next() {
+						id, err := ToId(iter)
+						if err != nil {
+							return err
+						}
+						if _, ok := acceptActors[id.String()]; ok {
+							acceptActors[id.String()] = true
+						}
+					}
+				}
 				for _, found := range acceptActors {
 					if !found {
-						return fmt.Errorf("peer gave an Accept wrapping a Follow but was not an object in the original Follow")
+						return forbiddenf("peer gave an Accept wrapping a Follow but was not an object in the original Follow")
 					}
 				}
 				return nil
@@ -797,6 +834,17 @@ func (w FederatingWrappedCallbacks) like(c context.Context, a vocab.ActivityStre
 
 // announce implements the federating Announce activity side effects.
 func (w FederatingWrappedCallbacks) announce(c context.Context, a vocab.ActivityStreamsAnnounce) error {
+	if relayed, err := w.isRelayed(a); err != nil {
+		return err
+	} else if relayed {
+		if err := w.relayed(c, a); err != nil {
+			return err
+		}
+		if w.Announce != nil {
+			return w.Announce(c, a)
+		}
+		return nil
+	}
 	id, err := GetId(a)
 	if err != nil {
 		return err
@@ -3,15 +3,14 @@ package pub
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
 )
 
-var ErrNotFound = errors.New("go-fed/activity: ActivityStreams data not found")
-
 // HandlerFunc determines whether an incoming HTTP request is an ActivityStreams
 // GET request, and if so attempts to serve ActivityStreams data.
 //
@@ -26,7 +25,8 @@ var ErrNotFound = errors.New("go-fed/activity: ActivityStreams data not found")
 // If 'isASRequest' is true and there is no error, then the HandlerFunc
 // successfully served the request and wrote to the ResponseWriter.
 //
-// Callers are responsible for authorized access to this resource.
+// Callers are responsible for authorized access to this resource, unless the
+// HandlerFunc is created with NewAuthorizedActivityStreamsHandler.
 type HandlerFunc func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error)
 
 // NewActivityStreamsHandler creates a HandlerFunc to serve ActivityStreams
@@ -38,6 +38,11 @@ type HandlerFunc func(c context.Context, w http.ResponseWriter, r *http.Request)
 // Tombstone Activities as well.
 //
 // Defaults to supporting content to be retrieved by HTTPS only.
+//
+// WARNING: It does not authenticate or authorize requests, and serves every
+// value in the Database to anyone who asks for it, including followers-only
+// and direct messages. Use NewAuthorizedActivityStreamsHandler to serve values
+// only to their audience.
 func NewActivityStreamsHandler(db Database, clock Clock) HandlerFunc {
 	return NewActivityStreamsHandlerScheme(db, clock, "https")
 }
@@ -57,31 +62,71 @@ func NewActivityStreamsHandler(db Database, clock Clock) HandlerFunc {
 // Returns ErrNotFound when the database does not retrieve any data and no
 // errors occurred during retrieval.
 func NewActivityStreamsHandlerScheme(db Database, clock Clock, scheme string) HandlerFunc {
+	return newActivityStreamsHandler(db, clock, scheme, nil, nil, nil)
+}
+
+// newActivityStreamsHandler creates a HandlerFunc to serve ActivityStreams
+// requests. If not nil, the request is first authenticated, actor documents are
+// created instead of retrieved, and the retrieved value is then authorized
+// before being served.
+func newActivityStreamsHandler(db Database, clock Clock, scheme string,
+	authenticate func(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error),
+	actors func(c context.Context, id *url.URL) (*ActorConfig, error),
+	authorize func(c context.Context, t vocab.Type) error) HandlerFunc {
 	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
 		// Do nothing if it is not an ActivityPub GET request
 		if !isActivityPubGet(r) {
 			return
 		}
 		isASRequest = true
+		// Delegate authenticating the request.
+		if authenticate != nil {
+			var authenticated bool
+			c, authenticated, err = authenticate(c, w, r)
+			if err != nil || !authenticated {
+				return
+			}
+		}
 		id := requestId(r, scheme)
-		// Lock and obtain a copy of the requested ActivityStreams value
-		err = db.Lock(c, id)
-		if err != nil {
-			return
+		var t vocab.Type
+		// Create the document if the value is an actor on this server.
+		if actors != nil {
+			var cfg *ActorConfig
+			if cfg, err = actors(c, id); err != nil {
+				return
+			} else if cfg != nil {
+				if t, err = NewActorDocument(*cfg); err != nil {
+					return
+				}
+			}
 		}
-		// WARNING: Unlock not deferred
-		t, err := db.Get(c, id)
-		if err != nil {
+		if t == nil {
+			// Lock and obtain a copy of the requested ActivityStreams
+			// value
+			err = db.Lock(c, id)
+			if err != nil {
+				return
+			}
+			// WARNING: Unlock not deferred
+			t, err = db.Get(c, id)
+			if err != nil {
+				db.Unlock(c, id)
+				return
+			}
 			db.Unlock(c, id)
-			return
+			// Unlock must have been called by this point and in
+			// every branch above
 		}
-		db.Unlock(c, id)
-		// Unlock must have been called by this point and in every
-		// branch above
 		if t == nil {
 			err = ErrNotFound
 			return
 		}
+		// Determine whether the requester may see the value.
+		if authorize != nil {
+			if err = authorize(c, t); err != nil {
+				return
+			}
+		}
 		// Remove sensitive fields.
 		clearSensitiveFields(t)
 		// Serialize the fetched value.
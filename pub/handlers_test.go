@@ -6,8 +6,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
 	"github.com/golang/mock/gomock"
 )
 
@@ -103,3 +106,223 @@ func TestActivityStreamsHandler(t *testing.T) {
 		assertByteEqual(t, b, mustSerializeToBytes(testMyNote))
 	})
 }
+
+// TestAuthorizedActivityStreamsHandler tests the handler for serving
+// ActivityPub requests only to the audience of the value.
+func TestAuthorizedActivityStreamsHandler(t *testing.T) {
+	ctx := context.Background()
+	const testMyFollowersIRI = "https://example.com/addison/followers"
+	setupFn := func(ctl *gomock.Controller, requester *url.URL) (db *MockDatabase, clock *MockClock, hf HandlerFunc) {
+		db = NewMockDatabase(ctl)
+		clock = NewMockClock(ctl)
+		var authn func(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error)
+		if requester != nil {
+			authn = func(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+				return WithRequester(c, requester), true, nil
+			}
+		}
+		hf = NewAuthorizedActivityStreamsHandler(db, clock, ObjectHandlerConfig{AuthenticateGet: authn})
+		return
+	}
+	noteTo := func(iris ...string) vocab.ActivityStreamsNote {
+		note := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		note.SetJSONLDId(id)
+		to := streams.NewActivityStreamsToProperty()
+		for _, iri := range iris {
+			to.AppendIRI(mustParse(iri))
+		}
+		note.SetActivityStreamsTo(to)
+		return note
+	}
+	serve := func(hf HandlerFunc) (*httptest.ResponseRecorder, error) {
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		_, err := hf(ctx, resp, req)
+		return resp, err
+	}
+	t.Run("ServesPublicContentAnonymously", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl, nil)
+		note := noteTo(PublicActivityPubIRI)
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		resp, err := serve(hf)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ReturnsNotFoundForPrivateContentAnonymously", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, _, hf := setupFn(ctl, nil)
+		note := noteTo(testFederatedActorIRI)
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		// Run & Verify
+		resp, err := serve(hf)
+		assertEqual(t, err, ErrNotFound)
+		assertEqual(t, len(resp.Result().Header), 0)
+	})
+	t.Run("ServesContentToAddressedRequester", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl, mustParse(testFederatedActorIRI))
+		note := noteTo(testFederatedActorIRI)
+		// Mock
+		mockDb.EXPECT().Lock(gomock.Any(), mustParse(testNoteId1))
+		mockDb.EXPECT().Get(gomock.Any(), mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(gomock.Any(), mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		resp, err := serve(hf)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ServesContentToFollowers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl, mustParse(testFederatedActorIRI2))
+		note := noteTo(testMyFollowersIRI)
+		followers := streams.NewActivityStreamsCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testMyFollowersIRI))
+		followers.SetJSONLDId(id)
+		items := streams.NewActivityStreamsItemsProperty()
+		items.AppendIRI(mustParse(testFederatedActorIRI2))
+		followers.SetActivityStreamsItems(items)
+		// Mock
+		mockDb.EXPECT().Lock(gomock.Any(), mustParse(testNoteId1))
+		mockDb.EXPECT().Get(gomock.Any(), mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(gomock.Any(), mustParse(testNoteId1))
+		mockDb.EXPECT().Lock(gomock.Any(), mustParse(testMyFollowersIRI))
+		mockDb.EXPECT().Owns(gomock.Any(), mustParse(testMyFollowersIRI)).Return(true, nil)
+		mockDb.EXPECT().Unlock(gomock.Any(), mustParse(testMyFollowersIRI))
+		mockDb.EXPECT().Lock(gomock.Any(), mustParse("https://example.com/addison"))
+		mockDb.EXPECT().Followers(gomock.Any(), mustParse("https://example.com/addison")).Return(followers, nil)
+		mockDb.EXPECT().Unlock(gomock.Any(), mustParse("https://example.com/addison"))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		resp, err := serve(hf)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ServesActorDocument", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb := NewMockDatabase(ctl)
+		mockClock := NewMockClock(ctl)
+		hf := NewAuthorizedActivityStreamsHandler(mockDb, mockClock, ObjectHandlerConfig{
+			Actors: func(c context.Context, id *url.URL) (*ActorConfig, error) {
+				if id.String() != testNoteId1 {
+					return nil, nil
+				}
+				return &ActorConfig{Id: id, PublicKey: mustPublicKey()}, nil
+			},
+		})
+		// Mock
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		resp, err := serve(hf)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ReturnsNotFoundForUnaddressedContentAnonymously", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, _, hf := setupFn(ctl, nil)
+		note := noteTo()
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		// Run & Verify
+		_, err := serve(hf)
+		assertEqual(t, err, ErrNotFound)
+	})
+	t.Run("ServesUnaddressedContentToAuthor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl, mustParse(testFederatedActorIRI))
+		note := noteTo()
+		attr := streams.NewActivityStreamsAttributedToProperty()
+		attr.AppendIRI(mustParse(testFederatedActorIRI))
+		note.SetActivityStreamsAttributedTo(attr)
+		// Mock
+		mockDb.EXPECT().Lock(gomock.Any(), mustParse(testNoteId1))
+		mockDb.EXPECT().Get(gomock.Any(), mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(gomock.Any(), mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		resp, err := serve(hf)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ForbidsUnaddressedContentToOthers", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, _, hf := setupFn(ctl, mustParse(testFederatedActorIRI2))
+		note := noteTo()
+		attr := streams.NewActivityStreamsAttributedToProperty()
+		attr.AppendIRI(mustParse(testFederatedActorIRI))
+		note.SetActivityStreamsAttributedTo(attr)
+		// Mock
+		mockDb.EXPECT().Lock(gomock.Any(), mustParse(testNoteId1))
+		mockDb.EXPECT().Get(gomock.Any(), mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(gomock.Any(), mustParse(testNoteId1))
+		// Run & Verify
+		_, err := serve(hf)
+		assertEqual(t, ErrorStatusCode(err), http.StatusForbidden)
+	})
+	t.Run("ServesUnaddressedCollectionAnonymously", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, mockClock, hf := setupFn(ctl, nil)
+		coll := streams.NewActivityStreamsOrderedCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testNoteId1))
+		coll.SetJSONLDId(id)
+		// Mock
+		mockDb.EXPECT().Lock(ctx, mustParse(testNoteId1))
+		mockDb.EXPECT().Get(ctx, mustParse(testNoteId1)).Return(coll, nil)
+		mockDb.EXPECT().Unlock(ctx, mustParse(testNoteId1))
+		mockClock.EXPECT().Now().Return(now())
+		// Run & Verify
+		resp, err := serve(hf)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("ForbidsRequesterOutsideAudience", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		mockDb, _, hf := setupFn(ctl, mustParse(testFederatedActorIRI3))
+		note := noteTo(testFederatedActorIRI)
+		// Mock
+		mockDb.EXPECT().Lock(gomock.Any(), mustParse(testNoteId1))
+		mockDb.EXPECT().Get(gomock.Any(), mustParse(testNoteId1)).Return(note, nil)
+		mockDb.EXPECT().Unlock(gomock.Any(), mustParse(testNoteId1))
+		mockDb.EXPECT().Lock(gomock.Any(), mustParse(testFederatedActorIRI))
+		mockDb.EXPECT().Owns(gomock.Any(), mustParse(testFederatedActorIRI)).Return(false, nil)
+		mockDb.EXPECT().Unlock(gomock.Any(), mustParse(testFederatedActorIRI))
+		// Run & Verify
+		_, err := serve(hf)
+		assertEqual(t, ErrorStatusCode(err), http.StatusForbidden)
+	})
+}
@@ -0,0 +1,184 @@
+package pub
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const (
+	// defaultInboxPathSuffix is the path suffix of inbox requests when an
+	// ActorHandlerConfig does not route inboxes itself.
+	defaultInboxPathSuffix = "/inbox"
+	// defaultOutboxPathSuffix is the path suffix of outbox requests when an
+	// ActorHandlerConfig does not route outboxes itself.
+	defaultOutboxPathSuffix = "/outbox"
+)
+
+// ActorHandlerConfig configures the http.Handler returned by NewActorHandler.
+//
+// The zero value is usable: it routes paths ending in "/inbox" and "/outbox"
+// to the Actor, responds with http.StatusNotFound to everything else, and
+// writes errors with DefaultErrorHandler.
+//
+// GET requests are served the ActivityStreams representation or the web page
+// preferred by their Accept header, responding with http.StatusNotAcceptable if
+// neither is acceptable.
+type ActorHandlerConfig struct {
+	// IsInbox determines whether the request is for an actor's inbox. If
+	// nil, requests whose path ends in "/inbox" are inbox requests.
+	IsInbox func(r *http.Request) bool
+	// IsOutbox determines whether the request is for an actor's outbox.
+	// If nil, requests whose path ends in "/outbox" are outbox requests.
+	IsOutbox func(r *http.Request) bool
+	// Objects serves ActivityStreams data for requests that are neither
+	// for an inbox nor an outbox, such as the HandlerFunc returned by
+	// NewAuthorizedActivityStreamsHandler. The HandlerFunc returned by
+	// NewActivityStreamsHandler serves every value to anyone, including
+	// values that are not public. It may be nil.
+	Objects HandlerFunc
+	// Fallback serves requests that are not ActivityPub requests, such
+	// as a browser asking for a web page. If nil, http.NotFound is used
+	// and web pages are not offered to GET requests.
+	Fallback http.Handler
+	// ErrorHandler writes the response when the Actor or Objects return
+	// an error. If nil, DefaultErrorHandler is used.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+	// Context creates the context passed to the Actor and Objects for the
+	// request, and may populate it with request-specific information. If
+	// nil, the request's own context is used.
+	Context func(r *http.Request) context.Context
+	// Scheme is the protocol scheme of the identifiers served. If empty,
+	// "https" is used.
+	Scheme string
+}
+
+// NewActorHandler creates an http.Handler that serves the inbox, outbox, and
+// ActivityStreams objects of an Actor.
+//
+// It handles checking whether a request is an ActivityPub request and writing
+// an HTTP response for errors, which would otherwise be repeated by every
+// application calling an Actor's methods.
+func NewActorHandler(a Actor, cfg ActorHandlerConfig) http.Handler {
+	if cfg.IsInbox == nil {
+		cfg.IsInbox = pathHasSuffix(defaultInboxPathSuffix)
+	}
+	if cfg.IsOutbox == nil {
+		cfg.IsOutbox = pathHasSuffix(defaultOutboxPathSuffix)
+	}
+	html := cfg.Fallback != nil
+	if cfg.Fallback == nil {
+		cfg.Fallback = http.NotFoundHandler()
+	}
+	if cfg.ErrorHandler == nil {
+		cfg.ErrorHandler = DefaultErrorHandler
+	}
+	if cfg.Context == nil {
+		cfg.Context = func(r *http.Request) context.Context {
+			return r.Context()
+		}
+	}
+	if len(cfg.Scheme) == 0 {
+		cfg.Scheme = "https"
+	}
+	h := &actorHandler{
+		actor: a,
+		cfg:   cfg,
+		html:  html,
+	}
+	if s, ok := a.(instanceActorServer); ok {
+		h.instance = s.instanceActorHandler(cfg.Scheme)
+	}
+	return h
+}
+
+// actorHandler is the http.Handler returned by NewActorHandler.
+type actorHandler struct {
+	actor Actor
+	cfg   ActorHandlerConfig
+	// instance serves the document of the Actor's instance actor, if it
+	// has one.
+	instance HandlerFunc
+	// html is true if the Fallback serves web pages.
+	html bool
+}
+
+// ServeHTTP routes the request to the instance actor's document, the Actor, the
+// Objects handler, or the Fallback handler.
+func (h *actorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		// Negotiate the representation of the resource.
+		addVaryAccept(w.Header())
+		mediaType, ok := negotiateGet(r, h.html)
+		if !ok {
+			http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+			return
+		} else if !IsActivityStreamsMediaType(mediaType) {
+			h.cfg.Fallback.ServeHTTP(w, r)
+			return
+		} else if !isActivityPubGet(r) {
+			// Only possible when web pages are not offered, such as
+			// for "*/*".
+			r = withAccept(r, mediaType)
+		}
+	}
+	c := h.cfg.Context(r)
+	var handled bool
+	var err error
+	if h.instance != nil {
+		if handled, err = h.instance(c, w, r); err != nil || handled {
+			h.finish(w, r, handled, err)
+			return
+		}
+	}
+	if h.cfg.IsInbox(r) {
+		handled, err = h.actor.PostInboxScheme(c, w, r, h.cfg.Scheme)
+		if err == nil && !handled {
+			handled, err = h.actor.GetInboxScheme(c, w, r, h.cfg.Scheme)
+		}
+	} else if h.cfg.IsOutbox(r) {
+		handled, err = h.actor.PostOutboxScheme(c, w, r, h.cfg.Scheme)
+		if err == nil && !handled {
+			handled, err = h.actor.GetOutboxScheme(c, w, r, h.cfg.Scheme)
+		}
+	} else if h.cfg.Objects != nil {
+		handled, err = h.cfg.Objects(c, w, r)
+	}
+	h.finish(w, r, handled, err)
+}
+
+// finish writes the response for a request that failed or was not handled.
+func (h *actorHandler) finish(w http.ResponseWriter, r *http.Request, handled bool, err error) {
+	if err != nil {
+		h.cfg.ErrorHandler(w, r, err)
+	} else if !handled {
+		h.cfg.Fallback.ServeHTTP(w, r)
+	}
+}
+
+// DefaultErrorHandler responds to a request that failed with the given error,
+// using the HTTP status code suggested by ErrorStatusCode.
+func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	code := ErrorStatusCode(err)
+	http.Error(w, http.StatusText(code), code)
+}
+
+// withAccept returns a shallow copy of the request with its Accept header set to
+// the media type.
+func withAccept(r *http.Request, mediaType string) *http.Request {
+	r2 := r.WithContext(r.Context())
+	r2.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		r2.Header[k] = v
+	}
+	r2.Header.Set(acceptHeader, mediaType)
+	return r2
+}
+
+// pathHasSuffix returns a function determining whether the path of a request
+// ends with the suffix, ignoring any trailing slash.
+func pathHasSuffix(suffix string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		return strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), suffix)
+	}
+}
@@ -0,0 +1,229 @@
+package pub
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+// TestActorHandler tests the http.Handler serving an Actor.
+func TestActorHandler(t *testing.T) {
+	// Set up test case
+	setupData()
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller, cfg ActorHandlerConfig) (delegate *MockDelegateActor, h http.Handler) {
+		delegate = NewMockDelegateActor(ctl)
+		a := NewCustomActor(
+			delegate,
+			/*enableSocialProtocol=*/ true,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		cfg.Context = func(r *http.Request) context.Context {
+			return ctx
+		}
+		h = NewActorHandler(a, cfg)
+		return
+	}
+	// Run tests
+	t.Run("RoutesInboxPost", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, h := setupFn(ctl, ActorHandlerConfig{})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		delegate.EXPECT().AuthenticatePostInbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(ctx, req, toDeserializedForm(testCreate)).Return(ctx, nil)
+		delegate.EXPECT().AuthorizePostInbox(ctx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().PostInbox(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().InboxForwarding(ctx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("RoutesOutboxGetWithCustomRouting", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, h := setupFn(ctl, ActorHandlerConfig{
+			IsInbox: func(r *http.Request) bool {
+				return false
+			},
+			IsOutbox: func(r *http.Request) bool {
+				return r.URL.Path == "/addison/outbox"
+			},
+		})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toGetOutboxRequest())
+		delegate.EXPECT().AuthenticateGetOutbox(ctx, resp, req).DoAndReturn(func(ctx context.Context, resp http.ResponseWriter, req *http.Request) (context.Context, bool, error) {
+			resp.WriteHeader(http.StatusForbidden)
+			return ctx, false, nil
+		})
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+	t.Run("ServesFallbackForNonActivityPubRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, ActorHandlerConfig{
+			Fallback: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}),
+		})
+		resp := httptest.NewRecorder()
+		req := toGetInboxRequest()
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusTeapot)
+	})
+	t.Run("NotFoundWithoutFallback", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, ActorHandlerConfig{})
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusNotFound)
+	})
+	t.Run("ServesWebPageToBrowser", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, ActorHandlerConfig{
+			Objects: func(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+				w.WriteHeader(http.StatusOK)
+				return true, nil
+			},
+			Fallback: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}),
+		})
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		req.Header.Set(acceptHeader, "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusTeapot)
+		assertEqual(t, resp.Header().Get(varyHeader), acceptHeader)
+	})
+	t.Run("ServesObjectsToPlainJSONRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, ActorHandlerConfig{
+			Objects: func(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+				w.WriteHeader(http.StatusGone)
+				return true, nil
+			},
+			Fallback: http.NotFoundHandler(),
+		})
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		req.Header.Set(acceptHeader, "text/html;q=0.5, application/json")
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusGone)
+	})
+	t.Run("NotAcceptable", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, ActorHandlerConfig{})
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", testNoteId1, nil)
+		req.Header.Set(acceptHeader, "text/html")
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusNotAcceptable)
+	})
+	t.Run("ServesObjects", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, ActorHandlerConfig{
+			Objects: func(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+				w.WriteHeader(http.StatusGone)
+				return true, nil
+			},
+		})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusGone)
+	})
+	t.Run("ServesInstanceActor", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		ia, _ := mustInstanceActor(ctl)
+		clock := NewMockClock(ctl)
+		clock.EXPECT().Now().Return(now())
+		a := NewCustomActor(
+			NewMockDelegateActor(ctl),
+			/*enableSocialProtocol=*/ true,
+			/*enableFederatedProtocol=*/ true,
+			clock,
+			WithInstanceActor(ia))
+		h := NewActorHandler(a, ActorHandlerConfig{})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testInstanceActorIRI, nil))
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusOK)
+	})
+	t.Run("MapsErrorsToStatusCodes", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, h := setupFn(ctl, ActorHandlerConfig{
+			Objects: func(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+				return true, ErrNotFound
+			},
+		})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, resp.Code, http.StatusNotFound)
+	})
+	t.Run("UsesCustomErrorHandler", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		var handledErr error
+		_, h := setupFn(ctl, ActorHandlerConfig{
+			Objects: func(c context.Context, w http.ResponseWriter, r *http.Request) (bool, error) {
+				return true, testErr
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				handledErr = err
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+		})
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Run the test
+		h.ServeHTTP(resp, req)
+		// Verify results
+		assertEqual(t, handledErr, testErr)
+		assertEqual(t, resp.Code, http.StatusServiceUnavailable)
+	})
+}
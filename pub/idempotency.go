@@ -0,0 +1,137 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// idempotencyKeyHeader is the header identifying retries of the same
+	// outbox POST request.
+	idempotencyKeyHeader = "Idempotency-Key"
+	// defaultIdempotencyTTL is the default time an Idempotency-Key is
+	// remembered.
+	defaultIdempotencyTTL = 24 * time.Hour
+)
+
+// IdempotencyStore remembers the activities created by outbox POST requests
+// bearing an Idempotency-Key header, so that retried requests do not create
+// them again.
+//
+// A key is first reserved by the request bearing it, before the request has
+// any side effect, and then either given the IRI of the activity created or
+// released if the request failed before creating one.
+//
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Reserve atomically reserves the key for the ttl if it is unknown or
+	// has expired, returning reserved as true. Otherwise, it returns the
+	// IRI of the activity created for the key, or a nil location if the
+	// request holding the reservation has not created it yet.
+	Reserve(c context.Context, key string, ttl time.Duration) (location *url.URL, reserved bool, err error)
+	// Put remembers the IRI of the activity created for the reserved key
+	// for the ttl. If it fails, the key is released and the activity is
+	// delivered regardless.
+	Put(c context.Context, key string, location *url.URL, ttl time.Duration) error
+	// Release forgets the reserved key, for which no activity was created
+	// or remembered, so that the request may be retried.
+	Release(c context.Context, key string) error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore keeping keys in memory, which
+// suits servers running a single process.
+type MemoryIdempotencyStore struct {
+	clock Clock
+	mu    sync.Mutex
+	keys  map[string]idempotencyEntry
+}
+
+// idempotencyEntry is a remembered Idempotency-Key. Its location is nil while
+// it is reserved.
+type idempotencyEntry struct {
+	location *url.URL
+	expires  time.Time
+}
+
+var _ IdempotencyStore = &MemoryIdempotencyStore{}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore expiring
+// keys according to the clock.
+func NewMemoryIdempotencyStore(clock Clock) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		clock: clock,
+		keys:  make(map[string]idempotencyEntry),
+	}
+}
+
+// Reserve reserves the key unless it is already known, and forgets the keys
+// that have expired.
+func (m *MemoryIdempotencyStore) Reserve(c context.Context, key string, ttl time.Duration) (location *url.URL, reserved bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	m.expire(now)
+	if e, ok := m.keys[key]; ok {
+		return e.location, false, nil
+	}
+	m.keys[key] = idempotencyEntry{expires: now.Add(ttl)}
+	return nil, true, nil
+}
+
+// Put remembers the IRI for the key.
+func (m *MemoryIdempotencyStore) Put(c context.Context, key string, location *url.URL, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key] = idempotencyEntry{
+		location: location,
+		expires:  m.clock.Now().Add(ttl),
+	}
+	return nil
+}
+
+// Release forgets the key.
+func (m *MemoryIdempotencyStore) Release(c context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.keys, key)
+	return nil
+}
+
+// expire forgets the keys that have expired by now.
+func (m *MemoryIdempotencyStore) expire(now time.Time) {
+	for k, e := range m.keys {
+		if !now.Before(e.expires) {
+			delete(m.keys, k)
+		}
+	}
+}
+
+// WithIdempotencyStore makes an Actor honor the Idempotency-Key header of POST
+// requests to outboxes. A request retried with the same key within the ttl is
+// responded to with http.StatusCreated and the Location of the activity the
+// first request created, without applying side effects or delivering it
+// again. The Location is remembered as soon as the activity is posted to the
+// outbox, so a retry after a failed delivery does not post it again. If the
+// ttl is zero, 24 hours is used.
+//
+// Keys are scoped to the outbox, and are only reserved after the request is
+// authenticated. Requests retried while the first is still being processed
+// are responded to with http.StatusConflict. Keys of requests that fail before
+// posting an activity are released, so that they may be retried.
+func WithIdempotencyStore(s IdempotencyStore, ttl time.Duration) ActorOption {
+	return func(b *baseActor) {
+		if ttl == 0 {
+			ttl = defaultIdempotencyTTL
+		}
+		b.idempotency = s
+		b.idempotencyTTL = ttl
+	}
+}
+
+// idempotencyStoreKey returns the key in the IdempotencyStore of a POST
+// request to the outbox with the Idempotency-Key header.
+func idempotencyStoreKey(outbox *url.URL, header string) string {
+	return outbox.String() + " " + header
+}
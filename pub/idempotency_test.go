@@ -0,0 +1,236 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+// TestIdempotentPostOutbox tests retrying outbox POST requests with an
+// Idempotency-Key.
+func TestIdempotentPostOutbox(t *testing.T) {
+	// Set up test case
+	setupData()
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (delegate *MockDelegateActor, clock *MockClock, a Actor) {
+		delegate = NewMockDelegateActor(ctl)
+		clock = NewMockClock(ctl)
+		a = NewCustomActor(
+			delegate,
+			/*enableSocialProtocol=*/ true,
+			/*enableFederatedProtocol=*/ false,
+			clock,
+			WithIdempotencyStore(NewMemoryIdempotencyStore(clock), time.Hour))
+		return
+	}
+	toKeyedRequest := func(key string) *http.Request {
+		req := toAPRequest(toPostOutboxRequest(testMyNote))
+		req.Header.Set(idempotencyKeyHeader, key)
+		return req
+	}
+	expectPost := func(delegate *MockDelegateActor, resp http.ResponseWriter, req *http.Request) {
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostOutboxRequestBodyHook(ctx, req, toDeserializedForm(testMyNote)).Return(ctx, nil)
+		delegate.EXPECT().WrapInCreate(ctx, toDeserializedForm(testMyNote), mustParse(testMyOutboxIRI)).DoAndReturn(func(c context.Context, t vocab.Type, u *url.URL) (vocab.ActivityStreamsCreate, error) {
+			return wrappedInCreate(t), nil
+		})
+		delegate.EXPECT().AddNewIDs(ctx, wrappedInCreate(toDeserializedForm(testMyNote))).DoAndReturn(func(c context.Context, activity Activity) error {
+			withNewId(activity)
+			return nil
+		})
+		delegate.EXPECT().PostOutbox(
+			ctx,
+			withNewId(wrappedInCreate(toDeserializedForm(testMyNote))),
+			mustParse(testMyOutboxIRI),
+			mustSerialize(toDeserializedForm(testMyNote)),
+		).Return(true, nil)
+	}
+	// Run tests
+	t.Run("RetryReturnsOriginalLocation", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, clock, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toKeyedRequest("abc")
+		retryResp := httptest.NewRecorder()
+		retryReq := toKeyedRequest("abc")
+		// Mock
+		expectPost(delegate, resp, req)
+		clock.EXPECT().Now().Return(now()).Times(3)
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, retryResp, retryReq).Return(ctx, true, nil)
+		// Run
+		_, err := a.PostOutbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		handled, err := a.PostOutbox(ctx, retryResp, retryReq)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, retryResp.Code, http.StatusCreated)
+		assertEqual(t, retryResp.Header().Get(locationHeader), testNewActivityIRI)
+	})
+	t.Run("RetryAfterExpiryPostsAgain", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, clock, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toKeyedRequest("abc")
+		retryResp := httptest.NewRecorder()
+		retryReq := toKeyedRequest("abc")
+		// Mock
+		expectPost(delegate, resp, req)
+		expectPost(delegate, retryResp, retryReq)
+		gomock.InOrder(
+			clock.EXPECT().Now().Return(now()),
+			clock.EXPECT().Now().Return(now()),
+			clock.EXPECT().Now().Return(now().Add(time.Hour)),
+			clock.EXPECT().Now().Return(now().Add(time.Hour)),
+		)
+		// Run
+		_, err := a.PostOutbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		handled, err := a.PostOutbox(ctx, retryResp, retryReq)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, retryResp.Code, http.StatusCreated)
+	})
+	t.Run("DifferentKeyPostsAgain", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, clock, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toKeyedRequest("abc")
+		otherResp := httptest.NewRecorder()
+		otherReq := toKeyedRequest("def")
+		// Mock
+		expectPost(delegate, resp, req)
+		expectPost(delegate, otherResp, otherReq)
+		clock.EXPECT().Now().Return(now()).Times(4)
+		// Run
+		_, err := a.PostOutbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		handled, err := a.PostOutbox(ctx, otherResp, otherReq)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, otherResp.Code, http.StatusCreated)
+	})
+	t.Run("ConflictWhileFirstIsProcessed", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate := NewMockDelegateActor(ctl)
+		clock := NewMockClock(ctl)
+		store := NewMemoryIdempotencyStore(clock)
+		a := NewCustomActor(delegate, true, false, clock, WithIdempotencyStore(store, time.Hour))
+		resp := httptest.NewRecorder()
+		req := toKeyedRequest("abc")
+		// Mock
+		clock.EXPECT().Now().Return(now()).Times(2)
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		_, reserved, err := store.Reserve(ctx, idempotencyStoreKey(mustParse(testMyOutboxIRI), "abc"), time.Hour)
+		assertEqual(t, err, nil)
+		assertEqual(t, reserved, true)
+		handled, err := a.PostOutbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusConflict)
+	})
+	t.Run("ReleasesKeyWhenRequestFails", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate, clock, a := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toKeyedRequest("abc")
+		retryResp := httptest.NewRecorder()
+		retryReq := toKeyedRequest("abc")
+		// Mock
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostOutboxRequestBodyHook(ctx, req, toDeserializedForm(testMyNote)).Return(ctx, malformedf("rejected"))
+		expectPost(delegate, retryResp, retryReq)
+		clock.EXPECT().Now().Return(now()).Times(3)
+		// Run
+		_, err := a.PostOutbox(ctx, resp, req)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+		handled, err := a.PostOutbox(ctx, retryResp, retryReq)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, retryResp.Code, http.StatusCreated)
+	})
+	t.Run("RemembersActivityWhenDeliveryFails", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate := NewMockDelegateActor(ctl)
+		clock := NewMockClock(ctl)
+		a := NewCustomActor(delegate, true, true, clock, WithIdempotencyStore(NewMemoryIdempotencyStore(clock), time.Hour))
+		resp := httptest.NewRecorder()
+		req := toKeyedRequest("abc")
+		retryResp := httptest.NewRecorder()
+		retryReq := toKeyedRequest("abc")
+		testErr := fmt.Errorf("test error")
+		// Mock
+		expectPost(delegate, resp, req)
+		delegate.EXPECT().Deliver(ctx, mustParse(testMyOutboxIRI), gomock.Any()).Return(testErr)
+		clock.EXPECT().Now().Return(now()).Times(3)
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, retryResp, retryReq).Return(ctx, true, nil)
+		// Run
+		_, err := a.PostOutbox(ctx, resp, req)
+		assertEqual(t, err, testErr)
+		handled, err := a.PostOutbox(ctx, retryResp, retryReq)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, retryResp.Code, http.StatusCreated)
+		assertEqual(t, retryResp.Header().Get(locationHeader), testNewActivityIRI)
+	})
+	t.Run("DeliversAndReleasesKeyWhenPutFails", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		delegate := NewMockDelegateActor(ctl)
+		clock := NewMockClock(ctl)
+		store := &failingPutStore{NewMemoryIdempotencyStore(clock)}
+		a := NewCustomActor(delegate, true, true, clock, WithIdempotencyStore(store, time.Hour))
+		resp := httptest.NewRecorder()
+		req := toKeyedRequest("abc")
+		// Mock
+		expectPost(delegate, resp, req)
+		delegate.EXPECT().Deliver(ctx, mustParse(testMyOutboxIRI), gomock.Any()).Return(nil)
+		clock.EXPECT().Now().Return(now()).AnyTimes()
+		// Run
+		handled, err := a.PostOutbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusCreated)
+		_, reserved, err := store.Reserve(ctx, idempotencyStoreKey(mustParse(testMyOutboxIRI), "abc"), time.Hour)
+		assertEqual(t, err, nil)
+		assertEqual(t, reserved, true)
+	})
+}
+
+// failingPutStore is an IdempotencyStore failing to remember locations.
+type failingPutStore struct {
+	*MemoryIdempotencyStore
+}
+
+// Put fails.
+func (f *failingPutStore) Put(c context.Context, key string, location *url.URL, ttl time.Duration) error {
+	return fmt.Errorf("test error")
+}
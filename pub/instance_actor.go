@@ -0,0 +1,181 @@
+package pub
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// InstanceActor is the Application actor representing the server itself,
+// rather than any of its users.
+//
+// Its key signs the requests that are not made on behalf of a local user, such
+// as fetching a remote actor or object while verifying an activity delivered to
+// an inbox. Peers that require every GET request to be signed, sometimes known
+// as "authorized fetch" or "secure mode", are then able to verify the request
+// by fetching the instance actor without themselves signing with a key this
+// server would need to fetch in turn.
+//
+// An InstanceActor is given to an Actor with the WithInstanceActor option, and
+// its document is served by the HandlerFunc returned by
+// NewInstanceActorHandler, or automatically by NewActorHandler for that Actor.
+type InstanceActor struct {
+	// Id is the IRI of the instance actor, such as
+	// "https://example.com/actor".
+	Id *url.URL
+	// PreferredUsername is the preferred username of the instance actor.
+	// If empty, the host of Id is used.
+	PreferredUsername string
+	// Inbox is the IRI of the instance actor's inbox. If nil, Id with an
+	// "/inbox" path segment appended is used.
+	Inbox *url.URL
+	// Outbox is the IRI of the instance actor's outbox. If nil, Id with an
+	// "/outbox" path segment appended is used.
+	Outbox *url.URL
+	// PublicKey is the public key of the instance actor, served in its
+	// document in PEM format.
+	PublicKey crypto.PublicKey
+	// NewTransport returns a Transport signing requests with the instance
+	// actor's private key, identifying the public key with the IRI
+	// returned by PublicKeyId. For example, it may return the
+	// HttpSigTransport created by NewHttpSigTransport.
+	NewTransport func(c context.Context, gofedAgent string) (t Transport, err error)
+}
+
+// PublicKeyId returns the IRI identifying the instance actor's public key,
+// which is its Id with a "main-key" fragment.
+func (i *InstanceActor) PublicKeyId() *url.URL {
+	return publicKeyIdOf(i.Id)
+}
+
+// Document creates the ActivityStreams representation of the instance actor.
+func (i *InstanceActor) Document() (vocab.ActivityStreamsApplication, error) {
+	username := i.PreferredUsername
+	if len(username) == 0 {
+		username = i.Id.Host
+	}
+	t, err := NewActorDocument(ActorConfig{
+		Type:              ApplicationActorType,
+		Id:                i.Id,
+		PreferredUsername: username,
+		Inbox:             i.Inbox,
+		Outbox:            i.Outbox,
+		PublicKey:         i.PublicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	app := t.(vocab.ActivityStreamsApplication)
+	// The instance actor neither follows nor likes anything.
+	app.SetActivityStreamsFollowers(nil)
+	app.SetActivityStreamsFollowing(nil)
+	app.SetActivityStreamsLiked(nil)
+	return app, nil
+}
+
+// WithInstanceActor signs the requests fetching data while processing inbox
+// deliveries with the instance actor's key, instead of with a Transport created
+// by CommonBehavior's NewTransport for the inbox's actor. The http.Handler
+// returned by NewActorHandler also serves the instance actor's document.
+//
+// Requests made on behalf of a local user, such as deliveries and the fetches
+// resolving their recipients, are still signed with that user's key.
+//
+// Actors created with NewCustomActor only serve the document.
+func WithInstanceActor(i *InstanceActor) ActorOption {
+	return func(b *baseActor) {
+		if i == nil {
+			return
+		}
+		b.instanceActor = i
+		if s, ok := b.delegate.(*sideEffectActor); ok {
+			s.instanceActor = i
+		}
+	}
+}
+
+// instanceActorServer is an Actor that may serve the document of an instance
+// actor.
+type instanceActorServer interface {
+	// instanceActorHandler returns the HandlerFunc serving the document,
+	// or nil if there is no instance actor.
+	instanceActorHandler(scheme string) HandlerFunc
+}
+
+// instanceActorHandler returns the HandlerFunc serving the document of the
+// instance actor given with WithInstanceActor, or nil if there is none.
+func (b *baseActor) instanceActorHandler(scheme string) HandlerFunc {
+	if b.instanceActor == nil {
+		return nil
+	}
+	return NewInstanceActorHandlerScheme(b.instanceActor, b.clock, scheme)
+}
+
+// NewInstanceActorHandler creates a HandlerFunc serving the document of the
+// instance actor to ActivityPub GET requests for its Id.
+//
+// The document is served to every requester, since peers fetch it to verify
+// the signatures of requests made with its key. Requests for other IRIs are
+// not handled.
+//
+// Defaults to supporting content to be retrieved by HTTPS only.
+func NewInstanceActorHandler(i *InstanceActor, clock Clock) HandlerFunc {
+	return NewInstanceActorHandlerScheme(i, clock, "https")
+}
+
+// NewInstanceActorHandlerScheme creates a HandlerFunc serving the document of
+// the instance actor to ActivityPub GET requests for its Id.
+//
+// Specifying the "scheme" allows for retrieving the document with identifiers
+// such as HTTP, HTTPS, or other protocol schemes.
+func NewInstanceActorHandlerScheme(i *InstanceActor, clock Clock, scheme string) HandlerFunc {
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
+		// Do nothing if it is not an ActivityPub GET request for the
+		// instance actor
+		if !isActivityPubGet(r) {
+			return
+		} else if id := collectionId(requestId(r, scheme)); id.String() != i.Id.String() {
+			return
+		}
+		isASRequest = true
+		app, err := i.Document()
+		if err != nil {
+			return
+		}
+		// Serialize the document.
+		m, err := streams.Serialize(app)
+		if err != nil {
+			return
+		}
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return
+		}
+		// Write the response.
+		addResponseHeaders(w.Header(), clock, raw)
+		w.WriteHeader(http.StatusOK)
+		n, err := w.Write(raw)
+		if err != nil {
+			return
+		} else if n != len(raw) {
+			err = fmt.Errorf("only wrote %d of %d bytes", n, len(raw))
+			return
+		}
+		return
+	}
+}
+
+// appendPath returns a copy of the IRI with the segment appended to its path.
+func appendPath(iri *url.URL, segment string) *url.URL {
+	u := *iri
+	u.Path = path.Join(u.Path, segment)
+	u.RawPath = ""
+	return &u
+}
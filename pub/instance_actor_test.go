@@ -0,0 +1,106 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+const (
+	testInstanceActorIRI = "https://example.com/actor"
+)
+
+// mustInstanceActor creates an InstanceActor with a newly generated key,
+// returning the Transport given to it.
+func mustInstanceActor(ctl *gomock.Controller) (*InstanceActor, *MockTransport) {
+	tp := NewMockTransport(ctl)
+	return &InstanceActor{
+		Id:        mustParse(testInstanceActorIRI),
+		PublicKey: mustPublicKey(),
+		NewTransport: func(c context.Context, gofedAgent string) (Transport, error) {
+			return tp, nil
+		},
+	}, tp
+}
+
+// TestInstanceActor tests the actor representing the server itself.
+func TestInstanceActor(t *testing.T) {
+	ctx := context.Background()
+	t.Run("ServesDocument", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		ia, _ := mustInstanceActor(ctl)
+		clock := NewMockClock(ctl)
+		clock.EXPECT().Now().Return(now())
+		hf := NewInstanceActorHandler(ia, clock)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testInstanceActorIRI, nil))
+		// Run
+		isASRequest, err := hf(ctx, resp, req)
+		// Verify
+		assertEqual(t, isASRequest, true)
+		assertEqual(t, err, nil)
+		assertEqual(t, resp.Code, http.StatusOK)
+		b, err := ioutil.ReadAll(resp.Result().Body)
+		assertEqual(t, err, nil)
+		var m map[string]interface{}
+		assertEqual(t, json.Unmarshal(b, &m), nil)
+		assertEqual(t, m["type"], "Application")
+		assertEqual(t, m["preferredUsername"], "example.com")
+		assertEqual(t, m["inbox"], "https://example.com/actor/inbox")
+		assertEqual(t, m["outbox"], "https://example.com/actor/outbox")
+		key := m["publicKey"].(map[string]interface{})
+		assertEqual(t, key["id"], "https://example.com/actor#main-key")
+		assertEqual(t, key["owner"], testInstanceActorIRI)
+		assertNotEqual(t, len(key["publicKeyPem"].(string)), 0)
+	})
+	t.Run("IgnoresOtherIRIs", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		ia, _ := mustInstanceActor(ctl)
+		hf := NewInstanceActorHandler(ia, NewMockClock(ctl))
+		resp := httptest.NewRecorder()
+		req := toAPRequest(httptest.NewRequest("GET", testNoteId1, nil))
+		// Run
+		isASRequest, err := hf(ctx, resp, req)
+		// Verify
+		assertEqual(t, isASRequest, false)
+		assertEqual(t, err, nil)
+	})
+	t.Run("SignsInboxFetchesWithInstanceKey", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		ia, tp := mustInstanceActor(ctl)
+		common := NewMockCommonBehavior(ctl)
+		a := NewFederatingActor(common, NewMockFederatingProtocol(ctl), NewMockDatabase(ctl), NewMockClock(ctl), WithInstanceActor(ia))
+		s := a.(*baseActorFederating).delegate.(*sideEffectActor)
+		// Run
+		got, err := s.newInboxTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent())
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, got, Transport(tp))
+	})
+	t.Run("SignsInboxFetchesWithActorKeyByDefault", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		common := NewMockCommonBehavior(ctl)
+		tp := NewMockTransport(ctl)
+		common.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(tp, nil)
+		a := NewFederatingActor(common, NewMockFederatingProtocol(ctl), NewMockDatabase(ctl), NewMockClock(ctl))
+		s := a.(*baseActorFederating).delegate.(*sideEffectActor)
+		// Run
+		got, err := s.newInboxTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent())
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, got, Transport(tp))
+	})
+}
@@ -0,0 +1,164 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// MediaStorage stores the media files uploaded by clients with the handler
+// created by NewMediaUploadHandler.
+type MediaStorage interface {
+	// StoreMedia saves the content of an uploaded file, returning the IRI
+	// where it is served.
+	//
+	// The name is the file name given by the client, which must not be
+	// trusted as a path or for its extension. The mediaType is the MIME
+	// type detected from the content, which is one of the image, audio,
+	// or video types recognized by IsAllowedMediaType.
+	StoreMedia(c context.Context, name, mediaType string, content io.Reader) (iri *url.URL, err error)
+	// DeleteMedia removes a file stored by StoreMedia. It is called when
+	// the upload cannot be posted to the outbox after being stored.
+	DeleteMedia(c context.Context, iri *url.URL) error
+}
+
+// mediaExtensions are the file extensions of the media types accepted for
+// uploads, which are the image, audio, and video types detected by
+// http.DetectContentType.
+var mediaExtensions = map[string]string{
+	"image/bmp":       ".bmp",
+	"image/gif":       ".gif",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"image/x-icon":    ".ico",
+	"audio/aiff":      ".aiff",
+	"audio/basic":     ".snd",
+	"audio/midi":      ".mid",
+	"audio/mpeg":      ".mp3",
+	"audio/wave":      ".wav",
+	"application/ogg": ".ogg",
+	"video/avi":       ".avi",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+}
+
+// IsAllowedMediaType determines whether files of the media type may be
+// uploaded and served. Only images, audio, and video that browsers will not
+// interpret as active content are allowed.
+func IsAllowedMediaType(mediaType string) bool {
+	_, ok := mediaExtensions[mediaType]
+	return ok
+}
+
+// isAllowedMediaExtension determines whether the file extension is that of an
+// allowed media type.
+func isAllowedMediaExtension(ext string) bool {
+	for _, e := range mediaExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalMediaStorage is a MediaStorage keeping files in a local directory, which
+// is convenient for testing and small deployments.
+//
+// Files are given random names, with the extension of their media type. The
+// files are served by the http.Handler returned by Handler.
+type LocalMediaStorage struct {
+	dir     string
+	baseURL *url.URL
+}
+
+var _ MediaStorage = &LocalMediaStorage{}
+
+// NewLocalMediaStorage returns a LocalMediaStorage storing files in the
+// directory, which are served under the baseURL, such as
+// "https://example.com/media".
+func NewLocalMediaStorage(dir string, baseURL *url.URL) *LocalMediaStorage {
+	return &LocalMediaStorage{
+		dir:     dir,
+		baseURL: baseURL,
+	}
+}
+
+// StoreMedia writes the content to a new file in the directory.
+func (l *LocalMediaStorage) StoreMedia(c context.Context, name, mediaType string, content io.Reader) (iri *url.URL, err error) {
+	ext, ok := mediaExtensions[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("cannot store media of type %q", mediaType)
+	}
+	f, err := ioutil.TempFile(l.dir, "media-*"+ext)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(f, content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	return appendPath(l.baseURL, filepath.Base(f.Name())), nil
+}
+
+// DeleteMedia removes the file served at the IRI from the directory.
+func (l *LocalMediaStorage) DeleteMedia(c context.Context, iri *url.URL) error {
+	name := path.Base(iri.Path)
+	if name == "." || name == "/" || name == ".." {
+		return fmt.Errorf("%s does not name a stored file", iri)
+	}
+	return os.Remove(filepath.Join(l.dir, name))
+}
+
+// Handler returns an http.Handler serving the stored files at the path of the
+// baseURL.
+//
+// Browsers are told not to guess the type of the files, and files that do not
+// have the extension of an allowed media type, such as ones placed in the
+// directory by other means, are served as attachments to be downloaded rather
+// than displayed. Directories are not listed: requests for them are
+// responded to with http.StatusNotFound.
+func (l *LocalMediaStorage) Handler() http.Handler {
+	files := http.StripPrefix(strings.TrimSuffix(l.baseURL.Path, "/"), http.FileServer(filesOnly{http.Dir(l.dir)}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if !isAllowedMediaExtension(strings.ToLower(path.Ext(r.URL.Path))) {
+			w.Header().Set("Content-Disposition", "attachment")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// filesOnly is an http.FileSystem that does not open directories, so they are
+// neither listed nor served by their index files.
+type filesOnly struct {
+	fs http.FileSystem
+}
+
+// Open opens the named file, failing with os.ErrNotExist for directories.
+func (f filesOnly) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := file.Stat(); err != nil {
+		file.Close()
+		return nil, err
+	} else if fi.IsDir() {
+		file.Close()
+		return nil, os.ErrNotExist
+	}
+	return file, nil
+}
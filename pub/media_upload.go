@@ -0,0 +1,257 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const (
+	// uploadFilePart is the multipart form part of the uploaded file.
+	uploadFilePart = "file"
+	// uploadObjectPart is the multipart form part of the object shell
+	// describing the uploaded file.
+	uploadObjectPart = "object"
+	// defaultMaxUploadBytes is the default size limit of upload requests.
+	defaultMaxUploadBytes = 10 << 20
+	// maxUploadMemory is how much of an upload is kept in memory, with the
+	// rest buffered in temporary files.
+	maxUploadMemory = 1 << 20
+	// sniffLen is how much of a file is used to detect its media type.
+	sniffLen = 512
+)
+
+// MediaUploadConfig configures the HandlerFunc returned by
+// NewMediaUploadHandler.
+type MediaUploadConfig struct {
+	// Storage stores the uploaded files.
+	Storage MediaStorage
+	// Outbox determines the outbox of the actor uploading to the endpoint.
+	// If nil, the endpoint's IRI with its last path segment replaced by
+	// "outbox" is used, such as "https://example.com/addison/outbox" for
+	// "https://example.com/addison/uploadMedia".
+	Outbox func(c context.Context, uploadIRI *url.URL) (*url.URL, error)
+	// MaxBytes limits the size of upload requests. If zero, 10 MiB is
+	// used.
+	MaxBytes int64
+	// Scheme is the protocol scheme of the endpoint's IRI. If empty,
+	// "https" is used.
+	Scheme string
+}
+
+// mediaUploader is an Actor able to post uploaded media to an outbox.
+type mediaUploader interface {
+	// postMedia handles an upload request.
+	postMedia(c context.Context, w http.ResponseWriter, r *http.Request, cfg MediaUploadConfig) (bool, error)
+}
+
+// NewMediaUploadHandler creates a HandlerFunc serving the 'uploadMedia'
+// endpoint of the Social API for an Actor, which may be advertised with the
+// UploadMedia of ActorEndpoints.
+//
+// Clients POST a multipart/form-data request with a "file" part containing the
+// media, and an "object" part containing the JSON of an Image, Video, Audio,
+// or other Document without its 'url'. The media type of the file is detected
+// from its content, ignoring the type and name declared by the client, and
+// files that are not of a type allowed by IsAllowedMediaType are rejected with
+// http.StatusBadRequest. The file is saved to the MediaStorage, and the
+// object's 'url' and 'mediaType' are set to describe it. The file is deleted
+// from the MediaStorage if the object cannot be posted. The object is
+// then posted to the outbox as if the client had posted it there: it is
+// wrapped with WrapInCreate, given ids with AddNewIDs, and delivered. Responds
+// with http.StatusCreated and the Location of the new activity.
+//
+// The request is authenticated with AuthenticatePostOutbox, and the object is
+// given to PostOutboxRequestBodyHook. Only POST requests with a multipart
+// content type are handled.
+func NewMediaUploadHandler(a Actor, cfg MediaUploadConfig) HandlerFunc {
+	if cfg.Outbox == nil {
+		cfg.Outbox = siblingOutbox
+	}
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = defaultMaxUploadBytes
+	}
+	if len(cfg.Scheme) == 0 {
+		cfg.Scheme = "https"
+	}
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
+		// Do nothing if it is not a multipart POST request.
+		if !isMultipartPost(r) {
+			return
+		}
+		u, ok := a.(mediaUploader)
+		if !ok {
+			return true, fmt.Errorf("actor %T does not support media uploads", a)
+		}
+		return u.postMedia(c, w, r, cfg)
+	}
+}
+
+// postMedia implements the generic algorithm for handling an upload to the
+// 'uploadMedia' endpoint, posting the described object to the actor's outbox.
+func (b *baseActor) postMedia(c context.Context, w http.ResponseWriter, r *http.Request, cfg MediaUploadConfig) (bool, error) {
+	// If the Social API is not enabled, then this endpoint is not enabled.
+	if !b.enableSocialProtocol {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return true, nil
+	}
+	// Delegate authenticating and authorizing the request.
+	c, authenticated, err := b.delegate.AuthenticatePostOutbox(c, w, r)
+	if err != nil {
+		return true, err
+	} else if !authenticated {
+		return true, nil
+	}
+	// Everything is good to begin processing the request.
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBytes)
+	if err = r.ParseMultipartForm(maxUploadMemory); err != nil {
+		writeClientError(w, &MalformedError{Err: err})
+		return true, nil
+	}
+	defer r.MultipartForm.RemoveAll()
+	asValue, err := uploadedObject(c, r)
+	if writeClientError(w, err) {
+		return true, nil
+	} else if err != nil {
+		return true, err
+	}
+	f, fh, err := r.FormFile(uploadFilePart)
+	if err != nil {
+		writeClientError(w, &MalformedError{Err: err})
+		return true, nil
+	}
+	defer f.Close()
+	// Detect the media type from the content, since neither the declared
+	// type nor the file name can be trusted.
+	sniff := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return true, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(sniff[:n]))
+	if !IsAllowedMediaType(mediaType) {
+		writeClientError(w, malformedf("cannot upload media of type %q", mediaType))
+		return true, nil
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return true, err
+	}
+	iri, err := cfg.Storage.StoreMedia(c, fh.Filename, mediaType, f)
+	if err != nil {
+		return true, err
+	}
+	// Remove the stored file unless it is posted to the outbox.
+	posted := false
+	defer func() {
+		if !posted {
+			cfg.Storage.DeleteMedia(c, iri)
+		}
+	}()
+	setMedia(asValue, iri, mediaType)
+	// Allow server implementations to set context data with a hook.
+	c, err = b.delegate.PostOutboxRequestBodyHook(c, r, asValue)
+	if writeClientError(w, err) {
+		return true, nil
+	} else if err != nil {
+		return true, err
+	}
+	// Complete the rest of the outbox and delivery process.
+	outboxId, err := cfg.Outbox(c, requestId(r, cfg.Scheme))
+	if err != nil {
+		return true, err
+	}
+	activity, deliverable, err := b.post(c, outboxId, asValue, nil)
+	if writeClientError(w, err) {
+		return true, nil
+	} else if err != nil {
+		return true, err
+	}
+	// The posted activity refers to the stored file, so keep it even if
+	// delivering the activity fails below.
+	posted = true
+	if err = b.deliverPosted(c, outboxId, activity, deliverable); writeClientError(w, err) {
+		return true, nil
+	} else if err != nil {
+		return true, err
+	}
+	// Respond to the request with the new Activity's IRI location.
+	w.Header().Set(locationHeader, activity.GetJSONLDId().Get().String())
+	w.WriteHeader(http.StatusCreated)
+	return true, nil
+}
+
+// uploadedObject returns the object shell of an upload, which must be a
+// Document or a type extending it, such as an Image.
+func uploadedObject(c context.Context, r *http.Request) (vocab.Type, error) {
+	var raw []byte
+	if v := r.MultipartForm.Value[uploadObjectPart]; len(v) > 0 {
+		raw = []byte(v[0])
+	} else if fhs := r.MultipartForm.File[uploadObjectPart]; len(fhs) > 0 {
+		f, err := fhs[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if raw, err = ioutil.ReadAll(f); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, malformedf("upload has no %q part", uploadObjectPart)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, &MalformedError{Err: err}
+	}
+	asValue, err := streams.ToType(c, m)
+	if streams.IsUnmatchedErr(err) {
+		return nil, &MalformedError{Err: err}
+	} else if err != nil {
+		return nil, err
+	} else if !streams.IsOrExtendsActivityStreamsDocument(asValue) {
+		return nil, malformedf("cannot upload media as a %s", asValue.GetTypeName())
+	}
+	return asValue, nil
+}
+
+// setMedia replaces the 'url' and 'mediaType' of the object to describe the
+// stored file.
+func setMedia(t vocab.Type, iri *url.URL, mediaType string) {
+	if v, ok := t.(urler); ok {
+		u := streams.NewActivityStreamsUrlProperty()
+		u.AppendIRI(iri)
+		v.SetActivityStreamsUrl(u)
+	}
+	if v, ok := t.(mediaTypeer); ok && len(mediaType) > 0 {
+		mt := streams.NewActivityStreamsMediaTypeProperty()
+		mt.Set(mediaType)
+		v.SetActivityStreamsMediaType(mt)
+	}
+}
+
+// siblingOutbox returns the IRI with its last path segment replaced by
+// "outbox".
+func siblingOutbox(c context.Context, uploadIRI *url.URL) (*url.URL, error) {
+	owner, err := ownerFromParentPath(c, uploadIRI)
+	if err != nil {
+		return nil, err
+	}
+	return appendPath(owner, "outbox"), nil
+}
+
+// isMultipartPost returns true if the request is a POST request with a
+// multipart/form-data body.
+func isMultipartPost(r *http.Request) bool {
+	if r.Method != "POST" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(contentTypeHeader))
+	return err == nil && mediaType == "multipart/form-data"
+}
@@ -0,0 +1,367 @@
+package pub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+const (
+	testUploadMediaIRI = "https://example.com/addison/uploadMedia"
+	testMediaBaseIRI   = "https://example.com/media"
+)
+
+// testPNG is the beginning of a PNG file.
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// toUploadRequest creates a multipart upload request with the object and, if
+// it is not nil, the file.
+func toUploadRequest(object string, file []byte, fileName, fileType string) *http.Request {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	if err := mw.WriteField(uploadObjectPart, object); err != nil {
+		panic(err)
+	}
+	if file != nil {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="file"; filename="`+fileName+`"`)
+		h.Set(contentTypeHeader, fileType)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			panic(err)
+		}
+		part.Write(file)
+	}
+	if err := mw.Close(); err != nil {
+		panic(err)
+	}
+	req := httptest.NewRequest("POST", testUploadMediaIRI, body)
+	req.Header.Set(contentTypeHeader, mw.FormDataContentType())
+	return req
+}
+
+// mustTempDir creates a temporary directory, panicking on failure.
+func mustTempDir() string {
+	dir, err := ioutil.TempDir("", "pub-media")
+	if err != nil {
+		panic(err)
+	}
+	return dir
+}
+
+// TestMediaUploadHandler tests uploading media through the Social API.
+func TestMediaUploadHandler(t *testing.T) {
+	setupData()
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller, dir string) (delegate *MockDelegateActor, h HandlerFunc) {
+		delegate = NewMockDelegateActor(ctl)
+		a := NewCustomActor(
+			delegate,
+			/*enableSocialProtocol=*/ true,
+			/*enableFederatedProtocol=*/ false,
+			NewMockClock(ctl))
+		h = NewMediaUploadHandler(a, MediaUploadConfig{
+			Storage: NewLocalMediaStorage(dir, mustParse(testMediaBaseIRI)),
+		})
+		return
+	}
+	t.Run("IgnoresNonMultipartRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		_, h := setupFn(ctl, dir)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostOutboxRequest(testMyNote))
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, false)
+	})
+	t.Run("StoresFileAndPostsToOutbox", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		delegate, h := setupFn(ctl, dir)
+		resp := httptest.NewRecorder()
+		req := toUploadRequest(`{"@context":"https://www.w3.org/ns/activitystreams","type":"Image","name":"A cat"}`, testPNG, "cat.png", "image/png")
+		var stored string
+		// Mock
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostOutboxRequestBodyHook(ctx, req, gomock.Any()).DoAndReturn(func(c context.Context, r *http.Request, data vocab.Type) (context.Context, error) {
+			img := data.(vocab.ActivityStreamsImage)
+			stored = img.GetActivityStreamsUrl().At(0).GetIRI().String()
+			assertEqual(t, img.GetActivityStreamsMediaType().Get(), "image/png")
+			return c, nil
+		})
+		delegate.EXPECT().WrapInCreate(ctx, gomock.Any(), mustParse(testMyOutboxIRI)).DoAndReturn(func(c context.Context, t vocab.Type, u *url.URL) (vocab.ActivityStreamsCreate, error) {
+			return wrappedInCreate(t), nil
+		})
+		delegate.EXPECT().AddNewIDs(ctx, gomock.Any()).DoAndReturn(func(c context.Context, activity Activity) error {
+			withNewId(activity)
+			return nil
+		})
+		delegate.EXPECT().PostOutbox(ctx, gomock.Any(), mustParse(testMyOutboxIRI), gomock.Any()).Return(true, nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusCreated)
+		assertEqual(t, resp.Header().Get(locationHeader), testNewActivityIRI)
+		storedIRI := mustParse(stored)
+		assertEqual(t, storedIRI.Host, "example.com")
+		assertEqual(t, path.Dir(storedIRI.Path), "/media")
+		assertEqual(t, path.Ext(storedIRI.Path), ".png")
+		b, err := ioutil.ReadFile(filepath.Join(dir, path.Base(storedIRI.Path)))
+		assertEqual(t, err, nil)
+		assertByteEqual(t, b, testPNG)
+	})
+	t.Run("DetectsUnknownMediaType", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		delegate, h := setupFn(ctl, dir)
+		resp := httptest.NewRecorder()
+		req := toUploadRequest(`{"@context":"https://www.w3.org/ns/activitystreams","type":"Document"}`, testPNG, "upload", "application/octet-stream")
+		// Mock
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostOutboxRequestBodyHook(ctx, req, gomock.Any()).DoAndReturn(func(c context.Context, r *http.Request, data vocab.Type) (context.Context, error) {
+			doc := data.(vocab.ActivityStreamsDocument)
+			assertEqual(t, doc.GetActivityStreamsMediaType().Get(), "image/png")
+			return c, nil
+		})
+		delegate.EXPECT().WrapInCreate(ctx, gomock.Any(), mustParse(testMyOutboxIRI)).DoAndReturn(func(c context.Context, t vocab.Type, u *url.URL) (vocab.ActivityStreamsCreate, error) {
+			return wrappedInCreate(t), nil
+		})
+		delegate.EXPECT().AddNewIDs(ctx, gomock.Any()).DoAndReturn(func(c context.Context, activity Activity) error {
+			withNewId(activity)
+			return nil
+		})
+		delegate.EXPECT().PostOutbox(ctx, gomock.Any(), mustParse(testMyOutboxIRI), gomock.Any()).Return(true, nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusCreated)
+	})
+	t.Run("BadRequestForActiveContent", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		delegate, h := setupFn(ctl, dir)
+		resp := httptest.NewRecorder()
+		req := toUploadRequest(`{"@context":"https://www.w3.org/ns/activitystreams","type":"Image"}`, []byte("<html><script>alert(1)</script></html>"), "cat.png", "image/png")
+		// Mock
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+		files, err := ioutil.ReadDir(dir)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(files), 0)
+	})
+	t.Run("DeletesFileWhenPostFails", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		delegate, h := setupFn(ctl, dir)
+		resp := httptest.NewRecorder()
+		req := toUploadRequest(`{"@context":"https://www.w3.org/ns/activitystreams","type":"Image"}`, testPNG, "cat.png", "image/png")
+		// Mock
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostOutboxRequestBodyHook(ctx, req, gomock.Any()).Return(ctx, malformedf("rejected"))
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+		files, err := ioutil.ReadDir(dir)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(files), 0)
+	})
+	t.Run("KeepsFileWhenDeliveryFails", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		delegate := NewMockDelegateActor(ctl)
+		a := NewCustomActor(
+			delegate,
+			/*enableSocialProtocol=*/ true,
+			/*enableFederatedProtocol=*/ true,
+			NewMockClock(ctl))
+		h := NewMediaUploadHandler(a, MediaUploadConfig{
+			Storage: NewLocalMediaStorage(dir, mustParse(testMediaBaseIRI)),
+		})
+		resp := httptest.NewRecorder()
+		req := toUploadRequest(`{"@context":"https://www.w3.org/ns/activitystreams","type":"Image"}`, testPNG, "cat.png", "image/png")
+		testErr := errors.New("test error")
+		// Mock
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		delegate.EXPECT().PostOutboxRequestBodyHook(ctx, req, gomock.Any()).Return(ctx, nil)
+		delegate.EXPECT().WrapInCreate(ctx, gomock.Any(), mustParse(testMyOutboxIRI)).DoAndReturn(func(c context.Context, t vocab.Type, u *url.URL) (vocab.ActivityStreamsCreate, error) {
+			return wrappedInCreate(t), nil
+		})
+		delegate.EXPECT().AddNewIDs(ctx, gomock.Any()).DoAndReturn(func(c context.Context, activity Activity) error {
+			withNewId(activity)
+			return nil
+		})
+		delegate.EXPECT().PostOutbox(ctx, gomock.Any(), mustParse(testMyOutboxIRI), gomock.Any()).Return(true, nil)
+		delegate.EXPECT().Deliver(ctx, mustParse(testMyOutboxIRI), gomock.Any()).Return(testErr)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, testErr)
+		assertEqual(t, handled, true)
+		files, err := ioutil.ReadDir(dir)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(files), 1)
+	})
+	t.Run("BadRequestForNonDocument", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		delegate, h := setupFn(ctl, dir)
+		resp := httptest.NewRecorder()
+		req := toUploadRequest(`{"@context":"https://www.w3.org/ns/activitystreams","type":"Note"}`, testPNG, "cat.png", "image/png")
+		// Mock
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("BadRequestWithoutFile", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		delegate, h := setupFn(ctl, dir)
+		resp := httptest.NewRecorder()
+		req := toUploadRequest(`{"@context":"https://www.w3.org/ns/activitystreams","type":"Image"}`, nil, "", "")
+		// Mock
+		delegate.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
+}
+
+// TestLocalMediaStorage tests storing and serving media files locally.
+func TestLocalMediaStorage(t *testing.T) {
+	t.Run("ServesStoredFile", func(t *testing.T) {
+		// Setup
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		s := NewLocalMediaStorage(dir, mustParse(testMediaBaseIRI))
+		// Run
+		iri, err := s.StoreMedia(context.Background(), "../../etc/passwd", "image/png", bytes.NewReader(testPNG))
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, path.Dir(iri.Path), "/media")
+		resp := httptest.NewRecorder()
+		s.Handler().ServeHTTP(resp, httptest.NewRequest("GET", iri.String(), nil))
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertByteEqual(t, resp.Body.Bytes(), testPNG)
+		assertEqual(t, path.Ext(iri.Path), ".png")
+		assertEqual(t, resp.Header().Get("X-Content-Type-Options"), "nosniff")
+		assertEqual(t, resp.Header().Get("Content-Disposition"), "")
+	})
+	t.Run("ServesOtherFilesAsAttachments", func(t *testing.T) {
+		// Setup
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		s := NewLocalMediaStorage(dir, mustParse(testMediaBaseIRI))
+		err := ioutil.WriteFile(filepath.Join(dir, "page.html"), []byte("<html></html>"), 0644)
+		assertEqual(t, err, nil)
+		// Run
+		resp := httptest.NewRecorder()
+		s.Handler().ServeHTTP(resp, httptest.NewRequest("GET", testMediaBaseIRI+"/page.html", nil))
+		// Verify
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, resp.Header().Get("X-Content-Type-Options"), "nosniff")
+		assertEqual(t, resp.Header().Get("Content-Disposition"), "attachment")
+	})
+	t.Run("DoesNotServeDirectories", func(t *testing.T) {
+		// Setup
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		s := NewLocalMediaStorage(dir, mustParse(testMediaBaseIRI))
+		_, err := s.StoreMedia(context.Background(), "cat.png", "image/png", bytes.NewReader(testPNG))
+		assertEqual(t, err, nil)
+		err = os.Mkdir(filepath.Join(dir, "sub"), 0755)
+		assertEqual(t, err, nil)
+		for _, target := range []string{testMediaBaseIRI + "/", testMediaBaseIRI + "/sub", testMediaBaseIRI + "/sub/"} {
+			// Run
+			resp := httptest.NewRecorder()
+			s.Handler().ServeHTTP(resp, httptest.NewRequest("GET", target, nil))
+			// Verify
+			assertEqual(t, resp.Code, http.StatusNotFound)
+		}
+	})
+	t.Run("RejectsDisallowedMediaType", func(t *testing.T) {
+		// Setup
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		s := NewLocalMediaStorage(dir, mustParse(testMediaBaseIRI))
+		// Run
+		_, err := s.StoreMedia(context.Background(), "page.html", "text/html", bytes.NewReader([]byte("<html></html>")))
+		// Verify
+		if err == nil {
+			t.Fatal("stored a disallowed media type")
+		}
+	})
+	t.Run("DeletesStoredFile", func(t *testing.T) {
+		// Setup
+		dir := mustTempDir()
+		defer os.RemoveAll(dir)
+		s := NewLocalMediaStorage(dir, mustParse(testMediaBaseIRI))
+		iri, err := s.StoreMedia(context.Background(), "cat.png", "image/png", bytes.NewReader(testPNG))
+		assertEqual(t, err, nil)
+		// Run
+		err = s.DeleteMedia(context.Background(), iri)
+		// Verify
+		assertEqual(t, err, nil)
+		files, err := ioutil.ReadDir(dir)
+		assertEqual(t, err, nil)
+		assertEqual(t, len(files), 0)
+	})
+}
@@ -0,0 +1,7 @@
+// Package memdb implements a pub.Database keeping everything in memory, for
+// prototyping applications and testing them.
+//
+// Values are stored in their JSON representation, so that the values returned
+// by the Database are never shared with callers, and the whole Database may be
+// saved with Snapshot and loaded again with Restore.
+package memdb
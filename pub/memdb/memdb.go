@@ -0,0 +1,553 @@
+package memdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const (
+	// beforeCursor prefixes the cursors of pages with the items older than
+	// a position.
+	beforeCursor = "before:"
+	// afterCursor prefixes the cursors of pages with the items more recent
+	// than a position.
+	afterCursor = "after:"
+)
+
+// Config configures a Database.
+type Config struct {
+	// Hosts are the hosts of the IRIs owned by this server, such as
+	// "example.com". NewID creates IRIs on the first one.
+	Hosts []string
+	// Scheme is the protocol scheme of the IRIs created by NewID. If
+	// empty, "https" is used.
+	Scheme string
+}
+
+// Database is a pub.Database kept in memory. It is safe for concurrent use.
+type Database struct {
+	hosts  []string
+	scheme string
+	// locks are the per-IRI locks taken with Lock.
+	locksMu sync.Mutex
+	locks   map[string]*lock
+	// mu guards the data below, independently of the per-IRI locks.
+	mu       sync.RWMutex
+	objects  map[string]json.RawMessage
+	inboxes  map[string][]string
+	outboxes map[string][]string
+	actors   actorIndex
+}
+
+var _ pub.Database = &Database{}
+
+// lock is the lock of an IRI.
+type lock struct {
+	// ch holds a value while the lock is taken.
+	ch chan struct{}
+	// refs counts the callers holding or waiting for the lock.
+	refs int
+}
+
+// actorIndex maps the inboxes and outboxes of the stored actors to them.
+type actorIndex struct {
+	byInbox  map[string]string
+	byOutbox map[string]string
+	inbox    map[string]string
+}
+
+// snapshot is the JSON representation of a Database.
+type snapshot struct {
+	Objects  map[string]json.RawMessage `json:"objects"`
+	Inboxes  map[string][]string        `json:"inboxes"`
+	Outboxes map[string][]string        `json:"outboxes"`
+}
+
+// New returns an empty Database.
+func New(cfg Config) *Database {
+	if len(cfg.Scheme) == 0 {
+		cfg.Scheme = "https"
+	}
+	return &Database{
+		hosts:    cfg.Hosts,
+		scheme:   cfg.Scheme,
+		locks:    make(map[string]*lock),
+		objects:  make(map[string]json.RawMessage),
+		inboxes:  make(map[string][]string),
+		outboxes: make(map[string][]string),
+		actors:   newActorIndex(),
+	}
+}
+
+// newActorIndex returns an empty actorIndex.
+func newActorIndex() actorIndex {
+	return actorIndex{
+		byInbox:  make(map[string]string),
+		byOutbox: make(map[string]string),
+		inbox:    make(map[string]string),
+	}
+}
+
+// Lock waits for the lock of the IRI, or for the context to be done.
+func (d *Database) Lock(c context.Context, id *url.URL) error {
+	k := id.String()
+	d.locksMu.Lock()
+	l, ok := d.locks[k]
+	if !ok {
+		l = &lock{ch: make(chan struct{}, 1)}
+		d.locks[k] = l
+	}
+	l.refs++
+	d.locksMu.Unlock()
+	select {
+	case l.ch <- struct{}{}:
+		return nil
+	case <-c.Done():
+		d.release(k, l)
+		return c.Err()
+	}
+}
+
+// Unlock releases the lock of the IRI.
+func (d *Database) Unlock(c context.Context, id *url.URL) error {
+	k := id.String()
+	d.locksMu.Lock()
+	l, ok := d.locks[k]
+	d.locksMu.Unlock()
+	if !ok {
+		return fmt.Errorf("memdb: %s is not locked", id)
+	}
+	select {
+	case <-l.ch:
+	default:
+		return fmt.Errorf("memdb: %s is not locked", id)
+	}
+	d.release(k, l)
+	return nil
+}
+
+// release drops a reference to the lock, forgetting it once unused.
+func (d *Database) release(k string, l *lock) {
+	d.locksMu.Lock()
+	defer d.locksMu.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(d.locks, k)
+	}
+}
+
+// InboxContains determines whether the id is in the inbox.
+func (d *Database) InboxContains(c context.Context, inbox, id *url.URL) (contains bool, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return containsString(d.inboxes[inbox.String()], id.String()), nil
+}
+
+// AppendInbox adds the id to the inbox as its most recent item.
+func (d *Database) AppendInbox(c context.Context, inbox, id *url.URL) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inboxes[inbox.String()] = append(d.inboxes[inbox.String()], id.String())
+	return nil
+}
+
+// InboxTotalItems returns the number of items in the inbox.
+func (d *Database) InboxTotalItems(c context.Context, inbox *url.URL) (n int, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.inboxes[inbox.String()]), nil
+}
+
+// GetInboxPage returns a page of the ids in the inbox.
+func (d *Database) GetInboxPage(c context.Context, inbox *url.URL, q pub.PageQuery) (page pub.CollectionPage, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return getPage(d.inboxes[inbox.String()], q)
+}
+
+// Owns determines whether the IRI is on one of the configured hosts.
+func (d *Database) Owns(c context.Context, id *url.URL) (owns bool, err error) {
+	for _, h := range d.hosts {
+		if strings.EqualFold(id.Host, h) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ActorForOutbox returns the stored actor whose 'outbox' is the IRI.
+func (d *Database) ActorForOutbox(c context.Context, outboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return lookupIRI(d.actors.byOutbox, outboxIRI)
+}
+
+// ActorForInbox returns the stored actor whose 'inbox' is the IRI.
+func (d *Database) ActorForInbox(c context.Context, inboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return lookupIRI(d.actors.byInbox, inboxIRI)
+}
+
+// OutboxForInbox returns the 'outbox' of the stored actor whose 'inbox' is the
+// IRI.
+func (d *Database) OutboxForInbox(c context.Context, inboxIRI *url.URL) (outboxIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	actorIRI, ok := d.actors.byInbox[inboxIRI.String()]
+	if !ok {
+		return nil, &pub.NotFoundError{Err: fmt.Errorf("memdb: no actor has inbox %s", inboxIRI)}
+	}
+	for outbox, actor := range d.actors.byOutbox {
+		if actor == actorIRI {
+			return url.Parse(outbox)
+		}
+	}
+	return nil, &pub.NotFoundError{Err: fmt.Errorf("memdb: actor %s has no outbox", actorIRI)}
+}
+
+// InboxForActor returns the 'inbox' of the stored actor, or nil if the actor
+// is not stored.
+func (d *Database) InboxForActor(c context.Context, actorIRI *url.URL) (inboxIRI *url.URL, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	inbox, ok := d.actors.inbox[actorIRI.String()]
+	if !ok {
+		return nil, nil
+	}
+	return url.Parse(inbox)
+}
+
+// Exists determines whether a value with the id is stored.
+func (d *Database) Exists(c context.Context, id *url.URL) (exists bool, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, exists = d.objects[id.String()]
+	return
+}
+
+// Get returns a copy of the stored value with the id, or pub.ErrNotFound.
+func (d *Database) Get(c context.Context, id *url.URL) (value vocab.Type, err error) {
+	d.mu.RLock()
+	raw, ok := d.objects[id.String()]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, pub.ErrNotFound
+	}
+	return toType(c, raw)
+}
+
+// Create stores the value, replacing any with the same id.
+func (d *Database) Create(c context.Context, asType vocab.Type) error {
+	return d.put(asType)
+}
+
+// Update stores the value, replacing any with the same id.
+func (d *Database) Update(c context.Context, asType vocab.Type) error {
+	return d.put(asType)
+}
+
+// Delete removes the value with the id.
+func (d *Database) Delete(c context.Context, id *url.URL) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.objects, id.String())
+	d.actors.remove(id.String())
+	return nil
+}
+
+// AppendOutbox adds the id to the outbox as its most recent item.
+func (d *Database) AppendOutbox(c context.Context, outbox, id *url.URL) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.outboxes[outbox.String()] = append(d.outboxes[outbox.String()], id.String())
+	return nil
+}
+
+// OutboxTotalItems returns the number of items in the outbox.
+func (d *Database) OutboxTotalItems(c context.Context, outbox *url.URL) (n int, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.outboxes[outbox.String()]), nil
+}
+
+// GetOutboxPage returns a page of the ids in the outbox.
+func (d *Database) GetOutboxPage(c context.Context, outbox *url.URL, q pub.PageQuery) (page pub.CollectionPage, err error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return getPage(d.outboxes[outbox.String()], q)
+}
+
+// NewID returns a random IRI on the first configured host, under a path named
+// after the value's type, such as "https://example.com/note/8f3a...".
+func (d *Database) NewID(c context.Context, t vocab.Type) (id *url.URL, err error) {
+	if len(d.hosts) == 0 {
+		return nil, fmt.Errorf("memdb: no hosts configured to create ids on")
+	}
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	return &url.URL{
+		Scheme: d.scheme,
+		Host:   d.hosts[0],
+		Path:   path.Join("/", strings.ToLower(t.GetTypeName()), hex.EncodeToString(b)),
+	}, nil
+}
+
+// Followers returns the collection in the 'followers' of the stored actor.
+func (d *Database) Followers(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, "followers")
+}
+
+// Following returns the collection in the 'following' of the stored actor.
+func (d *Database) Following(c context.Context, actorIRI *url.URL) (following vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, "following")
+}
+
+// Liked returns the collection in the 'liked' of the stored actor.
+func (d *Database) Liked(c context.Context, actorIRI *url.URL) (liked vocab.ActivityStreamsCollection, err error) {
+	return d.actorCollection(c, actorIRI, "liked")
+}
+
+// Snapshot writes the JSON representation of the stored values, inboxes, and
+// outboxes.
+func (d *Database) Snapshot(w io.Writer) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return json.NewEncoder(w).Encode(snapshot{
+		Objects:  d.objects,
+		Inboxes:  d.inboxes,
+		Outboxes: d.outboxes,
+	})
+}
+
+// Restore replaces the contents of the Database with a representation written
+// by Snapshot.
+func (d *Database) Restore(r io.Reader) error {
+	var s snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+	if s.Objects == nil {
+		s.Objects = make(map[string]json.RawMessage)
+	}
+	if s.Inboxes == nil {
+		s.Inboxes = make(map[string][]string)
+	}
+	if s.Outboxes == nil {
+		s.Outboxes = make(map[string][]string)
+	}
+	actors := newActorIndex()
+	for id, raw := range s.Objects {
+		var m map[string]interface{}
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return fmt.Errorf("memdb: restoring %s: %w", id, err)
+		}
+		actors.add(id, m)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.objects = s.Objects
+	d.inboxes = s.Inboxes
+	d.outboxes = s.Outboxes
+	d.actors = actors
+	return nil
+}
+
+// put stores the value by its id.
+func (d *Database) put(t vocab.Type) error {
+	id, err := pub.GetId(t)
+	if err != nil {
+		return err
+	}
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.objects[id.String()] = raw
+	d.actors.remove(id.String())
+	d.actors.add(id.String(), m)
+	return nil
+}
+
+// actorCollection returns the stored collection named by the property of the
+// stored actor, or an empty one with that id if it is not yet stored.
+func (d *Database) actorCollection(c context.Context, actorIRI *url.URL, property string) (vocab.ActivityStreamsCollection, error) {
+	d.mu.RLock()
+	actorRaw, ok := d.objects[actorIRI.String()]
+	d.mu.RUnlock()
+	if !ok {
+		return nil, &pub.NotFoundError{Err: fmt.Errorf("memdb: actor %s not found", actorIRI)}
+	}
+	var actor map[string]interface{}
+	if err := json.Unmarshal(actorRaw, &actor); err != nil {
+		return nil, err
+	}
+	s, ok := actor[property].(string)
+	if !ok {
+		return nil, fmt.Errorf("memdb: actor %s has no %s collection", actorIRI, property)
+	}
+	id, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	raw, ok := d.objects[id.String()]
+	d.mu.RUnlock()
+	if !ok {
+		col := streams.NewActivityStreamsCollection()
+		idProp := streams.NewJSONLDIdProperty()
+		idProp.Set(id)
+		col.SetJSONLDId(idProp)
+		col.SetActivityStreamsItems(streams.NewActivityStreamsItemsProperty())
+		return col, nil
+	}
+	t, err := toType(c, raw)
+	if err != nil {
+		return nil, err
+	}
+	col, ok := t.(vocab.ActivityStreamsCollection)
+	if !ok {
+		return nil, fmt.Errorf("memdb: %s is a %s, not a Collection", id, t.GetTypeName())
+	}
+	return col, nil
+}
+
+// add indexes the value if it is an actor with an inbox or outbox.
+func (a actorIndex) add(id string, m map[string]interface{}) {
+	if inbox, ok := m["inbox"].(string); ok {
+		a.byInbox[inbox] = id
+		a.inbox[id] = inbox
+	}
+	if outbox, ok := m["outbox"].(string); ok {
+		a.byOutbox[outbox] = id
+	}
+}
+
+// remove forgets the value with the id.
+func (a actorIndex) remove(id string) {
+	if inbox, ok := a.inbox[id]; ok {
+		delete(a.byInbox, inbox)
+		delete(a.inbox, id)
+	}
+	for outbox, actor := range a.byOutbox {
+		if actor == id {
+			delete(a.byOutbox, outbox)
+		}
+	}
+}
+
+// lookupIRI returns the IRI indexed by the key, or a pub.NotFoundError.
+func lookupIRI(index map[string]string, key *url.URL) (*url.URL, error) {
+	s, ok := index[key.String()]
+	if !ok {
+		return nil, &pub.NotFoundError{Err: fmt.Errorf("memdb: no actor has box %s", key)}
+	}
+	return url.Parse(s)
+}
+
+// getPage returns the page of the ids, which are ordered oldest first, selected
+// by the query.
+func getPage(ids []string, q pub.PageQuery) (page pub.CollectionPage, err error) {
+	n := len(ids)
+	limit := q.Limit
+	if limit <= 0 {
+		limit = n
+	}
+	// The page holds the ids in [lo, hi).
+	var lo, hi int
+	switch {
+	case q.Last:
+		lo, hi = 0, minInt(limit, n)
+	case strings.HasPrefix(q.Cursor, beforeCursor):
+		var pos int
+		if pos, err = strconv.Atoi(strings.TrimPrefix(q.Cursor, beforeCursor)); err != nil {
+			err = &pub.MalformedError{Err: fmt.Errorf("memdb: malformed cursor %q: %w", q.Cursor, err)}
+			return
+		}
+		hi = minInt(maxInt(pos, 0), n)
+		lo = maxInt(hi-limit, 0)
+	case strings.HasPrefix(q.Cursor, afterCursor):
+		var pos int
+		if pos, err = strconv.Atoi(strings.TrimPrefix(q.Cursor, afterCursor)); err != nil {
+			err = &pub.MalformedError{Err: fmt.Errorf("memdb: malformed cursor %q: %w", q.Cursor, err)}
+			return
+		}
+		lo = minInt(maxInt(pos+1, 0), n)
+		hi = minInt(lo+limit, n)
+	case len(q.Cursor) == 0:
+		lo, hi = maxInt(n-limit, 0), n
+	default:
+		err = &pub.MalformedError{Err: fmt.Errorf("memdb: unknown cursor %q", q.Cursor)}
+		return
+	}
+	for i := hi - 1; i >= lo; i-- {
+		var id *url.URL
+		if id, err = url.Parse(ids[i]); err != nil {
+			return
+		}
+		page.Items = append(page.Items, id)
+	}
+	if lo > 0 {
+		page.Next = beforeCursor + strconv.Itoa(lo)
+	}
+	if hi < n {
+		page.Prev = afterCursor + strconv.Itoa(hi-1)
+	}
+	return
+}
+
+// toType deserializes a stored value.
+func toType(c context.Context, raw json.RawMessage) (vocab.Type, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return streams.ToType(c, m)
+}
+
+// containsString determines whether the string is one of the entries.
+func containsString(entries []string, s string) bool {
+	for _, e := range entries {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// minInt returns the smaller integer.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxInt returns the larger integer.
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
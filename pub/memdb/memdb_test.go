@@ -0,0 +1,308 @@
+package memdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// mustParse parses the IRI, panicking on failure.
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// newNote returns a Note with the id and content.
+func newNote(id, content string) vocab.ActivityStreamsNote {
+	n := streams.NewActivityStreamsNote()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(mustParse(id))
+	n.SetJSONLDId(idProp)
+	contentProp := streams.NewActivityStreamsContentProperty()
+	contentProp.AppendXMLSchemaString(content)
+	n.SetActivityStreamsContent(contentProp)
+	return n
+}
+
+// newActor returns the document of an actor with the default collections.
+func newActor(t *testing.T, id string) vocab.Type {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := pub.NewActorDocument(pub.ActorConfig{
+		Id:        mustParse(id),
+		PublicKey: &key.PublicKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// TestLock tests the per-IRI locks.
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	iri := mustParse("https://example.com/addison")
+	t.Run("BlocksUntilUnlocked", func(t *testing.T) {
+		d := New(Config{})
+		if err := d.Lock(ctx, iri); err != nil {
+			t.Fatal(err)
+		}
+		locked := make(chan struct{})
+		go func() {
+			d.Lock(ctx, iri)
+			close(locked)
+		}()
+		select {
+		case <-locked:
+			t.Fatalf("second Lock did not block")
+		case <-time.After(10 * time.Millisecond):
+		}
+		if err := d.Unlock(ctx, iri); err != nil {
+			t.Fatal(err)
+		}
+		<-locked
+		if err := d.Unlock(ctx, iri); err != nil {
+			t.Fatal(err)
+		}
+		if len(d.locks) != 0 {
+			t.Fatalf("got %d locks, want none", len(d.locks))
+		}
+	})
+	t.Run("DoesNotBlockOtherIRIs", func(t *testing.T) {
+		d := New(Config{})
+		if err := d.Lock(ctx, iri); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Lock(ctx, mustParse("https://example.com/sam")); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("StopsWaitingWhenContextDone", func(t *testing.T) {
+		d := New(Config{})
+		if err := d.Lock(ctx, iri); err != nil {
+			t.Fatal(err)
+		}
+		c, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := d.Lock(c, iri); err == nil {
+			t.Fatalf("got no error, want the context's")
+		}
+	})
+	t.Run("UnlockWithoutLockFails", func(t *testing.T) {
+		d := New(Config{})
+		if err := d.Unlock(ctx, iri); err == nil {
+			t.Fatalf("got no error, want one")
+		}
+	})
+}
+
+// TestDatabase tests storing values and collections.
+func TestDatabase(t *testing.T) {
+	ctx := context.Background()
+	t.Run("StoresCopies", func(t *testing.T) {
+		d := New(Config{Hosts: []string{"example.com"}})
+		n := newNote("https://example.com/note/1", "hello")
+		if err := d.Create(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+		n.GetActivityStreamsContent().At(0).SetXMLSchemaString("changed")
+		got, err := d.Get(ctx, mustParse("https://example.com/note/1"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := got.(vocab.ActivityStreamsNote).GetActivityStreamsContent().At(0).GetXMLSchemaString(); s != "hello" {
+			t.Fatalf("got content %q, want %q", s, "hello")
+		}
+		if exists, _ := d.Exists(ctx, mustParse("https://example.com/note/1")); !exists {
+			t.Fatalf("note does not exist")
+		}
+		if err := d.Delete(ctx, mustParse("https://example.com/note/1")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.Get(ctx, mustParse("https://example.com/note/1")); pub.ErrorStatusCode(err) != 404 {
+			t.Fatalf("got %v, want not found", err)
+		}
+	})
+	t.Run("OwnsConfiguredHosts", func(t *testing.T) {
+		d := New(Config{Hosts: []string{"example.com"}})
+		if owns, _ := d.Owns(ctx, mustParse("https://example.com/note/1")); !owns {
+			t.Fatalf("does not own example.com")
+		}
+		if owns, _ := d.Owns(ctx, mustParse("https://other.example.com/note/1")); owns {
+			t.Fatalf("owns other.example.com")
+		}
+	})
+	t.Run("CreatesOwnedIds", func(t *testing.T) {
+		d := New(Config{Hosts: []string{"example.com"}})
+		a, err := d.NewID(ctx, streams.NewActivityStreamsNote())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := d.NewID(ctx, streams.NewActivityStreamsNote())
+		if a.Host != "example.com" || a.String() == b.String() {
+			t.Fatalf("got ids %s and %s, want distinct ones on example.com", a, b)
+		}
+	})
+	t.Run("IndexesActors", func(t *testing.T) {
+		d := New(Config{Hosts: []string{"example.com"}})
+		if err := d.Create(ctx, newActor(t, "https://example.com/addison")); err != nil {
+			t.Fatal(err)
+		}
+		inbox := mustParse("https://example.com/addison/inbox")
+		actor, err := d.ActorForInbox(ctx, inbox)
+		if err != nil || actor.String() != "https://example.com/addison" {
+			t.Fatalf("got %v and %v, want the actor", actor, err)
+		}
+		actor, err = d.ActorForOutbox(ctx, mustParse("https://example.com/addison/outbox"))
+		if err != nil || actor.String() != "https://example.com/addison" {
+			t.Fatalf("got %v and %v, want the actor", actor, err)
+		}
+		outbox, err := d.OutboxForInbox(ctx, inbox)
+		if err != nil || outbox.String() != "https://example.com/addison/outbox" {
+			t.Fatalf("got %v and %v, want the outbox", outbox, err)
+		}
+		got, err := d.InboxForActor(ctx, mustParse("https://example.com/addison"))
+		if err != nil || got.String() != inbox.String() {
+			t.Fatalf("got %v and %v, want the inbox", got, err)
+		}
+		if got, err := d.InboxForActor(ctx, mustParse("https://example.com/sam")); got != nil || err != nil {
+			t.Fatalf("got %v and %v, want nothing", got, err)
+		}
+	})
+	t.Run("StoresFollowers", func(t *testing.T) {
+		d := New(Config{Hosts: []string{"example.com"}})
+		actorIRI := mustParse("https://example.com/addison")
+		if err := d.Create(ctx, newActor(t, actorIRI.String())); err != nil {
+			t.Fatal(err)
+		}
+		followers, err := d.Followers(ctx, actorIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		followers.GetActivityStreamsItems().AppendIRI(mustParse("https://other.example.com/sam"))
+		if err := d.Update(ctx, followers); err != nil {
+			t.Fatal(err)
+		}
+		followers, err = d.Followers(ctx, actorIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if followers.GetJSONLDId().Get().String() != "https://example.com/addison/followers" || followers.GetActivityStreamsItems().Len() != 1 {
+			t.Fatalf("got unexpected followers")
+		}
+		if _, err := d.Liked(ctx, mustParse("https://example.com/sam")); err == nil {
+			t.Fatalf("got no error for an unknown actor")
+		}
+	})
+	t.Run("PagesInbox", func(t *testing.T) {
+		d := New(Config{Hosts: []string{"example.com"}})
+		inbox := mustParse("https://example.com/addison/inbox")
+		for _, s := range []string{"1", "2", "3", "4", "5"} {
+			if err := d.AppendInbox(ctx, inbox, mustParse("https://other.example.com/activity/"+s)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n, _ := d.InboxTotalItems(ctx, inbox); n != 5 {
+			t.Fatalf("got %d items, want 5", n)
+		}
+		if contains, _ := d.InboxContains(ctx, inbox, mustParse("https://other.example.com/activity/3")); !contains {
+			t.Fatalf("inbox does not contain activity 3")
+		}
+		first, err := d.GetInboxPage(ctx, inbox, pub.PageQuery{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertItems(t, first, "5", "4")
+		if len(first.Prev) > 0 {
+			t.Fatalf("first page has a previous page")
+		}
+		second, err := d.GetInboxPage(ctx, inbox, pub.PageQuery{Cursor: first.Next, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertItems(t, second, "3", "2")
+		back, err := d.GetInboxPage(ctx, inbox, pub.PageQuery{Cursor: second.Prev, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertItems(t, back, "5", "4")
+		last, err := d.GetInboxPage(ctx, inbox, pub.PageQuery{Last: true, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertItems(t, last, "2", "1")
+		if len(last.Next) > 0 {
+			t.Fatalf("last page has a next page")
+		}
+	})
+	t.Run("RejectsMalformedCursors", func(t *testing.T) {
+		d := New(Config{Hosts: []string{"example.com"}})
+		inbox := mustParse("https://example.com/addison/inbox")
+		for _, cursor := range []string{"unknown", beforeCursor + "x", afterCursor + "x"} {
+			_, err := d.GetInboxPage(ctx, inbox, pub.PageQuery{Cursor: cursor, Limit: 2})
+			var malformed *pub.MalformedError
+			if !errors.As(err, &malformed) {
+				t.Fatalf("got %v for cursor %q, want a MalformedError", err, cursor)
+			}
+		}
+	})
+	t.Run("SnapshotsAndRestores", func(t *testing.T) {
+		d := New(Config{Hosts: []string{"example.com"}})
+		if err := d.Create(ctx, newActor(t, "https://example.com/addison")); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Create(ctx, newNote("https://example.com/note/1", "hello")); err != nil {
+			t.Fatal(err)
+		}
+		outbox := mustParse("https://example.com/addison/outbox")
+		if err := d.AppendOutbox(ctx, outbox, mustParse("https://example.com/note/1")); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := d.Snapshot(&buf); err != nil {
+			t.Fatal(err)
+		}
+		restored := New(Config{Hosts: []string{"example.com"}})
+		if err := restored.Restore(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := restored.Get(ctx, mustParse("https://example.com/note/1")); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := restored.OutboxTotalItems(ctx, outbox); n != 1 {
+			t.Fatalf("got %d outbox items, want 1", n)
+		}
+		if actor, err := restored.ActorForOutbox(ctx, outbox); err != nil || actor.String() != "https://example.com/addison" {
+			t.Fatalf("got %v and %v, want the actor", actor, err)
+		}
+	})
+}
+
+// assertItems fails the test if the page does not hold the activities with the
+// suffixes, in order.
+func assertItems(t *testing.T, page pub.CollectionPage, suffixes ...string) {
+	t.Helper()
+	if len(page.Items) != len(suffixes) {
+		t.Fatalf("got %d items, want %d", len(page.Items), len(suffixes))
+	}
+	for i, s := range suffixes {
+		if want := "https://other.example.com/activity/" + s; page.Items[i].String() != want {
+			t.Fatalf("got item %d %s, want %s", i, page.Items[i], want)
+		}
+	}
+}
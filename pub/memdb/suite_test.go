@@ -0,0 +1,16 @@
+package memdb_test
+
+import (
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/pub/memdb"
+	"github.com/go-fed/activity/pub/pubtest"
+)
+
+// TestDatabaseSuite runs the conformance suite of pub.Database.
+func TestDatabaseSuite(t *testing.T) {
+	pubtest.RunDatabaseSuite(t, func(t *testing.T) pub.Database {
+		return memdb.New(memdb.Config{Hosts: []string{"example.com"}})
+	})
+}
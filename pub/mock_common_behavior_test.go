@@ -6,7 +6,6 @@ package pub
 
 import (
 	context "context"
-	vocab "github.com/go-fed/activity/streams/vocab"
 	gomock "github.com/golang/mock/gomock"
 	http "net/http"
 	url "net/url"
@@ -68,21 +67,6 @@ func (mr *MockCommonBehaviorMockRecorder) AuthenticateGetOutbox(c, w, r interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AuthenticateGetOutbox", reflect.TypeOf((*MockCommonBehavior)(nil).AuthenticateGetOutbox), c, w, r)
 }
 
-// GetOutbox mocks base method
-func (m *MockCommonBehavior) GetOutbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOutbox", c, r)
-	ret0, _ := ret[0].(vocab.ActivityStreamsOrderedCollectionPage)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
-}
-
-// GetOutbox indicates an expected call of GetOutbox
-func (mr *MockCommonBehaviorMockRecorder) GetOutbox(c, r interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOutbox", reflect.TypeOf((*MockCommonBehavior)(nil).GetOutbox), c, r)
-}
-
 // NewTransport mocks base method
 func (m *MockCommonBehavior) NewTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (Transport, error) {
 	m.ctrl.T.Helper()
@@ -66,6 +66,34 @@ func (mr *MockDatabaseMockRecorder) ActorForOutbox(c, outboxIRI interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ActorForOutbox", reflect.TypeOf((*MockDatabase)(nil).ActorForOutbox), c, outboxIRI)
 }
 
+// AppendInbox mocks base method.
+func (m *MockDatabase) AppendInbox(c context.Context, inbox, id *url.URL) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendInbox", c, inbox, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendInbox indicates an expected call of AppendInbox.
+func (mr *MockDatabaseMockRecorder) AppendInbox(c, inbox, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendInbox", reflect.TypeOf((*MockDatabase)(nil).AppendInbox), c, inbox, id)
+}
+
+// AppendOutbox mocks base method.
+func (m *MockDatabase) AppendOutbox(c context.Context, outbox, id *url.URL) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendOutbox", c, outbox, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendOutbox indicates an expected call of AppendOutbox.
+func (mr *MockDatabaseMockRecorder) AppendOutbox(c, outbox, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendOutbox", reflect.TypeOf((*MockDatabase)(nil).AppendOutbox), c, outbox, id)
+}
+
 // Create mocks base method.
 func (m *MockDatabase) Create(c context.Context, asType vocab.Type) error {
 	m.ctrl.T.Helper()
@@ -154,34 +182,34 @@ func (mr *MockDatabaseMockRecorder) Get(c, id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockDatabase)(nil).Get), c, id)
 }
 
-// GetInbox mocks base method.
-func (m *MockDatabase) GetInbox(c context.Context, inboxIRI *url.URL) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+// GetInboxPage mocks base method.
+func (m *MockDatabase) GetInboxPage(c context.Context, inbox *url.URL, q PageQuery) (CollectionPage, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetInbox", c, inboxIRI)
-	ret0, _ := ret[0].(vocab.ActivityStreamsOrderedCollectionPage)
+	ret := m.ctrl.Call(m, "GetInboxPage", c, inbox, q)
+	ret0, _ := ret[0].(CollectionPage)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetInbox indicates an expected call of GetInbox.
-func (mr *MockDatabaseMockRecorder) GetInbox(c, inboxIRI interface{}) *gomock.Call {
+// GetInboxPage indicates an expected call of GetInboxPage.
+func (mr *MockDatabaseMockRecorder) GetInboxPage(c, inbox, q interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInbox", reflect.TypeOf((*MockDatabase)(nil).GetInbox), c, inboxIRI)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInboxPage", reflect.TypeOf((*MockDatabase)(nil).GetInboxPage), c, inbox, q)
 }
 
-// GetOutbox mocks base method.
-func (m *MockDatabase) GetOutbox(c context.Context, outboxIRI *url.URL) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+// GetOutboxPage mocks base method.
+func (m *MockDatabase) GetOutboxPage(c context.Context, outbox *url.URL, q PageQuery) (CollectionPage, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOutbox", c, outboxIRI)
-	ret0, _ := ret[0].(vocab.ActivityStreamsOrderedCollectionPage)
+	ret := m.ctrl.Call(m, "GetOutboxPage", c, outbox, q)
+	ret0, _ := ret[0].(CollectionPage)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetOutbox indicates an expected call of GetOutbox.
-func (mr *MockDatabaseMockRecorder) GetOutbox(c, outboxIRI interface{}) *gomock.Call {
+// GetOutboxPage indicates an expected call of GetOutboxPage.
+func (mr *MockDatabaseMockRecorder) GetOutboxPage(c, outbox, q interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOutbox", reflect.TypeOf((*MockDatabase)(nil).GetOutbox), c, outboxIRI)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOutboxPage", reflect.TypeOf((*MockDatabase)(nil).GetOutboxPage), c, outbox, q)
 }
 
 // InboxContains mocks base method.
@@ -214,6 +242,21 @@ func (mr *MockDatabaseMockRecorder) InboxForActor(c, actorIRI interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InboxForActor", reflect.TypeOf((*MockDatabase)(nil).InboxForActor), c, actorIRI)
 }
 
+// InboxTotalItems mocks base method.
+func (m *MockDatabase) InboxTotalItems(c context.Context, inbox *url.URL) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InboxTotalItems", c, inbox)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InboxTotalItems indicates an expected call of InboxTotalItems.
+func (mr *MockDatabaseMockRecorder) InboxTotalItems(c, inbox interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InboxTotalItems", reflect.TypeOf((*MockDatabase)(nil).InboxTotalItems), c, inbox)
+}
+
 // Liked mocks base method.
 func (m *MockDatabase) Liked(c context.Context, actorIRI *url.URL) (vocab.ActivityStreamsCollection, error) {
 	m.ctrl.T.Helper()
@@ -273,6 +316,21 @@ func (mr *MockDatabaseMockRecorder) OutboxForInbox(c, inboxIRI interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OutboxForInbox", reflect.TypeOf((*MockDatabase)(nil).OutboxForInbox), c, inboxIRI)
 }
 
+// OutboxTotalItems mocks base method.
+func (m *MockDatabase) OutboxTotalItems(c context.Context, outbox *url.URL) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OutboxTotalItems", c, outbox)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OutboxTotalItems indicates an expected call of OutboxTotalItems.
+func (mr *MockDatabaseMockRecorder) OutboxTotalItems(c, outbox interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OutboxTotalItems", reflect.TypeOf((*MockDatabase)(nil).OutboxTotalItems), c, outbox)
+}
+
 // Owns mocks base method.
 func (m *MockDatabase) Owns(c context.Context, id *url.URL) (bool, error) {
 	m.ctrl.T.Helper()
@@ -288,34 +346,6 @@ func (mr *MockDatabaseMockRecorder) Owns(c, id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Owns", reflect.TypeOf((*MockDatabase)(nil).Owns), c, id)
 }
 
-// SetInbox mocks base method.
-func (m *MockDatabase) SetInbox(c context.Context, inbox vocab.ActivityStreamsOrderedCollectionPage) error {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetInbox", c, inbox)
-	ret0, _ := ret[0].(error)
-	return ret0
-}
-
-// SetInbox indicates an expected call of SetInbox.
-func (mr *MockDatabaseMockRecorder) SetInbox(c, inbox interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetInbox", reflect.TypeOf((*MockDatabase)(nil).SetInbox), c, inbox)
-}
-
-// SetOutbox mocks base method.
-func (m *MockDatabase) SetOutbox(c context.Context, outbox vocab.ActivityStreamsOrderedCollectionPage) error {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetOutbox", c, outbox)
-	ret0, _ := ret[0].(error)
-	return ret0
-}
-
-// SetOutbox indicates an expected call of SetOutbox.
-func (mr *MockDatabaseMockRecorder) SetOutbox(c, outbox interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOutbox", reflect.TypeOf((*MockDatabase)(nil).SetOutbox), c, outbox)
-}
-
 // Unlock mocks base method.
 func (m *MockDatabase) Unlock(c context.Context, id *url.URL) error {
 	m.ctrl.T.Helper()
@@ -232,31 +232,31 @@ func (mr *MockDelegateActorMockRecorder) WrapInCreate(c, value, outboxIRI interf
 }
 
 // GetOutbox mocks base method
-func (m *MockDelegateActor) GetOutbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+func (m *MockDelegateActor) GetOutbox(c context.Context, outboxIRI *url.URL, r *http.Request) (vocab.Type, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOutbox", c, r)
-	ret0, _ := ret[0].(vocab.ActivityStreamsOrderedCollectionPage)
+	ret := m.ctrl.Call(m, "GetOutbox", c, outboxIRI, r)
+	ret0, _ := ret[0].(vocab.Type)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetOutbox indicates an expected call of GetOutbox
-func (mr *MockDelegateActorMockRecorder) GetOutbox(c, r interface{}) *gomock.Call {
+func (mr *MockDelegateActorMockRecorder) GetOutbox(c, outboxIRI, r interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOutbox", reflect.TypeOf((*MockDelegateActor)(nil).GetOutbox), c, r)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOutbox", reflect.TypeOf((*MockDelegateActor)(nil).GetOutbox), c, outboxIRI, r)
 }
 
 // GetInbox mocks base method
-func (m *MockDelegateActor) GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
+func (m *MockDelegateActor) GetInbox(c context.Context, inboxIRI *url.URL, r *http.Request) (vocab.Type, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetInbox", c, r)
-	ret0, _ := ret[0].(vocab.ActivityStreamsOrderedCollectionPage)
+	ret := m.ctrl.Call(m, "GetInbox", c, inboxIRI, r)
+	ret0, _ := ret[0].(vocab.Type)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetInbox indicates an expected call of GetInbox
-func (mr *MockDelegateActorMockRecorder) GetInbox(c, r interface{}) *gomock.Call {
+func (mr *MockDelegateActorMockRecorder) GetInbox(c, inboxIRI, r interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInbox", reflect.TypeOf((*MockDelegateActor)(nil).GetInbox), c, r)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInbox", reflect.TypeOf((*MockDelegateActor)(nil).GetInbox), c, inboxIRI, r)
 }
@@ -6,7 +6,6 @@ package pub
 
 import (
 	context "context"
-	vocab "github.com/go-fed/activity/streams/vocab"
 	gomock "github.com/golang/mock/gomock"
 	http "net/http"
 	url "net/url"
@@ -154,18 +153,3 @@ func (mr *MockFederatingProtocolMockRecorder) FilterForwarding(c, potentialRecip
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FilterForwarding", reflect.TypeOf((*MockFederatingProtocol)(nil).FilterForwarding), c, potentialRecipients, a)
 }
-
-// GetInbox mocks base method
-func (m *MockFederatingProtocol) GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetInbox", c, r)
-	ret0, _ := ret[0].(vocab.ActivityStreamsOrderedCollectionPage)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
-}
-
-// GetInbox indicates an expected call of GetInbox
-func (mr *MockFederatingProtocolMockRecorder) GetInbox(c, r interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInbox", reflect.TypeOf((*MockFederatingProtocol)(nil).GetInbox), c, r)
-}
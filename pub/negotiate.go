@@ -0,0 +1,170 @@
+package pub
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ActivityJSONMediaType is the ActivityStreams media type.
+	ActivityJSONMediaType = "application/activity+json"
+	// LDJSONMediaType is the JSON-LD media type with the ActivityStreams
+	// profile.
+	LDJSONMediaType = "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\""
+	// JSONMediaType is the plain JSON media type, which is served the
+	// ActivityStreams representation.
+	JSONMediaType = "application/json"
+	// HTMLMediaType is the media type of web pages.
+	HTMLMediaType = "text/html"
+	// varyHeader is the Vary header.
+	varyHeader = "Vary"
+)
+
+var (
+	// activityStreamsOffers are the media types of the ActivityStreams
+	// representation, in order of preference.
+	activityStreamsOffers = []string{
+		ActivityJSONMediaType,
+		LDJSONMediaType,
+		JSONMediaType,
+	}
+	// htmlFirstOffers are the media types of both representations, with
+	// the web page preferred when the client does not express a
+	// preference, such as with "*/*".
+	htmlFirstOffers = append([]string{HTMLMediaType}, activityStreamsOffers...)
+)
+
+// mediaRange is a media range of an Accept header, or a media type offered by
+// the server.
+type mediaRange struct {
+	typ     string
+	subtype string
+	params  map[string]string
+	q       float64
+}
+
+// parseMediaRange parses a media range, returning false if it is malformed.
+func parseMediaRange(s string) (m mediaRange, ok bool) {
+	parts := strings.Split(s, ";")
+	typeSubtype := strings.SplitN(strings.ToLower(strings.TrimSpace(parts[0])), "/", 2)
+	if len(typeSubtype) != 2 || len(typeSubtype[0]) == 0 || len(typeSubtype[1]) == 0 {
+		return
+	}
+	m.typ = typeSubtype[0]
+	m.subtype = typeSubtype[1]
+	m.q = 1
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		k := strings.ToLower(strings.TrimSpace(kv[0]))
+		v := strings.Trim(strings.TrimSpace(kv[1]), "\"")
+		if k == "q" {
+			q, err := strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				return
+			}
+			m.q = q
+			continue
+		}
+		if m.params == nil {
+			m.params = make(map[string]string)
+		}
+		m.params[k] = v
+	}
+	ok = true
+	return
+}
+
+// matches determines whether the offered media type is in this range,
+// returning how specific the range is. More specific ranges take precedence.
+func (m mediaRange) matches(offer mediaRange) (specificity int, ok bool) {
+	if m.typ == "*" {
+		return 0, true
+	} else if m.typ != offer.typ {
+		return
+	} else if m.subtype == "*" {
+		return 1, true
+	} else if m.subtype != offer.subtype {
+		return
+	}
+	for k, v := range m.params {
+		if offer.params[k] != v {
+			return
+		}
+	}
+	return 2 + len(m.params), true
+}
+
+// NegotiateContentType determines which of the offered media types best
+// satisfies the Accept header, honoring its quality values and wildcards.
+//
+// Offers that are equally acceptable are decided by the most specific media
+// range matching them, and then by their order. An empty header accepts
+// anything. Returns false if no offer is acceptable, in which case the server
+// should respond with http.StatusNotAcceptable.
+func NegotiateContentType(accept string, offers []string) (mediaType string, ok bool) {
+	if len(strings.TrimSpace(accept)) == 0 {
+		accept = "*/*"
+	}
+	var ranges []mediaRange
+	for _, s := range strings.Split(accept, ",") {
+		if m, valid := parseMediaRange(s); valid {
+			ranges = append(ranges, m)
+		}
+	}
+	bestQ := 0.0
+	bestSpecificity := -1
+	for _, o := range offers {
+		offer, valid := parseMediaRange(o)
+		if !valid {
+			continue
+		}
+		q, specificity := 0.0, -1
+		for _, m := range ranges {
+			if s, match := m.matches(offer); match && s > specificity {
+				q, specificity = m.q, s
+			}
+		}
+		if q > bestQ || (q == bestQ && q > 0 && specificity > bestSpecificity) {
+			mediaType, ok = o, true
+			bestQ, bestSpecificity = q, specificity
+		}
+	}
+	return
+}
+
+// IsActivityStreamsMediaType returns true if the media type returned by
+// NegotiateContentType is served the ActivityStreams representation.
+func IsActivityStreamsMediaType(mediaType string) bool {
+	for _, o := range activityStreamsOffers {
+		if mediaType == o {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateGet determines which representation of the resource to serve to a
+// GET request. Web pages are only offered if html is true.
+func negotiateGet(r *http.Request, html bool) (mediaType string, ok bool) {
+	offers := activityStreamsOffers
+	if html {
+		offers = htmlFirstOffers
+	}
+	return NegotiateContentType(strings.Join(r.Header[acceptHeader], ","), offers)
+}
+
+// addVaryAccept indicates the response depends on the Accept header.
+func addVaryAccept(h http.Header) {
+	for _, v := range h[varyHeader] {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), acceptHeader) {
+				return
+			}
+		}
+	}
+	h.Add(varyHeader, acceptHeader)
+}
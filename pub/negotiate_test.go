@@ -0,0 +1,94 @@
+package pub
+
+import (
+	"testing"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		offers   []string
+		expected string
+		ok       bool
+	}{
+		{
+			"Empty Accepts Anything",
+			"",
+			htmlFirstOffers,
+			HTMLMediaType,
+			true,
+		},
+		{
+			"Wildcard Prefers First Offer",
+			"*/*",
+			activityStreamsOffers,
+			ActivityJSONMediaType,
+			true,
+		},
+		{
+			"Browser",
+			"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			htmlFirstOffers,
+			HTMLMediaType,
+			true,
+		},
+		{
+			"Mastodon",
+			"application/activity+json, application/ld+json",
+			htmlFirstOffers,
+			ActivityJSONMediaType,
+			true,
+		},
+		{
+			"With Quoted Profile",
+			"application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\"",
+			htmlFirstOffers,
+			LDJSONMediaType,
+			true,
+		},
+		{
+			"With Other Profile",
+			"application/ld+json; profile=\"https://example.com/profile\"",
+			htmlFirstOffers,
+			"",
+			false,
+		},
+		{
+			"Plain JSON",
+			"application/json, text/plain, */*",
+			htmlFirstOffers,
+			JSONMediaType,
+			true,
+		},
+		{
+			"Quality Values",
+			"text/html;q=0.5, application/activity+json;q=0.9",
+			htmlFirstOffers,
+			ActivityJSONMediaType,
+			true,
+		},
+		{
+			"Refused Type",
+			"application/activity+json;q=0, text/html",
+			activityStreamsOffers,
+			"",
+			false,
+		},
+		{
+			"Specific Range Overrides Wildcard",
+			"*/*, text/html;q=0",
+			htmlFirstOffers,
+			ActivityJSONMediaType,
+			true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, ok := NegotiateContentType(test.accept, test.offers)
+			if actual != test.expected || ok != test.ok {
+				t.Fatalf("expected %q %v, got %q %v", test.expected, test.ok, actual, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package nodeinfo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// maxDocumentBytes is the largest document read from another server.
+const maxDocumentBytes = 1 << 20
+
+// Client fetches the NodeInfo of other servers.
+type Client struct {
+	client   pub.HttpClient
+	appAgent string
+}
+
+// NewClient returns a Client issuing requests through the HTTP client.
+//
+// The appAgent identifies the calling application in the User-Agent of the
+// requests, alongside the go-fed/activity version.
+func NewClient(client pub.HttpClient, appAgent string) *Client {
+	return &Client{
+		client:   client,
+		appAgent: appAgent,
+	}
+}
+
+// Fetch obtains the NodeInfo document of the server at the host, preferring
+// the 2.1 schema over the 2.0 schema.
+func (cl *Client) Fetch(c context.Context, host string) (*NodeInfo, error) {
+	u := &url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path:   WellKnownPath,
+	}
+	var d Discovery
+	if err := cl.get(c, u, &d); err != nil {
+		return nil, err
+	}
+	var href string
+	for _, l := range d.Links {
+		if l.Rel == Schema21 {
+			href = l.Href
+			break
+		} else if l.Rel == Schema20 {
+			href = l.Href
+		}
+	}
+	if len(href) == 0 {
+		return nil, &pub.RemoteError{
+			IRI: u,
+			Err: fmt.Errorf("nodeinfo: %s links to no supported schema", host),
+		}
+	}
+	nu, err := u.Parse(href)
+	if err != nil {
+		return nil, &pub.RemoteError{IRI: u, Err: err}
+	}
+	n := &NodeInfo{}
+	if err = cl.get(c, nu, n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// get requests the JSON document at the IRI.
+func (cl *Client) get(c context.Context, u *url.URL, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(c)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s (go-fed/activity %s)", cl.appAgent, pub.Version))
+	resp, err := cl.client.Do(req)
+	if err != nil {
+		return &pub.RemoteError{IRI: u, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &pub.RemoteError{
+			IRI:        u,
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("nodeinfo: GET request to %s failed (%d): %s", u, resp.StatusCode, resp.Status),
+		}
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDocumentBytes+1))
+	if err != nil {
+		return &pub.RemoteError{IRI: u, StatusCode: resp.StatusCode, Err: err}
+	} else if len(b) > maxDocumentBytes {
+		return &pub.RemoteError{
+			IRI:        u,
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("nodeinfo: response from %s exceeds %d bytes", u, maxDocumentBytes),
+		}
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return &pub.RemoteError{IRI: u, StatusCode: resp.StatusCode, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package nodeinfo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// testHttpClient serves requests with a handler.
+type testHttpClient struct {
+	h http.Handler
+}
+
+// Do serves the request with the handler.
+func (c testHttpClient) Do(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != "example.com" {
+		return nil, errors.New("unknown host")
+	}
+	resp := httptest.NewRecorder()
+	c.h.ServeHTTP(resp, req)
+	return resp.Result(), nil
+}
+
+// TestClient tests fetching the NodeInfo of other servers.
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	base, _ := url.Parse("https://example.com")
+	h := NewHandler(Config{
+		BaseURL:  base,
+		Provider: testProvider{usage: Usage{Users: Users{Total: 3}}},
+	})
+	t.Run("FetchesLatestSchema", func(t *testing.T) {
+		cl := NewClient(testHttpClient{h: h}, "myApp")
+		n, err := cl.Fetch(ctx, "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Version != "2.1" || n.Software != DefaultSoftware() || n.Usage.Users.Total != 3 {
+			t.Fatalf("got %+v", n)
+		}
+	})
+	t.Run("RejectsOversizedDocument", func(t *testing.T) {
+		large := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"links":[],"padding":"`))
+			w.Write(bytes.Repeat([]byte("a"), maxDocumentBytes))
+			w.Write([]byte(`"}`))
+		})
+		cl := NewClient(testHttpClient{h: large}, "myApp")
+		var re *pub.RemoteError
+		if _, err := cl.Fetch(ctx, "example.com"); !errors.As(err, &re) {
+			t.Fatalf("got %v, want RemoteError", err)
+		}
+	})
+	t.Run("ReturnsErrorForUnreachableHost", func(t *testing.T) {
+		cl := NewClient(testHttpClient{h: h}, "myApp")
+		if _, err := cl.Fetch(ctx, "other.example.com"); err == nil {
+			t.Fatal("fetched from an unreachable host")
+		}
+	})
+}
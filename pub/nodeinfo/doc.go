@@ -0,0 +1,7 @@
+// Package nodeinfo implements the NodeInfo protocol, versions 2.0 and 2.1, which
+// describes the software, protocols, and usage of a federated server.
+//
+// NewHandler serves the "/.well-known/nodeinfo" discovery document and the
+// NodeInfo documents of this server, and a Client fetches the NodeInfo of other
+// servers.
+package nodeinfo
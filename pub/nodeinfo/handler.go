@@ -0,0 +1,160 @@
+package nodeinfo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+const (
+	// schema20Path is the path of the NodeInfo 2.0 document.
+	schema20Path = "/nodeinfo/2.0"
+	// schema21Path is the path of the NodeInfo 2.1 document.
+	schema21Path = "/nodeinfo/2.1"
+	// discoveryContentType is the media type of the discovery document.
+	discoveryContentType = "application/json"
+	// schema20ContentType is the media type of the NodeInfo 2.0 document.
+	schema20ContentType = "application/json; profile=\"" + Schema20 + "#\""
+	// schema21ContentType is the media type of the NodeInfo 2.1 document.
+	schema21ContentType = "application/json; profile=\"" + Schema21 + "#\""
+)
+
+// Provider supplies the values of the NodeInfo documents that change while the
+// server runs.
+type Provider interface {
+	// Usage returns the current usage statistics.
+	Usage(c context.Context) (Usage, error)
+	// OpenRegistrations returns true if anyone may currently register an
+	// account.
+	OpenRegistrations(c context.Context) (bool, error)
+}
+
+// Config configures the http.Handler returned by NewHandler.
+type Config struct {
+	// BaseURL is the IRI of the server, such as "https://example.com".
+	// The NodeInfo documents are served at "/nodeinfo/2.0" and
+	// "/nodeinfo/2.1" under its path.
+	BaseURL *url.URL
+	// Provider supplies the usage statistics and whether registrations are
+	// open.
+	Provider Provider
+	// Software describes the application. If its Name is empty, the
+	// DefaultSoftware is used.
+	Software Software
+	// Services are the third party sites the server connects to.
+	Services Services
+	// Metadata is free form information about the server.
+	Metadata map[string]interface{}
+}
+
+// NewHandler creates an http.Handler serving the discovery document at
+// WellKnownPath and the NodeInfo documents it links to. It should be routed
+// both WellKnownPath and the "/nodeinfo/" path prefix under the path of the
+// BaseURL.
+//
+// Requests for other paths are responded to with http.StatusNotFound, and
+// failures of the Provider with http.StatusInternalServerError.
+func NewHandler(cfg Config) http.Handler {
+	if len(cfg.Software.Name) == 0 {
+		cfg.Software = DefaultSoftware()
+	}
+	if cfg.Services.Inbound == nil {
+		cfg.Services.Inbound = []string{}
+	}
+	if cfg.Services.Outbound == nil {
+		cfg.Services.Outbound = []string{}
+	}
+	if cfg.Metadata == nil {
+		cfg.Metadata = map[string]interface{}{}
+	}
+	return &handler{cfg: cfg}
+}
+
+// handler is the http.Handler returned by NewHandler.
+type handler struct {
+	cfg Config
+}
+
+// ServeHTTP responds with the discovery document or a NodeInfo document.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	var v interface{}
+	var contentType string
+	switch path.Clean(r.URL.Path) {
+	case WellKnownPath:
+		v = Discovery{
+			Links: []Link{
+				{Rel: Schema20, Href: h.href(schema20Path)},
+				{Rel: Schema21, Href: h.href(schema21Path)},
+			},
+		}
+		contentType = discoveryContentType
+	case h.path(schema20Path):
+		n, err := h.nodeInfo(r.Context(), "2.0")
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		v = n
+		contentType = schema20ContentType
+	case h.path(schema21Path):
+		n, err := h.nodeInfo(r.Context(), "2.1")
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		v = n
+		contentType = schema21ContentType
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// path returns the path p under the path of the BaseURL.
+func (h *handler) path(p string) string {
+	return path.Join("/", h.cfg.BaseURL.Path, p)
+}
+
+// href returns the IRI of the path under the BaseURL.
+func (h *handler) href(p string) string {
+	u := *h.cfg.BaseURL
+	u.Path = h.path(p)
+	return u.String()
+}
+
+// nodeInfo creates the NodeInfo document of the schema version.
+func (h *handler) nodeInfo(c context.Context, version string) (n NodeInfo, err error) {
+	n = NodeInfo{
+		Version:   version,
+		Software:  h.cfg.Software,
+		Protocols: []string{activityPubProtocol},
+		Services:  h.cfg.Services,
+		Metadata:  h.cfg.Metadata,
+	}
+	if version == "2.0" {
+		// The 2.0 schema forbids additional software properties.
+		n.Software.Repository = ""
+		n.Software.Homepage = ""
+	}
+	if n.Usage, err = h.cfg.Provider.Usage(c); err != nil {
+		return
+	}
+	n.OpenRegistrations, err = h.cfg.Provider.OpenRegistrations(c)
+	return
+}
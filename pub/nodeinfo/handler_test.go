@@ -0,0 +1,103 @@
+package nodeinfo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// testProvider is a Provider of fixed values.
+type testProvider struct {
+	usage Usage
+	open  bool
+	err   error
+}
+
+// Usage returns the fixed usage.
+func (p testProvider) Usage(c context.Context) (Usage, error) {
+	return p.usage, p.err
+}
+
+// OpenRegistrations returns the fixed value.
+func (p testProvider) OpenRegistrations(c context.Context) (bool, error) {
+	return p.open, p.err
+}
+
+// TestHandler tests serving the discovery and NodeInfo documents.
+func TestHandler(t *testing.T) {
+	base, _ := url.Parse("https://example.com")
+	setupFn := func(p Provider) http.Handler {
+		return NewHandler(Config{
+			BaseURL:  base,
+			Provider: p,
+			Software: Software{
+				Name:       "myapp",
+				Version:    "1.2.3",
+				Repository: "https://example.com/myapp.git",
+			},
+		})
+	}
+	serve := func(h http.Handler, target string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest("GET", target, nil))
+		return resp
+	}
+	p := testProvider{
+		usage: Usage{Users: Users{Total: 3, ActiveHalfyear: 2, ActiveMonth: 1}, LocalPosts: 7},
+		open:  true,
+	}
+	t.Run("ServesDiscovery", func(t *testing.T) {
+		resp := serve(setupFn(p), "https://example.com/.well-known/nodeinfo")
+		want := `{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.0","href":"https://example.com/nodeinfo/2.0"},{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.1","href":"https://example.com/nodeinfo/2.1"}]}`
+		if got := resp.Body.String(); got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	})
+	t.Run("Serves21", func(t *testing.T) {
+		resp := serve(setupFn(p), "https://example.com/nodeinfo/2.1")
+		want := `{"version":"2.1","software":{"name":"myapp","version":"1.2.3","repository":"https://example.com/myapp.git"},"protocols":["activitypub"],"services":{"inbound":[],"outbound":[]},"openRegistrations":true,"usage":{"users":{"total":3,"activeHalfyear":2,"activeMonth":1},"localPosts":7,"localComments":0},"metadata":{}}`
+		if got := resp.Body.String(); got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+		if ct := resp.Header().Get("Content-Type"); ct != schema21ContentType {
+			t.Fatalf("got content type %q", ct)
+		}
+	})
+	t.Run("Serves20WithoutRepository", func(t *testing.T) {
+		resp := serve(setupFn(p), "https://example.com/nodeinfo/2.0")
+		want := `{"version":"2.0","software":{"name":"myapp","version":"1.2.3"},"protocols":["activitypub"],"services":{"inbound":[],"outbound":[]},"openRegistrations":true,"usage":{"users":{"total":3,"activeHalfyear":2,"activeMonth":1},"localPosts":7,"localComments":0},"metadata":{}}`
+		if got := resp.Body.String(); got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+	})
+	t.Run("ReturnsInternalErrorIfProviderFails", func(t *testing.T) {
+		resp := serve(setupFn(testProvider{err: errors.New("test error")}), "https://example.com/nodeinfo/2.1")
+		if resp.Code != http.StatusInternalServerError {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusInternalServerError)
+		}
+	})
+	t.Run("ServesUnderBasePath", func(t *testing.T) {
+		sub, _ := url.Parse("https://example.com/social")
+		h := NewHandler(Config{BaseURL: sub, Provider: p})
+		resp := serve(h, "https://example.com/.well-known/nodeinfo")
+		want := `{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.0","href":"https://example.com/social/nodeinfo/2.0"},{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.1","href":"https://example.com/social/nodeinfo/2.1"}]}`
+		if got := resp.Body.String(); got != want {
+			t.Fatalf("got %s, want %s", got, want)
+		}
+		if resp = serve(h, "https://example.com/social/nodeinfo/2.1"); resp.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusOK)
+		}
+		if resp = serve(h, "https://example.com/nodeinfo/2.1"); resp.Code != http.StatusNotFound {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusNotFound)
+		}
+	})
+	t.Run("ReturnsNotFoundForOtherPaths", func(t *testing.T) {
+		resp := serve(setupFn(p), "https://example.com/nodeinfo/1.0")
+		if resp.Code != http.StatusNotFound {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusNotFound)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package nodeinfo
+
+import (
+	"github.com/go-fed/activity/pub"
+)
+
+const (
+	// WellKnownPath is the path of the discovery document.
+	WellKnownPath = "/.well-known/nodeinfo"
+	// Schema20 is the relation of the link to a NodeInfo 2.0 document.
+	Schema20 = "http://nodeinfo.diaspora.software/ns/schema/2.0"
+	// Schema21 is the relation of the link to a NodeInfo 2.1 document.
+	Schema21 = "http://nodeinfo.diaspora.software/ns/schema/2.1"
+	// activityPubProtocol is the protocol supported by this library.
+	activityPubProtocol = "activitypub"
+)
+
+// Link is a link in the discovery document.
+type Link struct {
+	// Rel is the schema of the linked document, such as Schema21.
+	Rel string `json:"rel"`
+	// Href is the IRI of the linked document.
+	Href string `json:"href"`
+}
+
+// Discovery is the discovery document, linking to the NodeInfo documents of a
+// server.
+type Discovery struct {
+	// Links are the links to the NodeInfo documents.
+	Links []Link `json:"links"`
+}
+
+// NodeInfo is a NodeInfo document.
+type NodeInfo struct {
+	// Version is the version of the schema, such as "2.1".
+	Version string `json:"version"`
+	// Software is the software running on the server.
+	Software Software `json:"software"`
+	// Protocols are the federation protocols supported by the server.
+	Protocols []string `json:"protocols"`
+	// Services are the third party sites the server connects to.
+	Services Services `json:"services"`
+	// OpenRegistrations is true if anyone may register an account.
+	OpenRegistrations bool `json:"openRegistrations"`
+	// Usage are the usage statistics of the server.
+	Usage Usage `json:"usage"`
+	// Metadata is free form information about the server.
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// Software is the software running on a server.
+type Software struct {
+	// Name is the canonical name of the software, made of lowercase
+	// letters, digits, and hyphens.
+	Name string `json:"name"`
+	// Version is the version of the software.
+	Version string `json:"version"`
+	// Repository is the IRI of the source code of the software. It is not
+	// part of the 2.0 schema.
+	Repository string `json:"repository,omitempty"`
+	// Homepage is the IRI of the homepage of the software. It is not part
+	// of the 2.0 schema.
+	Homepage string `json:"homepage,omitempty"`
+}
+
+// Services are the third party sites a server connects to.
+type Services struct {
+	// Inbound are the sites the server retrieves messages from.
+	Inbound []string `json:"inbound"`
+	// Outbound are the sites the server publishes messages to.
+	Outbound []string `json:"outbound"`
+}
+
+// Usage are the usage statistics of a server.
+type Usage struct {
+	// Users are the statistics about the accounts of the server.
+	Users Users `json:"users"`
+	// LocalPosts is the number of posts made by the accounts.
+	LocalPosts int `json:"localPosts"`
+	// LocalComments is the number of comments made by the accounts.
+	LocalComments int `json:"localComments"`
+}
+
+// Users are the statistics about the accounts of a server.
+type Users struct {
+	// Total is the number of accounts.
+	Total int `json:"total"`
+	// ActiveHalfyear is the number of accounts active in the past 180
+	// days.
+	ActiveHalfyear int `json:"activeHalfyear"`
+	// ActiveMonth is the number of accounts active in the past 30 days.
+	ActiveMonth int `json:"activeMonth"`
+}
+
+// DefaultSoftware describes the go-fed/activity library, for applications that
+// do not describe themselves.
+func DefaultSoftware() Software {
+	return Software{
+		Name:       "go-fed",
+		Version:    pub.Version,
+		Repository: "https://github.com/go-fed/activity",
+		Homepage:   "https://go-fed.org/",
+	}
+}
@@ -0,0 +1,214 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// tokenContextKey is the context key of the access token of a request.
+type tokenContextKey struct{}
+
+// TokenFromContext returns the access token authenticating the request, as set
+// by an Authenticator. It returns nil if the request has none.
+func TokenFromContext(c context.Context) *Token {
+	t, _ := c.Value(tokenContextKey{}).(*Token)
+	return t
+}
+
+// AuthenticatorConfig configures an Authenticator.
+type AuthenticatorConfig struct {
+	// Owner determines the IRI of the actor owning an inbox or outbox. If
+	// nil, the box's IRI without its last path segment is used, such as
+	// "https://example.com/addison" for "https://example.com/addison/inbox".
+	Owner func(c context.Context, boxIRI *url.URL) (*url.URL, error)
+	// Scheme is the protocol scheme of the boxes' IRIs. If empty, "https"
+	// is used.
+	Scheme string
+}
+
+// Authenticator authenticates Social API requests bearing the access tokens
+// issued by a Server, as in RFC 6750.
+//
+// Its methods have the signatures of the authentication hooks of the pub
+// package, such as CommonBehavior's AuthenticateGetInbox and the
+// SocialProtocol's AuthenticatePostOutbox, to which applications delegate. The
+// scopes map onto the hooks as follows:
+//
+//   - ScopeRead permits reading the actor's inbox, and reading its outbox and
+//     collections as the actor rather than anonymously.
+//   - ScopeWrite permits posting to the actor's outbox.
+//   - ScopeFollow additionally permits posting the activities checked by
+//     AuthorizeActivity.
+//
+// Successfully authenticated contexts carry the actor with pub.WithRequester
+// and the Token for TokenFromContext.
+type Authenticator struct {
+	server *Server
+	owner  func(c context.Context, boxIRI *url.URL) (*url.URL, error)
+	scheme string
+}
+
+// NewAuthenticator returns an Authenticator of the tokens issued by the Server.
+func NewAuthenticator(s *Server, cfg AuthenticatorConfig) *Authenticator {
+	a := &Authenticator{
+		server: s,
+		owner:  cfg.Owner,
+		scheme: cfg.Scheme,
+	}
+	if a.owner == nil {
+		a.owner = ownerFromParentPath
+	}
+	if len(a.scheme) == 0 {
+		a.scheme = "https"
+	}
+	return a
+}
+
+// AuthenticatePostOutbox requires a token with ScopeWrite, authorized by the
+// actor owning the outbox.
+func (a *Authenticator) AuthenticatePostOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
+	return a.authenticate(c, w, r, true, ScopeWrite, true)
+}
+
+// AuthenticateGetInbox requires a token with ScopeRead, authorized by the actor
+// owning the inbox.
+func (a *Authenticator) AuthenticateGetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
+	return a.authenticate(c, w, r, true, ScopeRead, true)
+}
+
+// AuthenticateGetOutbox permits anonymous requests, since an outbox is public,
+// but requires a token bearing ScopeRead if one is given.
+func (a *Authenticator) AuthenticateGetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
+	return a.authenticate(c, w, r, false, ScopeRead, false)
+}
+
+// AuthenticateGet permits anonymous requests, but requires a token bearing
+// ScopeRead if one is given. It is suitable for the AuthenticateGet of the
+// collection and object handlers, such as pub's CollectionHandlerConfig.
+func (a *Authenticator) AuthenticateGet(c context.Context, w http.ResponseWriter, r *http.Request) (out context.Context, authenticated bool, err error) {
+	return a.authenticate(c, w, r, false, ScopeRead, false)
+}
+
+// AuthorizeActivity requires ScopeFollow of the token in the context for
+// activities managing relationships: Follow, Block, Accept, Reject, and an
+// Undo of an embedded Follow or Block.
+//
+// It is meant to be called in the SocialProtocol's PostOutboxRequestBodyHook.
+// Returns a pub.ForbiddenError if the token lacks the scope, or if there is
+// no token in the context.
+func AuthorizeActivity(c context.Context, data vocab.Type) error {
+	t := TokenFromContext(c)
+	if t == nil {
+		return &pub.ForbiddenError{Err: fmt.Errorf("oauth: no access token")}
+	}
+	if isRelationshipActivity(data) && !t.HasScope(ScopeFollow) {
+		return &pub.ForbiddenError{Err: fmt.Errorf("oauth: %s requires the %s scope", data.GetTypeName(), ScopeFollow)}
+	}
+	return nil
+}
+
+// isRelationshipActivity determines whether the value is an activity managing
+// relationships.
+func isRelationshipActivity(t vocab.Type) bool {
+	if streams.IsOrExtendsActivityStreamsFollow(t) ||
+		streams.IsOrExtendsActivityStreamsBlock(t) ||
+		streams.IsOrExtendsActivityStreamsAccept(t) ||
+		streams.IsOrExtendsActivityStreamsReject(t) {
+		return true
+	}
+	undo, ok := t.(vocab.ActivityStreamsUndo)
+	if !ok {
+		return false
+	}
+	if op := undo.GetActivityStreamsObject(); op != nil {
+		for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+			if o := iter.GetType(); o != nil && isRelationshipActivity(o) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authenticate authenticates the request's access token, requiring it to have
+// the scope and, if owned is true, to be authorized by the actor owning the
+// box.
+//
+// If required is false, requests without a token are anonymous.
+func (a *Authenticator) authenticate(c context.Context, w http.ResponseWriter, r *http.Request, required bool, scope string, owned bool) (out context.Context, authenticated bool, err error) {
+	out = c
+	accessToken, ok := bearerToken(r)
+	if !ok {
+		if required {
+			writeChallenge(w, http.StatusUnauthorized, "", scope)
+			return
+		}
+		authenticated = true
+		return
+	}
+	t, err := a.server.Introspect(c, accessToken)
+	if err != nil {
+		return
+	} else if t == nil {
+		writeChallenge(w, http.StatusUnauthorized, "invalid_token", "")
+		return
+	} else if !t.HasScope(scope) {
+		writeChallenge(w, http.StatusForbidden, "insufficient_scope", scope)
+		return
+	}
+	if owned {
+		var owner *url.URL
+		boxIRI := &url.URL{Scheme: a.scheme, Host: r.Host, Path: r.URL.Path}
+		owner, err = a.owner(c, boxIRI)
+		if err != nil {
+			return
+		} else if owner.String() != t.Actor.String() {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+	}
+	out = pub.WithRequester(c, t.Actor)
+	out = context.WithValue(out, tokenContextKey{}, t)
+	authenticated = true
+	return
+}
+
+// bearerToken returns the access token in the request's Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	const prefix = "bearer "
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(h[len(prefix):]), true
+}
+
+// writeChallenge responds with a Bearer authentication challenge, with the
+// optional error code and required scope.
+func writeChallenge(w http.ResponseWriter, status int, code, scope string) {
+	challenge := `Bearer realm="activitypub"`
+	if len(code) > 0 {
+		challenge += fmt.Sprintf(", error=%q", code)
+	}
+	if len(scope) > 0 {
+		challenge += fmt.Sprintf(", scope=%q", scope)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// ownerFromParentPath returns the box's IRI without its last path segment.
+func ownerFromParentPath(c context.Context, boxIRI *url.URL) (*url.URL, error) {
+	owner := *boxIRI
+	owner.Path = path.Dir(path.Clean(owner.Path))
+	owner.RawPath = ""
+	return &owner, nil
+}
@@ -0,0 +1,125 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+)
+
+// issueToken stores a token for testActor with the scopes.
+func issueToken(t *testing.T, s *Server, clock *testClock, accessToken string, scopes ...string) {
+	err := s.cfg.Store.SaveToken(context.Background(), &Token{
+		AccessToken: accessToken,
+		ClientID:    "client",
+		Actor:       mustParse(testActor),
+		Scopes:      scopes,
+		Expires:     clock.now.Add(defaultTokenTTL),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// bearerRequest returns a request with the access token, if any.
+func bearerRequest(method, target, accessToken string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	if len(accessToken) > 0 {
+		r.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return r
+}
+
+// TestAuthenticator tests authenticating Social API requests.
+func TestAuthenticator(t *testing.T) {
+	s, clock := newTestServer()
+	issueToken(t, s, clock, "reader", ScopeRead)
+	issueToken(t, s, clock, "writer", ScopeRead, ScopeWrite)
+	a := NewAuthenticator(s, AuthenticatorConfig{})
+	t.Run("PostsToOwnOutboxWithWriteScope", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		c, ok, err := a.AuthenticatePostOutbox(context.Background(), resp, bearerRequest("POST", testActor+"/outbox", "writer"))
+		if err != nil || !ok {
+			t.Fatalf("got %v and %v, want authenticated", ok, err)
+		}
+		if got := pub.RequesterFromContext(c); got == nil || got.String() != testActor {
+			t.Fatalf("got requester %v, want %s", got, testActor)
+		}
+		if TokenFromContext(c) == nil {
+			t.Fatalf("got no token in context")
+		}
+	})
+	t.Run("RejectsPostWithoutWriteScope", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		_, ok, err := a.AuthenticatePostOutbox(context.Background(), resp, bearerRequest("POST", testActor+"/outbox", "reader"))
+		if err != nil || ok {
+			t.Fatalf("got %v and %v, want unauthenticated", ok, err)
+		}
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusForbidden)
+		}
+	})
+	t.Run("RejectsPostToOtherOutbox", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		_, ok, err := a.AuthenticatePostOutbox(context.Background(), resp, bearerRequest("POST", "https://example.com/sam/outbox", "writer"))
+		if err != nil || ok {
+			t.Fatalf("got %v and %v, want unauthenticated", ok, err)
+		}
+		if resp.Code != http.StatusForbidden {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusForbidden)
+		}
+	})
+	t.Run("RequiresTokenForInbox", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		_, ok, err := a.AuthenticateGetInbox(context.Background(), resp, bearerRequest("GET", testActor+"/inbox", ""))
+		if err != nil || ok {
+			t.Fatalf("got %v and %v, want unauthenticated", ok, err)
+		}
+		if resp.Code != http.StatusUnauthorized || len(resp.Header().Get("WWW-Authenticate")) == 0 {
+			t.Fatalf("got status %d, want %d with a challenge", resp.Code, http.StatusUnauthorized)
+		}
+	})
+	t.Run("RejectsExpiredToken", func(t *testing.T) {
+		s, clock := newTestServer()
+		issueToken(t, s, clock, "reader", ScopeRead)
+		clock.now = clock.now.Add(defaultTokenTTL)
+		resp := httptest.NewRecorder()
+		_, ok, err := NewAuthenticator(s, AuthenticatorConfig{}).AuthenticateGetInbox(context.Background(), resp, bearerRequest("GET", testActor+"/inbox", "reader"))
+		if err != nil || ok {
+			t.Fatalf("got %v and %v, want unauthenticated", ok, err)
+		}
+		if resp.Code != http.StatusUnauthorized {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusUnauthorized)
+		}
+	})
+	t.Run("PermitsAnonymousOutboxRead", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		c, ok, err := a.AuthenticateGetOutbox(context.Background(), resp, bearerRequest("GET", testActor+"/outbox", ""))
+		if err != nil || !ok {
+			t.Fatalf("got %v and %v, want authenticated", ok, err)
+		}
+		if got := pub.RequesterFromContext(c); got != nil {
+			t.Fatalf("got requester %v, want none", got)
+		}
+	})
+	t.Run("RequiresFollowScopeForFollow", func(t *testing.T) {
+		c, _, _ := a.AuthenticatePostOutbox(context.Background(), httptest.NewRecorder(), bearerRequest("POST", testActor+"/outbox", "writer"))
+		err := AuthorizeActivity(c, streams.NewActivityStreamsFollow())
+		if pub.ErrorStatusCode(err) != http.StatusForbidden {
+			t.Fatalf("got %v, want a forbidden error", err)
+		}
+		undo := streams.NewActivityStreamsUndo()
+		obj := streams.NewActivityStreamsObjectProperty()
+		obj.AppendActivityStreamsBlock(streams.NewActivityStreamsBlock())
+		undo.SetActivityStreamsObject(obj)
+		if err := AuthorizeActivity(c, undo); pub.ErrorStatusCode(err) != http.StatusForbidden {
+			t.Fatalf("got %v, want a forbidden error", err)
+		}
+		if err := AuthorizeActivity(c, streams.NewActivityStreamsCreate()); err != nil {
+			t.Fatalf("got %v, want no error", err)
+		}
+	})
+}
@@ -0,0 +1,14 @@
+// Package oauth implements an OAuth 2.0 authorization server, RFC 6749, for
+// the ActivityPub Social API.
+//
+// Clients register themselves with the handler returned by Server's
+// RegistrationHandler, as in RFC 7591, and then obtain access tokens for an
+// actor with the authorization code flow protected by PKCE, RFC 7636. Access
+// tokens are described to other services by the IntrospectionHandler, as in
+// RFC 7662.
+//
+// Tokens are granted the ScopeRead, ScopeWrite, and ScopeFollow scopes, which
+// an Authenticator maps onto the authentication hooks of the outbox, inbox,
+// and collection handlers of the pub package. Clients, authorization codes,
+// and tokens are kept in a pluggable TokenStore.
+package oauth
@@ -0,0 +1,143 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// ScopeRead permits reading the actor's inbox, outbox, and
+	// collections.
+	ScopeRead = "read"
+	// ScopeWrite permits posting activities to the actor's outbox.
+	ScopeWrite = "write"
+	// ScopeFollow permits posting the activities managing the actor's
+	// relationships, such as Follow and Block, to its outbox. They also
+	// require ScopeWrite.
+	ScopeFollow = "follow"
+	// CodeChallengeMethodS256 is the PKCE code challenge method, which is
+	// the only one supported.
+	CodeChallengeMethodS256 = "S256"
+	// TokenTypeBearer is the type of the access tokens issued.
+	TokenTypeBearer = "Bearer"
+)
+
+// Client is an application registered to obtain access tokens.
+type Client struct {
+	// ID identifies the client.
+	ID string
+	// Secret authenticates a confidential client at the token and
+	// introspection endpoints. It is empty for public clients, such as
+	// native applications, which rely on PKCE alone.
+	Secret string
+	// Name is the human readable name of the client, shown to users when
+	// asking for their consent.
+	Name string
+	// RedirectURIs are the IRIs the client may be redirected to with an
+	// authorization code.
+	RedirectURIs []string
+	// Scopes are the scopes the client may request.
+	Scopes []string
+	// IssuedAt is when the client was registered.
+	IssuedAt time.Time
+}
+
+// IsPublic determines whether the client has no secret.
+func (cl *Client) IsPublic() bool {
+	return len(cl.Secret) == 0
+}
+
+// hasRedirectURI determines whether the IRI is registered for the client.
+func (cl *Client) hasRedirectURI(uri string) bool {
+	for _, r := range cl.RedirectURIs {
+		if r == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizationCode is the single-use grant exchanged by a client for an access
+// token.
+type AuthorizationCode struct {
+	// Code is the value given to the client.
+	Code string
+	// ClientID identifies the client the code was issued to.
+	ClientID string
+	// RedirectURI is the "redirect_uri" of the authorization request,
+	// which the client must give again when exchanging the code. It is
+	// empty if the request omitted it.
+	RedirectURI string
+	// Actor is the IRI of the actor that authorized the client.
+	Actor *url.URL
+	// Scopes are the granted scopes.
+	Scopes []string
+	// CodeChallenge is the PKCE code challenge, which the client's code
+	// verifier must match.
+	CodeChallenge string
+	// Expires is when the code may no longer be exchanged.
+	Expires time.Time
+}
+
+// Token is an access token permitting a client to act on behalf of an actor.
+type Token struct {
+	// AccessToken is the value given to the client.
+	AccessToken string
+	// ClientID identifies the client the token was issued to.
+	ClientID string
+	// Actor is the IRI of the actor that authorized the client.
+	Actor *url.URL
+	// Scopes are the granted scopes.
+	Scopes []string
+	// Expires is when the token is no longer valid.
+	Expires time.Time
+}
+
+// HasScope determines whether the token was granted the scope.
+func (t *Token) HasScope(scope string) bool {
+	return hasScope(t.Scopes, scope)
+}
+
+// isKnownScope determines whether the scope is one of ScopeRead, ScopeWrite,
+// and ScopeFollow.
+func isKnownScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeWrite || scope == ScopeFollow
+}
+
+// hasScope determines whether the scope is in the list.
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// parseScope splits the space-delimited 'scope' parameter, dropping
+// duplicates.
+func parseScope(s string) (scopes []string) {
+	for _, f := range strings.Fields(s) {
+		if !hasScope(scopes, f) {
+			scopes = append(scopes, f)
+		}
+	}
+	return
+}
+
+// formatScope joins the scopes into a 'scope' parameter.
+func formatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// randomString returns a URL-safe string of n random bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,590 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+)
+
+const (
+	// defaultCodeTTL is the default lifetime of authorization codes.
+	defaultCodeTTL = 10 * time.Minute
+	// defaultTokenTTL is the default lifetime of access tokens.
+	defaultTokenTTL = 24 * time.Hour
+	// secretBytes is the number of random bytes in issued identifiers,
+	// secrets, codes, and tokens.
+	secretBytes = 32
+)
+
+// ErrAccessDenied is returned by Config's Authorize when the user declines to
+// authorize the client.
+var ErrAccessDenied = errors.New("oauth: access denied")
+
+// AuthorizationRequest is a client's request for an actor's authorization,
+// which the application presents to the user for their consent.
+type AuthorizationRequest struct {
+	// Client is the client requesting authorization.
+	Client *Client
+	// RedirectURI is where the client will be redirected to.
+	RedirectURI string
+	// Scopes are the requested scopes.
+	Scopes []string
+	// State is the opaque value the client will be redirected with.
+	State string
+}
+
+// Config configures a Server.
+type Config struct {
+	// Store persists the clients, authorization codes, and access tokens.
+	Store TokenStore
+	// Clock determines the expiry of authorization codes and access
+	// tokens.
+	Clock pub.Clock
+	// Authorize authenticates the user at the authorization endpoint and
+	// obtains their consent to the request, returning the IRI of the
+	// actor the client may act on behalf of.
+	//
+	// If the user is not yet logged in or has not yet consented, the
+	// implementation writes the page asking them to do so to the
+	// ResponseWriter and returns a nil actorIRI and nil error. The page
+	// is expected to submit back to the authorization endpoint, with the
+	// same query parameters.
+	//
+	// Returns ErrAccessDenied if the user declines, in which case the
+	// client is redirected with an "access_denied" error. Other errors
+	// respond with http.StatusInternalServerError.
+	Authorize func(c context.Context, w http.ResponseWriter, r *http.Request, req *AuthorizationRequest) (actorIRI *url.URL, err error)
+	// AuthorizationEndpoint is the IRI of the handler returned by
+	// AuthorizationHandler, advertised by ActorEndpoints.
+	AuthorizationEndpoint *url.URL
+	// TokenEndpoint is the IRI of the handler returned by TokenHandler,
+	// advertised by ActorEndpoints.
+	TokenEndpoint *url.URL
+	// CodeTTL is how long authorization codes may be exchanged for. If
+	// zero, ten minutes is used.
+	CodeTTL time.Duration
+	// TokenTTL is how long access tokens are valid for. If zero, 24 hours
+	// is used.
+	TokenTTL time.Duration
+}
+
+// Server is an OAuth 2.0 authorization server, issuing access tokens for the
+// Social API with the authorization code flow and PKCE.
+type Server struct {
+	cfg Config
+}
+
+// NewServer returns a Server with the configuration.
+func NewServer(cfg Config) *Server {
+	if cfg.CodeTTL == 0 {
+		cfg.CodeTTL = defaultCodeTTL
+	}
+	if cfg.TokenTTL == 0 {
+		cfg.TokenTTL = defaultTokenTTL
+	}
+	return &Server{cfg: cfg}
+}
+
+// ActorEndpoints returns the endpoints to advertise in the documents of the
+// actors on this server, such as with pub's ActorConfig.
+func (s *Server) ActorEndpoints() *pub.ActorEndpoints {
+	return &pub.ActorEndpoints{
+		OAuthAuthorizationEndpoint: s.cfg.AuthorizationEndpoint,
+		OAuthTokenEndpoint:         s.cfg.TokenEndpoint,
+	}
+}
+
+// Introspect returns the access token if it is valid, or nil if it is unknown
+// or expired.
+func (s *Server) Introspect(c context.Context, accessToken string) (*Token, error) {
+	if len(accessToken) == 0 {
+		return nil, nil
+	}
+	t, err := s.cfg.Store.Token(c, accessToken)
+	if err != nil {
+		return nil, err
+	} else if t == nil || !s.cfg.Clock.Now().Before(t.Expires) {
+		return nil, nil
+	}
+	return t, nil
+}
+
+// registrationRequest is the client metadata of a registration request.
+type registrationRequest struct {
+	RedirectURIs            []string `json:"redirect_uris"`
+	ClientName              string   `json:"client_name,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+}
+
+// registrationResponse is the information about a newly registered client.
+type registrationResponse struct {
+	ClientID                string   `json:"client_id"`
+	ClientSecret            string   `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64    `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64   `json:"client_secret_expires_at,omitempty"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	ClientName              string   `json:"client_name,omitempty"`
+	Scope                   string   `json:"scope"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+}
+
+// RegistrationHandler returns the http.Handler registering clients with their
+// JSON metadata, as in RFC 7591.
+//
+// Registration is open to anyone. Clients with a "token_endpoint_auth_method"
+// of "none" are public clients without a secret, and all others are issued
+// one. Clients requesting no scope may only request ScopeRead.
+func (s *Server) RegistrationHandler() http.Handler {
+	return http.HandlerFunc(s.register)
+}
+
+// register serves the RegistrationHandler.
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req registrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, &oauthError{code: "invalid_client_metadata", description: "malformed JSON", status: http.StatusBadRequest})
+		return
+	}
+	if len(req.RedirectURIs) == 0 {
+		writeError(w, &oauthError{code: "invalid_redirect_uri", description: "redirect_uris required", status: http.StatusBadRequest})
+		return
+	}
+	for _, uri := range req.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || len(u.Fragment) > 0 {
+			writeError(w, &oauthError{code: "invalid_redirect_uri", description: "redirect_uris must be absolute without a fragment", status: http.StatusBadRequest})
+			return
+		}
+	}
+	scopes := parseScope(req.Scope)
+	if len(scopes) == 0 {
+		scopes = []string{ScopeRead}
+	}
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			writeError(w, &oauthError{code: "invalid_client_metadata", description: "unknown scope " + scope, status: http.StatusBadRequest})
+			return
+		}
+	}
+	cl := &Client{
+		Name:         req.ClientName,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       scopes,
+		IssuedAt:     s.cfg.Clock.Now(),
+	}
+	var err error
+	if cl.ID, err = randomString(secretBytes); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	switch req.TokenEndpointAuthMethod {
+	case "none":
+	case "", "client_secret_basic", "client_secret_post":
+		if cl.Secret, err = randomString(secretBytes); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if len(req.TokenEndpointAuthMethod) == 0 {
+			req.TokenEndpointAuthMethod = "client_secret_basic"
+		}
+	default:
+		writeError(w, &oauthError{code: "invalid_client_metadata", description: "unsupported token_endpoint_auth_method", status: http.StatusBadRequest})
+		return
+	}
+	if err := s.cfg.Store.SaveClient(r.Context(), cl); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	resp := registrationResponse{
+		ClientID:                cl.ID,
+		ClientSecret:            cl.Secret,
+		ClientIDIssuedAt:        cl.IssuedAt.Unix(),
+		RedirectURIs:            cl.RedirectURIs,
+		ClientName:              cl.Name,
+		Scope:                   formatScope(cl.Scopes),
+		TokenEndpointAuthMethod: req.TokenEndpointAuthMethod,
+		GrantTypes:              []string{"authorization_code"},
+		ResponseTypes:           []string{"code"},
+	}
+	if !cl.IsPublic() {
+		var never int64
+		resp.ClientSecretExpiresAt = &never
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// AuthorizationHandler returns the http.Handler of the authorization endpoint,
+// where users authorize clients with Config's Authorize and clients are
+// redirected back with an authorization code.
+//
+// Only the "code" response type is supported, and a PKCE code challenge with
+// the S256 method is required. Requests naming an unknown client or
+// unregistered redirect URI respond with http.StatusBadRequest, since the
+// client cannot safely be redirected. Other errors are given to the client in
+// its redirect.
+func (s *Server) AuthorizationHandler() http.Handler {
+	return http.HandlerFunc(s.authorize)
+}
+
+// authorize serves the AuthorizationHandler.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, "GET, POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "oauth: malformed request", http.StatusBadRequest)
+		return
+	}
+	c := r.Context()
+	cl, err := s.cfg.Store.Client(c, r.Form.Get("client_id"))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	} else if cl == nil {
+		http.Error(w, "oauth: unknown client", http.StatusBadRequest)
+		return
+	}
+	givenRedirectURI := r.Form.Get("redirect_uri")
+	redirectURI := givenRedirectURI
+	if len(redirectURI) == 0 && len(cl.RedirectURIs) == 1 {
+		redirectURI = cl.RedirectURIs[0]
+	}
+	if !cl.hasRedirectURI(redirectURI) {
+		http.Error(w, "oauth: redirect_uri is not registered for the client", http.StatusBadRequest)
+		return
+	}
+	// The client is now redirected back with any error.
+	state := r.Form.Get("state")
+	if rt := r.Form.Get("response_type"); rt != "code" {
+		redirectError(w, r, redirectURI, state, &oauthError{code: "unsupported_response_type", description: "only the code response type is supported"})
+		return
+	}
+	challenge := r.Form.Get("code_challenge")
+	if len(challenge) == 0 {
+		redirectError(w, r, redirectURI, state, &oauthError{code: "invalid_request", description: "code_challenge required"})
+		return
+	} else if r.Form.Get("code_challenge_method") != CodeChallengeMethodS256 {
+		redirectError(w, r, redirectURI, state, &oauthError{code: "invalid_request", description: "code_challenge_method must be S256"})
+		return
+	}
+	scopes := cl.Scopes
+	if scope := r.Form.Get("scope"); len(scope) > 0 {
+		scopes = parseScope(scope)
+		for _, s := range scopes {
+			if !hasScope(cl.Scopes, s) {
+				redirectError(w, r, redirectURI, state, &oauthError{code: "invalid_scope", description: "scope " + s + " is not permitted"})
+				return
+			}
+		}
+	}
+	actorIRI, err := s.cfg.Authorize(c, w, r, &AuthorizationRequest{
+		Client:      cl,
+		RedirectURI: redirectURI,
+		Scopes:      scopes,
+		State:       state,
+	})
+	if errors.Is(err, ErrAccessDenied) {
+		redirectError(w, r, redirectURI, state, &oauthError{code: "access_denied", description: "the user declined"})
+		return
+	} else if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	} else if actorIRI == nil {
+		// Authorize has responded, such as with a login page.
+		return
+	}
+	code, err := randomString(secretBytes)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	err = s.cfg.Store.SaveCode(c, &AuthorizationCode{
+		Code:          code,
+		ClientID:      cl.ID,
+		RedirectURI:   givenRedirectURI,
+		Actor:         actorIRI,
+		Scopes:        scopes,
+		CodeChallenge: challenge,
+		Expires:       s.cfg.Clock.Now().Add(s.cfg.CodeTTL),
+	})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	redirect(w, r, redirectURI, url.Values{
+		"code":  []string{code},
+		"state": []string{state},
+	})
+}
+
+// tokenResponse is the successful response of the token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// TokenHandler returns the http.Handler of the token endpoint, where clients
+// exchange authorization codes and their PKCE code verifiers for access
+// tokens.
+//
+// Confidential clients authenticate with HTTP Basic authentication or the
+// "client_secret" parameter. Public clients only give their "client_id".
+func (s *Server) TokenHandler() http.Handler {
+	return http.HandlerFunc(s.token)
+}
+
+// token serves the TokenHandler.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, &oauthError{code: "invalid_request", description: "malformed request", status: http.StatusBadRequest})
+		return
+	}
+	c := r.Context()
+	cl, err := s.authenticateClient(c, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if gt := r.PostForm.Get("grant_type"); gt != "authorization_code" {
+		writeError(w, &oauthError{code: "unsupported_grant_type", description: "only the authorization_code grant type is supported", status: http.StatusBadRequest})
+		return
+	}
+	code, err := s.cfg.Store.TakeCode(c, r.PostForm.Get("code"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	invalidGrant := &oauthError{code: "invalid_grant", description: "invalid authorization code", status: http.StatusBadRequest}
+	if code == nil ||
+		code.ClientID != cl.ID ||
+		// The redirect_uri is only required if the authorization
+		// request included it.
+		(len(code.RedirectURI) > 0 && code.RedirectURI != r.PostForm.Get("redirect_uri")) ||
+		!s.cfg.Clock.Now().Before(code.Expires) {
+		writeError(w, invalidGrant)
+		return
+	} else if !verifyCodeChallenge(code.CodeChallenge, r.PostForm.Get("code_verifier")) {
+		invalidGrant.description = "code_verifier does not match the code_challenge"
+		writeError(w, invalidGrant)
+		return
+	}
+	accessToken, err := randomString(secretBytes)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	t := &Token{
+		AccessToken: accessToken,
+		ClientID:    cl.ID,
+		Actor:       code.Actor,
+		Scopes:      code.Scopes,
+		Expires:     s.cfg.Clock.Now().Add(s.cfg.TokenTTL),
+	}
+	if err := s.cfg.Store.SaveToken(c, t); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tokenResponse{
+		AccessToken: t.AccessToken,
+		TokenType:   TokenTypeBearer,
+		ExpiresIn:   int64(s.cfg.TokenTTL / time.Second),
+		Scope:       formatScope(t.Scopes),
+	})
+}
+
+// introspectionResponse describes a token, as in RFC 7662.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// IntrospectionHandler returns the http.Handler describing access tokens to
+// authenticated clients, as in RFC 7662. The "sub" of an active token is the
+// IRI of the actor that authorized it.
+//
+// Confidential clients, such as other services of the application, may
+// introspect any token. Public clients may only introspect their own, and
+// other tokens are described as inactive.
+func (s *Server) IntrospectionHandler() http.Handler {
+	return http.HandlerFunc(s.introspect)
+}
+
+// introspect serves the IntrospectionHandler.
+func (s *Server) introspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, &oauthError{code: "invalid_request", description: "malformed request", status: http.StatusBadRequest})
+		return
+	}
+	c := r.Context()
+	cl, err := s.authenticateClient(c, r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	t, err := s.Introspect(c, r.PostForm.Get("token"))
+	if err != nil {
+		writeError(w, err)
+		return
+	} else if t == nil || (cl.IsPublic() && t.ClientID != cl.ID) {
+		writeJSON(w, http.StatusOK, introspectionResponse{})
+		return
+	}
+	writeJSON(w, http.StatusOK, introspectionResponse{
+		Active:    true,
+		Scope:     formatScope(t.Scopes),
+		ClientID:  t.ClientID,
+		Subject:   t.Actor.String(),
+		TokenType: TokenTypeBearer,
+		ExpiresAt: t.Expires.Unix(),
+	})
+}
+
+// authenticateClient returns the client making a request to the token or
+// introspection endpoint.
+func (s *Server) authenticateClient(c context.Context, r *http.Request) (*Client, error) {
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	invalidClient := &oauthError{code: "invalid_client", description: "client authentication failed", status: http.StatusUnauthorized}
+	if len(id) == 0 {
+		return nil, invalidClient
+	}
+	cl, err := s.cfg.Store.Client(c, id)
+	if err != nil {
+		return nil, err
+	} else if cl == nil {
+		return nil, invalidClient
+	} else if !cl.IsPublic() && subtle.ConstantTimeCompare([]byte(cl.Secret), []byte(secret)) != 1 {
+		return nil, invalidClient
+	}
+	return cl, nil
+}
+
+// verifyCodeChallenge determines whether the PKCE code verifier matches the
+// S256 code challenge.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) == 0 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// oauthError is an error response of the OAuth 2.0 endpoints.
+type oauthError struct {
+	code        string
+	description string
+	status      int
+}
+
+// Error returns the error code and description.
+func (e *oauthError) Error() string {
+	return "oauth: " + e.code + ": " + e.description
+}
+
+// errorResponse is the JSON representation of an oauthError.
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// writeError responds with the error. Errors other than an oauthError are
+// internal server errors, whose details are not disclosed.
+func writeError(w http.ResponseWriter, err error) {
+	var oerr *oauthError
+	if !errors.As(err, &oerr) {
+		oerr = &oauthError{code: "server_error", status: http.StatusInternalServerError}
+	}
+	if oerr.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	writeJSON(w, oerr.status, errorResponse{
+		Error:            oerr.code,
+		ErrorDescription: oerr.description,
+	})
+}
+
+// writeJSON responds with the value, which must not be cached since it may
+// contain secrets.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	w.Write(raw)
+}
+
+// redirectError redirects the client back with the error.
+func redirectError(w http.ResponseWriter, r *http.Request, redirectURI, state string, oerr *oauthError) {
+	params := url.Values{
+		"error":             []string{oerr.code},
+		"error_description": []string{oerr.description},
+	}
+	if len(state) > 0 {
+		params.Set("state", state)
+	}
+	redirect(w, r, redirectURI, params)
+}
+
+// redirect redirects to the IRI with the parameters added to its query.
+func redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "oauth: malformed redirect_uri", http.StatusBadRequest)
+		return
+	}
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			if len(v) > 0 {
+				q.Add(k, v)
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// methodNotAllowed responds that the request method is not supported.
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,292 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testRedirectURI = "https://app.example.org/callback"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testActor       = "https://example.com/addison"
+)
+
+// testClock is a pub.Clock at a fixed time.
+type testClock struct {
+	now time.Time
+}
+
+// Now returns the fixed time.
+func (t *testClock) Now() time.Time {
+	return t.now
+}
+
+// mustParse parses the IRI, panicking on failure.
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// challengeOf returns the S256 code challenge of the verifier.
+func challengeOf(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// newTestServer returns a Server whose users authorize every request as
+// testActor, unless the request has a "deny" parameter.
+func newTestServer() (*Server, *testClock) {
+	clock := &testClock{now: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	s := NewServer(Config{
+		Store: NewMemoryStore(),
+		Clock: clock,
+		Authorize: func(c context.Context, w http.ResponseWriter, r *http.Request, req *AuthorizationRequest) (*url.URL, error) {
+			if len(r.Form.Get("deny")) > 0 {
+				return nil, ErrAccessDenied
+			}
+			return mustParse(testActor), nil
+		},
+		AuthorizationEndpoint: mustParse("https://example.com/oauth/authorize"),
+		TokenEndpoint:         mustParse("https://example.com/oauth/token"),
+	})
+	return s, clock
+}
+
+// register registers a client, returning the registration response.
+func register(t *testing.T, s *Server, body string) registrationResponse {
+	resp := httptest.NewRecorder()
+	s.RegistrationHandler().ServeHTTP(resp, httptest.NewRequest("POST", "https://example.com/oauth/register", strings.NewReader(body)))
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("got status %d, want %d: %s", resp.Code, http.StatusCreated, resp.Body.String())
+	}
+	var reg registrationResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &reg); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// authorize requests authorization, returning the redirect location.
+func authorize(t *testing.T, s *Server, params url.Values) *url.URL {
+	resp := httptest.NewRecorder()
+	s.AuthorizationHandler().ServeHTTP(resp, httptest.NewRequest("GET", "https://example.com/oauth/authorize?"+params.Encode(), nil))
+	if resp.Code != http.StatusFound {
+		t.Fatalf("got status %d, want %d: %s", resp.Code, http.StatusFound, resp.Body.String())
+	}
+	return mustParse(resp.Header().Get("Location"))
+}
+
+// postForm serves a form POST with the handler.
+func postForm(h http.Handler, target string, form url.Values, clientID, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(secret) > 0 {
+		req.SetBasicAuth(clientID, secret)
+	}
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp
+}
+
+// authorizeParams returns the parameters of a valid authorization request.
+func authorizeParams(clientID string) url.Values {
+	return url.Values{
+		"response_type":         []string{"code"},
+		"client_id":             []string{clientID},
+		"redirect_uri":          []string{testRedirectURI},
+		"scope":                 []string{"read write"},
+		"state":                 []string{"xyz"},
+		"code_challenge":        []string{challengeOf(testVerifier)},
+		"code_challenge_method": []string{CodeChallengeMethodS256},
+	}
+}
+
+// tokenParams returns the parameters exchanging the code.
+func tokenParams(clientID, code, verifier string) url.Values {
+	return url.Values{
+		"grant_type":    []string{"authorization_code"},
+		"client_id":     []string{clientID},
+		"code":          []string{code},
+		"redirect_uri":  []string{testRedirectURI},
+		"code_verifier": []string{verifier},
+	}
+}
+
+// TestServer tests the authorization code flow.
+func TestServer(t *testing.T) {
+	t.Run("IssuesTokenToPublicClient", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"client_name":"App","redirect_uris":["`+testRedirectURI+`"],"scope":"read write follow","token_endpoint_auth_method":"none"}`)
+		if len(reg.ClientSecret) > 0 {
+			t.Fatalf("public client was issued a secret")
+		}
+		loc := authorize(t, s, authorizeParams(reg.ClientID))
+		if got := loc.Query().Get("state"); got != "xyz" {
+			t.Fatalf("got state %q, want %q", got, "xyz")
+		}
+		code := loc.Query().Get("code")
+		resp := postForm(s.TokenHandler(), "https://example.com/oauth/token", tokenParams(reg.ClientID, code, testVerifier), "", "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", resp.Code, http.StatusOK, resp.Body.String())
+		}
+		if cc := resp.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Fatalf("got Cache-Control %q, want %q", cc, "no-store")
+		}
+		var tok tokenResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &tok); err != nil {
+			t.Fatal(err)
+		}
+		if tok.TokenType != TokenTypeBearer || tok.Scope != "read write" || tok.ExpiresIn != int64(defaultTokenTTL/time.Second) {
+			t.Fatalf("got unexpected token response %+v", tok)
+		}
+		got, err := s.Introspect(context.Background(), tok.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		} else if got == nil || got.Actor.String() != testActor {
+			t.Fatalf("got token %+v, want one for %s", got, testActor)
+		}
+		// The code is single-use.
+		resp = postForm(s.TokenHandler(), "https://example.com/oauth/token", tokenParams(reg.ClientID, code, testVerifier), "", "")
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusBadRequest)
+		}
+	})
+	t.Run("RejectsWrongCodeVerifier", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"scope":"read write","token_endpoint_auth_method":"none"}`)
+		code := authorize(t, s, authorizeParams(reg.ClientID)).Query().Get("code")
+		resp := postForm(s.TokenHandler(), "https://example.com/oauth/token", tokenParams(reg.ClientID, code, "wrong"), "", "")
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "invalid_grant") {
+			t.Fatalf("got status %d and %s, want invalid_grant", resp.Code, resp.Body.String())
+		}
+	})
+	t.Run("RejectsExpiredCode", func(t *testing.T) {
+		s, clock := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"scope":"read write","token_endpoint_auth_method":"none"}`)
+		code := authorize(t, s, authorizeParams(reg.ClientID)).Query().Get("code")
+		clock.now = clock.now.Add(defaultCodeTTL)
+		resp := postForm(s.TokenHandler(), "https://example.com/oauth/token", tokenParams(reg.ClientID, code, testVerifier), "", "")
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusBadRequest)
+		}
+	})
+	t.Run("ExchangesCodeWithoutOmittedRedirectURI", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"scope":"read write","token_endpoint_auth_method":"none"}`)
+		params := authorizeParams(reg.ClientID)
+		params.Del("redirect_uri")
+		loc := authorize(t, s, params)
+		if got := loc.Scheme + "://" + loc.Host + loc.Path; got != testRedirectURI {
+			t.Fatalf("got redirect to %s, want %s", got, testRedirectURI)
+		}
+		form := tokenParams(reg.ClientID, loc.Query().Get("code"), testVerifier)
+		form.Del("redirect_uri")
+		resp := postForm(s.TokenHandler(), "https://example.com/oauth/token", form, "", "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d: %s", resp.Code, http.StatusOK, resp.Body.String())
+		}
+	})
+	t.Run("RejectsMismatchedRedirectURI", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"scope":"read write","token_endpoint_auth_method":"none"}`)
+		code := authorize(t, s, authorizeParams(reg.ClientID)).Query().Get("code")
+		form := tokenParams(reg.ClientID, code, testVerifier)
+		form.Del("redirect_uri")
+		resp := postForm(s.TokenHandler(), "https://example.com/oauth/token", form, "", "")
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), "invalid_grant") {
+			t.Fatalf("got status %d and %s, want invalid_grant", resp.Code, resp.Body.String())
+		}
+	})
+	t.Run("AuthenticatesConfidentialClient", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"scope":"read write"}`)
+		if len(reg.ClientSecret) == 0 {
+			t.Fatalf("confidential client was not issued a secret")
+		}
+		code := authorize(t, s, authorizeParams(reg.ClientID)).Query().Get("code")
+		resp := postForm(s.TokenHandler(), "https://example.com/oauth/token", tokenParams(reg.ClientID, code, testVerifier), reg.ClientID, "wrong")
+		if resp.Code != http.StatusUnauthorized {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusUnauthorized)
+		}
+	})
+	t.Run("RequiresCodeChallenge", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"token_endpoint_auth_method":"none"}`)
+		params := authorizeParams(reg.ClientID)
+		params.Set("scope", "read")
+		params.Del("code_challenge")
+		loc := authorize(t, s, params)
+		if got := loc.Query().Get("error"); got != "invalid_request" {
+			t.Fatalf("got error %q, want %q", got, "invalid_request")
+		}
+	})
+	t.Run("RejectsUnregisteredScope", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"token_endpoint_auth_method":"none"}`)
+		loc := authorize(t, s, authorizeParams(reg.ClientID))
+		if got := loc.Query().Get("error"); got != "invalid_scope" {
+			t.Fatalf("got error %q, want %q", got, "invalid_scope")
+		}
+	})
+	t.Run("RedirectsDeniedRequest", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"scope":"read write","token_endpoint_auth_method":"none"}`)
+		params := authorizeParams(reg.ClientID)
+		params.Set("deny", "1")
+		loc := authorize(t, s, params)
+		if got := loc.Query().Get("error"); got != "access_denied" {
+			t.Fatalf("got error %q, want %q", got, "access_denied")
+		}
+	})
+	t.Run("DoesNotRedirectToUnregisteredURI", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"scope":"read write","token_endpoint_auth_method":"none"}`)
+		params := authorizeParams(reg.ClientID)
+		params.Set("redirect_uri", "https://evil.example.net/callback")
+		resp := httptest.NewRecorder()
+		s.AuthorizationHandler().ServeHTTP(resp, httptest.NewRequest("GET", "https://example.com/oauth/authorize?"+params.Encode(), nil))
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusBadRequest)
+		}
+	})
+	t.Run("IntrospectsToken", func(t *testing.T) {
+		s, _ := newTestServer()
+		reg := register(t, s, `{"redirect_uris":["`+testRedirectURI+`"],"scope":"read write"}`)
+		code := authorize(t, s, authorizeParams(reg.ClientID)).Query().Get("code")
+		resp := postForm(s.TokenHandler(), "https://example.com/oauth/token", tokenParams(reg.ClientID, code, testVerifier), reg.ClientID, reg.ClientSecret)
+		var tok tokenResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &tok); err != nil {
+			t.Fatal(err)
+		}
+		resp = postForm(s.IntrospectionHandler(), "https://example.com/oauth/introspect", url.Values{"token": []string{tok.AccessToken}}, reg.ClientID, reg.ClientSecret)
+		var info introspectionResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &info); err != nil {
+			t.Fatal(err)
+		}
+		if !info.Active || info.Subject != testActor || info.Scope != "read write" || info.ClientID != reg.ClientID {
+			t.Fatalf("got unexpected introspection %+v", info)
+		}
+		resp = postForm(s.IntrospectionHandler(), "https://example.com/oauth/introspect", url.Values{"token": []string{"unknown"}}, reg.ClientID, reg.ClientSecret)
+		if strings.TrimSpace(resp.Body.String()) != `{"active":false}` {
+			t.Fatalf("got %s, want an inactive token", resp.Body.String())
+		}
+	})
+	t.Run("AdvertisesActorEndpoints", func(t *testing.T) {
+		s, _ := newTestServer()
+		e := s.ActorEndpoints()
+		if e.OAuthAuthorizationEndpoint.String() != "https://example.com/oauth/authorize" || e.OAuthTokenEndpoint.String() != "https://example.com/oauth/token" {
+			t.Fatalf("got unexpected endpoints %+v", e)
+		}
+	})
+}
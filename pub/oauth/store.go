@@ -0,0 +1,103 @@
+package oauth
+
+import (
+	"context"
+	"sync"
+)
+
+// TokenStore persists the registered clients and the grants issued to them.
+//
+// Lookups return nil and no error if there is no such value. Implementations
+// must be safe for concurrent use.
+type TokenStore interface {
+	// SaveClient stores a newly registered client.
+	SaveClient(c context.Context, cl *Client) error
+	// Client returns the client with the id.
+	Client(c context.Context, id string) (*Client, error)
+	// SaveCode stores a newly issued authorization code.
+	SaveCode(c context.Context, code *AuthorizationCode) error
+	// TakeCode returns the authorization code and removes it, so that it
+	// is only ever exchanged once.
+	TakeCode(c context.Context, code string) (*AuthorizationCode, error)
+	// SaveToken stores a newly issued access token.
+	SaveToken(c context.Context, t *Token) error
+	// Token returns the access token, including expired ones.
+	Token(c context.Context, accessToken string) (*Token, error)
+	// RevokeToken removes the access token, if it exists.
+	RevokeToken(c context.Context, accessToken string) error
+}
+
+// MemoryStore is a TokenStore keeping its values in memory, which are lost when
+// the process exits.
+type MemoryStore struct {
+	mu      sync.Mutex
+	clients map[string]*Client
+	codes   map[string]*AuthorizationCode
+	tokens  map[string]*Token
+}
+
+var _ TokenStore = &MemoryStore{}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clients: make(map[string]*Client),
+		codes:   make(map[string]*AuthorizationCode),
+		tokens:  make(map[string]*Token),
+	}
+}
+
+// SaveClient stores the client.
+func (m *MemoryStore) SaveClient(c context.Context, cl *Client) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clients[cl.ID] = cl
+	return nil
+}
+
+// Client returns the client with the id.
+func (m *MemoryStore) Client(c context.Context, id string) (*Client, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clients[id], nil
+}
+
+// SaveCode stores the authorization code.
+func (m *MemoryStore) SaveCode(c context.Context, code *AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code.Code] = code
+	return nil
+}
+
+// TakeCode returns and removes the authorization code.
+func (m *MemoryStore) TakeCode(c context.Context, code string) (*AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ac := m.codes[code]
+	delete(m.codes, code)
+	return ac, nil
+}
+
+// SaveToken stores the access token.
+func (m *MemoryStore) SaveToken(c context.Context, t *Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[t.AccessToken] = t
+	return nil
+}
+
+// Token returns the access token.
+func (m *MemoryStore) Token(c context.Context, accessToken string) (*Token, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tokens[accessToken], nil
+}
+
+// RevokeToken removes the access token.
+func (m *MemoryStore) RevokeToken(c context.Context, accessToken string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.tokens, accessToken)
+	return nil
+}
@@ -0,0 +1,236 @@
+package pub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Box is the kind of collection an ActivityPub request is made to.
+type Box string
+
+const (
+	// BoxInbox is an actor's inbox.
+	BoxInbox Box = "inbox"
+	// BoxOutbox is an actor's outbox.
+	BoxOutbox Box = "outbox"
+)
+
+// Observer is notified of what an Actor does, in order to collect metrics or
+// trace requests.
+//
+// Methods starting an operation return the context the operation continues
+// with. Tracers may return a context carrying a new span, which is then passed
+// to the delegates of the Actor, to the Transport, and to the method notifying
+// the end of the operation. Durations are measured with the Actor's Clock.
+//
+// Observers are called synchronously, and concurrently for concurrent requests,
+// so they should be quick and safe for concurrent use. Embed NoopObserver to
+// only implement some of the methods.
+type Observer interface {
+	// RequestReceived is called when the Actor begins handling an
+	// ActivityPub GET or POST request to an inbox or outbox.
+	RequestReceived(c context.Context, box Box, r *http.Request) context.Context
+	// RequestAuthenticated is called once the request has been
+	// authenticated by the application, or has failed to be.
+	RequestAuthenticated(c context.Context, box Box, r *http.Request, authenticated bool)
+	// RequestHandled is called when the Actor is done handling the
+	// request, with the error it returned, if any.
+	RequestHandled(c context.Context, box Box, r *http.Request, d time.Duration, err error)
+	// SideEffectRun is called once the side effects of a new activity
+	// posted to an inbox or outbox have run.
+	SideEffectRun(c context.Context, box Box, activityType string, d time.Duration, err error)
+	// ForwardingDecided is called once the Actor has decided whether to
+	// forward an activity delivered to an inbox. The recipients are empty
+	// if it is not forwarded.
+	ForwardingDecided(c context.Context, activity *url.URL, recipients []*url.URL)
+	// DeliveryStarted is called when the Transport begins delivering an
+	// activity to the recipients' inboxes.
+	DeliveryStarted(c context.Context, recipients []*url.URL) context.Context
+	// DeliveryFinished is called when the Transport is done delivering,
+	// with the error it returned, if any.
+	DeliveryFinished(c context.Context, recipients []*url.URL, d time.Duration, err error)
+	// DereferenceStarted is called when the Transport begins fetching an
+	// IRI.
+	DereferenceStarted(c context.Context, iri *url.URL) context.Context
+	// DereferenceFinished is called when the Transport is done fetching
+	// the IRI, with the error it returned, if any.
+	DereferenceFinished(c context.Context, iri *url.URL, d time.Duration, err error)
+}
+
+// NoopObserver is an Observer doing nothing.
+type NoopObserver struct{}
+
+// NoopObserver is an Observer.
+var _ Observer = NoopObserver{}
+
+// RequestReceived returns the context.
+func (NoopObserver) RequestReceived(c context.Context, box Box, r *http.Request) context.Context {
+	return c
+}
+
+// RequestAuthenticated does nothing.
+func (NoopObserver) RequestAuthenticated(c context.Context, box Box, r *http.Request, authenticated bool) {
+}
+
+// RequestHandled does nothing.
+func (NoopObserver) RequestHandled(c context.Context, box Box, r *http.Request, d time.Duration, err error) {
+}
+
+// SideEffectRun does nothing.
+func (NoopObserver) SideEffectRun(c context.Context, box Box, activityType string, d time.Duration, err error) {
+}
+
+// ForwardingDecided does nothing.
+func (NoopObserver) ForwardingDecided(c context.Context, activity *url.URL, recipients []*url.URL) {
+}
+
+// DeliveryStarted returns the context.
+func (NoopObserver) DeliveryStarted(c context.Context, recipients []*url.URL) context.Context {
+	return c
+}
+
+// DeliveryFinished does nothing.
+func (NoopObserver) DeliveryFinished(c context.Context, recipients []*url.URL, d time.Duration, err error) {
+}
+
+// DereferenceStarted returns the context.
+func (NoopObserver) DereferenceStarted(c context.Context, iri *url.URL) context.Context {
+	return c
+}
+
+// DereferenceFinished does nothing.
+func (NoopObserver) DereferenceFinished(c context.Context, iri *url.URL, d time.Duration, err error) {
+}
+
+// WithObserver notifies the Observer of the requests an Actor handles. If the
+// Actor was not created with NewCustomActor, the Observer is also notified of
+// the side effects the Actor runs, of its inbox forwarding decisions, and of the
+// calls to the Transports it creates.
+//
+// Without this option, an Actor observes nothing and measures no durations.
+func WithObserver(o Observer) ActorOption {
+	return func(b *baseActor) {
+		b.observer = o
+		if s, ok := b.delegate.(*sideEffectActor); ok {
+			s.observer = o
+		}
+	}
+}
+
+// observeRequest notifies the Observer, if any, that a request to the box was
+// received. It returns the context to handle the request with, and a function
+// to call with the context and error once the request is handled.
+func (b *baseActor) observeRequest(c context.Context, box Box, r *http.Request) (context.Context, func(c context.Context, err error)) {
+	if b.observer == nil {
+		return c, func(context.Context, error) {}
+	}
+	c = b.observer.RequestReceived(c, box, r)
+	start := b.clock.Now()
+	return c, func(c context.Context, err error) {
+		b.observer.RequestHandled(c, box, r, b.clock.Now().Sub(start), err)
+	}
+}
+
+// observeAuthentication notifies the Observer, if any, of the outcome of
+// authenticating a request to the box.
+func (b *baseActor) observeAuthentication(c context.Context, box Box, r *http.Request, authenticated bool) {
+	if b.observer != nil {
+		b.observer.RequestAuthenticated(c, box, r, authenticated)
+	}
+}
+
+// observeSideEffect returns a function to call with the error of running the
+// side effects of the activity, notifying the Observer, if any.
+//
+// Within a transaction, the Observer is only notified of side effects that
+// succeed once the transaction is committed, and not at all of attempts that
+// are tried again once values are fetched.
+func (a *sideEffectActor) observeSideEffect(c context.Context, box Box, activity Activity) func(err error) {
+	if a.observer == nil {
+		return func(error) {}
+	}
+	start := a.clock.Now()
+	return func(err error) {
+		d := a.clock.Now().Sub(start)
+		switch {
+		case a.tx == nil:
+			a.observer.SideEffectRun(c, box, activity.GetTypeName(), d, err)
+		case len(a.tx.missing) > 0 || errors.Is(err, ErrTxConflict):
+			// The side effects are run again in a new attempt.
+		case err != nil:
+			a.observer.SideEffectRun(c, box, activity.GetTypeName(), d, err)
+		default:
+			a.afterCommit(func(a *sideEffectActor) error {
+				a.observer.SideEffectRun(c, box, activity.GetTypeName(), d, nil)
+				return nil
+			})
+		}
+	}
+}
+
+// observeForwarding notifies the Observer, if any, of the decision to forward
+// the activity to the recipients.
+func (a *sideEffectActor) observeForwarding(c context.Context, activity Activity, recipients []*url.URL) {
+	if a.observer != nil {
+		a.observer.ForwardingDecided(c, activity.GetJSONLDId().Get(), recipients)
+	}
+}
+
+// newTransport creates a Transport with CommonBehavior's NewTransport, which
+// notifies the Observer, if any, of its calls, and does not wait on peers
+// within a transaction.
+func (a *sideEffectActor) newTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (Transport, error) {
+	t, err := a.common.NewTransport(c, actorBoxIRI, gofedAgent)
+	if err != nil {
+		return nil, err
+	}
+	return a.txTransport(a.observeTransport(t)), nil
+}
+
+// observeTransport returns a Transport notifying the Observer, if any, of the
+// calls to the Transport.
+func (a *sideEffectActor) observeTransport(t Transport) Transport {
+	if a.observer == nil {
+		return t
+	}
+	return &observingTransport{t: t, o: a.observer, clock: a.clock}
+}
+
+// observingTransport is a Transport notifying an Observer of the calls made to
+// another Transport.
+type observingTransport struct {
+	t     Transport
+	o     Observer
+	clock Clock
+}
+
+// Dereference fetches the IRI with the underlying Transport.
+func (t *observingTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	c = t.o.DereferenceStarted(c, iri)
+	start := t.clock.Now()
+	b, err := t.t.Dereference(c, iri)
+	t.o.DereferenceFinished(c, iri, t.clock.Now().Sub(start), err)
+	return b, err
+}
+
+// Deliver delivers to the IRI with the underlying Transport.
+func (t *observingTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	recipients := []*url.URL{to}
+	c = t.o.DeliveryStarted(c, recipients)
+	start := t.clock.Now()
+	err := t.t.Deliver(c, b, to)
+	t.o.DeliveryFinished(c, recipients, t.clock.Now().Sub(start), err)
+	return err
+}
+
+// BatchDeliver delivers to the recipients with the underlying Transport.
+func (t *observingTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	c = t.o.DeliveryStarted(c, recipients)
+	start := t.clock.Now()
+	err := t.t.BatchDeliver(c, b, recipients)
+	t.o.DeliveryFinished(c, recipients, t.clock.Now().Sub(start), err)
+	return err
+}
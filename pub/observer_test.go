@@ -0,0 +1,232 @@
+package pub
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+// spanContextKey is the context key of the spans of the fakeObserver.
+type spanContextKey struct{}
+
+// fakeObserver records what it is notified of, and starts a span in the
+// context of every operation.
+type fakeObserver struct {
+	NoopObserver
+	events []string
+}
+
+func (o *fakeObserver) RequestReceived(c context.Context, box Box, r *http.Request) context.Context {
+	o.events = append(o.events, fmt.Sprintf("received %s %s", r.Method, box))
+	return context.WithValue(c, spanContextKey{}, "request")
+}
+
+func (o *fakeObserver) RequestAuthenticated(c context.Context, box Box, r *http.Request, authenticated bool) {
+	o.events = append(o.events, fmt.Sprintf("authenticated %s %s %v", r.Method, box, authenticated))
+}
+
+func (o *fakeObserver) RequestHandled(c context.Context, box Box, r *http.Request, d time.Duration, err error) {
+	o.events = append(o.events, fmt.Sprintf("handled %s %s %v in %s %v", r.Method, box, c.Value(spanContextKey{}), d, err))
+}
+
+func (o *fakeObserver) SideEffectRun(c context.Context, box Box, activityType string, d time.Duration, err error) {
+	o.events = append(o.events, fmt.Sprintf("ran %s %s in %s %v", box, activityType, d, err))
+}
+
+func (o *fakeObserver) DereferenceStarted(c context.Context, iri *url.URL) context.Context {
+	o.events = append(o.events, fmt.Sprintf("dereferencing %s", iri))
+	return context.WithValue(c, spanContextKey{}, "dereference")
+}
+
+func (o *fakeObserver) DereferenceFinished(c context.Context, iri *url.URL, d time.Duration, err error) {
+	o.events = append(o.events, fmt.Sprintf("dereferenced %s %v in %s %v", iri, c.Value(spanContextKey{}), d, err))
+}
+
+func (o *fakeObserver) DeliveryStarted(c context.Context, recipients []*url.URL) context.Context {
+	o.events = append(o.events, fmt.Sprintf("delivering to %d", len(recipients)))
+	return context.WithValue(c, spanContextKey{}, "delivery")
+}
+
+func (o *fakeObserver) DeliveryFinished(c context.Context, recipients []*url.URL, d time.Duration, err error) {
+	o.events = append(o.events, fmt.Sprintf("delivered to %d %v in %s %v", len(recipients), c.Value(spanContextKey{}), d, err))
+}
+
+// TestObserver tests that Actors notify their Observer.
+func TestObserver(t *testing.T) {
+	ctx := context.Background()
+	spanCtx := context.WithValue(ctx, spanContextKey{}, "request")
+	now := time.Now()
+	t.Run("ObservesRequests", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		setupData()
+		delegate := NewMockDelegateActor(ctl)
+		clock := NewMockClock(ctl)
+		o := &fakeObserver{}
+		a := NewCustomActor(delegate, false, true, clock, WithObserver(o))
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostInboxRequest(testCreate))
+		gomock.InOrder(
+			clock.EXPECT().Now().Return(now),
+			clock.EXPECT().Now().Return(now.Add(time.Second)),
+		)
+		delegate.EXPECT().AuthenticatePostInbox(spanCtx, resp, req).Return(spanCtx, true, nil)
+		delegate.EXPECT().PostInboxRequestBodyHook(spanCtx, req, toDeserializedForm(testCreate)).Return(spanCtx, nil)
+		delegate.EXPECT().AuthorizePostInbox(spanCtx, resp, toDeserializedForm(testCreate)).Return(true, nil)
+		delegate.EXPECT().PostInbox(spanCtx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		delegate.EXPECT().InboxForwarding(spanCtx, mustParse(testMyInboxIRI), toDeserializedForm(testCreate)).Return(nil)
+		// Run
+		_, err := a.PostInbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, fmt.Sprint(o.events), fmt.Sprint([]string{
+			"received POST inbox",
+			"authenticated POST inbox true",
+			"handled POST inbox request in 1s <nil>",
+		}))
+	})
+	t.Run("ObservesUnauthenticatedRequests", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		setupData()
+		delegate := NewMockDelegateActor(ctl)
+		clock := NewMockClock(ctl)
+		o := &fakeObserver{}
+		a := NewCustomActor(delegate, true, false, clock, WithObserver(o))
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toGetOutboxRequest())
+		clock.EXPECT().Now().Return(now).Times(2)
+		delegate.EXPECT().AuthenticateGetOutbox(spanCtx, resp, req).Return(spanCtx, false, nil)
+		// Run
+		_, err := a.GetOutbox(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, fmt.Sprint(o.events), fmt.Sprint([]string{
+			"received GET outbox",
+			"authenticated GET outbox false",
+			"handled GET outbox request in 0s <nil>",
+		}))
+	})
+	t.Run("ObservesSideEffects", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		setupData()
+		fp := NewMockFederatingProtocol(ctl)
+		db := NewMockDatabase(ctl)
+		clock := NewMockClock(ctl)
+		o := &fakeObserver{}
+		a := &sideEffectActor{s2s: fp, db: db, clock: clock, observer: o}
+		inboxIRI := mustParse(testMyInboxIRI)
+		db.EXPECT().Lock(ctx, inboxIRI)
+		db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		db.EXPECT().AppendInbox(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(nil)
+		db.EXPECT().Unlock(ctx, inboxIRI)
+		gomock.InOrder(
+			clock.EXPECT().Now().Return(now),
+			clock.EXPECT().Now().Return(now.Add(time.Millisecond)),
+		)
+		fp.EXPECT().FederatingCallbacks(ctx).Return(FederatingWrappedCallbacks{}, nil, nil)
+		fp.EXPECT().DefaultCallback(ctx, testListen).Return(nil)
+		// Run
+		err := a.PostInbox(ctx, inboxIRI, testListen)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, fmt.Sprint(o.events), fmt.Sprint([]string{
+			"ran inbox Listen in 1ms <nil>",
+		}))
+	})
+	t.Run("ObservesTransports", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		setupData()
+		common := NewMockCommonBehavior(ctl)
+		tp := NewMockTransport(ctl)
+		clock := NewMockClock(ctl)
+		o := &fakeObserver{}
+		a := &sideEffectActor{common: common, clock: clock, observer: o}
+		iri := mustParse(testFederatedActorIRI)
+		inboxIRI := mustParse(testFederatedInboxIRI)
+		fetchErr := errors.New("test")
+		clock.EXPECT().Now().Return(now).Times(4)
+		common.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(context.WithValue(ctx, spanContextKey{}, "dereference"), iri).Return(nil, fetchErr)
+		tp.EXPECT().Deliver(context.WithValue(ctx, spanContextKey{}, "delivery"), []byte("{}"), inboxIRI).Return(nil)
+		// Run
+		ot, err := a.newTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent())
+		assertEqual(t, err, nil)
+		_, err = ot.Dereference(ctx, iri)
+		assertEqual(t, err, fetchErr)
+		err = ot.Deliver(ctx, []byte("{}"), inboxIRI)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, fmt.Sprint(o.events), fmt.Sprint([]string{
+			"dereferencing " + testFederatedActorIRI,
+			"dereferenced " + testFederatedActorIRI + " dereference in 0s test",
+			"delivering to 1",
+			"delivered to 1 delivery in 0s <nil>",
+		}))
+	})
+	t.Run("DoesNotWrapTransportsWithoutObserver", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		common := NewMockCommonBehavior(ctl)
+		tp := NewMockTransport(ctl)
+		a := &sideEffectActor{common: common}
+		common.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		// Run
+		ot, err := a.newTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent())
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, ot, Transport(tp))
+	})
+}
+
+// TestExpvarObserver tests the counters of the ExpvarObserver.
+func TestExpvarObserver(t *testing.T) {
+	ctx := context.Background()
+	m := new(expvar.Map).Init()
+	o := NewExpvarObserver(m)
+	req := httptest.NewRequest("POST", testMyInboxIRI, nil)
+	recipients := []*url.URL{mustParse(testFederatedInboxIRI), mustParse(testFederatedInboxIRI2)}
+	o.RequestReceived(ctx, BoxInbox, req)
+	o.RequestAuthenticated(ctx, BoxInbox, req, false)
+	o.RequestHandled(ctx, BoxInbox, req, time.Second, errors.New("test"))
+	o.SideEffectRun(ctx, BoxInbox, "Create", time.Second, nil)
+	o.ForwardingDecided(ctx, mustParse(testFederatedActivityIRI), recipients)
+	o.ForwardingDecided(ctx, mustParse(testFederatedActivityIRI2), nil)
+	o.DeliveryFinished(ctx, recipients, time.Second, errors.New("test"))
+	o.DereferenceFinished(ctx, mustParse(testFederatedActorIRI), time.Second, nil)
+	for key, want := range map[string]string{
+		"inbox.POST.requests":        "1",
+		"inbox.POST.unauthenticated": "1",
+		"inbox.POST.errors":          "1",
+		"inbox.POST.nanos":           "1000000000",
+		"inbox.sideEffects.Create":   "1",
+		"forwarded":                  "1",
+		"notForwarded":               "1",
+		"deliveries":                 "2",
+		"deliveryErrors":             "1",
+		"dereferences":               "1",
+	} {
+		v := m.Get(key)
+		if v == nil {
+			t.Errorf("%s is not set", key)
+			continue
+		}
+		assertEqual(t, v.String(), want)
+	}
+	assertEqual(t, m.Get("dereferenceErrors"), nil)
+}
@@ -0,0 +1,16 @@
+package pub
+
+// ActorOption configures optional behavior of an Actor at construction time.
+//
+// Options are applied in order after the Actor has been otherwise fully
+// constructed, so a later option may override an earlier one.
+type ActorOption func(b *baseActor)
+
+// applyOptions applies the options to the baseActor.
+func (b *baseActor) applyOptions(opts []ActorOption) {
+	for _, opt := range opts {
+		if opt != nil {
+			opt(b)
+		}
+	}
+}
@@ -111,6 +111,18 @@ type actorer interface {
 	SetActivityStreamsActor(i vocab.ActivityStreamsActorProperty)
 }
 
+// urler is an ActivityStreams type with a 'url' property
+type urler interface {
+	GetActivityStreamsUrl() vocab.ActivityStreamsUrlProperty
+	SetActivityStreamsUrl(i vocab.ActivityStreamsUrlProperty)
+}
+
+// mediaTypeer is an ActivityStreams type with a 'mediaType' property
+type mediaTypeer interface {
+	GetActivityStreamsMediaType() vocab.ActivityStreamsMediaTypeProperty
+	SetActivityStreamsMediaType(i vocab.ActivityStreamsMediaTypeProperty)
+}
+
 // appendIRIer is an ActivityStreams type that can Append IRIs.
 type appendIRIer interface {
 	AppendIRI(v *url.URL)
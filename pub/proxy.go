@@ -0,0 +1,247 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// proxyIdParam is the form parameter of the IRI fetched by the proxy.
+	proxyIdParam = "id"
+	// jsonLDIdProperty is the 'id' property of proxied objects.
+	jsonLDIdProperty = "id"
+	// defaultMaxProxyBytes is the default size limit of proxied objects.
+	defaultMaxProxyBytes = 1 << 20
+	// maxProxyRequestBytes limits the size of proxy requests, which only
+	// carry an IRI.
+	maxProxyRequestBytes = 8 << 10
+)
+
+// ProxyConfig configures the HandlerFunc returned by NewProxyHandler.
+type ProxyConfig struct {
+	// Outbox determines the outbox of the actor using the endpoint, whose
+	// Transport fetches the objects. If nil, the endpoint's IRI with its
+	// last path segment replaced by "outbox" is used, such as
+	// "https://example.com/addison/outbox" for
+	// "https://example.com/addison/proxy".
+	Outbox func(c context.Context, proxyIRI *url.URL) (*url.URL, error)
+	// NewTransport returns the Transport of the actor owning the outbox.
+	// If nil, CommonBehavior's NewTransport is used, which requires the
+	// Actor to have been created with NewSocialActor or NewActor.
+	NewTransport func(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (t Transport, err error)
+	// MaxBytes limits the size of the proxied objects. If zero, 1 MiB is
+	// used.
+	MaxBytes int
+	// LookupIP resolves the host of a requested IRI, whose addresses must
+	// all be public according to IsPublicIP. If nil, the host is resolved
+	// with net.DefaultResolver.
+	LookupIP func(c context.Context, host string) ([]net.IP, error)
+	// Scheme is the protocol scheme of the endpoint's IRI. If empty,
+	// "https" is used.
+	Scheme string
+}
+
+// limitedDereferencer is a Transport able to stop reading a response once it
+// exceeds a size, such as HttpSigTransport.
+type limitedDereferencer interface {
+	// DereferenceLimit fetches the IRI, reading at most maxBytes.
+	DereferenceLimit(c context.Context, iri *url.URL, maxBytes int64) ([]byte, error)
+}
+
+// proxier is an Actor able to fetch objects on behalf of its clients.
+type proxier interface {
+	// postProxy handles a proxy request.
+	postProxy(c context.Context, w http.ResponseWriter, r *http.Request, cfg ProxyConfig) (bool, error)
+}
+
+// NewProxyHandler creates a HandlerFunc serving the 'proxyUrl' endpoint of the
+// Social API for an Actor, which may be advertised with the ProxyURL of
+// ActorEndpoints.
+//
+// Clients POST a form with the HTTPS "id" of a remote object, which this
+// server fetches with the Transport of the client's actor, so that peers
+// requiring signed fetches respond. The response must be a JSON object whose
+// 'id' is on the same host as the requested IRI, and is returned to the client
+// as ActivityStreams data.
+//
+// IRIs whose host resolves to an address that is not public, such as a
+// loopback or private network address, are refused with a ForbiddenError.
+// Since the Transport resolves the host again and may follow redirects, its
+// HttpClient should also dial with DialPublicOnly. Transports implementing
+// DereferenceLimit, such as HttpSigTransport, stop reading responses larger
+// than MaxBytes; the responses of other Transports are checked after they are
+// read.
+//
+// The request is authenticated with AuthenticatePostOutbox. Failures to reach
+// the peer are returned as a RemoteError. Only POST requests with a form
+// content type are handled.
+func NewProxyHandler(a Actor, cfg ProxyConfig) HandlerFunc {
+	if cfg.Outbox == nil {
+		cfg.Outbox = siblingOutbox
+	}
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = defaultMaxProxyBytes
+	}
+	if len(cfg.Scheme) == 0 {
+		cfg.Scheme = "https"
+	}
+	return func(c context.Context, w http.ResponseWriter, r *http.Request) (isASRequest bool, err error) {
+		// Do nothing if it is not a form POST request.
+		if !isFormPost(r) {
+			return
+		}
+		p, ok := a.(proxier)
+		if !ok {
+			return true, fmt.Errorf("actor %T does not support proxying", a)
+		}
+		return p.postProxy(c, w, r, cfg)
+	}
+}
+
+// postProxy implements the generic algorithm for handling a request to the
+// 'proxyUrl' endpoint, fetching a remote object on behalf of a client.
+func (b *baseActor) postProxy(c context.Context, w http.ResponseWriter, r *http.Request, cfg ProxyConfig) (bool, error) {
+	// If the Social API is not enabled, then this endpoint is not enabled.
+	if !b.enableSocialProtocol {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return true, nil
+	}
+	// Delegate authenticating and authorizing the request.
+	c, authenticated, err := b.delegate.AuthenticatePostOutbox(c, w, r)
+	if err != nil {
+		return true, err
+	} else if !authenticated {
+		return true, nil
+	}
+	// Everything is good to begin processing the request.
+	r.Body = http.MaxBytesReader(w, r.Body, maxProxyRequestBytes)
+	if err = r.ParseForm(); err != nil {
+		writeClientError(w, &MalformedError{Err: err})
+		return true, nil
+	}
+	iri, err := url.Parse(r.PostForm.Get(proxyIdParam))
+	if err != nil {
+		writeClientError(w, &MalformedError{Err: err})
+		return true, nil
+	} else if iri.Scheme != "https" || len(iri.Hostname()) == 0 {
+		writeClientError(w, malformedf("cannot proxy %q", iri))
+		return true, nil
+	}
+	if err = checkPublicHost(c, cfg.LookupIP, iri); writeClientError(w, err) {
+		return true, nil
+	} else if err != nil {
+		return true, err
+	}
+	outboxId, err := cfg.Outbox(c, requestId(r, cfg.Scheme))
+	if err != nil {
+		return true, err
+	}
+	newTransport := cfg.NewTransport
+	if newTransport == nil {
+		s, ok := b.delegate.(*sideEffectActor)
+		if !ok {
+			return true, fmt.Errorf("ProxyConfig requires NewTransport for delegate %T", b.delegate)
+		}
+		newTransport = s.newTransport
+	}
+	tp, err := newTransport(c, outboxId, goFedUserAgent())
+	if err != nil {
+		return true, err
+	}
+	var raw []byte
+	if ld, ok := tp.(limitedDereferencer); ok {
+		raw, err = ld.DereferenceLimit(c, iri, int64(cfg.MaxBytes))
+	} else {
+		raw, err = tp.Dereference(c, iri)
+	}
+	if err != nil {
+		return true, err
+	}
+	if err = validateProxied(iri, raw, cfg.MaxBytes); err != nil {
+		return true, err
+	}
+	// Respond with the fetched data.
+	addResponseHeaders(w.Header(), b.clock, raw)
+	w.WriteHeader(http.StatusOK)
+	n, err := w.Write(raw)
+	if err != nil {
+		return true, err
+	} else if n != len(raw) {
+		return true, fmt.Errorf("ResponseWriter.Write wrote %d of %d bytes", n, len(raw))
+	}
+	return true, nil
+}
+
+// validateProxied determines whether the data fetched from the IRI may be given
+// to a client: it must not be too large, and must be a JSON object whose 'id'
+// is on the IRI's host, so that a peer cannot serve objects of other servers.
+func validateProxied(iri *url.URL, raw []byte, maxBytes int) error {
+	if len(raw) > maxBytes {
+		return &RemoteError{IRI: iri, Err: fmt.Errorf("%s is larger than %d bytes", iri, maxBytes)}
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return &RemoteError{IRI: iri, Err: err}
+	}
+	s, ok := m[jsonLDIdProperty].(string)
+	if !ok {
+		return &RemoteError{IRI: iri, Err: fmt.Errorf("%s has no id", iri)}
+	}
+	id, err := url.Parse(s)
+	if err != nil {
+		return &RemoteError{IRI: iri, Err: err}
+	} else if id.Host != iri.Host {
+		return &RemoteError{IRI: iri, Err: fmt.Errorf("%s served an object with id %s", iri, id)}
+	}
+	return nil
+}
+
+// checkPublicHost returns a ForbiddenError unless every address of the IRI's
+// host is public.
+func checkPublicHost(c context.Context, lookupIP func(c context.Context, host string) ([]net.IP, error), iri *url.URL) error {
+	host := iri.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if lookupIP == nil {
+			lookupIP = lookupIPAddrs
+		}
+		var err error
+		if ips, err = lookupIP(c, host); err != nil {
+			return &RemoteError{IRI: iri, Err: err}
+		}
+	}
+	for _, ip := range ips {
+		if !IsPublicIP(ip) {
+			return forbiddenf("cannot proxy %s, which has the non-public address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+// lookupIPAddrs resolves the host with the default resolver.
+func lookupIPAddrs(c context.Context, host string) ([]net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(c, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, nil
+}
+
+// isFormPost returns true if the request is a POST request with a URL-encoded
+// form body.
+func isFormPost(r *http.Request) bool {
+	if r.Method != "POST" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(contentTypeHeader))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
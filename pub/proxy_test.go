@@ -0,0 +1,182 @@
+package pub
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+const (
+	testProxyIRI = "https://example.com/addison/proxy"
+)
+
+// toProxyRequest creates a proxy request for the IRI.
+func toProxyRequest(id string) *http.Request {
+	form := url.Values{proxyIdParam: []string{id}}
+	req := httptest.NewRequest("POST", testProxyIRI, strings.NewReader(form.Encode()))
+	req.Header.Set(contentTypeHeader, "application/x-www-form-urlencoded")
+	return req
+}
+
+// TestProxyHandler tests fetching remote objects on behalf of clients.
+func TestProxyHandler(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (c *MockCommonBehavior, sp *MockSocialProtocol, tp *MockTransport, clock *MockClock, h HandlerFunc) {
+		setupData()
+		c = NewMockCommonBehavior(ctl)
+		sp = NewMockSocialProtocol(ctl)
+		tp = NewMockTransport(ctl)
+		clock = NewMockClock(ctl)
+		a := NewSocialActor(c, sp, NewMockDatabase(ctl), clock)
+		h = NewProxyHandler(a, ProxyConfig{
+			LookupIP: func(c context.Context, host string) ([]net.IP, error) {
+				if host == "internal.example.com" {
+					return []net.IP{net.ParseIP("10.0.0.1")}, nil
+				}
+				return []net.IP{net.ParseIP("93.184.216.34")}, nil
+			},
+		})
+		return
+	}
+	t.Run("IgnoresNonFormRequest", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, _, h := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toAPRequest(toPostOutboxRequest(testMyNote))
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, false)
+	})
+	t.Run("FetchesWithActorTransport", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, sp, tp, clock, h := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toProxyRequest(testNoteId1)
+		raw := mustSerializeToBytes(testFederatedNote)
+		// Mock
+		sp.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testNoteId1)).Return(raw, nil)
+		clock.EXPECT().Now().Return(now())
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusOK)
+		assertEqual(t, resp.Header().Get(contentTypeHeader), contentTypeHeaderValue)
+		assertByteEqual(t, resp.Body.Bytes(), raw)
+	})
+	t.Run("DeniesIfNotAuthenticated", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, sp, _, _, h := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toProxyRequest(testNoteId1)
+		// Mock
+		sp.EXPECT().AuthenticatePostOutbox(ctx, resp, req).DoAndReturn(func(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return c, false, nil
+		})
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusUnauthorized)
+	})
+	t.Run("BadRequestForNonHTTPId", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, sp, _, _, h := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toProxyRequest("file:///etc/passwd")
+		// Mock
+		sp.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("BadRequestForHTTPId", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, sp, _, _, h := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toProxyRequest("http://example.com/note/1")
+		// Mock
+		sp.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusBadRequest)
+	})
+	t.Run("ForbidsPrivateAddress", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, sp, _, _, h := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toProxyRequest("https://internal.example.com/admin")
+		// Mock
+		sp.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+	t.Run("ForbidsLoopbackAddress", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, sp, _, _, h := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toProxyRequest("https://[::1]:8080/admin")
+		// Mock
+		sp.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, handled, true)
+		assertEqual(t, resp.Code, http.StatusForbidden)
+	})
+	t.Run("RejectsObjectOfOtherHost", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		c, sp, tp, _, h := setupFn(ctl)
+		resp := httptest.NewRecorder()
+		req := toProxyRequest(testFederatedActivityIRI)
+		// Mock
+		sp.EXPECT().AuthenticatePostOutbox(ctx, resp, req).Return(ctx, true, nil)
+		c.EXPECT().NewTransport(ctx, mustParse(testMyOutboxIRI), goFedUserAgent()).Return(tp, nil)
+		tp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(mustSerializeToBytes(testFederatedNote), nil)
+		// Run
+		handled, err := h(ctx, resp, req)
+		// Verify
+		assertEqual(t, handled, true)
+		assertEqual(t, ErrorStatusCode(err), http.StatusBadGateway)
+	})
+}
@@ -105,27 +105,12 @@ var (
 	// testOrderedCollectionDedupedElemsString is the JSON-LD version of the
 	// testOrderedCollectionDedupedElems value with duplicates removed
 	testOrderedCollectionDedupedElemsString string
-	// testEmptyOrderedCollection is an empty OrderedCollectionPage.
-	testEmptyOrderedCollection vocab.ActivityStreamsOrderedCollectionPage
-	// testOrderedCollectionWithNewId has the new id
-	testOrderedCollectionWithNewId vocab.ActivityStreamsOrderedCollectionPage
-	// testOrderedCollectionWithNewId has the second new id
-	testOrderedCollectionWithNewId2 vocab.ActivityStreamsOrderedCollectionPage
-	// testOrderedCollectionWithBothNewIds has both new ids.
-	testOrderedCollectionWithBothNewIds vocab.ActivityStreamsOrderedCollectionPage
-	// testOrderedCollectionWithFederatedId has the federated Activity id.
-	testOrderedCollectionWithFederatedId vocab.ActivityStreamsOrderedCollectionPage
 	// testMyListen is a test Listen C2S Activity.
 	testMyListen vocab.ActivityStreamsListen
 	// testMyListenNoId is a test Listen C2S Activity without an id.
 	testMyListenNoId vocab.ActivityStreamsListen
 	// testListen is a test Listen Activity.
 	testListen vocab.ActivityStreamsListen
-	// testOrderedCollectionWithFederatedId2 has the second federated
-	// Activity id.
-	testOrderedCollectionWithFederatedId2 vocab.ActivityStreamsOrderedCollectionPage
-	// testOrderedCollectionWithBothFederatedIds has both federated Activity id.
-	testOrderedCollectionWithBothFederatedIds vocab.ActivityStreamsOrderedCollectionPage
 	// testPerson is a Person.
 	testPerson vocab.ActivityStreamsPerson
 	// testMyPerson is my Person.
@@ -268,39 +253,6 @@ func setupData() {
 		testOrderedCollectionDupedElems.SetActivityStreamsOrderedItems(oi)
 		testOrderedCollectionDedupedElemsString = `{"@context":"https://www.w3.org/ns/activitystreams","orderedItems":"https://example.com/note/1","type":"OrderedCollectionPage"}`
 	}()
-	// testEmptyOrderedCollection
-	func() {
-		testEmptyOrderedCollection = streams.NewActivityStreamsOrderedCollectionPage()
-	}()
-	// testOrderedCollectionWithNewId
-	func() {
-		testOrderedCollectionWithNewId = streams.NewActivityStreamsOrderedCollectionPage()
-		oi := streams.NewActivityStreamsOrderedItemsProperty()
-		oi.AppendIRI(mustParse(testNewActivityIRI))
-		testOrderedCollectionWithNewId.SetActivityStreamsOrderedItems(oi)
-	}()
-	// testOrderedCollectionWithNewId2
-	func() {
-		testOrderedCollectionWithNewId2 = streams.NewActivityStreamsOrderedCollectionPage()
-		oi := streams.NewActivityStreamsOrderedItemsProperty()
-		oi.AppendIRI(mustParse(testNewActivityIRI2))
-		testOrderedCollectionWithNewId2.SetActivityStreamsOrderedItems(oi)
-	}()
-	// testOrderedCollectionWithBothNewIds
-	func() {
-		testOrderedCollectionWithBothNewIds = streams.NewActivityStreamsOrderedCollectionPage()
-		oi := streams.NewActivityStreamsOrderedItemsProperty()
-		oi.AppendIRI(mustParse(testNewActivityIRI))
-		oi.AppendIRI(mustParse(testNewActivityIRI2))
-		testOrderedCollectionWithBothNewIds.SetActivityStreamsOrderedItems(oi)
-	}()
-	// testOrderedCollectionWithFederatedId
-	func() {
-		testOrderedCollectionWithFederatedId = streams.NewActivityStreamsOrderedCollectionPage()
-		oi := streams.NewActivityStreamsOrderedItemsProperty()
-		oi.AppendIRI(mustParse(testFederatedActivityIRI))
-		testOrderedCollectionWithFederatedId.SetActivityStreamsOrderedItems(oi)
-	}()
 	// testMyListen
 	func() {
 		testMyListen = streams.NewActivityStreamsListen()
@@ -331,21 +283,6 @@ func setupData() {
 		op.AppendActivityStreamsNote(testFederatedNote)
 		testListen.SetActivityStreamsObject(op)
 	}()
-	// testOrderedCollectionWithFederatedId2
-	func() {
-		testOrderedCollectionWithFederatedId2 = streams.NewActivityStreamsOrderedCollectionPage()
-		oi := streams.NewActivityStreamsOrderedItemsProperty()
-		oi.AppendIRI(mustParse(testFederatedActivityIRI2))
-		testOrderedCollectionWithFederatedId2.SetActivityStreamsOrderedItems(oi)
-	}()
-	// testOrderedCollectionWithBothFederatedIds
-	func() {
-		testOrderedCollectionWithBothFederatedIds = streams.NewActivityStreamsOrderedCollectionPage()
-		oi := streams.NewActivityStreamsOrderedItemsProperty()
-		oi.AppendIRI(mustParse(testFederatedActivityIRI))
-		oi.AppendIRI(mustParse(testFederatedActivityIRI2))
-		testOrderedCollectionWithBothFederatedIds.SetActivityStreamsOrderedItems(oi)
-	}()
 	// testPerson
 	func() {
 		testPerson = streams.NewActivityStreamsPerson()
@@ -0,0 +1,85 @@
+package pub
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// nonPublicNetworks are the address ranges that are not reachable on the
+// public internet, beyond the loopback, link-local, multicast, and unspecified
+// addresses recognized by net.IP.
+var nonPublicNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"fc00::/7",
+)
+
+// mustParseCIDRs parses the networks, panicking on failure.
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// IsPublicIP determines whether the address is reachable on the public
+// internet, and not a loopback, private, link-local, multicast, or otherwise
+// reserved address.
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range nonPublicNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicOnlyDialer refuses to connect to addresses that are not public, which
+// are checked after they are resolved.
+var publicOnlyDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+	Control: func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+			return fmt.Errorf("refusing to connect to non-public address %s", address)
+		}
+		return nil
+	},
+}
+
+// DialPublicOnly connects to the address like a net.Dialer, but refuses to
+// connect to addresses that are not public according to IsPublicIP.
+//
+// Use it as the DialContext of the http.Transport of the HttpClient given to
+// a Transport fetching IRIs chosen by others, such as the ones fetched for the
+// endpoint created by NewProxyHandler. The address is checked after it is
+// resolved, so that neither redirects nor DNS answers changing between lookups
+// reach private services.
+func DialPublicOnly(c context.Context, network, address string) (net.Conn, error) {
+	return publicOnlyDialer.DialContext(c, network, address)
+}
@@ -0,0 +1,47 @@
+package pub
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+// TestIsPublicIP tests recognizing addresses reachable on the public internet.
+func TestIsPublicIP(t *testing.T) {
+	for _, tc := range []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+	} {
+		if got := IsPublicIP(net.ParseIP(tc.ip)); got != tc.public {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tc.ip, got, tc.public)
+		}
+	}
+}
+
+// TestDialPublicOnly tests refusing connections to non-public addresses.
+func TestDialPublicOnly(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	conn, err := DialPublicOnly(context.Background(), "tcp", l.Addr().String())
+	if err == nil {
+		conn.Close()
+		t.Fatal("connected to a loopback address")
+	}
+}
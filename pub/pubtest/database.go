@@ -0,0 +1,486 @@
+package pubtest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// foreignHost is the host of IRIs that no Database under test owns.
+const foreignHost = "foreign.invalid"
+
+// RunDatabaseSuite runs contract cases of the pub.Database methods as
+// subtests, each against a new empty Database returned by newDatabase.
+//
+// The suite only drives a Database through the pub.Database interface, so it
+// does not fit every valid implementation. It assumes that:
+//   - the Database starts empty and needs no fixture beyond newDatabase,
+//   - the ids created by NewID are owned, and ids on the host
+//     "foreign.invalid" are not,
+//   - Create stores values of other servers as well as owned ones, and
+//   - actors stored with Create, with the collections named by
+//     pub.NewActorDocument, have their inbox, outbox, followers, following,
+//     and liked indexed, as Create is the only way the interface offers to
+//     store them.
+//
+// A Database whose actors are provisioned by other means, or which refuses
+// some values, fails the cases relying on it and should be tested with its
+// own fixtures instead. Inboxes and outboxes need not deduplicate their items:
+// the library checks InboxContains before appending.
+//
+// The exclusivity of locks is not checked for a pub.TxDatabase, which may leave
+// isolation to its transactions instead.
+func RunDatabaseSuite(t *testing.T, newDatabase func(t *testing.T) pub.Database) {
+	ctx := context.Background()
+	t.Run("LockAllowsMissingIds", func(t *testing.T) {
+		db := newDatabase(t)
+		id := foreignIRI("missing")
+		if err := db.Lock(ctx, id); err != nil {
+			t.Fatalf("Lock: %v", err)
+		}
+		if err := db.Unlock(ctx, id); err != nil {
+			t.Fatalf("Unlock: %v", err)
+		}
+	})
+	t.Run("LockIsExclusive", func(t *testing.T) {
+		db := newDatabase(t)
+		if _, ok := db.(pub.TxDatabase); ok {
+			t.Skip("a TxDatabase may leave isolation to its transactions")
+		}
+		id := foreignIRI("contended")
+		var holders, overlapped int32
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					if err := db.Lock(ctx, id); err != nil {
+						t.Errorf("Lock: %v", err)
+						return
+					}
+					if atomic.AddInt32(&holders, 1) > 1 {
+						atomic.StoreInt32(&overlapped, 1)
+					}
+					time.Sleep(time.Microsecond)
+					atomic.AddInt32(&holders, -1)
+					if err := db.Unlock(ctx, id); err != nil {
+						t.Errorf("Unlock: %v", err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if overlapped != 0 {
+			t.Fatalf("several goroutines held the lock at once")
+		}
+	})
+	t.Run("LocksOfDifferentIdsAreIndependent", func(t *testing.T) {
+		db := newDatabase(t)
+		if err := db.Lock(ctx, foreignIRI("a")); err != nil {
+			t.Fatalf("Lock: %v", err)
+		}
+		defer db.Unlock(ctx, foreignIRI("a"))
+		done := make(chan error, 1)
+		go func() {
+			err := db.Lock(ctx, foreignIRI("b"))
+			if err == nil {
+				err = db.Unlock(ctx, foreignIRI("b"))
+			}
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Lock: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("locking one id blocked locking another")
+		}
+	})
+	t.Run("GetMissingIsNotFound", func(t *testing.T) {
+		db := newDatabase(t)
+		v, err := db.Get(ctx, foreignIRI("missing"))
+		if err != nil && pub.ErrorStatusCode(err) != http.StatusNotFound {
+			t.Fatalf("got %v, want no value or a not found error", err)
+		} else if err == nil && v != nil {
+			t.Fatalf("got a value for a missing id")
+		}
+		if exists, err := db.Exists(ctx, foreignIRI("missing")); err != nil || exists {
+			t.Fatalf("Exists: got %v and %v, want false", exists, err)
+		}
+	})
+	t.Run("CreateUpdateDelete", func(t *testing.T) {
+		db := newDatabase(t)
+		id := newID(t, db, streams.NewActivityStreamsNote())
+		if err := db.Create(ctx, newNote(id, "created")); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		assertContent(t, db, id, "created")
+		if err := db.Update(ctx, newNote(id, "updated")); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		assertContent(t, db, id, "updated")
+		if err := db.Delete(ctx, id); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if exists, err := db.Exists(ctx, id); err != nil || exists {
+			t.Fatalf("Exists after Delete: got %v and %v, want false", exists, err)
+		}
+	})
+	t.Run("CreateAcceptsForeignValues", func(t *testing.T) {
+		db := newDatabase(t)
+		id := foreignIRI("note")
+		if err := db.Create(ctx, newNote(id, "federated")); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		assertContent(t, db, id, "federated")
+	})
+	t.Run("CreateTwiceReplaces", func(t *testing.T) {
+		db := newDatabase(t)
+		id := foreignIRI("note")
+		if err := db.Create(ctx, newNote(id, "first")); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := db.Create(ctx, newNote(id, "second")); err != nil {
+			t.Fatalf("second Create: %v", err)
+		}
+		assertContent(t, db, id, "second")
+	})
+	t.Run("RoundTripsCollections", func(t *testing.T) {
+		db := newDatabase(t)
+		id := newID(t, db, streams.NewActivityStreamsOrderedCollection())
+		col := streams.NewActivityStreamsOrderedCollection()
+		setId(col, id)
+		items := streams.NewActivityStreamsOrderedItemsProperty()
+		items.AppendIRI(foreignIRI("1"))
+		items.AppendIRI(foreignIRI("2"))
+		col.SetActivityStreamsOrderedItems(items)
+		if err := db.Create(ctx, col); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		v, err := db.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		got, ok := v.(vocab.ActivityStreamsOrderedCollection)
+		if !ok {
+			t.Fatalf("got a %T, want an OrderedCollection", v)
+		}
+		oi := got.GetActivityStreamsOrderedItems()
+		if oi == nil || oi.Len() != 2 || oi.At(0).GetIRI().String() != foreignIRI("1").String() {
+			t.Fatalf("got unexpected ordered items")
+		}
+	})
+	t.Run("NewIDIsUniqueAndOwned", func(t *testing.T) {
+		db := newDatabase(t)
+		seen := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			id := newID(t, db, streams.NewActivityStreamsNote())
+			if seen[id.String()] {
+				t.Fatalf("NewID returned %s twice", id)
+			}
+			seen[id.String()] = true
+			if owns, err := db.Owns(ctx, id); err != nil || !owns {
+				t.Fatalf("Owns %s: got %v and %v, want true", id, owns, err)
+			}
+		}
+	})
+	t.Run("DoesNotOwnForeignIds", func(t *testing.T) {
+		db := newDatabase(t)
+		if owns, err := db.Owns(ctx, foreignIRI("note")); err != nil || owns {
+			t.Fatalf("got %v and %v, want false", owns, err)
+		}
+	})
+	t.Run("Inbox", func(t *testing.T) {
+		db := newDatabase(t)
+		runBoxCases(t, db, db.AppendInbox, db.InboxTotalItems, db.GetInboxPage, db.InboxContains)
+	})
+	t.Run("Outbox", func(t *testing.T) {
+		db := newDatabase(t)
+		runBoxCases(t, db, db.AppendOutbox, db.OutboxTotalItems, db.GetOutboxPage, nil)
+	})
+	t.Run("ConcurrentAppendsUnderLock", func(t *testing.T) {
+		db := newDatabase(t)
+		inbox := ownedBox(t, db, "inbox")
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := db.Lock(ctx, inbox); err != nil {
+					t.Errorf("Lock: %v", err)
+					return
+				}
+				defer db.Unlock(ctx, inbox)
+				if err := db.AppendInbox(ctx, inbox, foreignIRI(fmt.Sprintf("activity/%d", i))); err != nil {
+					t.Errorf("AppendInbox: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		if n, err := db.InboxTotalItems(ctx, inbox); err != nil || n != 10 {
+			t.Fatalf("got %d items and %v, want 10", n, err)
+		}
+	})
+	t.Run("IndexesActors", func(t *testing.T) {
+		db := newDatabase(t)
+		actorIRI := newID(t, db, streams.NewActivityStreamsPerson())
+		if err := db.Create(ctx, newActor(t, actorIRI)); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		inbox, outbox := appendPath(actorIRI, "inbox"), appendPath(actorIRI, "outbox")
+		if got, err := db.ActorForInbox(ctx, inbox); err != nil || got.String() != actorIRI.String() {
+			t.Fatalf("ActorForInbox: got %v and %v, want %s", got, err, actorIRI)
+		}
+		if got, err := db.ActorForOutbox(ctx, outbox); err != nil || got.String() != actorIRI.String() {
+			t.Fatalf("ActorForOutbox: got %v and %v, want %s", got, err, actorIRI)
+		}
+		if got, err := db.OutboxForInbox(ctx, inbox); err != nil || got.String() != outbox.String() {
+			t.Fatalf("OutboxForInbox: got %v and %v, want %s", got, err, outbox)
+		}
+		if got, err := db.InboxForActor(ctx, actorIRI); err != nil || got.String() != inbox.String() {
+			t.Fatalf("InboxForActor: got %v and %v, want %s", got, err, inbox)
+		}
+	})
+	t.Run("InboxForUnknownActorIsNil", func(t *testing.T) {
+		db := newDatabase(t)
+		if got, err := db.InboxForActor(ctx, foreignIRI("actor")); got != nil || err != nil {
+			t.Fatalf("got %v and %v, want neither, so the library dereferences the actor", got, err)
+		}
+	})
+	t.Run("ActorCollections", func(t *testing.T) {
+		db := newDatabase(t)
+		actorIRI := newID(t, db, streams.NewActivityStreamsPerson())
+		if err := db.Create(ctx, newActor(t, actorIRI)); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		getters := map[string]func(context.Context, *url.URL) (vocab.ActivityStreamsCollection, error){
+			"followers": db.Followers,
+			"following": db.Following,
+			"liked":     db.Liked,
+		}
+		for name, get := range getters {
+			col, err := get(ctx, actorIRI)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if id := col.GetJSONLDId(); id == nil || id.Get().String() != appendPath(actorIRI, name).String() {
+				t.Fatalf("%s: got a collection without the actor's id", name)
+			}
+			items := col.GetActivityStreamsItems()
+			if items == nil {
+				items = streams.NewActivityStreamsItemsProperty()
+				col.SetActivityStreamsItems(items)
+			}
+			items.AppendIRI(foreignIRI(name))
+			if err := db.Update(ctx, col); err != nil {
+				t.Fatalf("Update %s: %v", name, err)
+			}
+			if col, err = get(ctx, actorIRI); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			items = col.GetActivityStreamsItems()
+			if items == nil || items.Len() != 1 || items.At(0).GetIRI().String() != foreignIRI(name).String() {
+				t.Fatalf("%s: the added item was not stored", name)
+			}
+		}
+	})
+}
+
+// runBoxCases runs the contract cases of an inbox or outbox.
+func runBoxCases(t *testing.T,
+	db pub.Database,
+	appendFn func(context.Context, *url.URL, *url.URL) error,
+	totalItems func(context.Context, *url.URL) (int, error),
+	getPage func(context.Context, *url.URL, pub.PageQuery) (pub.CollectionPage, error),
+	contains func(context.Context, *url.URL, *url.URL) (bool, error)) {
+	ctx := context.Background()
+	box := ownedBox(t, db, "box")
+	other := ownedBox(t, db, "other")
+	if n, err := totalItems(ctx, box); err != nil || n != 0 {
+		t.Fatalf("empty box: got %d items and %v, want none", n, err)
+	}
+	var want []string
+	for i := 1; i <= 5; i++ {
+		id := foreignIRI(fmt.Sprintf("activity/%d", i))
+		if err := appendFn(ctx, box, id); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		want = append([]string{id.String()}, want...)
+	}
+	if n, err := totalItems(ctx, box); err != nil || n != 5 {
+		t.Fatalf("got %d items and %v, want 5", n, err)
+	}
+	if n, err := totalItems(ctx, other); err != nil || n != 0 {
+		t.Fatalf("another box: got %d items and %v, want none", n, err)
+	}
+	if contains != nil {
+		if ok, err := contains(ctx, box, foreignIRI("activity/3")); err != nil || !ok {
+			t.Fatalf("contains: got %v and %v, want true", ok, err)
+		}
+		if ok, err := contains(ctx, box, foreignIRI("activity/6")); err != nil || ok {
+			t.Fatalf("contains: got %v and %v, want false", ok, err)
+		}
+	}
+	// Follow the next pages from the first, then the previous pages back.
+	var got []string
+	var cursors []string
+	q := pub.PageQuery{Limit: 2}
+	for i := 0; ; i++ {
+		if i > 5 {
+			t.Fatalf("pages do not end")
+		}
+		page, err := getPage(ctx, box, q)
+		if err != nil {
+			t.Fatalf("page %q: %v", q.Cursor, err)
+		}
+		if len(page.Items) > 2 {
+			t.Fatalf("page %q: got %d items, more than the limit", q.Cursor, len(page.Items))
+		}
+		if i == 0 && len(page.Prev) > 0 {
+			t.Fatalf("the first page has a previous page")
+		}
+		for _, id := range page.Items {
+			got = append(got, id.String())
+		}
+		cursors = append(cursors, page.Prev)
+		if len(page.Next) == 0 {
+			break
+		}
+		q.Cursor = page.Next
+	}
+	assertIds(t, "paging", got, want)
+	if last := cursors[len(cursors)-1]; len(last) > 0 {
+		page, err := getPage(ctx, box, pub.PageQuery{Cursor: last, Limit: 2})
+		if err != nil {
+			t.Fatalf("previous page: %v", err)
+		}
+		if len(page.Items) == 0 {
+			t.Fatalf("the previous page is empty")
+		}
+	}
+	last, err := getPage(ctx, box, pub.PageQuery{Last: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("last page: %v", err)
+	}
+	if len(last.Next) > 0 {
+		t.Fatalf("the last page has a next page")
+	}
+	var lastIds []string
+	for _, id := range last.Items {
+		lastIds = append(lastIds, id.String())
+	}
+	assertIds(t, "last page", lastIds, want[len(want)-len(lastIds):])
+	if len(lastIds) == 0 {
+		t.Fatalf("the last page is empty")
+	}
+}
+
+// assertIds fails the test if the ids differ from the wanted ones.
+func assertIds(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got %v, want %v", what, got, want)
+		}
+	}
+}
+
+// assertContent fails the test if the stored value with the id is not a Note
+// with the content.
+func assertContent(t *testing.T, db pub.Database, id *url.URL, content string) {
+	t.Helper()
+	if exists, err := db.Exists(context.Background(), id); err != nil || !exists {
+		t.Fatalf("Exists: got %v and %v, want true", exists, err)
+	}
+	v, err := db.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	n, ok := v.(vocab.ActivityStreamsNote)
+	if !ok {
+		t.Fatalf("got a %T, want a Note", v)
+	}
+	if c := n.GetActivityStreamsContent(); c == nil || c.Len() != 1 || c.At(0).GetXMLSchemaString() != content {
+		t.Fatalf("got unexpected content, want %q", content)
+	}
+}
+
+// newID returns an id created by the Database for the value.
+func newID(t *testing.T, db pub.Database, v vocab.Type) *url.URL {
+	t.Helper()
+	id, err := db.NewID(context.Background(), v)
+	if err != nil {
+		t.Fatalf("NewID: %v", err)
+	}
+	return id
+}
+
+// ownedBox returns an inbox or outbox IRI owned by the Database.
+func ownedBox(t *testing.T, db pub.Database, name string) *url.URL {
+	return appendPath(newID(t, db, streams.NewActivityStreamsOrderedCollection()), name)
+}
+
+// foreignIRI returns an IRI with the path on a host owned by no Database under
+// test.
+func foreignIRI(p string) *url.URL {
+	return &url.URL{Scheme: "https", Host: foreignHost, Path: "/" + p}
+}
+
+// appendPath returns the IRI with the segment added to its path.
+func appendPath(u *url.URL, segment string) *url.URL {
+	c := *u
+	c.Path = c.Path + "/" + segment
+	return &c
+}
+
+// setId sets the id of the value.
+func setId(v vocab.Type, id *url.URL) {
+	p := streams.NewJSONLDIdProperty()
+	p.Set(id)
+	v.SetJSONLDId(p)
+}
+
+// newNote returns a Note with the id and content.
+func newNote(id *url.URL, content string) vocab.ActivityStreamsNote {
+	n := streams.NewActivityStreamsNote()
+	setId(n, id)
+	c := streams.NewActivityStreamsContentProperty()
+	c.AppendXMLSchemaString(content)
+	n.SetActivityStreamsContent(c)
+	return n
+}
+
+// newActor returns the document of an actor with the default collections.
+func newActor(t *testing.T, id *url.URL) vocab.Type {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := pub.NewActorDocument(pub.ActorConfig{
+		Id:        id,
+		PublicKey: &key.PublicKey,
+	})
+	if err != nil {
+		t.Fatalf("NewActorDocument: %v", err)
+	}
+	return a
+}
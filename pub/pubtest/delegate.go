@@ -0,0 +1,105 @@
+package pubtest
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// Delegate implements the pub.CommonBehavior, pub.FederatingProtocol, and
+// pub.SocialProtocol of an Actor under test. It allows every request, blocks no
+// one, forwards to every potential recipient, and accepts Follow requests
+// automatically, leaving the rest to the default behaviors of the library.
+//
+// The Servers of a Federation use it, as does the conformance subpackage.
+type Delegate struct {
+	// Transport returns the Transport of the actor with the box. It is
+	// required.
+	Transport func(c context.Context, actorBoxIRI *url.URL) (pub.Transport, error)
+	// AuthenticateDelivery authenticates deliveries to an inbox. If nil,
+	// every delivery is authenticated.
+	AuthenticateDelivery func(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error)
+}
+
+var (
+	_ pub.CommonBehavior     = &Delegate{}
+	_ pub.FederatingProtocol = &Delegate{}
+	_ pub.SocialProtocol     = &Delegate{}
+)
+
+// AuthenticateGetInbox allows anyone to read inboxes.
+func (d *Delegate) AuthenticateGetInbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+
+// AuthenticateGetOutbox allows anyone to read outboxes.
+func (d *Delegate) AuthenticateGetOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+
+// NewTransport returns the Transport of the box's actor.
+func (d *Delegate) NewTransport(c context.Context, actorBoxIRI *url.URL, gofedAgent string) (pub.Transport, error) {
+	return d.Transport(c, actorBoxIRI)
+}
+
+// PostInboxRequestBodyHook does nothing.
+func (d *Delegate) PostInboxRequestBodyHook(c context.Context, r *http.Request, activity pub.Activity) (context.Context, error) {
+	return c, nil
+}
+
+// AuthenticatePostInbox authenticates the delivery with AuthenticateDelivery,
+// if set.
+func (d *Delegate) AuthenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	if d.AuthenticateDelivery == nil {
+		return c, true, nil
+	}
+	return d.AuthenticateDelivery(c, w, r)
+}
+
+// Blocked blocks no one.
+func (d *Delegate) Blocked(c context.Context, actorIRIs []*url.URL) (bool, error) {
+	return false, nil
+}
+
+// FederatingCallbacks accepts Follow requests automatically.
+func (d *Delegate) FederatingCallbacks(c context.Context) (pub.FederatingWrappedCallbacks, []interface{}, error) {
+	return pub.FederatingWrappedCallbacks{OnFollow: pub.OnFollowAutomaticallyAccept}, nil, nil
+}
+
+// DefaultCallback does nothing for other activities.
+func (d *Delegate) DefaultCallback(c context.Context, activity pub.Activity) error {
+	return nil
+}
+
+// MaxInboxForwardingRecursionDepth returns maxRecursionDepth.
+func (d *Delegate) MaxInboxForwardingRecursionDepth(c context.Context) int {
+	return maxRecursionDepth
+}
+
+// MaxDeliveryRecursionDepth returns maxRecursionDepth.
+func (d *Delegate) MaxDeliveryRecursionDepth(c context.Context) int {
+	return maxRecursionDepth
+}
+
+// FilterForwarding forwards to every potential recipient.
+func (d *Delegate) FilterForwarding(c context.Context, potentialRecipients []*url.URL, a pub.Activity) ([]*url.URL, error) {
+	return potentialRecipients, nil
+}
+
+// PostOutboxRequestBodyHook does nothing.
+func (d *Delegate) PostOutboxRequestBodyHook(c context.Context, r *http.Request, data vocab.Type) (context.Context, error) {
+	return c, nil
+}
+
+// AuthenticatePostOutbox allows anyone to post to outboxes.
+func (d *Delegate) AuthenticatePostOutbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	return c, true, nil
+}
+
+// SocialCallbacks uses the default behaviors.
+func (d *Delegate) SocialCallbacks(c context.Context) (pub.SocialWrappedCallbacks, []interface{}, error) {
+	return pub.SocialWrappedCallbacks{}, nil, nil
+}
@@ -0,0 +1,4 @@
+// Package pubtest provides tests that any implementation of the pub interfaces
+// is expected to pass, checking the contracts the pub package relies on beyond
+// what the compiler can.
+package pubtest
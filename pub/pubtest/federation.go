@@ -0,0 +1,392 @@
+package pubtest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/pub/memdb"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/go-fed/httpsig"
+)
+
+const (
+	// keyBits is the size of the RSA keys generated for actors.
+	keyBits = 2048
+	// appAgent identifies the requests of the servers of a Federation.
+	appAgent = "pubtest"
+	// maxRecursionDepth limits the recursion of inbox forwarding and of
+	// resolving the recipients of deliveries.
+	maxRecursionDepth = 4
+)
+
+// Federation is a set of ActivityPub servers running in-process, for testing
+// federation between actors end to end.
+//
+// Each Server listens on its own httptest TLS server, and requests to its host
+// made with the Federation's client are routed to that listener. Servers store
+// their data in a memdb.Database and deliver with an HttpSigTransport signing
+// requests with the keys generated for their actors. Deliveries are
+// authenticated by verifying their HTTP Signature with the sending actor's
+// public key, and Follow requests are automatically accepted.
+//
+// A Federation is bound to the test it is created for, which it fails when a
+// step or assertion does not succeed. It must be closed when done.
+type Federation struct {
+	t       testing.TB
+	client  *http.Client
+	mu      sync.Mutex
+	servers map[string]*Server
+}
+
+// Server is an ActivityPub server of a Federation, hosting any number of
+// actors.
+type Server struct {
+	// Host is the host of the IRIs of the server, such as "a.example".
+	Host string
+	// DB is the Database of the server.
+	DB *memdb.Database
+	// Actor is the pub.Actor serving the inboxes and outboxes of all of
+	// the server's actors.
+	Actor pub.FederatingActor
+
+	f      *Federation
+	ts     *httptest.Server
+	mu     sync.Mutex
+	actors map[string]*Actor
+}
+
+// Actor is an actor hosted on a Server of a Federation.
+type Actor struct {
+	// IRI is the id of the actor, such as "https://a.example/alex".
+	IRI *url.URL
+
+	s   *Server
+	key *rsa.PrivateKey
+}
+
+// NewFederation returns a Federation without servers, bound to the test.
+func NewFederation(t testing.TB) *Federation {
+	f := &Federation{
+		t:       t,
+		servers: make(map[string]*Server),
+	}
+	f.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext:     f.dial,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	return f
+}
+
+// Client returns the HTTP client routing requests to the hosts of the
+// Federation's servers.
+func (f *Federation) Client() *http.Client {
+	return f.client
+}
+
+// Close shuts down the servers of the Federation.
+func (f *Federation) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.servers {
+		s.ts.Close()
+	}
+}
+
+// NewServer starts a Server for the host.
+func (f *Federation) NewServer(host string) *Server {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.servers[host]; ok {
+		f.t.Fatalf("pubtest: server %s already exists", host)
+	}
+	s := &Server{
+		Host:   host,
+		DB:     memdb.New(memdb.Config{Hosts: []string{host}}),
+		f:      f,
+		actors: make(map[string]*Actor),
+	}
+	d := &Delegate{
+		Transport:            s.newTransport,
+		AuthenticateDelivery: s.authenticatePostInbox,
+	}
+	s.Actor = pub.NewActor(d, d, d, s.DB, clock{})
+	s.ts = httptest.NewTLSServer(pub.NewActorHandler(s.Actor, pub.ActorHandlerConfig{
+		// Test servers serve every value to anyone; real servers
+		// should use pub.NewAuthorizedActivityStreamsHandler.
+		Objects:      pub.NewActivityStreamsHandler(s.DB, clock{}),
+		ErrorHandler: s.handleError,
+	}))
+	f.servers[host] = s
+	return s
+}
+
+// dial connects to the listener of the server for the host of the address.
+func (f *Federation) dial(c context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	s, ok := f.servers[host]
+	f.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("pubtest: no server for host %s", host)
+	}
+	var d net.Dialer
+	return d.DialContext(c, network, s.ts.Listener.Addr().String())
+}
+
+// handleError logs the errors of the server's handler before writing them.
+func (s *Server) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	s.f.t.Logf("pubtest: %s %s%s: %v", r.Method, s.Host, r.URL.Path, err)
+	pub.DefaultErrorHandler(w, r, err)
+}
+
+// NewActor creates an actor with the name on the server, with a new key and
+// the default collections, such as "https://a.example/alex/inbox".
+func (s *Server) NewActor(name string) *Actor {
+	s.f.t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		s.f.t.Fatalf("pubtest: generating key: %v", err)
+	}
+	a := &Actor{
+		IRI: &url.URL{Scheme: "https", Host: s.Host, Path: "/" + name},
+		s:   s,
+		key: key,
+	}
+	doc, err := pub.NewActorDocument(pub.ActorConfig{
+		Id:                a.IRI,
+		PreferredUsername: name,
+		PublicKey:         &key.PublicKey,
+	})
+	if err != nil {
+		s.f.t.Fatalf("pubtest: creating actor %s: %v", a.IRI, err)
+	}
+	if err = s.DB.Create(context.Background(), doc); err != nil {
+		s.f.t.Fatalf("pubtest: storing actor %s: %v", a.IRI, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actors[a.Inbox().String()] = a
+	s.actors[a.Outbox().String()] = a
+	return a
+}
+
+// actorForBox returns the actor with the inbox or outbox.
+func (s *Server) actorForBox(box *url.URL) (*Actor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.actors[box.String()]
+	if !ok {
+		return nil, fmt.Errorf("pubtest: no actor on %s has box %s", s.Host, box)
+	}
+	return a, nil
+}
+
+// Inbox returns the IRI of the actor's inbox.
+func (a *Actor) Inbox() *url.URL {
+	return a.collection("inbox")
+}
+
+// Outbox returns the IRI of the actor's outbox.
+func (a *Actor) Outbox() *url.URL {
+	return a.collection("outbox")
+}
+
+// collection returns the IRI of the actor's default collection.
+func (a *Actor) collection(name string) *url.URL {
+	c := *a.IRI
+	c.Path = c.Path + "/" + name
+	return &c
+}
+
+// Send adds the value to the actor's outbox and delivers it to its recipients,
+// as pub.FederatingActor's Send does, returning the activity created.
+func (a *Actor) Send(v vocab.Type) pub.Activity {
+	a.s.f.t.Helper()
+	activity, err := a.s.Actor.Send(context.Background(), a.Outbox(), v)
+	if err != nil {
+		a.s.f.t.Fatalf("pubtest: %s sending %s: %v", a.IRI, v.GetTypeName(), err)
+	}
+	return activity
+}
+
+// Follow sends a Follow of the other actor, returning it.
+func (a *Actor) Follow(other *Actor) pub.Activity {
+	a.s.f.t.Helper()
+	follow := streams.NewActivityStreamsFollow()
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(a.IRI)
+	follow.SetActivityStreamsActor(actor)
+	object := streams.NewActivityStreamsObjectProperty()
+	object.AppendIRI(other.IRI)
+	follow.SetActivityStreamsObject(object)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(other.IRI)
+	follow.SetActivityStreamsTo(to)
+	return a.Send(follow)
+}
+
+// AssertInboxContains fails the test if the actor's inbox does not contain the
+// id.
+func (a *Actor) AssertInboxContains(id *url.URL) {
+	a.s.f.t.Helper()
+	contains, err := a.s.DB.InboxContains(context.Background(), a.Inbox(), id)
+	if err != nil {
+		a.s.f.t.Fatalf("pubtest: reading inbox of %s: %v", a.IRI, err)
+	} else if !contains {
+		a.s.f.t.Errorf("inbox of %s does not contain %s", a.IRI, id)
+	}
+}
+
+// AssertFollowedBy fails the test if the other actor is not in the actor's
+// followers.
+func (a *Actor) AssertFollowedBy(other *Actor) {
+	a.s.f.t.Helper()
+	followers, err := a.s.DB.Followers(context.Background(), a.IRI)
+	if err != nil {
+		a.s.f.t.Fatalf("pubtest: reading followers of %s: %v", a.IRI, err)
+	} else if !hasItem(followers, other.IRI) {
+		a.s.f.t.Errorf("followers of %s do not include %s", a.IRI, other.IRI)
+	}
+}
+
+// AssertFollowing fails the test if the other actor is not in what the actor
+// follows.
+func (a *Actor) AssertFollowing(other *Actor) {
+	a.s.f.t.Helper()
+	following, err := a.s.DB.Following(context.Background(), a.IRI)
+	if err != nil {
+		a.s.f.t.Fatalf("pubtest: reading following of %s: %v", a.IRI, err)
+	} else if !hasItem(following, other.IRI) {
+		a.s.f.t.Errorf("%s does not follow %s", a.IRI, other.IRI)
+	}
+}
+
+// hasItem determines whether the id is one of the items of the collection.
+func hasItem(col vocab.ActivityStreamsCollection, id *url.URL) bool {
+	items := col.GetActivityStreamsItems()
+	if items == nil {
+		return false
+	}
+	for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+		if itemId, err := pub.ToId(iter); err == nil && itemId.String() == id.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// clock is the pub.Clock of the servers.
+type clock struct{}
+
+func (clock) Now() time.Time {
+	return time.Now()
+}
+
+// newTransport returns a Transport signing with the key of the box's actor.
+func (s *Server) newTransport(c context.Context, actorBoxIRI *url.URL) (pub.Transport, error) {
+	a, err := s.actorForBox(actorBoxIRI)
+	if err != nil {
+		return nil, err
+	}
+	getSigner, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, []string{"(request-target)", "date"}, httpsig.Signature)
+	if err != nil {
+		return nil, err
+	}
+	postSigner, _, err := httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, []string{"(request-target)", "date", "digest"}, httpsig.Signature)
+	if err != nil {
+		return nil, err
+	}
+	keyId := *a.IRI
+	keyId.Fragment = "main-key"
+	return pub.NewHttpSigTransport(s.f.client, appAgent, clock{}, getSigner, postSigner, keyId.String(), a.key), nil
+}
+
+// authenticatePostInbox verifies the HTTP Signature of the delivery with the
+// public key fetched from its key id.
+func (s *Server) authenticatePostInbox(c context.Context, w http.ResponseWriter, r *http.Request) (context.Context, bool, error) {
+	v, err := httpsig.NewVerifier(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return c, false, nil
+	}
+	key, err := s.fetchKey(c, v.KeyId())
+	if err != nil {
+		return c, false, err
+	}
+	if err = v.Verify(key, httpsig.RSA_SHA256); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return c, false, nil
+	}
+	return c, true, nil
+}
+
+// fetchKey dereferences the document of the key's owner and returns its
+// public key.
+func (s *Server) fetchKey(c context.Context, keyId string) (*rsa.PublicKey, error) {
+	u, err := url.Parse(keyId)
+	if err != nil {
+		return nil, err
+	}
+	u.Fragment = ""
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(c)
+	req.Header.Set("Accept", "application/activity+json")
+	resp, err := s.f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pubtest: fetching key %s: %s", keyId, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		PublicKey struct {
+			PublicKeyPem string `json:"publicKeyPem"`
+		} `json:"publicKey"`
+	}
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(doc.PublicKey.PublicKeyPem))
+	if block == nil {
+		return nil, fmt.Errorf("pubtest: %s has no PEM public key", u)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("pubtest: key %s is a %T, not an RSA key", keyId, key)
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,23 @@
+package pubtest
+
+import (
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// TestFederation tests following an actor on another server.
+func TestFederation(t *testing.T) {
+	f := NewFederation(t)
+	defer f.Close()
+	alex := f.NewServer("a.example").NewActor("alex")
+	sam := f.NewServer("b.example").NewActor("sam")
+	follow := alex.Follow(sam)
+	id, err := pub.GetId(follow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sam.AssertInboxContains(id)
+	sam.AssertFollowedBy(alex)
+	alex.AssertFollowing(sam)
+}
@@ -0,0 +1,301 @@
+package pubtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// Exchange is a call to a pub.Transport recorded by a RecordingTransport, as
+// stored in fixture files.
+type Exchange struct {
+	// Method is "GET" for Dereference and "POST" for Deliver.
+	Method string `json:"method"`
+	// IRI is the IRI dereferenced or delivered to.
+	IRI string `json:"iri"`
+	// Request is the body delivered, if any.
+	Request Body `json:"request,omitempty"`
+	// Status is the status code of the response. Since Transports do not
+	// report the status of successful calls, it is http.StatusOK for all of
+	// them, and zero if the peer could not be reached.
+	Status int `json:"status"`
+	// Response is the body dereferenced, if any.
+	Response Body `json:"response,omitempty"`
+	// Error is the message of the error of an unsuccessful call.
+	Error string `json:"error,omitempty"`
+}
+
+// Body is the body of a request or response. It is stored as is in fixture
+// files if it is a JSON object or array, and as a JSON string otherwise, so that
+// both well-formed and broken payloads can be recorded and edited.
+type Body []byte
+
+// MarshalJSON returns the body, or the body as a string if it is not a JSON
+// object or array.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if isJSONDocument(b) {
+		return b, nil
+	}
+	return json.Marshal(string(b))
+}
+
+// UnmarshalJSON sets the body from a JSON string, object, or array.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*b = Body(s)
+		return nil
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// isJSONDocument determines whether the bytes are a JSON object or array.
+func isJSONDocument(b []byte) bool {
+	t := bytes.TrimSpace(b)
+	return len(t) > 0 && (t[0] == '{' || t[0] == '[') && json.Valid(t)
+}
+
+// sameBody determines whether two bodies are equal, ignoring the formatting of
+// JSON documents.
+func sameBody(a, b []byte) bool {
+	if isJSONDocument(a) && isJSONDocument(b) {
+		var ca, cb bytes.Buffer
+		if json.Compact(&ca, a) == nil && json.Compact(&cb, b) == nil {
+			return bytes.Equal(ca.Bytes(), cb.Bytes())
+		}
+	}
+	return bytes.Equal(a, b)
+}
+
+// LoadExchanges reads the exchanges of a fixture file written by a
+// RecordingTransport.
+func LoadExchanges(path string) ([]Exchange, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var exchanges []Exchange
+	if err = json.Unmarshal(b, &exchanges); err != nil {
+		return nil, fmt.Errorf("pubtest: reading fixture %s: %w", path, err)
+	}
+	return exchanges, nil
+}
+
+// RecordingTransport is a pub.Transport recording the calls made to another
+// Transport, such as a pub.HttpSigTransport talking to real peers, so they can
+// be saved as a fixture file and replayed by a ReplayTransport.
+//
+// Its BatchDeliver delivers to each recipient in turn, so that the exchanges
+// are recorded in a deterministic order.
+type RecordingTransport struct {
+	t         pub.Transport
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+// RecordingTransport is a pub.Transport.
+var _ pub.Transport = &RecordingTransport{}
+
+// NewRecordingTransport returns a RecordingTransport recording the calls made
+// to the Transport.
+func NewRecordingTransport(t pub.Transport) *RecordingTransport {
+	return &RecordingTransport{t: t}
+}
+
+// Dereference dereferences the IRI with the underlying Transport, recording the
+// exchange.
+func (r *RecordingTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	b, err := r.t.Dereference(c, iri)
+	r.record(Exchange{Method: http.MethodGet, IRI: iri.String(), Response: b}, err)
+	return b, err
+}
+
+// Deliver delivers the body with the underlying Transport, recording the
+// exchange.
+func (r *RecordingTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	err := r.t.Deliver(c, b, to)
+	r.record(Exchange{Method: http.MethodPost, IRI: to.String(), Request: b}, err)
+	return err
+}
+
+// BatchDeliver delivers the body to each recipient in turn.
+func (r *RecordingTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	return batchDeliver(c, r, b, recipients)
+}
+
+// record adds the exchange, with the outcome of the call.
+func (r *RecordingTransport) record(e Exchange, err error) {
+	e.Status = http.StatusOK
+	if err != nil {
+		e.Status = 0
+		e.Error = err.Error()
+		var remote *pub.RemoteError
+		if errors.As(err, &remote) {
+			e.Status = remote.StatusCode
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exchanges = append(r.exchanges, e)
+}
+
+// Exchanges returns the exchanges recorded so far, in order.
+func (r *RecordingTransport) Exchanges() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Exchange(nil), r.exchanges...)
+}
+
+// Save writes the exchanges recorded so far to the fixture file.
+func (r *RecordingTransport) Save(path string) error {
+	b, err := json.MarshalIndent(r.Exchanges(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// Matching determines how strictly a ReplayTransport matches calls to recorded
+// exchanges. Each level includes the requirements of the previous ones.
+type Matching int
+
+const (
+	// MatchIRI matches calls to any unused exchange with the same method
+	// and IRI.
+	MatchIRI Matching = iota
+	// MatchBody also requires deliveries to have the same body, ignoring
+	// the formatting of JSON documents.
+	MatchBody
+	// MatchSequence also requires calls to be made in the recorded order.
+	MatchSequence
+)
+
+// ReplayTransport is a pub.Transport serving recorded exchanges back instead of
+// making requests, for deterministic tests. Combined with a fixed pub.Clock,
+// behaviors with peers captured once by a RecordingTransport become regression
+// tests.
+//
+// Each exchange is served once. Unsuccessful exchanges are returned as a
+// pub.RemoteError with the recorded status code. Calls matching no exchange
+// fail with an error that is not a pub.RemoteError.
+type ReplayTransport struct {
+	matching  Matching
+	mu        sync.Mutex
+	exchanges []Exchange
+	used      []bool
+}
+
+// ReplayTransport is a pub.Transport.
+var _ pub.Transport = &ReplayTransport{}
+
+// NewReplayTransport returns a ReplayTransport serving the exchanges.
+func NewReplayTransport(exchanges []Exchange, m Matching) *ReplayTransport {
+	return &ReplayTransport{
+		matching:  m,
+		exchanges: exchanges,
+		used:      make([]bool, len(exchanges)),
+	}
+}
+
+// Dereference returns the recorded response for the IRI.
+func (r *ReplayTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	e, err := r.replay(http.MethodGet, iri, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(e.Response), nil
+}
+
+// Deliver returns the recorded outcome of delivering the body to the IRI.
+func (r *ReplayTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	_, err := r.replay(http.MethodPost, to, b)
+	return err
+}
+
+// BatchDeliver delivers the body to each recipient in turn, as the
+// RecordingTransport does.
+func (r *ReplayTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	return batchDeliver(c, r, b, recipients)
+}
+
+// Remaining returns the exchanges not served yet, in order.
+func (r *ReplayTransport) Remaining() []Exchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var remaining []Exchange
+	for i, e := range r.exchanges {
+		if !r.used[i] {
+			remaining = append(remaining, e)
+		}
+	}
+	return remaining
+}
+
+// replay marks the exchange matching the call as used and returns it, or
+// returns the error it recorded.
+func (r *ReplayTransport) replay(method string, iri *url.URL, body []byte) (Exchange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.exchanges {
+		if r.used[i] {
+			continue
+		}
+		if r.matches(e, method, iri, body) {
+			r.used[i] = true
+			return e, exchangeError(e, iri)
+		} else if r.matching >= MatchSequence {
+			return Exchange{}, fmt.Errorf("pubtest: %s %s does not match the next recorded exchange, %s %s", method, iri, e.Method, e.IRI)
+		}
+	}
+	return Exchange{}, fmt.Errorf("pubtest: no recorded exchange matches %s %s", method, iri)
+}
+
+// matches determines whether the exchange matches the call.
+func (r *ReplayTransport) matches(e Exchange, method string, iri *url.URL, body []byte) bool {
+	if e.Method != method || e.IRI != iri.String() {
+		return false
+	}
+	return r.matching < MatchBody || sameBody(e.Request, body)
+}
+
+// exchangeError returns the error recorded by the exchange, if any.
+func exchangeError(e Exchange, iri *url.URL) error {
+	if e.Status == http.StatusOK && len(e.Error) == 0 {
+		return nil
+	}
+	msg := e.Error
+	if len(msg) == 0 {
+		msg = fmt.Sprintf("%s request to %s failed (%d)", e.Method, e.IRI, e.Status)
+	}
+	return &pub.RemoteError{IRI: iri, StatusCode: e.Status, Err: errors.New(msg)}
+}
+
+// batchDeliver delivers the body to each recipient in turn with the Transport,
+// returning an error if any of the deliveries failed.
+func batchDeliver(c context.Context, t pub.Transport, b []byte, recipients []*url.URL) error {
+	var errs []string
+	for _, to := range recipients {
+		if err := t.Deliver(c, b, to); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return &pub.RemoteError{
+			Err: fmt.Errorf("batch deliver had at least one failure: %s", strings.Join(errs, "; ")),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package pubtest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// fakeTransport serves documents by IRI and fails deliveries to gone.
+type fakeTransport struct {
+	docs map[string]string
+	gone string
+}
+
+func (f *fakeTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	doc, ok := f.docs[iri.String()]
+	if !ok {
+		return nil, &pub.RemoteError{IRI: iri, StatusCode: 404, Err: errors.New("not found")}
+	}
+	return []byte(doc), nil
+}
+
+func (f *fakeTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	if to.String() == f.gone {
+		return &pub.RemoteError{IRI: to, StatusCode: 410, Err: errors.New("gone")}
+	}
+	return nil
+}
+
+func (f *fakeTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	return batchDeliver(c, f, b, recipients)
+}
+
+// mustParse parses the IRI, panicking on failure.
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// record records exchanges with a fakeTransport, saves them, and loads them
+// back.
+func record(t *testing.T) []Exchange {
+	ctx := context.Background()
+	r := NewRecordingTransport(&fakeTransport{
+		docs: map[string]string{
+			"https://a.example/note": `{"type": "Note", "content": "hi"}`,
+			"https://a.example/odd":  `not json`,
+		},
+		gone: "https://b.example/gone/inbox",
+	})
+	r.Dereference(ctx, mustParse("https://a.example/note"))
+	r.Dereference(ctx, mustParse("https://a.example/odd"))
+	r.Dereference(ctx, mustParse("https://a.example/missing"))
+	r.BatchDeliver(ctx, []byte(`{"type": "Create"}`), []*url.URL{
+		mustParse("https://b.example/sam/inbox"),
+		mustParse("https://b.example/gone/inbox"),
+	})
+	dir, err := ioutil.TempDir("", "pubtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "exchanges.json")
+	if err := r.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	exchanges, err := LoadExchanges(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 5 {
+		t.Fatalf("got %d exchanges, want 5", len(exchanges))
+	}
+	return exchanges
+}
+
+// TestRecordReplay tests replaying recorded exchanges.
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	t.Run("ReplaysResponses", func(t *testing.T) {
+		r := NewReplayTransport(record(t), MatchSequence)
+		if b, err := r.Dereference(ctx, mustParse("https://a.example/note")); err != nil || !sameBody(b, []byte(`{"type":"Note","content":"hi"}`)) {
+			t.Fatalf("got %s and %v, want the note", b, err)
+		}
+		if b, err := r.Dereference(ctx, mustParse("https://a.example/odd")); err != nil || string(b) != "not json" {
+			t.Fatalf("got %q and %v, want the odd payload", b, err)
+		}
+		if _, err := r.Dereference(ctx, mustParse("https://a.example/missing")); pub.ErrorStatusCode(err) != 502 {
+			t.Fatalf("got %v, want a remote error", err)
+		}
+		if err := r.Deliver(ctx, []byte(`{"type": "Create"}`), mustParse("https://b.example/sam/inbox")); err != nil {
+			t.Fatal(err)
+		}
+		var remote *pub.RemoteError
+		if err := r.Deliver(ctx, []byte(`{"type": "Create"}`), mustParse("https://b.example/gone/inbox")); !errors.As(err, &remote) || remote.StatusCode != 410 {
+			t.Fatalf("got %v, want a 410 remote error", err)
+		}
+		if remaining := r.Remaining(); len(remaining) != 0 {
+			t.Fatalf("got %d unused exchanges", len(remaining))
+		}
+	})
+	t.Run("MatchIRIIgnoresOrderAndBody", func(t *testing.T) {
+		r := NewReplayTransport(record(t), MatchIRI)
+		if err := r.Deliver(ctx, []byte(`{"type": "Update"}`), mustParse("https://b.example/sam/inbox")); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Deliver(ctx, []byte(`{"type": "Update"}`), mustParse("https://b.example/sam/inbox")); err == nil {
+			t.Fatalf("replayed an exchange twice")
+		}
+		if remaining := r.Remaining(); len(remaining) != 4 {
+			t.Fatalf("got %d unused exchanges, want 4", len(remaining))
+		}
+	})
+	t.Run("MatchBodyComparesBodies", func(t *testing.T) {
+		r := NewReplayTransport(record(t), MatchBody)
+		if err := r.Deliver(ctx, []byte(`{"type": "Update"}`), mustParse("https://b.example/sam/inbox")); err == nil {
+			t.Fatalf("matched a different body")
+		}
+		if err := r.Deliver(ctx, []byte(`{"type":"Create"}`), mustParse("https://b.example/sam/inbox")); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("MatchSequenceRequiresOrder", func(t *testing.T) {
+		r := NewReplayTransport(record(t), MatchSequence)
+		if _, err := r.Dereference(ctx, mustParse("https://a.example/odd")); err == nil {
+			t.Fatalf("matched out of order")
+		}
+	})
+}
@@ -0,0 +1,461 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+// sharedInboxProperty is the member of an actor's 'endpoints' naming the inbox
+// shared by the actors of its server.
+const sharedInboxProperty = "sharedInbox"
+
+// NewRelayFollow creates the Follow an actor of this server, usually its
+// instance actor, sends to subscribe to a relay, as LitePub and Mastodon
+// relays expect: its 'object' is the Public collection, and it is addressed to
+// the relay's actor.
+//
+// Send it from the actor's outbox with FederatingActor's Send, so that it is
+// stored and the relay's Accept is recognized. Once accepted, the relay is in
+// the actor's following collection, and its IRI should be listed in the
+// Relays of the FederatingWrappedCallbacks of the actor's inbox.
+func NewRelayFollow(actor, relay *url.URL) vocab.ActivityStreamsFollow {
+	f := streams.NewActivityStreamsFollow()
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(actor)
+	f.SetActivityStreamsActor(actorProp)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(mustParsePublic())
+	f.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(relay)
+	f.SetActivityStreamsTo(to)
+	return f
+}
+
+// mustParsePublic returns the IRI of the Public collection.
+func mustParsePublic() *url.URL {
+	u, err := url.Parse(PublicActivityPubIRI)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// isRelayFollow determines whether the Follow subscribes to a relay, which is
+// when it follows the Public collection.
+func isRelayFollow(follow Activity) (bool, error) {
+	op := follow.GetActivityStreamsObject()
+	if op == nil {
+		return false, nil
+	}
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return false, err
+		}
+		if IsPublic(id.String()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isRelayed determines whether the activity was sent by one of the Relays.
+func (w FederatingWrappedCallbacks) isRelayed(a Activity) (bool, error) {
+	if len(w.Relays) == 0 {
+		return false, nil
+	}
+	actors := a.GetActivityStreamsActor()
+	if actors == nil {
+		return false, nil
+	}
+	for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+		id, err := ToId(iter)
+		if err != nil {
+			return false, err
+		}
+		if containsIRI(w.Relays, id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// relayed handles an Announce by one of the Relays. The relay cannot vouch for
+// what other servers sent it, so each announced object is fetched again from
+// its origin. Announced Create activities have their objects created if they
+// are new, announced Update and Delete activities have the side effects of the
+// update and delete callbacks, and other objects are created if they are new.
+func (w FederatingWrappedCallbacks) relayed(c context.Context, a vocab.ActivityStreamsAnnounce) error {
+	op := a.GetActivityStreamsObject()
+	if op == nil || op.Len() == 0 {
+		return ErrObjectRequired
+	}
+	tport, err := w.newTransport(c, w.inboxIRI, goFedUserAgent())
+	if err != nil {
+		return err
+	}
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		// Only the IRI of an embedded value is trusted.
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		t, err := fetchFromOrigin(c, tport, id)
+		if err != nil {
+			return err
+		}
+		switch {
+		case streams.IsOrExtendsActivityStreamsCreate(t):
+			create, ok := t.(Activity)
+			if !ok {
+				return malformedf("a relayed Create does not satisfy the Activity interface")
+			}
+			if err := embedFromOrigin(c, tport, create); err != nil {
+				return err
+			}
+			if cop := create.GetActivityStreamsObject(); cop != nil {
+				for citer := cop.Begin(); citer != cop.End(); citer = citer.Next() {
+					if err := w.createIfNew(c, citer.GetType()); err != nil {
+						return err
+					}
+				}
+			}
+		case streams.IsOrExtendsActivityStreamsUpdate(t):
+			update, ok := t.(vocab.ActivityStreamsUpdate)
+			if !ok {
+				return malformedf("a relayed Update does not satisfy the ActivityStreamsUpdate interface")
+			}
+			if err := embedFromOrigin(c, tport, update); err != nil {
+				return err
+			}
+			if err := w.update(c, update); err != nil {
+				return err
+			}
+		case streams.IsOrExtendsActivityStreamsDelete(t):
+			del, ok := t.(vocab.ActivityStreamsDelete)
+			if !ok {
+				return malformedf("a relayed Delete does not satisfy the ActivityStreamsDelete interface")
+			}
+			if err := w.deleteFn(c, del); err != nil {
+				return err
+			}
+		default:
+			if err := w.createIfNew(c, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// embedFromOrigin replaces the objects of a relayed activity given by IRI with
+// the values fetched from their origin, once the objects are checked to share
+// the origin of the activity's actors.
+func embedFromOrigin(c context.Context, tport Transport, a Activity) error {
+	if err := mustHaveActivityOriginMatchObjects(a); err != nil {
+		return err
+	}
+	op := a.GetActivityStreamsObject()
+	if op == nil {
+		return nil
+	}
+	for iter := op.Begin(); iter != op.End(); iter = iter.Next() {
+		if iter.GetType() != nil {
+			continue
+		}
+		id, err := ToId(iter)
+		if err != nil {
+			return err
+		}
+		obj, err := fetchFromOrigin(c, tport, id)
+		if err != nil {
+			return err
+		}
+		if err = iter.SetType(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchFromOrigin dereferences the IRI, and ensures the value fetched is the
+// one identified by the IRI.
+func fetchFromOrigin(c context.Context, tport Transport, iri *url.URL) (vocab.Type, error) {
+	b, err := tport.Dereference(c, iri)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	t, err := streams.ToType(c, m)
+	if err != nil {
+		return nil, err
+	}
+	id, err := GetId(t)
+	if err != nil {
+		return nil, err
+	}
+	if id.String() != iri.String() {
+		return nil, forbiddenf("fetched %q but got %q", iri, id)
+	}
+	return t, nil
+}
+
+// createIfNew creates the federated value in the database, unless it is
+// already there.
+func (w FederatingWrappedCallbacks) createIfNew(c context.Context, t vocab.Type) error {
+	return createIfNew(c, w.db, t)
+}
+
+// createIfNew creates the federated value in the database, unless it is
+// already there.
+func createIfNew(c context.Context, db Database, t vocab.Type) error {
+	id, err := GetId(t)
+	if err != nil {
+		return err
+	}
+	if err := db.Lock(c, id); err != nil {
+		return err
+	}
+	defer db.Unlock(c, id)
+	if exists, err := db.Exists(c, id); err != nil {
+		return err
+	} else if exists {
+		return nil
+	}
+	return db.Create(c, t)
+}
+
+// relay Announces a public activity delivered to the inbox of a relay to the
+// shared inboxes of the servers subscribed to it, other than the activity's
+// own. Nothing is done unless Relay is set, the activity is a public Create,
+// Update, Delete, or Announce, and it comes from a subscribed server.
+//
+// The Announce is added to the relay's outbox, and fanned out to the
+// subscribers, usually in the background.
+func (w FederatingWrappedCallbacks) relay(c context.Context, activity Activity) error {
+	if !w.Relay {
+		return nil
+	} else if !streams.IsOrExtendsActivityStreamsCreate(activity) &&
+		!streams.IsOrExtendsActivityStreamsUpdate(activity) &&
+		!streams.IsOrExtendsActivityStreamsDelete(activity) &&
+		!streams.IsOrExtendsActivityStreamsAnnounce(activity) {
+		return nil
+	}
+	if public, err := isPublic(activity); err != nil || !public {
+		return err
+	}
+	activityId, err := GetId(activity)
+	if err != nil {
+		return err
+	}
+	origins := make(map[string]bool)
+	if actors := activity.GetActivityStreamsActor(); actors != nil {
+		for iter := actors.Begin(); iter != actors.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return err
+			}
+			origins[id.Host] = true
+		}
+	}
+	// Get the relay's subscribers.
+	if err := w.db.Lock(c, w.inboxIRI); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	actorIRI, err := w.db.ActorForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	outboxIRI, err := w.db.OutboxForInbox(c, w.inboxIRI)
+	if err != nil {
+		w.db.Unlock(c, w.inboxIRI)
+		return err
+	}
+	w.db.Unlock(c, w.inboxIRI)
+	// Unlock must be called by now and every branch above.
+	if err := w.db.Lock(c, actorIRI); err != nil {
+		return err
+	}
+	followers, err := w.db.Followers(c, actorIRI)
+	w.db.Unlock(c, actorIRI)
+	if err != nil {
+		return err
+	}
+	subscribed := false
+	var subscribers []*url.URL
+	if items := followers.GetActivityStreamsItems(); items != nil {
+		for iter := items.Begin(); iter != items.End(); iter = iter.Next() {
+			id, err := ToId(iter)
+			if err != nil {
+				return err
+			}
+			if origins[id.Host] {
+				subscribed = true
+			} else {
+				subscribers = append(subscribers, id)
+			}
+		}
+	}
+	if !subscribed || len(subscribers) == 0 {
+		return nil
+	}
+	announce := streams.NewActivityStreamsAnnounce()
+	actorProp := streams.NewActivityStreamsActorProperty()
+	actorProp.AppendIRI(actorIRI)
+	announce.SetActivityStreamsActor(actorProp)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(activityId)
+	announce.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(mustParsePublic())
+	announce.SetActivityStreamsTo(to)
+	if err := w.addNewIds(c, announce); err != nil {
+		return err
+	}
+	// Store the Announce so that its id can be dereferenced.
+	announceId := announce.GetJSONLDId().Get()
+	if err := w.db.Lock(c, announceId); err != nil {
+		return err
+	}
+	// WARNING: Unlock not deferred.
+	if err := w.db.Create(c, announce); err != nil {
+		w.db.Unlock(c, announceId)
+		return err
+	}
+	w.db.Unlock(c, announceId)
+	// Unlock must be called by now and every branch above.
+	if err := w.db.Lock(c, outboxIRI); err != nil {
+		return err
+	}
+	err = w.db.AppendOutbox(c, outboxIRI, announceId)
+	w.db.Unlock(c, outboxIRI)
+	if err != nil {
+		return err
+	}
+	return w.fanOut(c, outboxIRI, announce, subscribers)
+}
+
+// maxRelayFanOuts limits how many relay fan-outs an Actor delivers in the
+// background at once.
+const maxRelayFanOuts = 16
+
+// fanOut delivers the Announce of a relay to the shared inboxes of the
+// subscribers once the transaction, if any, is committed, so that the
+// transaction does not wait on them.
+//
+// Up to maxRelayFanOuts fan-outs are delivered in the background, so that the
+// request does not wait on them either. Once as many are under way, the
+// request delivers its own before returning. Failures are reported to the
+// Observer as the outcome of the Announce's side effects in the outbox.
+func (a *sideEffectActor) fanOut(c context.Context, outboxIRI *url.URL, announce Activity, subscribers []*url.URL) error {
+	return a.afterCommit(func(a *sideEffectActor) error {
+		c := detachedContext{c}
+		select {
+		case a.fanOuts <- struct{}{}:
+			go func() {
+				defer func() { <-a.fanOuts }()
+				a.observedFanOut(c, outboxIRI, announce, subscribers)
+			}()
+		default:
+			a.observedFanOut(c, outboxIRI, announce, subscribers)
+		}
+		return nil
+	})
+}
+
+// observedFanOut delivers the Announce of a relay to the subscribers,
+// notifying the Observer, if any, of the outcome.
+func (a *sideEffectActor) observedFanOut(c context.Context, outboxIRI *url.URL, announce Activity, subscribers []*url.URL) {
+	done := a.observeSideEffect(c, BoxOutbox, announce)
+	done(a.deliverToSubscribers(c, outboxIRI, announce, subscribers))
+}
+
+// deliverToSubscribers delivers the Announce of a relay to the shared inboxes
+// of the subscribers, skipping those that cannot be resolved. The subscribers
+// are read from the database, and the ones not there yet are fetched and
+// stored for the next Announce.
+func (a *sideEffectActor) deliverToSubscribers(c context.Context, outboxIRI *url.URL, announce Activity, subscribers []*url.URL) error {
+	tport, err := a.newTransport(c, outboxIRI, goFedUserAgent())
+	if err != nil {
+		return err
+	}
+	var recipients []*url.URL
+	for _, id := range subscribers {
+		t, err := a.storedActor(c, id)
+		if err != nil {
+			return err
+		} else if t == nil {
+			if t, err = fetchFromOrigin(c, tport, id); err != nil {
+				continue
+			}
+			if err = a.transact(c, func(a *sideEffectActor) error {
+				return createIfNew(c, a.db, t)
+			}); err != nil {
+				return err
+			}
+		}
+		inbox, err := sharedInbox(t)
+		if err != nil {
+			continue
+		}
+		recipients = append(recipients, inbox)
+	}
+	recipients = dedupeIRIs(recipients, nil)
+	if len(recipients) == 0 {
+		return nil
+	}
+	return a.deliverToRecipients(c, outboxIRI, announce, recipients)
+}
+
+// storedActor returns the actor stored in the database, or nil if there is
+// none.
+func (a *sideEffectActor) storedActor(c context.Context, id *url.URL) (vocab.Type, error) {
+	if err := a.db.Lock(c, id); err != nil {
+		return nil, err
+	}
+	defer a.db.Unlock(c, id)
+	if exists, err := a.db.Exists(c, id); err != nil || !exists {
+		return nil, err
+	}
+	return a.db.Get(c, id)
+}
+
+// isPublic determines whether the value is addressed to the Public collection.
+func isPublic(t vocab.Type) (bool, error) {
+	recipients, err := audienceIds(t)
+	if err != nil {
+		return false, err
+	}
+	for _, iri := range recipients {
+		if IsPublic(iri.String()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sharedInbox returns the 'sharedInbox' of an actor's 'endpoints', or its
+// 'inbox' if it has none.
+func sharedInbox(t vocab.Type) (*url.URL, error) {
+	type unknownPropertieser interface {
+		GetUnknownProperties() map[string]interface{}
+	}
+	if u, ok := t.(unknownPropertieser); ok {
+		if m, ok := u.GetUnknownProperties()[endpointsProperty].(map[string]interface{}); ok {
+			if s, ok := m[sharedInboxProperty].(string); ok {
+				return url.Parse(s)
+			}
+		}
+	}
+	return getInbox(t)
+}
@@ -0,0 +1,525 @@
+package pub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+	"github.com/golang/mock/gomock"
+)
+
+const (
+	testRelayIRI            = "https://relay.example.com/actor"
+	testRelayInboxIRI       = "https://relay.example.com/inbox"
+	testRelayOutboxIRI      = "https://relay.example.com/outbox"
+	testOriginInstanceIRI   = "https://other.example.com/actor"
+	testSubscriberIRI       = "https://third.example.com/actor"
+	testSubscriberInboxIRI  = "https://third.example.com/inbox"
+	testSubscriberActorJSON = `{
+  "@context": "https://www.w3.org/ns/activitystreams",
+  "type": "Application",
+  "id": "https://third.example.com/actor",
+  "inbox": "https://third.example.com/actor/inbox",
+  "endpoints": {"sharedInbox": "https://third.example.com/inbox"}
+}`
+)
+
+// newPublicCreate creates a public Create of a note by a federated actor.
+func newPublicCreate() vocab.ActivityStreamsCreate {
+	c := streams.NewActivityStreamsCreate()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testFederatedActivityIRI))
+	c.SetJSONLDId(id)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(mustParse(testFederatedActorIRI))
+	c.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(mustParse(testFederatedActivityIRI2))
+	c.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(mustParse(PublicActivityPubIRI))
+	c.SetActivityStreamsTo(to)
+	return c
+}
+
+// newPublicUpdate creates a public Update of a note, given by IRI, by a
+// federated actor.
+func newPublicUpdate() vocab.ActivityStreamsUpdate {
+	u := streams.NewActivityStreamsUpdate()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testFederatedActivityIRI))
+	u.SetJSONLDId(id)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(mustParse(testFederatedActorIRI))
+	u.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(mustParse(testFederatedActivityIRI2))
+	u.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(mustParse(PublicActivityPubIRI))
+	u.SetActivityStreamsTo(to)
+	return u
+}
+
+// newPublicDelete creates a public Delete of a note by a federated actor.
+func newPublicDelete() vocab.ActivityStreamsDelete {
+	d := streams.NewActivityStreamsDelete()
+	id := streams.NewJSONLDIdProperty()
+	id.Set(mustParse(testFederatedActivityIRI))
+	d.SetJSONLDId(id)
+	actor := streams.NewActivityStreamsActorProperty()
+	actor.AppendIRI(mustParse(testFederatedActorIRI))
+	d.SetActivityStreamsActor(actor)
+	op := streams.NewActivityStreamsObjectProperty()
+	op.AppendIRI(mustParse(testFederatedActivityIRI2))
+	d.SetActivityStreamsObject(op)
+	to := streams.NewActivityStreamsToProperty()
+	to.AppendIRI(mustParse(PublicActivityPubIRI))
+	d.SetActivityStreamsTo(to)
+	return d
+}
+
+// newNote creates a note with the id and content.
+func newNote(id, content string) vocab.ActivityStreamsNote {
+	n := streams.NewActivityStreamsNote()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(mustParse(id))
+	n.SetJSONLDId(idProp)
+	c := streams.NewActivityStreamsContentProperty()
+	c.AppendXMLSchemaString(content)
+	n.SetActivityStreamsContent(c)
+	return n
+}
+
+// TestNewRelayFollow tests the Follow subscribing to a relay.
+func TestNewRelayFollow(t *testing.T) {
+	f := NewRelayFollow(mustParse(testOriginInstanceIRI), mustParse(testRelayIRI))
+	m := mustSerialize(f)
+	assertEqual(t, m["type"], "Follow")
+	assertEqual(t, m["actor"], testOriginInstanceIRI)
+	assertEqual(t, m["object"], PublicActivityPubIRI)
+	assertEqual(t, m["to"], testRelayIRI)
+	isRelay, err := isRelayFollow(f)
+	assertEqual(t, err, nil)
+	assertEqual(t, isRelay, true)
+}
+
+// TestRelayClient tests subscribing to a relay and handling its Announces.
+func TestRelayClient(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase, mockTp *MockTransport) {
+		mockDB = NewMockDatabase(ctl)
+		mockTp = NewMockTransport(ctl)
+		w.inboxIRI = mustParse(testMyInboxIRI)
+		w.db = mockDB
+		w.newTransport = func(c context.Context, a *url.URL, s string) (Transport, error) {
+			return mockTp, nil
+		}
+		w.Relays = []*url.URL{mustParse(testRelayIRI)}
+		return
+	}
+	newFollowFn := func() vocab.ActivityStreamsFollow {
+		f := NewRelayFollow(mustParse(testFederatedActorIRI2), mustParse(testRelayIRI))
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse(testFederatedActivityIRI))
+		f.SetJSONLDId(id)
+		return f
+	}
+	newAnnounceFn := func(object vocab.Type) vocab.ActivityStreamsAnnounce {
+		a := streams.NewActivityStreamsAnnounce()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(mustParse("https://relay.example.com/activities/1"))
+		a.SetJSONLDId(id)
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testRelayIRI))
+		a.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendType(object)
+		a.SetActivityStreamsObject(op)
+		return a
+	}
+	t.Run("AcceptOfRelayFollowUpdatesFollowing", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		follow := newFollowFn()
+		following := streams.NewActivityStreamsCollection()
+		expectFollowing := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testRelayIRI))
+		expectFollowing.SetActivityStreamsItems(expectItems)
+		mockDB.EXPECT().Lock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testMyInboxIRI)).Return(
+			mustParse(testFederatedActorIRI2), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testMyInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Get(ctx, mustParse(testFederatedActivityIRI)).Return(follow, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActorIRI2))
+		mockDB.EXPECT().Following(ctx, mustParse(testFederatedActorIRI2)).Return(
+			following, nil)
+		mockDB.EXPECT().Update(ctx, expectFollowing)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActorIRI2))
+		a := streams.NewActivityStreamsAccept()
+		actor := streams.NewActivityStreamsActorProperty()
+		actor.AppendIRI(mustParse(testRelayIRI))
+		a.SetActivityStreamsActor(actor)
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsFollow(follow)
+		a.SetActivityStreamsObject(op)
+		err := w.accept(ctx, a)
+		assertEqual(t, err, nil)
+	})
+	t.Run("RefetchesRelayedObjectsFromOrigin", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		origin := newNote(testFederatedActivityIRI2, "from origin")
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			mustSerializeToBytes(origin), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI2)).Return(false, nil)
+		mockDB.EXPECT().Create(ctx, toDeserializedForm(origin))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		called := false
+		w.Announce = func(c context.Context, a vocab.ActivityStreamsAnnounce) error {
+			called = true
+			return nil
+		}
+		err := w.announce(ctx, newAnnounceFn(newNote(testFederatedActivityIRI2, "forged by relay")))
+		assertEqual(t, err, nil)
+		assertEqual(t, called, true)
+	})
+	t.Run("CreatesObjectsOfRelayedCreate", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		note := newNote(testFederatedActivityIRI2, "from origin")
+		create := newPublicCreate()
+		op := streams.NewActivityStreamsObjectProperty()
+		op.AppendActivityStreamsNote(note)
+		create.SetActivityStreamsObject(op)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(create), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI2)).Return(false, nil)
+		mockDB.EXPECT().Create(ctx, gomock.Any()).Do(func(c context.Context, v vocab.Type) {
+			assertEqual(t, mustSerialize(v)["content"], "from origin")
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		err := w.announce(ctx, newAnnounceFn(create))
+		assertEqual(t, err, nil)
+	})
+	t.Run("SkipsKnownObjects", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		origin := newNote(testFederatedActivityIRI2, "from origin")
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			mustSerializeToBytes(origin), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI2)).Return(true, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		err := w.announce(ctx, newAnnounceFn(origin))
+		assertEqual(t, err, nil)
+	})
+	t.Run("UpdatesObjectsOfRelayedUpdate", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		update := newPublicUpdate()
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(update), nil)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			mustSerializeToBytes(newNote(testFederatedActivityIRI2, "edited")), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Update(ctx, gomock.Any()).Do(func(c context.Context, v vocab.Type) {
+			assertEqual(t, mustSerialize(v)["content"], "edited")
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		called := false
+		w.Update = func(c context.Context, u vocab.ActivityStreamsUpdate) error {
+			called = true
+			return nil
+		}
+		err := w.announce(ctx, newAnnounceFn(update))
+		assertEqual(t, err, nil)
+		assertEqual(t, called, true)
+	})
+	t.Run("DeletesObjectsOfRelayedDelete", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, mockTp := setupFn(ctl)
+		del := newPublicDelete()
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI)).Return(
+			mustSerializeToBytes(del), nil)
+		mockDB.EXPECT().Lock(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Delete(ctx, mustParse(testFederatedActivityIRI2))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testFederatedActivityIRI2))
+		called := false
+		w.Delete = func(c context.Context, d vocab.ActivityStreamsDelete) error {
+			called = true
+			return nil
+		}
+		err := w.announce(ctx, newAnnounceFn(del))
+		assertEqual(t, err, nil)
+		assertEqual(t, called, true)
+	})
+	t.Run("ErrorIfOriginServesAnotherObject", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, mockTp := setupFn(ctl)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testFederatedActivityIRI2)).Return(
+			mustSerializeToBytes(newNote(testNoteId1, "elsewhere")), nil)
+		err := w.announce(ctx, newAnnounceFn(newNote(testFederatedActivityIRI2, "forged by relay")))
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+	})
+}
+
+// TestRelayServer tests acting as a relay.
+func TestRelayServer(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (w FederatingWrappedCallbacks, mockDB *MockDatabase, mockTp *MockTransport) {
+		mockDB = NewMockDatabase(ctl)
+		mockTp = NewMockTransport(ctl)
+		w.inboxIRI = mustParse(testRelayInboxIRI)
+		w.db = mockDB
+		w.newTransport = func(c context.Context, a *url.URL, s string) (Transport, error) {
+			return mockTp, nil
+		}
+		w.addNewIds = func(c context.Context, activity Activity) error {
+			id := streams.NewJSONLDIdProperty()
+			id.Set(mustParse(testNewActivityIRI))
+			activity.SetJSONLDId(id)
+			return nil
+		}
+		w.Relay = true
+		return
+	}
+	expectSubscribersFn := func(mockDB *MockDatabase, subscribers ...string) {
+		followers := streams.NewActivityStreamsCollection()
+		items := streams.NewActivityStreamsItemsProperty()
+		for _, s := range subscribers {
+			items.AppendIRI(mustParse(s))
+		}
+		followers.SetActivityStreamsItems(items)
+		mockDB.EXPECT().Lock(ctx, mustParse(testRelayInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testRelayInboxIRI)).Return(
+			mustParse(testRelayIRI), nil)
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testRelayInboxIRI)).Return(
+			mustParse(testRelayOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testRelayInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testRelayIRI))
+		mockDB.EXPECT().Followers(ctx, mustParse(testRelayIRI)).Return(followers, nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testRelayIRI))
+	}
+	t.Run("FollowOfPublicSubscribes", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		w.OnFollow = OnFollowAutomaticallyAccept
+		var delivered Activity
+		w.deliver = func(c context.Context, outboxIRI *url.URL, activity Activity) error {
+			delivered = activity
+			return nil
+		}
+		followers := streams.NewActivityStreamsCollection()
+		expectFollowers := streams.NewActivityStreamsCollection()
+		expectItems := streams.NewActivityStreamsItemsProperty()
+		expectItems.AppendIRI(mustParse(testOriginInstanceIRI))
+		expectFollowers.SetActivityStreamsItems(expectItems)
+		mockDB.EXPECT().Lock(ctx, mustParse(testRelayInboxIRI))
+		mockDB.EXPECT().ActorForInbox(ctx, mustParse(testRelayInboxIRI)).Return(
+			mustParse(testRelayIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testRelayInboxIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testRelayIRI))
+		mockDB.EXPECT().Followers(ctx, mustParse(testRelayIRI)).Return(followers, nil)
+		mockDB.EXPECT().Update(ctx, expectFollowers)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testRelayIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testRelayInboxIRI))
+		mockDB.EXPECT().OutboxForInbox(ctx, mustParse(testRelayInboxIRI)).Return(
+			mustParse(testRelayOutboxIRI), nil)
+		mockDB.EXPECT().Unlock(ctx, mustParse(testRelayInboxIRI))
+		err := w.follow(ctx, NewRelayFollow(mustParse(testOriginInstanceIRI), mustParse(testRelayIRI)))
+		assertEqual(t, err, nil)
+		if !streams.IsOrExtendsActivityStreamsAccept(delivered) {
+			t.Fatalf("expected Accept, got %T", delivered)
+		}
+	})
+	t.Run("AnnouncesToOtherSubscribers", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		expectSubscribersFn(mockDB, testOriginInstanceIRI, testSubscriberIRI)
+		var stored Activity
+		mockDB.EXPECT().Lock(ctx, mustParse(testNewActivityIRI))
+		mockDB.EXPECT().Create(ctx, gomock.Any()).Do(func(c context.Context, v vocab.Type) {
+			stored = v.(Activity)
+		})
+		mockDB.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI))
+		mockDB.EXPECT().Lock(ctx, mustParse(testRelayOutboxIRI))
+		mockDB.EXPECT().AppendOutbox(ctx, mustParse(testRelayOutboxIRI), mustParse(testNewActivityIRI))
+		mockDB.EXPECT().Unlock(ctx, mustParse(testRelayOutboxIRI))
+		var outbox *url.URL
+		var announce Activity
+		var subscribers []*url.URL
+		w.fanOut = func(c context.Context, outboxIRI *url.URL, activity Activity, s []*url.URL) error {
+			outbox, announce, subscribers = outboxIRI, activity, s
+			return nil
+		}
+		err := w.relay(ctx, newPublicCreate())
+		assertEqual(t, err, nil)
+		assertEqual(t, outbox.String(), testRelayOutboxIRI)
+		assertEqual(t, len(subscribers), 1)
+		assertEqual(t, subscribers[0].String(), testSubscriberIRI)
+		assertEqual(t, stored, announce)
+		m := mustSerialize(announce)
+		assertEqual(t, m["type"], "Announce")
+		assertEqual(t, m["id"], testNewActivityIRI)
+		assertEqual(t, m["actor"], testRelayIRI)
+		assertEqual(t, m["object"], testFederatedActivityIRI)
+		assertEqual(t, m["to"], PublicActivityPubIRI)
+	})
+	t.Run("IgnoresUnsubscribedServers", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, mockDB, _ := setupFn(ctl)
+		expectSubscribersFn(mockDB, testSubscriberIRI)
+		w.fanOut = func(c context.Context, outboxIRI *url.URL, activity Activity, s []*url.URL) error {
+			t.Fatalf("announced %v", activity)
+			return nil
+		}
+		err := w.relay(ctx, newPublicCreate())
+		assertEqual(t, err, nil)
+	})
+	t.Run("IgnoresNonPublicActivities", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, _ := setupFn(ctl)
+		c := newPublicCreate()
+		to := streams.NewActivityStreamsToProperty()
+		to.AppendIRI(mustParse(testRelayIRI))
+		c.SetActivityStreamsTo(to)
+		err := w.relay(ctx, c)
+		assertEqual(t, err, nil)
+	})
+	t.Run("IgnoresFollows", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		w, _, _ := setupFn(ctl)
+		err := w.relay(ctx, NewRelayFollow(mustParse(testOriginInstanceIRI), mustParse(testRelayIRI)))
+		assertEqual(t, err, nil)
+	})
+	t.Run("DoesNothingUnlessRelay", func(t *testing.T) {
+		var w FederatingWrappedCallbacks
+		err := w.relay(ctx, newPublicCreate())
+		assertEqual(t, err, nil)
+	})
+}
+
+// TestRelayFanOut tests delivering the Announces of a relay to its
+// subscribers.
+func TestRelayFanOut(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (db *MockDatabase, tp *MockTransport, a *sideEffectActor) {
+		setupData()
+		common := NewMockCommonBehavior(ctl)
+		db = NewMockDatabase(ctl)
+		tp = NewMockTransport(ctl)
+		// One Transport resolves the subscribers, another delivers.
+		common.EXPECT().NewTransport(gomock.Any(), mustParse(testRelayOutboxIRI), goFedUserAgent()).Return(tp, nil).Times(2)
+		a = &sideEffectActor{common: common, db: db}
+		return
+	}
+	t.Run("FetchesAndStoresNewSubscribers", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, tp, a := setupFn(ctl)
+		subscriber := mustParse(testSubscriberIRI)
+		db.EXPECT().Lock(ctx, subscriber).Times(2)
+		db.EXPECT().Exists(ctx, subscriber).Return(false, nil).Times(2)
+		db.EXPECT().Unlock(ctx, subscriber).Times(2)
+		tp.EXPECT().Dereference(ctx, subscriber).Return([]byte(testSubscriberActorJSON), nil)
+		db.EXPECT().Create(ctx, gomock.Any())
+		tp.EXPECT().BatchDeliver(ctx, gomock.Any(), []*url.URL{mustParse(testSubscriberInboxIRI)})
+		err := a.deliverToSubscribers(ctx, mustParse(testRelayOutboxIRI), newPublicCreate(), []*url.URL{subscriber})
+		assertEqual(t, err, nil)
+	})
+	t.Run("DeliversInBackgroundToStoredSubscribers", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, tp, a := setupFn(ctl)
+		a.fanOuts = make(chan struct{}, 1)
+		subscriber := mustParse(testSubscriberIRI)
+		var m map[string]interface{}
+		err := json.Unmarshal([]byte(testSubscriberActorJSON), &m)
+		assertEqual(t, err, nil)
+		stored, err := streams.ToType(ctx, m)
+		assertEqual(t, err, nil)
+		db.EXPECT().Lock(gomock.Any(), subscriber)
+		db.EXPECT().Exists(gomock.Any(), subscriber).Return(true, nil)
+		db.EXPECT().Get(gomock.Any(), subscriber).Return(stored, nil)
+		db.EXPECT().Unlock(gomock.Any(), subscriber)
+		done := make(chan struct{})
+		tp.EXPECT().BatchDeliver(gomock.Any(), gomock.Any(), []*url.URL{mustParse(testSubscriberInboxIRI)}).Do(
+			func(c context.Context, b []byte, recipients []*url.URL) {
+				close(done)
+			})
+		err = a.fanOut(ctx, mustParse(testRelayOutboxIRI), newPublicCreate(), []*url.URL{subscriber})
+		assertEqual(t, err, nil)
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the Announce was not delivered")
+		}
+	})
+	t.Run("DeliversBeforeReturningWhenBusy", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		db, tp, a := setupFn(ctl)
+		a.fanOuts = make(chan struct{}, 1)
+		a.fanOuts <- struct{}{}
+		subscriber := mustParse(testSubscriberIRI)
+		var m map[string]interface{}
+		err := json.Unmarshal([]byte(testSubscriberActorJSON), &m)
+		assertEqual(t, err, nil)
+		stored, err := streams.ToType(ctx, m)
+		assertEqual(t, err, nil)
+		db.EXPECT().Lock(gomock.Any(), subscriber)
+		db.EXPECT().Exists(gomock.Any(), subscriber).Return(true, nil)
+		db.EXPECT().Get(gomock.Any(), subscriber).Return(stored, nil)
+		db.EXPECT().Unlock(gomock.Any(), subscriber)
+		delivered := false
+		tp.EXPECT().BatchDeliver(gomock.Any(), gomock.Any(), []*url.URL{mustParse(testSubscriberInboxIRI)}).Do(
+			func(c context.Context, b []byte, recipients []*url.URL) {
+				delivered = true
+			})
+		err = a.fanOut(ctx, mustParse(testRelayOutboxIRI), newPublicCreate(), []*url.URL{subscriber})
+		assertEqual(t, err, nil)
+		assertEqual(t, delivered, true)
+	})
+	t.Run("ReportsFailuresToObserver", func(t *testing.T) {
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		setupData()
+		common := NewMockCommonBehavior(ctl)
+		db := NewMockDatabase(ctl)
+		clock := NewMockClock(ctl)
+		o := &fakeObserver{}
+		a := &sideEffectActor{common: common, db: db, clock: clock, observer: o}
+		subscriber := mustParse(testSubscriberIRI)
+		common.EXPECT().NewTransport(gomock.Any(), mustParse(testRelayOutboxIRI), goFedUserAgent()).Return(NewMockTransport(ctl), nil)
+		db.EXPECT().Lock(gomock.Any(), subscriber).Return(testErr)
+		clock.EXPECT().Now().Return(now()).Times(2)
+		err := a.fanOut(ctx, mustParse(testRelayOutboxIRI), newPublicCreate(), []*url.URL{subscriber})
+		assertEqual(t, err, nil)
+		assertEqual(t, fmt.Sprint(o.events), fmt.Sprintf("[ran outbox Create in 0s %v]", testErr))
+	})
+}
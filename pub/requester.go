@@ -0,0 +1,27 @@
+package pub
+
+import (
+	"context"
+	"net/url"
+)
+
+// requesterContextKey is the context key of the authenticated requester.
+type requesterContextKey struct{}
+
+// WithRequester returns a copy of the context carrying the IRI of the actor
+// that made the request, as authenticated by the application.
+//
+// Applications call it in their GET authentication hooks, so that the handlers
+// of this library are able to decide what the requester is permitted to see,
+// and in their POST authentication hooks, so that AuditEvents record who caused
+// a change.
+func WithRequester(c context.Context, actorIRI *url.URL) context.Context {
+	return context.WithValue(c, requesterContextKey{}, actorIRI)
+}
+
+// RequesterFromContext returns the IRI of the actor that made the request, as
+// set by WithRequester. It returns nil if the request is anonymous.
+func RequesterFromContext(c context.Context) *url.URL {
+	actorIRI, _ := c.Value(requesterContextKey{}).(*url.URL)
+	return actorIRI
+}
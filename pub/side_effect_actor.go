@@ -3,6 +3,7 @@ package pub
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -27,6 +28,24 @@ type sideEffectActor struct {
 	c2s    SocialProtocol
 	db     Database
 	clock  Clock
+	// pageSize is the maximum number of items on a page of an inbox or
+	// outbox.
+	pageSize int
+	// instanceActor, if set, signs the requests fetching data while
+	// processing inbox deliveries.
+	instanceActor *InstanceActor
+	// observer, if set, is notified of side effects, forwarding
+	// decisions, and the calls to Transports.
+	observer Observer
+	// audit, if set, receives the changes made by the side effects of
+	// activities.
+	audit AuditSink
+	// tx is the transaction begun by transact that db belongs to, or nil
+	// outside of transactions.
+	tx *txState
+	// fanOuts holds a value for each relay fan-out delivering in the
+	// background. If nil, relays fan out before returning.
+	fanOuts chan struct{}
 }
 
 // PostInboxRequestBodyHook defers to the delegate.
@@ -59,14 +78,56 @@ func (a *sideEffectActor) AuthenticateGetOutbox(c context.Context, w http.Respon
 	return a.common.AuthenticateGetOutbox(c, w, r)
 }
 
-// GetOutbox delegates to the SocialProtocol.
-func (a *sideEffectActor) GetOutbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
-	return a.common.GetOutbox(c, r)
+// GetOutbox obtains the outbox, or the page of it requested, from the
+// database.
+func (a *sideEffectActor) GetOutbox(c context.Context, outboxIRI *url.URL, r *http.Request) (t vocab.Type, err error) {
+	err = a.transact(c, func(a *sideEffectActor) (err error) {
+		t, err = a.getCollection(c, outboxIRI, r, a.db.OutboxTotalItems, a.db.GetOutboxPage)
+		return
+	})
+	return
 }
 
-// GetInbox delegates to the FederatingProtocol.
-func (a *sideEffectActor) GetInbox(c context.Context, r *http.Request) (vocab.ActivityStreamsOrderedCollectionPage, error) {
-	return a.s2s.GetInbox(c, r)
+// GetInbox obtains the inbox, or the page of it requested, from the database.
+func (a *sideEffectActor) GetInbox(c context.Context, inboxIRI *url.URL, r *http.Request) (t vocab.Type, err error) {
+	err = a.transact(c, func(a *sideEffectActor) (err error) {
+		t, err = a.getCollection(c, inboxIRI, r, a.db.InboxTotalItems, a.db.GetInboxPage)
+		return
+	})
+	return
+}
+
+// getCollection obtains an inbox or outbox from the database with the given
+// functions. The OrderedCollection is returned unless a page of it is
+// requested, in which case only that OrderedCollectionPage is returned.
+func (a *sideEffectActor) getCollection(c context.Context,
+	collectionIRI *url.URL,
+	r *http.Request,
+	totalItems func(context.Context, *url.URL) (int, error),
+	getPage func(context.Context, *url.URL, PageQuery) (CollectionPage, error)) (t vocab.Type, err error) {
+	q, page := parsePageQuery(r, a.pageSize)
+	// Acquire a lock to read the collection. Defer release.
+	err = a.db.Lock(c, collectionIRI)
+	if err != nil {
+		return
+	}
+	defer a.db.Unlock(c, collectionIRI)
+	if len(page) == 0 {
+		var n int
+		n, err = totalItems(c, collectionIRI)
+		if err != nil {
+			return
+		}
+		t = toOrderedCollection(collectionIRI, n)
+		return
+	}
+	var p CollectionPage
+	p, err = getPage(c, collectionIRI, q)
+	if err != nil {
+		return
+	}
+	t = toOrderedCollectionPage(collectionIRI, page, p)
+	return
 }
 
 // AuthorizePostInbox defers to the federating protocol whether the peer request
@@ -75,7 +136,7 @@ func (a *sideEffectActor) AuthorizePostInbox(c context.Context, w http.ResponseW
 	authorized = false
 	actor := activity.GetActivityStreamsActor()
 	if actor == nil {
-		err = fmt.Errorf("no actors in post to inbox")
+		err = malformedf("no actors in post to inbox")
 		return
 	}
 	var iris []*url.URL
@@ -86,7 +147,7 @@ func (a *sideEffectActor) AuthorizePostInbox(c context.Context, w http.ResponseW
 		} else if t := iter.GetType(); t != nil {
 			iris = append(iris, activity.GetJSONLDId().Get())
 		} else {
-			err = fmt.Errorf("actor at index %d is missing an id", i)
+			err = malformedf("actor at index %d is missing an id", i)
 			return
 		}
 	}
@@ -106,35 +167,53 @@ func (a *sideEffectActor) AuthorizePostInbox(c context.Context, w http.ResponseW
 // request, adding the activity to the actor's inbox, and triggering side
 // effects based on the activity's type.
 func (a *sideEffectActor) PostInbox(c context.Context, inboxIRI *url.URL, activity Activity) error {
+	return a.transact(c, func(a *sideEffectActor) error {
+		return a.postInbox(c, inboxIRI, activity)
+	})
+}
+
+// postInbox implements PostInbox with the side-effect actor's Database.
+func (a *sideEffectActor) postInbox(c context.Context, inboxIRI *url.URL, activity Activity) error {
 	isNew, err := a.addToInboxIfNew(c, inboxIRI, activity)
 	if err != nil {
 		return err
 	}
-	if isNew {
-		wrapped, other, err := a.s2s.FederatingCallbacks(c)
-		if err != nil {
-			return err
-		}
-		// Populate side channels.
-		wrapped.db = a.db
-		wrapped.inboxIRI = inboxIRI
-		wrapped.newTransport = a.common.NewTransport
-		wrapped.deliver = a.Deliver
-		wrapped.addNewIds = a.AddNewIDs
-		res, err := streams.NewTypeResolver(wrapped.callbacks(other)...)
+	// An AsyncInbox retrying failed side effects finds the activity
+	// already in the inbox.
+	if isNew || IsInboxRetry(c) {
+		done := a.observeSideEffect(c, BoxInbox, activity)
+		err = a.inboxSideEffects(c, inboxIRI, activity)
+		done(err)
+	}
+	return err
+}
+
+// inboxSideEffects runs the side effects of a new activity in the inbox.
+func (a *sideEffectActor) inboxSideEffects(c context.Context, inboxIRI *url.URL, activity Activity) error {
+	wrapped, other, err := a.s2s.FederatingCallbacks(c)
+	if err != nil {
+		return err
+	}
+	// Populate side channels.
+	wrapped.db = a.auditDatabase(BoxInbox, inboxIRI, activity)
+	wrapped.inboxIRI = inboxIRI
+	wrapped.newTransport = a.newInboxTransport
+	wrapped.deliver = a.Deliver
+	wrapped.addNewIds = a.AddNewIDs
+	wrapped.fanOut = a.fanOut
+	res, err := streams.NewTypeResolver(wrapped.callbacks(other)...)
+	if err != nil {
+		return err
+	}
+	if err = res.Resolve(c, activity); err != nil && !streams.IsUnmatchedErr(err) {
+		return err
+	} else if streams.IsUnmatchedErr(err) {
+		err = a.s2s.DefaultCallback(c, activity)
 		if err != nil {
 			return err
 		}
-		if err = res.Resolve(c, activity); err != nil && !streams.IsUnmatchedErr(err) {
-			return err
-		} else if streams.IsUnmatchedErr(err) {
-			err = a.s2s.DefaultCallback(c, activity)
-			if err != nil {
-				return err
-			}
-		}
 	}
-	return nil
+	return wrapped.relay(c, activity)
 }
 
 // InboxForwarding implements the 3-part inbox forwarding algorithm specified in
@@ -143,6 +222,14 @@ func (a *sideEffectActor) PostInbox(c context.Context, inboxIRI *url.URL, activi
 //
 // InboxForwarding sets the federated data in the database.
 func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL, activity Activity) error {
+	return a.transact(c, func(a *sideEffectActor) error {
+		return a.inboxForwarding(c, inboxIRI, activity)
+	})
+}
+
+// inboxForwarding implements InboxForwarding with the side-effect actor's
+// Database.
+func (a *sideEffectActor) inboxForwarding(c context.Context, inboxIRI *url.URL, activity Activity) error {
 	// 1. Must be first time we have seen this Activity.
 	//
 	// Obtain the id of the activity
@@ -154,20 +241,24 @@ func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL,
 	}
 	// WARNING: Unlock is not deferred
 	//
-	// If the database already contains the activity, exit early.
+	// If the database already contains the activity, exit early, unless
+	// an AsyncInbox is retrying a forwarding that failed after storing it.
 	exists, err := a.db.Exists(c, id.Get())
 	if err != nil {
 		a.db.Unlock(c, id.Get())
 		return err
-	} else if exists {
+	} else if exists && !IsInboxRetry(c) {
 		a.db.Unlock(c, id.Get())
+		a.observeForwarding(c, activity, nil)
 		return nil
 	}
 	// Attempt to create the activity entry.
-	err = a.db.Create(c, activity)
-	if err != nil {
-		a.db.Unlock(c, id.Get())
-		return err
+	if !exists {
+		err = a.db.Create(c, activity)
+		if err != nil {
+			a.db.Unlock(c, id.Get())
+			return err
+		}
 	}
 	a.db.Unlock(c, id.Get())
 	// Unlock by this point and in every branch above.
@@ -268,6 +359,7 @@ func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL,
 	// If we own none of the Collection IRIs in 'to', 'cc', or 'audience'
 	// then no need to do inbox forwarding. We have nothing to forward to.
 	if len(colIRIs) == 0 {
+		a.observeForwarding(c, activity, nil)
 		return nil
 	}
 	// 3. The values of 'inReplyTo', 'object', 'target', or 'tag' are owned
@@ -281,6 +373,7 @@ func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL,
 	// If we don't own any of the 'inReplyTo', 'object', 'target', or 'tag'
 	// values, then no need to do inbox forwarding.
 	if !ownsValue {
+		a.observeForwarding(c, activity, nil)
 		return nil
 	}
 	// Do the inbox forwarding since the above conditions hold true. Support
@@ -314,6 +407,7 @@ func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL,
 			}
 		}
 	}
+	a.observeForwarding(c, activity, recipients)
 	return a.deliverToRecipients(c, inboxIRI, activity, recipients)
 }
 
@@ -323,6 +417,17 @@ func (a *sideEffectActor) InboxForwarding(c context.Context, inboxIRI *url.URL,
 // This implementation assumes all types are meant to be delivered except for
 // the ActivityStreams Block type.
 func (a *sideEffectActor) PostOutbox(c context.Context, activity Activity, outboxIRI *url.URL, rawJSON map[string]interface{}) (deliverable bool, err error) {
+	err = a.transact(c, func(a *sideEffectActor) (err error) {
+		deliverable, err = a.postOutbox(c, activity, outboxIRI, rawJSON)
+		return
+	})
+	return
+}
+
+// postOutbox implements PostOutbox with the side-effect actor's Database.
+func (a *sideEffectActor) postOutbox(c context.Context, activity Activity, outboxIRI *url.URL, rawJSON map[string]interface{}) (deliverable bool, err error) {
+	done := a.observeSideEffect(c, BoxOutbox, activity)
+	defer func() { done(err) }()
 	// TODO: Determine this if c2s is nil
 	deliverable = true
 	if a.c2s != nil {
@@ -333,11 +438,11 @@ func (a *sideEffectActor) PostOutbox(c context.Context, activity Activity, outbo
 			return
 		}
 		// Populate side channels.
-		wrapped.db = a.db
+		wrapped.db = a.auditDatabase(BoxOutbox, outboxIRI, activity)
 		wrapped.outboxIRI = outboxIRI
 		wrapped.rawActivity = rawJSON
 		wrapped.clock = a.clock
-		wrapped.newTransport = a.common.NewTransport
+		wrapped.newTransport = a.newTransport
 		undeliverable := false
 		wrapped.undeliverable = &undeliverable
 		var res *streams.TypeResolver
@@ -374,13 +479,13 @@ func (a *sideEffectActor) AddNewIDs(c context.Context, activity Activity) error
 	if streams.IsOrExtendsActivityStreamsCreate(activity) {
 		o, ok := activity.(objecter)
 		if !ok {
-			return fmt.Errorf("cannot add new id for Create: %T has no object property", activity)
+			return malformedf("cannot add new id for Create: %T has no object property", activity)
 		}
 		if oProp := o.GetActivityStreamsObject(); oProp != nil {
 			for iter := oProp.Begin(); iter != oProp.End(); iter = iter.Next() {
 				t := iter.GetType()
 				if t == nil {
-					return fmt.Errorf("cannot add new id for object in Create: object is not embedded as a value literal")
+					return malformedf("cannot add new id for object in Create: object is not embedded as a value literal")
 				}
 				id, err = a.db.NewID(c, t)
 				if err != nil {
@@ -399,16 +504,31 @@ func (a *sideEffectActor) AddNewIDs(c context.Context, activity Activity) error
 // another server.
 //
 // Must be called if at least the federated protocol is supported.
+//
+// Within a transaction, the recipients are determined and the activity is
+// delivered once the transaction is committed. The Database is read outside of
+// a transaction, since the recipients are dereferenced along the way.
 func (a *sideEffectActor) Deliver(c context.Context, outboxIRI *url.URL, activity Activity) error {
-	recipients, err := a.prepare(c, outboxIRI, activity)
-	if err != nil {
-		return err
-	}
-	return a.deliverToRecipients(c, outboxIRI, activity, recipients)
+	return a.afterCommit(func(a *sideEffectActor) error {
+		recipients, err := a.prepare(c, outboxIRI, activity)
+		if err != nil {
+			return err
+		}
+		return a.deliverToRecipients(c, outboxIRI, activity, recipients)
+	})
 }
 
 // WrapInCreate wraps an object with a Create activity.
 func (a *sideEffectActor) WrapInCreate(c context.Context, obj vocab.Type, outboxIRI *url.URL) (create vocab.ActivityStreamsCreate, err error) {
+	err = a.transact(c, func(a *sideEffectActor) (err error) {
+		create, err = a.wrapInCreate(c, obj, outboxIRI)
+		return
+	})
+	return
+}
+
+// wrapInCreate implements WrapInCreate with the side-effect actor's Database.
+func (a *sideEffectActor) wrapInCreate(c context.Context, obj vocab.Type, outboxIRI *url.URL) (create vocab.ActivityStreamsCreate, err error) {
 	err = a.db.Lock(c, outboxIRI)
 	if err != nil {
 		return
@@ -425,8 +545,14 @@ func (a *sideEffectActor) WrapInCreate(c context.Context, obj vocab.Type, outbox
 }
 
 // deliverToRecipients will take a prepared Activity and send it to specific
-// recipients on behalf of an actor.
+// recipients on behalf of an actor. Within a transaction, it is sent once the
+// transaction is committed.
 func (a *sideEffectActor) deliverToRecipients(c context.Context, boxIRI *url.URL, activity Activity, recipients []*url.URL) error {
+	if a.tx != nil {
+		return a.afterCommit(func(a *sideEffectActor) error {
+			return a.deliverToRecipients(c, boxIRI, activity, recipients)
+		})
+	}
 	m, err := streams.Serialize(activity)
 	if err != nil {
 		return err
@@ -435,7 +561,7 @@ func (a *sideEffectActor) deliverToRecipients(c context.Context, boxIRI *url.URL
 	if err != nil {
 		return err
 	}
-	tp, err := a.common.NewTransport(c, boxIRI, goFedUserAgent())
+	tp, err := a.newTransport(c, boxIRI, goFedUserAgent())
 	if err != nil {
 		return err
 	}
@@ -461,26 +587,14 @@ func (a *sideEffectActor) addToOutbox(c context.Context, outboxIRI *url.URL, act
 	// WARNING: Unlock(c, id) should be called by this point and in every
 	// return before here.
 	//
-	// Acquire a lock to read the outbox. Defer release.
+	// Acquire a lock to write to the outbox. Defer release.
 	err = a.db.Lock(c, outboxIRI)
 	if err != nil {
 		return err
 	}
 	defer a.db.Unlock(c, outboxIRI)
-	outbox, err := a.db.GetOutbox(c, outboxIRI)
-	if err != nil {
-		return err
-	}
-	// Prepend the activity to the list of 'orderedItems'.
-	oi := outbox.GetActivityStreamsOrderedItems()
-	if oi == nil {
-		oi = streams.NewActivityStreamsOrderedItemsProperty()
-	}
-	oi.PrependIRI(id.Get())
-	outbox.SetActivityStreamsOrderedItems(oi)
-	// Save in the database.
-	err = a.db.SetOutbox(c, outbox)
-	return err
+	// Add the activity as the most recent item in the outbox.
+	return a.db.AppendOutbox(c, outboxIRI, id.Get())
 }
 
 // addToInboxIfNew will add the activity to the inbox at the specified IRI if
@@ -490,7 +604,7 @@ func (a *sideEffectActor) addToOutbox(c context.Context, outboxIRI *url.URL, act
 //
 // Returns true when the activity is novel.
 func (a *sideEffectActor) addToInboxIfNew(c context.Context, inboxIRI *url.URL, activity Activity) (isNew bool, err error) {
-	// Acquire a lock to read the inbox. Defer release.
+	// Acquire a lock to write to the inbox. Defer release.
 	err = a.db.Lock(c, inboxIRI)
 	if err != nil {
 		return
@@ -505,21 +619,9 @@ func (a *sideEffectActor) addToInboxIfNew(c context.Context, inboxIRI *url.URL,
 	} else if contains {
 		return
 	}
-	// It is a new id, acquire the inbox.
+	// It is a new id, add it as the most recent item in the inbox.
 	isNew = true
-	inbox, err := a.db.GetInbox(c, inboxIRI)
-	if err != nil {
-		return
-	}
-	// Prepend the activity to the list of 'orderedItems'.
-	oi := inbox.GetActivityStreamsOrderedItems()
-	if oi == nil {
-		oi = streams.NewActivityStreamsOrderedItemsProperty()
-	}
-	oi.PrependIRI(id.Get())
-	inbox.SetActivityStreamsOrderedItems(oi)
-	// Save in the database.
-	err = a.db.SetInbox(c, inbox)
+	err = a.db.AppendInbox(c, inboxIRI, id.Get())
 	return
 }
 
@@ -578,7 +680,7 @@ func (a *sideEffectActor) hasInboxForwardingValues(c context.Context, inboxIRI *
 	// Recur Preparation: Try fetching the IRIs so we can recur into them.
 	for _, iri := range iris {
 		// Dereferencing the IRI.
-		tport, err := a.common.NewTransport(c, inboxIRI, goFedUserAgent())
+		tport, err := a.newInboxTransport(c, inboxIRI, goFedUserAgent())
 		if err != nil {
 			return false, err
 		}
@@ -716,7 +818,7 @@ func (a *sideEffectActor) prepare(c context.Context, outboxIRI *url.URL, activit
 
 	// look for any actors' inboxes that weren't already discovered above;
 	// find these by making dereference calls to remote instances
-	t, err := a.common.NewTransport(c, outboxIRI, goFedUserAgent())
+	t, err := a.newTransport(c, outboxIRI, goFedUserAgent())
 	if err != nil {
 		return nil, err
 	}
@@ -855,3 +957,165 @@ func (a *sideEffectActor) dereferenceForResolvingInboxes(c context.Context, t Tr
 	}
 	return
 }
+
+// newInboxTransport creates a Transport to fetch data while processing a
+// delivery to the inbox. The instance actor signs the requests if there is one,
+// otherwise the inbox's actor does.
+func (a *sideEffectActor) newInboxTransport(c context.Context, inboxIRI *url.URL, gofedAgent string) (Transport, error) {
+	if a.instanceActor != nil {
+		t, err := a.instanceActor.NewTransport(c, gofedAgent)
+		if err != nil {
+			return nil, err
+		}
+		return a.txTransport(a.observeTransport(t)), nil
+	}
+	return a.newTransport(c, inboxIRI, gofedAgent)
+}
+
+// transact calls f with the side-effect actor. If its Database is a
+// TxDatabase, f is instead called with a copy using a new transaction as its
+// Database, which is committed if f succeeds and rolled back otherwise.
+//
+// The transaction never waits on peers. Values dereferenced within it that
+// have not been fetched yet make it roll back, be fetched, and be tried again
+// with them, and deliveries are made once it is committed. A transaction
+// conflicting with a concurrent one is also tried again, up to
+// maxTxConflicts times.
+//
+// Calls nested within f reuse its transaction.
+func (a *sideEffectActor) transact(c context.Context, f func(a *sideEffectActor) error) error {
+	txdb, ok := a.db.(TxDatabase)
+	if !ok {
+		return f(a)
+	}
+	state := &txState{fetched: make(map[string]fetchResult)}
+	conflicts := 0
+	for {
+		tx, err := txdb.Begin(c)
+		if err != nil {
+			return err
+		}
+		state.missing = nil
+		state.committed = nil
+		txa := *a
+		txa.db = txDatabase{tx}
+		txa.tx = state
+		err = f(&txa)
+		if len(state.missing) > 0 {
+			// Fetch outside of the transaction, then try again.
+			tx.Rollback(c)
+			if len(state.fetched)+len(state.missing) > maxTxFetches {
+				return fmt.Errorf("transaction dereferences more than %d values", maxTxFetches)
+			}
+			for _, m := range state.missing {
+				b, err := m.t.Dereference(c, m.iri)
+				state.fetched[m.iri.String()] = fetchResult{b: b, err: err}
+			}
+			continue
+		}
+		if err == nil {
+			err = tx.Commit(c)
+		} else {
+			tx.Rollback(c)
+		}
+		if errors.Is(err, ErrTxConflict) && conflicts < maxTxConflicts {
+			conflicts++
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, g := range state.committed {
+			if err = g(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// maxTxFetches limits how many values a transaction may dereference.
+const maxTxFetches = 64
+
+// maxTxConflicts limits how many times a transaction is tried again after
+// conflicting with a concurrent one.
+const maxTxConflicts = 8
+
+// txState is the state of a transaction begun by transact, kept across its
+// attempts.
+type txState struct {
+	// fetched are the values dereferenced for the transaction by IRI.
+	fetched map[string]fetchResult
+	// missing are the values the current attempt needed but were not
+	// fetched yet.
+	missing []fetchRequest
+	// committed are called with the side-effect actor outside of the
+	// transaction once it is committed.
+	committed []func(a *sideEffectActor) error
+}
+
+// fetchResult is the outcome of dereferencing an IRI.
+type fetchResult struct {
+	b   []byte
+	err error
+}
+
+// fetchRequest is an IRI to dereference with a Transport.
+type fetchRequest struct {
+	t   Transport
+	iri *url.URL
+}
+
+// errFetchRequired is returned within a transaction when dereferencing a value
+// that has not been fetched yet. The transaction is tried again once it is.
+var errFetchRequired = errors.New("value must be fetched before the transaction")
+
+// afterCommit calls f with the side-effect actor once the transaction it is in
+// is committed, or right away if it is not in one.
+func (a *sideEffectActor) afterCommit(f func(a *sideEffectActor) error) error {
+	if a.tx == nil {
+		return f(a)
+	}
+	a.tx.committed = append(a.tx.committed, f)
+	return nil
+}
+
+// txTransport returns the Transport to use within the transaction, if any.
+func (a *sideEffectActor) txTransport(t Transport) Transport {
+	if a.tx == nil {
+		return t
+	}
+	return &transactionTransport{t: t, tx: a.tx}
+}
+
+// transactionTransport is a Transport used within a transaction, which serves
+// the values fetched for it and delivers once it is committed.
+type transactionTransport struct {
+	t  Transport
+	tx *txState
+}
+
+// Dereference returns the value fetched for the transaction, or records that
+// it is missing.
+func (t *transactionTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	if r, ok := t.tx.fetched[iri.String()]; ok {
+		return r.b, r.err
+	}
+	t.tx.missing = append(t.tx.missing, fetchRequest{t: t.t, iri: iri})
+	return nil, errFetchRequired
+}
+
+// Deliver sends the value once the transaction is committed.
+func (t *transactionTransport) Deliver(c context.Context, b []byte, to *url.URL) error {
+	t.tx.committed = append(t.tx.committed, func(*sideEffectActor) error {
+		return t.t.Deliver(c, b, to)
+	})
+	return nil
+}
+
+// BatchDeliver sends the value once the transaction is committed.
+func (t *transactionTransport) BatchDeliver(c context.Context, b []byte, recipients []*url.URL) error {
+	t.tx.committed = append(t.tx.committed, func(*sideEffectActor) error {
+		return t.t.BatchDeliver(c, b, recipients)
+	})
+	return nil
+}
@@ -2,6 +2,7 @@ package pub
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http/httptest"
 	"net/url"
@@ -91,28 +92,83 @@ func TestPassThroughMethods(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
-		c, _, _, _, _, a := setupFn(ctl)
+		_, _, _, db, _, a := setupFn(ctl)
+		outboxIRI := mustParse(testMyOutboxIRI)
 		req := toAPRequest(toGetOutboxRequest())
-		c.EXPECT().GetOutbox(ctx, req).Return(testOrderedCollectionUniqueElems, testErr)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, outboxIRI),
+			db.EXPECT().OutboxTotalItems(ctx, outboxIRI).Return(2, nil),
+			db.EXPECT().Unlock(ctx, outboxIRI),
+		)
 		// Run
-		p, err := a.GetOutbox(ctx, req)
+		p, err := a.GetOutbox(ctx, outboxIRI, req)
 		// Verify
-		assertEqual(t, p, testOrderedCollectionUniqueElems)
-		assertEqual(t, err, testErr)
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(p), []byte(`{"@context":"https://www.w3.org/ns/activitystreams","first":"https://example.com/addison/outbox?page=first","id":"https://example.com/addison/outbox","last":"https://example.com/addison/outbox?page=last","totalItems":2,"type":"OrderedCollection"}`))
+	})
+	t.Run("GetOutboxPage", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, db, _, a := setupFn(ctl)
+		a.(*sideEffectActor).pageSize = 2
+		outboxIRI := mustParse(testMyOutboxIRI)
+		req := toAPRequest(httptest.NewRequest("GET", testMyOutboxIRI+"?page=b", nil))
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, outboxIRI),
+			db.EXPECT().GetOutboxPage(ctx, outboxIRI, PageQuery{Cursor: "b", Limit: 2}).Return(CollectionPage{
+				Items: []*url.URL{mustParse(testNewActivityIRI), mustParse(testNewActivityIRI2)},
+				Next:  "c",
+				Prev:  "a",
+			}, nil),
+			db.EXPECT().Unlock(ctx, outboxIRI),
+		)
+		// Run
+		p, err := a.GetOutbox(ctx, outboxIRI, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(p), []byte(`{"@context":"https://www.w3.org/ns/activitystreams","id":"https://example.com/addison/outbox?page=b","next":"https://example.com/addison/outbox?page=c","orderedItems":["https://example.com/new/1","https://example.com/new/2"],"partOf":"https://example.com/addison/outbox","prev":"https://example.com/addison/outbox?page=a","type":"OrderedCollectionPage"}`))
 	})
 	t.Run("GetInbox", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
-		_, fp, _, _, _, a := setupFn(ctl)
+		_, _, _, db, _, a := setupFn(ctl)
+		inboxIRI := mustParse(testMyInboxIRI)
 		req := toAPRequest(toGetInboxRequest())
-		fp.EXPECT().GetInbox(ctx, req).Return(testOrderedCollectionUniqueElems, testErr)
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, inboxIRI),
+			db.EXPECT().InboxTotalItems(ctx, inboxIRI).Return(0, testErr),
+			db.EXPECT().Unlock(ctx, inboxIRI),
+		)
 		// Run
-		p, err := a.GetInbox(ctx, req)
+		p, err := a.GetInbox(ctx, inboxIRI, req)
 		// Verify
-		assertEqual(t, p, testOrderedCollectionUniqueElems)
+		assertEqual(t, p, nil)
 		assertEqual(t, err, testErr)
 	})
+	t.Run("GetInboxLastPage", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, _, _, db, _, a := setupFn(ctl)
+		a.(*sideEffectActor).pageSize = 2
+		inboxIRI := mustParse(testMyInboxIRI)
+		req := toAPRequest(httptest.NewRequest("GET", testMyInboxIRI+"?page=last", nil))
+		gomock.InOrder(
+			db.EXPECT().Lock(ctx, inboxIRI),
+			db.EXPECT().GetInboxPage(ctx, inboxIRI, PageQuery{Last: true, Limit: 2}).Return(CollectionPage{
+				Items: []*url.URL{mustParse(testFederatedActivityIRI)},
+				Prev:  "a",
+			}, nil),
+			db.EXPECT().Unlock(ctx, inboxIRI),
+		)
+		// Run
+		p, err := a.GetInbox(ctx, inboxIRI, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertByteEqual(t, mustSerializeToBytes(p), []byte(`{"@context":"https://www.w3.org/ns/activitystreams","id":"https://example.com/addison/inbox?page=last","orderedItems":"https://other.example.com/activity/1","partOf":"https://example.com/addison/inbox","prev":"https://example.com/addison/inbox?page=a","type":"OrderedCollectionPage"}`))
+	})
 }
 
 // TestAuthorizePostInbox tests the Authorization for a federated message, which
@@ -208,7 +264,7 @@ func TestPostInbox(t *testing.T) {
 		return
 	}
 	// Run tests
-	t.Run("AddsToEmptyInbox", func(t *testing.T) {
+	t.Run("AppendsToInbox", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -217,8 +273,7 @@ func TestPostInbox(t *testing.T) {
 		gomock.InOrder(
 			db.EXPECT().Lock(ctx, inboxIRI),
 			db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil),
-			db.EXPECT().GetInbox(ctx, inboxIRI).Return(testEmptyOrderedCollection, nil),
-			db.EXPECT().SetInbox(ctx, testOrderedCollectionWithFederatedId).Return(nil),
+			db.EXPECT().AppendInbox(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(nil),
 			db.EXPECT().Unlock(ctx, inboxIRI),
 		)
 		fp.EXPECT().FederatingCallbacks(ctx).Return(FederatingWrappedCallbacks{}, nil, nil)
@@ -244,26 +299,6 @@ func TestPostInbox(t *testing.T) {
 		// Verify
 		assertEqual(t, err, nil)
 	})
-	t.Run("AddsToInbox", func(t *testing.T) {
-		// Setup
-		ctl := gomock.NewController(t)
-		defer ctl.Finish()
-		_, fp, _, db, _, a := setupFn(ctl)
-		inboxIRI := mustParse(testMyInboxIRI)
-		gomock.InOrder(
-			db.EXPECT().Lock(ctx, inboxIRI),
-			db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil),
-			db.EXPECT().GetInbox(ctx, inboxIRI).Return(testOrderedCollectionWithFederatedId2, nil),
-			db.EXPECT().SetInbox(ctx, testOrderedCollectionWithBothFederatedIds).Return(nil),
-			db.EXPECT().Unlock(ctx, inboxIRI),
-		)
-		fp.EXPECT().FederatingCallbacks(ctx).Return(FederatingWrappedCallbacks{}, nil, nil)
-		fp.EXPECT().DefaultCallback(ctx, testListen).Return(nil)
-		// Run
-		err := a.PostInbox(ctx, inboxIRI, testListen)
-		// Verify
-		assertEqual(t, err, nil)
-	})
 	t.Run("ResolvesToCustomFunction", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
@@ -273,8 +308,7 @@ func TestPostInbox(t *testing.T) {
 		gomock.InOrder(
 			db.EXPECT().Lock(ctx, inboxIRI),
 			db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil),
-			db.EXPECT().GetInbox(ctx, inboxIRI).Return(testEmptyOrderedCollection, nil),
-			db.EXPECT().SetInbox(ctx, testOrderedCollectionWithFederatedId).Return(nil),
+			db.EXPECT().AppendInbox(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(nil),
 			db.EXPECT().Unlock(ctx, inboxIRI),
 		)
 		pass := false
@@ -299,8 +333,7 @@ func TestPostInbox(t *testing.T) {
 		gomock.InOrder(
 			db.EXPECT().Lock(ctx, inboxIRI),
 			db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil),
-			db.EXPECT().GetInbox(ctx, inboxIRI).Return(testEmptyOrderedCollection, nil),
-			db.EXPECT().SetInbox(ctx, testOrderedCollectionWithFederatedId).Return(nil),
+			db.EXPECT().AppendInbox(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(nil),
 			db.EXPECT().Unlock(ctx, inboxIRI),
 		)
 		pass := false
@@ -325,8 +358,7 @@ func TestPostInbox(t *testing.T) {
 		gomock.InOrder(
 			db.EXPECT().Lock(ctx, inboxIRI),
 			db.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil),
-			db.EXPECT().GetInbox(ctx, inboxIRI).Return(testEmptyOrderedCollection, nil),
-			db.EXPECT().SetInbox(ctx, testOrderedCollectionWithFederatedId).Return(nil),
+			db.EXPECT().AppendInbox(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(nil),
 			db.EXPECT().Unlock(ctx, inboxIRI),
 		)
 		pass := false
@@ -345,6 +377,25 @@ func TestPostInbox(t *testing.T) {
 		assertEqual(t, err, nil)
 		assertEqual(t, pass, true)
 	})
+	t.Run("RunsSideEffectsAgainOnRetry", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, fp, _, db, _, a := setupFn(ctl)
+		retryCtx := context.WithValue(ctx, inboxRetryContextKey{}, true)
+		inboxIRI := mustParse(testMyInboxIRI)
+		gomock.InOrder(
+			db.EXPECT().Lock(retryCtx, inboxIRI),
+			db.EXPECT().InboxContains(retryCtx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(true, nil),
+			db.EXPECT().Unlock(retryCtx, inboxIRI),
+		)
+		fp.EXPECT().FederatingCallbacks(retryCtx).Return(FederatingWrappedCallbacks{}, nil, nil)
+		fp.EXPECT().DefaultCallback(retryCtx, testListen).Return(nil)
+		// Run
+		err := a.PostInbox(retryCtx, inboxIRI, testListen)
+		// Verify
+		assertEqual(t, err, nil)
+	})
 }
 
 // TestInboxForwarding ensures that the inbox forwarding logic is correct.
@@ -842,30 +893,7 @@ func TestPostOutbox(t *testing.T) {
 		}
 		return
 	}
-	t.Run("AddsToEmptyOutbox", func(t *testing.T) {
-		// Setup
-		ctl := gomock.NewController(t)
-		defer ctl.Finish()
-		_, _, sp, db, _, a := setupFn(ctl)
-		outboxIRI := mustParse(testMyOutboxIRI)
-		gomock.InOrder(
-			db.EXPECT().Lock(ctx, mustParse(testNewActivityIRI)),
-			db.EXPECT().Create(ctx, testMyListen),
-			db.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI)),
-			db.EXPECT().Lock(ctx, outboxIRI),
-			db.EXPECT().GetOutbox(ctx, outboxIRI).Return(testEmptyOrderedCollection, nil),
-			db.EXPECT().SetOutbox(ctx, testOrderedCollectionWithNewId).Return(nil),
-			db.EXPECT().Unlock(ctx, outboxIRI),
-		)
-		sp.EXPECT().SocialCallbacks(ctx).Return(SocialWrappedCallbacks{}, nil, nil)
-		sp.EXPECT().DefaultCallback(ctx, testMyListen).Return(nil)
-		// Run
-		deliverable, err := a.PostOutbox(ctx, testMyListen, outboxIRI, mustSerialize(testMyListen))
-		// Verify
-		assertEqual(t, err, nil)
-		assertEqual(t, deliverable, true)
-	})
-	t.Run("AddsToOutbox", func(t *testing.T) {
+	t.Run("AppendsToOutbox", func(t *testing.T) {
 		// Setup
 		ctl := gomock.NewController(t)
 		defer ctl.Finish()
@@ -876,8 +904,7 @@ func TestPostOutbox(t *testing.T) {
 			db.EXPECT().Create(ctx, testMyListen),
 			db.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI)),
 			db.EXPECT().Lock(ctx, outboxIRI),
-			db.EXPECT().GetOutbox(ctx, outboxIRI).Return(testOrderedCollectionWithNewId2, nil),
-			db.EXPECT().SetOutbox(ctx, testOrderedCollectionWithBothNewIds).Return(nil),
+			db.EXPECT().AppendOutbox(ctx, outboxIRI, mustParse(testNewActivityIRI)).Return(nil),
 			db.EXPECT().Unlock(ctx, outboxIRI),
 		)
 		sp.EXPECT().SocialCallbacks(ctx).Return(SocialWrappedCallbacks{}, nil, nil)
@@ -899,8 +926,7 @@ func TestPostOutbox(t *testing.T) {
 			db.EXPECT().Create(ctx, testMyListen),
 			db.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI)),
 			db.EXPECT().Lock(ctx, outboxIRI),
-			db.EXPECT().GetOutbox(ctx, outboxIRI).Return(testEmptyOrderedCollection, nil),
-			db.EXPECT().SetOutbox(ctx, testOrderedCollectionWithNewId).Return(nil),
+			db.EXPECT().AppendOutbox(ctx, outboxIRI, mustParse(testNewActivityIRI)).Return(nil),
 			db.EXPECT().Unlock(ctx, outboxIRI),
 		)
 		pass := false
@@ -928,8 +954,7 @@ func TestPostOutbox(t *testing.T) {
 			db.EXPECT().Create(ctx, testMyCreate),
 			db.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI)),
 			db.EXPECT().Lock(ctx, outboxIRI),
-			db.EXPECT().GetOutbox(ctx, outboxIRI).Return(testEmptyOrderedCollection, nil),
-			db.EXPECT().SetOutbox(ctx, testOrderedCollectionWithNewId).Return(nil),
+			db.EXPECT().AppendOutbox(ctx, outboxIRI, mustParse(testNewActivityIRI)).Return(nil),
 			db.EXPECT().Unlock(ctx, outboxIRI),
 		)
 		pass := false
@@ -957,8 +982,7 @@ func TestPostOutbox(t *testing.T) {
 			db.EXPECT().Create(ctx, testMyCreate),
 			db.EXPECT().Unlock(ctx, mustParse(testNewActivityIRI)),
 			db.EXPECT().Lock(ctx, outboxIRI),
-			db.EXPECT().GetOutbox(ctx, outboxIRI).Return(testEmptyOrderedCollection, nil),
-			db.EXPECT().SetOutbox(ctx, testOrderedCollectionWithNewId).Return(nil),
+			db.EXPECT().AppendOutbox(ctx, outboxIRI, mustParse(testNewActivityIRI)).Return(nil),
 			db.EXPECT().Unlock(ctx, outboxIRI),
 		)
 		pass := false
@@ -1828,3 +1852,258 @@ func TestWrapInCreate(t *testing.T) {
 		assertByteEqual(t, mustSerializeToBytes(got), mustSerializeToBytes(expect))
 	})
 }
+
+// fakeTxDatabase is a TxDatabase whose own methods are mocked by the embedded
+// MockDatabase, and which begins the transaction tx.
+type fakeTxDatabase struct {
+	*MockDatabase
+	tx       *fakeTx
+	beginErr error
+}
+
+func (d *fakeTxDatabase) Begin(c context.Context) (Tx, error) {
+	if d.beginErr != nil {
+		return nil, d.beginErr
+	}
+	return d.tx, nil
+}
+
+// fakeTx is a Tx whose reads and writes are mocked by the embedded
+// MockDatabase, and which records how it finished. Its commits fail with the
+// commitErrs, in order, until there are none left.
+type fakeTx struct {
+	*MockDatabase
+	committed  bool
+	rolledBack bool
+	commitErrs []error
+}
+
+func (t *fakeTx) Commit(c context.Context) error {
+	if len(t.commitErrs) > 0 {
+		err := t.commitErrs[0]
+		t.commitErrs = t.commitErrs[1:]
+		return err
+	}
+	t.committed = true
+	return nil
+}
+
+func (t *fakeTx) Rollback(c context.Context) error {
+	t.rolledBack = true
+	return nil
+}
+
+// TestTransactions tests that a TxDatabase is used through transactions in
+// place of locks.
+func TestTransactions(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func(ctl *gomock.Controller) (fp *MockFederatingProtocol, db *fakeTxDatabase, tx *MockDatabase, a DelegateActor) {
+		setupData()
+		fp = NewMockFederatingProtocol(ctl)
+		tx = NewMockDatabase(ctl)
+		db = &fakeTxDatabase{
+			MockDatabase: NewMockDatabase(ctl),
+			tx:           &fakeTx{MockDatabase: tx},
+		}
+		a = &sideEffectActor{
+			common: NewMockCommonBehavior(ctl),
+			s2s:    fp,
+			c2s:    NewMockSocialProtocol(ctl),
+			db:     db,
+			clock:  NewMockClock(ctl),
+		}
+		return
+	}
+	// Run tests
+	t.Run("GetOutboxCommitsWithoutLocking", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, tx, a := setupFn(ctl)
+		outboxIRI := mustParse(testMyOutboxIRI)
+		req := toAPRequest(toGetOutboxRequest())
+		// Mock
+		tx.EXPECT().OutboxTotalItems(ctx, outboxIRI).Return(2, nil)
+		// Run
+		p, err := a.GetOutbox(ctx, outboxIRI, req)
+		// Verify
+		assertEqual(t, err, nil)
+		assertNotEqual(t, p, nil)
+		assertEqual(t, db.tx.committed, true)
+		assertEqual(t, db.tx.rolledBack, false)
+	})
+	t.Run("PostInboxRollsBackOnError", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, tx, a := setupFn(ctl)
+		inboxIRI := mustParse(testMyInboxIRI)
+		// Mock
+		tx.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, testErr)
+		// Run
+		err := a.PostInbox(ctx, inboxIRI, testListen)
+		// Verify
+		assertEqual(t, err, testErr)
+		assertEqual(t, db.tx.committed, false)
+		assertEqual(t, db.tx.rolledBack, true)
+	})
+	t.Run("PostInboxCallbacksUseTransaction", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		fp, db, tx, a := setupFn(ctl)
+		inboxIRI := mustParse(testMyInboxIRI)
+		// Mock
+		tx.EXPECT().InboxContains(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(false, nil)
+		tx.EXPECT().AppendInbox(ctx, inboxIRI, mustParse(testFederatedActivityIRI)).Return(nil)
+		fp.EXPECT().FederatingCallbacks(ctx).Return(FederatingWrappedCallbacks{}, nil, nil)
+		tx.EXPECT().Create(ctx, testFederatedNote).Return(nil)
+		// Run
+		err := a.PostInbox(ctx, inboxIRI, testCreate)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, db.tx.committed, true)
+	})
+	t.Run("InboxForwardingCommitsWithoutLocking", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, tx, a := setupFn(ctl)
+		inboxIRI := mustParse(testMyInboxIRI)
+		// Mock
+		tx.EXPECT().Exists(ctx, mustParse(testFederatedActivityIRI)).Return(true, nil)
+		// Run
+		err := a.InboxForwarding(ctx, inboxIRI, testListen)
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, db.tx.committed, true)
+	})
+	t.Run("FetchesOutsideTransactionAndRetries", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, _, a := setupFn(ctl)
+		sa := a.(*sideEffectActor)
+		mockCommon := sa.common.(*MockCommonBehavior)
+		mockTp := NewMockTransport(ctl)
+		attempts := 0
+		// Mock
+		mockCommon.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(mockTp, nil).Times(2)
+		mockTp.EXPECT().Dereference(ctx, mustParse(testNoteId1)).DoAndReturn(func(c context.Context, iri *url.URL) ([]byte, error) {
+			// The first attempt has been rolled back.
+			assertEqual(t, db.tx.rolledBack, true)
+			return testRespBody, nil
+		})
+		// Run
+		err := sa.transact(ctx, func(a *sideEffectActor) error {
+			attempts++
+			tp, err := a.newTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent())
+			if err != nil {
+				return err
+			}
+			b, err := tp.Dereference(ctx, mustParse(testNoteId1))
+			if err != nil {
+				return err
+			}
+			assertByteEqual(t, b, testRespBody)
+			return nil
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, attempts, 2)
+		assertEqual(t, db.tx.committed, true)
+	})
+	t.Run("DeliversAfterCommit", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, _, a := setupFn(ctl)
+		sa := a.(*sideEffectActor)
+		mockCommon := sa.common.(*MockCommonBehavior)
+		mockTp := NewMockTransport(ctl)
+		recipients := []*url.URL{mustParse(testFederatedActorIRI)}
+		// Mock
+		mockCommon.EXPECT().NewTransport(ctx, mustParse(testMyInboxIRI), goFedUserAgent()).Return(mockTp, nil)
+		mockTp.EXPECT().BatchDeliver(ctx, gomock.Any(), recipients).DoAndReturn(func(c context.Context, b []byte, to []*url.URL) error {
+			assertEqual(t, db.tx.committed, true)
+			return nil
+		})
+		// Run
+		err := sa.transact(ctx, func(a *sideEffectActor) error {
+			err := a.deliverToRecipients(ctx, mustParse(testMyInboxIRI), testListen, recipients)
+			assertEqual(t, db.tx.committed, false)
+			return err
+		})
+		// Verify
+		assertEqual(t, err, nil)
+	})
+	t.Run("RetriesCommitConflicts", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, _, a := setupFn(ctl)
+		sa := a.(*sideEffectActor)
+		db.tx.commitErrs = []error{fmt.Errorf("serialization failure: %w", ErrTxConflict)}
+		attempts := 0
+		// Run
+		err := sa.transact(ctx, func(a *sideEffectActor) error {
+			attempts++
+			return nil
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, attempts, 2)
+		assertEqual(t, db.tx.committed, true)
+	})
+	t.Run("GivesUpAfterRepeatedConflicts", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, _, a := setupFn(ctl)
+		sa := a.(*sideEffectActor)
+		attempts := 0
+		// Run
+		err := sa.transact(ctx, func(a *sideEffectActor) error {
+			attempts++
+			return fmt.Errorf("deadlock: %w", ErrTxConflict)
+		})
+		// Verify
+		assertEqual(t, errors.Is(err, ErrTxConflict), true)
+		assertEqual(t, attempts, maxTxConflicts+1)
+		assertEqual(t, db.tx.committed, false)
+	})
+	t.Run("ObservesSideEffectsOnceCommitted", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, _, a := setupFn(ctl)
+		sa := a.(*sideEffectActor)
+		o := &fakeObserver{}
+		sa.observer = o
+		db.tx.commitErrs = []error{fmt.Errorf("serialization failure: %w", ErrTxConflict)}
+		// Mock
+		sa.clock.(*MockClock).EXPECT().Now().Return(now()).AnyTimes()
+		// Run
+		err := sa.transact(ctx, func(a *sideEffectActor) error {
+			a.observeSideEffect(ctx, BoxInbox, testListen)(nil)
+			assertEqual(t, len(o.events), 0)
+			return nil
+		})
+		// Verify
+		assertEqual(t, err, nil)
+		assertEqual(t, fmt.Sprint(o.events), "[ran inbox Listen in 0s <nil>]")
+	})
+	t.Run("ReturnsBeginError", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		_, db, _, a := setupFn(ctl)
+		db.beginErr = testErr
+		req := toAPRequest(toGetInboxRequest())
+		// Run
+		p, err := a.GetInbox(ctx, mustParse(testMyInboxIRI), req)
+		// Verify
+		assertEqual(t, p, nil)
+		assertEqual(t, err, testErr)
+	})
+}
@@ -2,7 +2,6 @@ package pub
 
 import (
 	"context"
-	"fmt"
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
 	"net/url"
@@ -316,7 +315,7 @@ func (w SocialWrappedCallbacks) update(c context.Context, a vocab.ActivityStream
 		// Copy over new top-level values.
 		objType := op.At(idx).GetType()
 		if objType == nil {
-			return fmt.Errorf("object at index %d is not a literal type value", idx)
+			return malformedf("object at index %d is not a literal type value", idx)
 		}
 		newM, err := objType.Serialize()
 		if err != nil {
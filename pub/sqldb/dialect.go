@@ -0,0 +1,62 @@
+package sqldb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect adapts the statements of a Database to a SQL database.
+type Dialect interface {
+	// Placeholder returns the parameter marker of the n-th argument of a
+	// statement, counting from 1.
+	Placeholder(n int) string
+	// IRIType returns the column type of IRIs, which are compared and
+	// indexed.
+	IRIType() string
+	// DocumentType returns the column type of JSON documents.
+	DocumentType() string
+}
+
+var (
+	// Postgres is the Dialect of PostgreSQL.
+	Postgres Dialect = postgres{}
+	// MySQL is the Dialect of MySQL and MariaDB. IRIs are limited to 1024
+	// ASCII characters so that they may be indexed.
+	MySQL Dialect = mysql{}
+	// SQLite is the Dialect of SQLite.
+	SQLite Dialect = sqlite{}
+)
+
+type postgres struct{}
+
+func (postgres) Placeholder(n int) string { return "$" + strconv.Itoa(n) }
+func (postgres) IRIType() string          { return "TEXT" }
+func (postgres) DocumentType() string     { return "JSONB" }
+
+type mysql struct{}
+
+func (mysql) Placeholder(n int) string { return "?" }
+func (mysql) IRIType() string          { return "VARCHAR(1024) CHARACTER SET ascii" }
+func (mysql) DocumentType() string     { return "LONGTEXT" }
+
+type sqlite struct{}
+
+func (sqlite) Placeholder(n int) string { return "?" }
+func (sqlite) IRIType() string          { return "TEXT" }
+func (sqlite) DocumentType() string     { return "TEXT" }
+
+// rebind replaces the '?' parameter markers of the statement with the ones of
+// the Dialect.
+func rebind(d Dialect, query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(d.Placeholder(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
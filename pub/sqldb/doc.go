@@ -0,0 +1,13 @@
+// Package sqldb implements a pub.Database on a SQL store through the
+// database/sql interfaces.
+//
+// Values are stored as JSON documents keyed by their IRI, alongside index
+// tables for the members of inboxes and outboxes, the boxes and collections of
+// actors, and the members of collections such as followers. The schema is
+// created by Migrate, whose migrations are part of the package.
+//
+// The Database is also a pub.TxDatabase, so the side-effect actor groups the
+// statements of each of its operations in a transaction instead of taking
+// locks. Transactions are serializable unless configured otherwise, and those
+// conflicting with concurrent ones are tried again.
+package sqldb
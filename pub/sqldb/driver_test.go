@@ -0,0 +1,401 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// stubDriverName is the name the stub driver is registered with. Each data
+// source name opens a distinct, initially empty, database.
+const stubDriverName = "sqldbstub"
+
+// stub is the registered stub driver.
+var stub = &stubDriver{dbs: make(map[string]*stubDB)}
+
+func init() {
+	sql.Register(stubDriverName, stub)
+}
+
+// stubDriver is a database/sql driver keeping its data in memory. Rather than
+// interpreting SQL, it only knows the statements of this package, each of which
+// is implemented by a stubHandler.
+type stubDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*stubDB
+}
+
+// stubHandler runs a statement against the data, returning the columns and
+// rows of queries.
+type stubHandler func(d *stubDB, args []driver.Value) (cols []string, rows [][]driver.Value, err error)
+
+// stubDB is the data of a database opened with the stub driver.
+type stubDB struct {
+	mu sync.Mutex
+	// serial is held by serializable transactions from their beginning to
+	// their end, so that they run one at a time.
+	serial     sync.Mutex
+	migrations int64
+	objects    map[string]string
+	// actors holds the inbox, outbox, followers, following, and liked of
+	// the actors, each of which may be nil.
+	actors map[string][]driver.Value
+	// items holds the items of the inboxes and outboxes, oldest first.
+	items   map[string][]stubItem
+	members map[string][]string
+	// appendConflicts is how many of the next appends fail, as if a
+	// concurrent append had taken the position.
+	appendConflicts int
+	// commitConflicts is how many of the next commits fail with a
+	// serialization failure, rolling back their transaction.
+	commitConflicts int
+}
+
+// stubConflict is the serialization failure of a commit, which reports its
+// SQLSTATE code as drivers such as pgx do.
+type stubConflict struct{}
+
+func (stubConflict) Error() string {
+	return "stub: could not serialize access due to concurrent update"
+}
+
+func (stubConflict) SQLState() string {
+	return "40001"
+}
+
+// stubItem is an item of an inbox or outbox.
+type stubItem struct {
+	position int64
+	id       string
+}
+
+func (s *stubDriver) Open(name string) (driver.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.dbs[name]
+	if !ok {
+		d = &stubDB{
+			objects: make(map[string]string),
+			actors:  make(map[string][]driver.Value),
+			items:   make(map[string][]stubItem),
+			members: make(map[string][]string),
+		}
+		s.dbs[name] = d
+	}
+	return &stubConn{db: d}, nil
+}
+
+// clone returns a copy of the data, to restore it from on rollback.
+func (d *stubDB) clone() *stubDB {
+	c := &stubDB{
+		migrations: d.migrations,
+		objects:    make(map[string]string),
+		actors:     make(map[string][]driver.Value),
+		items:      make(map[string][]stubItem),
+		members:    make(map[string][]string),
+	}
+	for k, v := range d.objects {
+		c.objects[k] = v
+	}
+	for k, v := range d.actors {
+		c.actors[k] = append([]driver.Value(nil), v...)
+	}
+	for k, v := range d.items {
+		c.items[k] = append([]stubItem(nil), v...)
+	}
+	for k, v := range d.members {
+		c.members[k] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// stubConn is a connection to a stubDB.
+type stubConn struct {
+	db *stubDB
+}
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	if strings.HasPrefix(query, "CREATE ") {
+		return &stubStmt{db: c.db, handler: func(*stubDB, []driver.Value) ([]string, [][]driver.Value, error) {
+			return nil, nil, nil
+		}}, nil
+	}
+	h, ok := stubHandlers[query]
+	if !ok {
+		return nil, fmt.Errorf("stub: unsupported statement %q", query)
+	}
+	return &stubStmt{db: c.db, handler: h}, nil
+}
+
+func (c *stubConn) Close() error {
+	return nil
+}
+
+func (c *stubConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx begins a transaction. Serializable transactions run one at a time,
+// while those of other isolation levels have no isolation at all.
+func (c *stubConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	serial := opts.Isolation == driver.IsolationLevel(sql.LevelSerializable)
+	if serial {
+		c.db.serial.Lock()
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	return &stubTx{db: c.db, saved: c.db.clone(), serial: serial}, nil
+}
+
+// stubTx is a transaction, which restores the data it began with on rollback.
+type stubTx struct {
+	db     *stubDB
+	saved  *stubDB
+	serial bool
+}
+
+func (t *stubTx) Commit() error {
+	t.db.mu.Lock()
+	conflict := t.db.commitConflicts > 0
+	if conflict {
+		t.db.commitConflicts--
+	}
+	t.db.mu.Unlock()
+	if conflict {
+		t.Rollback()
+		return stubConflict{}
+	}
+	t.end()
+	return nil
+}
+
+func (t *stubTx) Rollback() error {
+	defer t.end()
+	t.db.mu.Lock()
+	defer t.db.mu.Unlock()
+	t.db.migrations = t.saved.migrations
+	t.db.objects = t.saved.objects
+	t.db.actors = t.saved.actors
+	t.db.items = t.saved.items
+	t.db.members = t.saved.members
+	return nil
+}
+
+// end lets the next serializable transaction begin.
+func (t *stubTx) end() {
+	if t.serial {
+		t.serial = false
+		t.db.serial.Unlock()
+	}
+}
+
+// stubStmt runs a stubHandler.
+type stubStmt struct {
+	db      *stubDB
+	handler stubHandler
+}
+
+func (s *stubStmt) Close() error {
+	return nil
+}
+
+func (s *stubStmt) NumInput() int {
+	return -1
+}
+
+func (s *stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, _, err := s.handler(s.db, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	cols, rows, err := s.handler(s.db, args)
+	if err != nil {
+		return nil, err
+	}
+	return &stubRows{cols: cols, rows: rows}, nil
+}
+
+// stubRows are the rows of a query.
+type stubRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *stubRows) Columns() []string {
+	return r.cols
+}
+
+func (r *stubRows) Close() error {
+	return nil
+}
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// count returns the single row of a COUNT(*) query.
+func count(n int) ([]string, [][]driver.Value, error) {
+	return []string{"count"}, [][]driver.Value{{int64(n)}}, nil
+}
+
+// stubHandlers implement the statements of this package.
+var stubHandlers = map[string]stubHandler{
+	countMigrations: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return count(int(d.migrations))
+	},
+	insertMigration: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		d.migrations++
+		return nil, nil, nil
+	},
+	selectObject: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		doc, ok := d.objects[args[0].(string)]
+		if !ok {
+			return []string{"document"}, nil, nil
+		}
+		return []string{"document"}, [][]driver.Value{{doc}}, nil
+	},
+	countObject: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		_, ok := d.objects[args[0].(string)]
+		if ok {
+			return count(1)
+		}
+		return count(0)
+	},
+	insertObject: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		k := args[0].(string)
+		if _, ok := d.objects[k]; ok {
+			return nil, nil, fmt.Errorf("stub: duplicate object %s", k)
+		}
+		d.objects[k] = args[1].(string)
+		return nil, nil, nil
+	},
+	deleteObject: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		delete(d.objects, args[0].(string))
+		return nil, nil, nil
+	},
+	selectActor: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		cols := []string{"inbox", "followers", "following", "liked"}
+		a, ok := d.actors[args[0].(string)]
+		if !ok {
+			return cols, nil, nil
+		}
+		return cols, [][]driver.Value{{a[0], a[2], a[3], a[4]}}, nil
+	},
+	selectActorByInbox: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		cols := []string{"iri", "outbox"}
+		for iri, a := range d.actors {
+			if a[0] == args[0] {
+				return cols, [][]driver.Value{{iri, a[1]}}, nil
+			}
+		}
+		return cols, nil, nil
+	},
+	selectActorByOutbox: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		cols := []string{"iri"}
+		for iri, a := range d.actors {
+			if a[1] == args[0] {
+				return cols, [][]driver.Value{{iri}}, nil
+			}
+		}
+		return cols, nil, nil
+	},
+	insertActor: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		d.actors[args[0].(string)] = args[1:]
+		return nil, nil, nil
+	},
+	deleteActor: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		delete(d.actors, args[0].(string))
+		return nil, nil, nil
+	},
+	selectMembers: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		var rows [][]driver.Value
+		for _, m := range d.members[args[0].(string)] {
+			rows = append(rows, []driver.Value{m})
+		}
+		return []string{"member"}, rows, nil
+	},
+	insertMember: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		k := args[0].(string)
+		d.members[k] = append(d.members[k], args[2].(string))
+		return nil, nil, nil
+	},
+	deleteMembers: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		delete(d.members, args[0].(string))
+		return nil, nil, nil
+	},
+	countItem: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		for _, it := range d.items[args[0].(string)] {
+			if it.id == args[1] {
+				return count(1)
+			}
+		}
+		return count(0)
+	},
+	countItems: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return count(len(d.items[args[0].(string)]))
+	},
+	appendItem: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if d.appendConflicts > 0 {
+			d.appendConflicts--
+			return nil, nil, fmt.Errorf("stub: duplicate position")
+		}
+		box, id := args[0].(string), args[1].(string)
+		items := d.items[box]
+		pos := int64(1)
+		for _, it := range items {
+			if it.id == id {
+				return nil, nil, fmt.Errorf("stub: duplicate item %s in %s", id, box)
+			}
+			pos = it.position + 1
+		}
+		d.items[box] = append(items, stubItem{position: pos, id: id})
+		return nil, nil, nil
+	},
+	savepointAppend: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return nil, nil, nil
+	},
+	rollbackAppend: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return nil, nil, nil
+	},
+	releaseAppend: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		return nil, nil, nil
+	},
+	selectItemsBefore: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		items := d.items[args[0].(string)]
+		pos, limit := args[1].(int64), args[2].(int64)
+		var rows [][]driver.Value
+		for i := len(items) - 1; i >= 0 && int64(len(rows)) < limit; i-- {
+			if items[i].position < pos {
+				rows = append(rows, []driver.Value{items[i].position, items[i].id})
+			}
+		}
+		return []string{"position", "item"}, rows, nil
+	},
+	selectItemsAfter: func(d *stubDB, args []driver.Value) ([]string, [][]driver.Value, error) {
+		items := d.items[args[0].(string)]
+		pos, limit := args[1].(int64), args[2].(int64)
+		var rows [][]driver.Value
+		for i := 0; i < len(items) && int64(len(rows)) < limit; i++ {
+			if items[i].position > pos {
+				rows = append(rows, []driver.Value{items[i].position, items[i].id})
+			}
+		}
+		return []string{"position", "item"}, rows, nil
+	},
+}
@@ -0,0 +1,64 @@
+package sqldb
+
+import (
+	"context"
+	"fmt"
+)
+
+// migrations create the schema of a Database, in order, with the IRI and
+// document column types of the Dialect as the first and second verbs. The
+// version of a schema is the number of migrations applied to it.
+//
+// Migrations must never be edited or reordered once released, only appended.
+var migrations = []string{
+	`CREATE TABLE gofed_objects (iri %[1]s PRIMARY KEY, document %[2]s NOT NULL)`,
+	`CREATE TABLE gofed_actors (iri %[1]s PRIMARY KEY, inbox %[1]s, outbox %[1]s, followers %[1]s, following %[1]s, liked %[1]s)`,
+	`CREATE INDEX gofed_actors_inbox ON gofed_actors (inbox)`,
+	`CREATE INDEX gofed_actors_outbox ON gofed_actors (outbox)`,
+	`CREATE TABLE gofed_items (box %[1]s NOT NULL, position BIGINT NOT NULL, item %[1]s NOT NULL, PRIMARY KEY (box, position))`,
+	`CREATE UNIQUE INDEX gofed_items_item ON gofed_items (box, item)`,
+	`CREATE TABLE gofed_members (collection %[1]s NOT NULL, position BIGINT NOT NULL, member %[1]s NOT NULL, PRIMARY KEY (collection, position))`,
+}
+
+const (
+	createMigrations = `CREATE TABLE IF NOT EXISTS gofed_migrations (version BIGINT NOT NULL)`
+	countMigrations  = `SELECT COUNT(*) FROM gofed_migrations`
+	insertMigration  = `INSERT INTO gofed_migrations (version) VALUES (?)`
+)
+
+// Migrate brings the schema of the database up to date, applying each missing
+// migration in its own transaction. It is meant to be called once at startup,
+// before the Database is used, and not by several processes at once.
+func (d *Database) Migrate(c context.Context) error {
+	if _, err := d.db.ExecContext(c, createMigrations); err != nil {
+		return err
+	}
+	var version int
+	if err := d.db.QueryRowContext(c, countMigrations).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		if err := d.migrate(c, version); err != nil {
+			return fmt.Errorf("sqldb: migration %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+// migrate applies the migration at the index and records it.
+func (d *Database) migrate(c context.Context, i int) error {
+	tx, err := d.db.BeginTx(c, nil)
+	if err != nil {
+		return err
+	}
+	stmt := fmt.Sprintf(migrations[i], d.dialect.IRIType(), d.dialect.DocumentType())
+	if _, err = tx.ExecContext(c, stmt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.ExecContext(c, rebind(d.dialect, insertMigration), i+1); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
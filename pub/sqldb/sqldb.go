@@ -0,0 +1,754 @@
+package sqldb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+const (
+	selectObject        = `SELECT document FROM gofed_objects WHERE iri = ?`
+	countObject         = `SELECT COUNT(*) FROM gofed_objects WHERE iri = ?`
+	insertObject        = `INSERT INTO gofed_objects (iri, document) VALUES (?, ?)`
+	deleteObject        = `DELETE FROM gofed_objects WHERE iri = ?`
+	selectActor         = `SELECT inbox, followers, following, liked FROM gofed_actors WHERE iri = ?`
+	selectActorByInbox  = `SELECT iri, outbox FROM gofed_actors WHERE inbox = ?`
+	selectActorByOutbox = `SELECT iri FROM gofed_actors WHERE outbox = ?`
+	insertActor         = `INSERT INTO gofed_actors (iri, inbox, outbox, followers, following, liked) VALUES (?, ?, ?, ?, ?, ?)`
+	deleteActor         = `DELETE FROM gofed_actors WHERE iri = ?`
+	selectMembers       = `SELECT member FROM gofed_members WHERE collection = ? ORDER BY position`
+	insertMember        = `INSERT INTO gofed_members (collection, position, member) VALUES (?, ?, ?)`
+	deleteMembers       = `DELETE FROM gofed_members WHERE collection = ?`
+	countItem           = `SELECT COUNT(*) FROM gofed_items WHERE box = ? AND item = ?`
+	countItems          = `SELECT COUNT(*) FROM gofed_items WHERE box = ?`
+	appendItem          = `INSERT INTO gofed_items (box, position, item) SELECT ?, COALESCE(MAX(position), 0) + 1, ? FROM gofed_items WHERE box = ?`
+	selectItemsBefore   = `SELECT position, item FROM gofed_items WHERE box = ? AND position < ? ORDER BY position DESC LIMIT ?`
+	selectItemsAfter    = `SELECT position, item FROM gofed_items WHERE box = ? AND position > ? ORDER BY position LIMIT ?`
+	savepointAppend     = `SAVEPOINT gofed_append`
+	rollbackAppend      = `ROLLBACK TO SAVEPOINT gofed_append`
+	releaseAppend       = `RELEASE SAVEPOINT gofed_append`
+)
+
+// maxAppendAttempts is how many times appending an item to an inbox or outbox
+// is attempted. Concurrent appends to a box race for its next position, which
+// the primary key of gofed_items lets only one of them take.
+const maxAppendAttempts = 5
+
+// maxConflictAttempts is how many times a write made outside of a transaction
+// is attempted when it conflicts with a concurrent transaction.
+const maxConflictAttempts = 5
+
+// sqlStater is implemented by the errors of drivers reporting their SQLSTATE
+// code, such as pgx.
+type sqlStater interface {
+	SQLState() string
+}
+
+const (
+	// beforeCursor prefixes the cursors of pages with the items older than
+	// a position.
+	beforeCursor = "before:"
+	// afterCursor prefixes the cursors of pages with the items more recent
+	// than a position.
+	afterCursor = "after:"
+)
+
+// Config configures a Database.
+type Config struct {
+	// DB is the SQL database to store values in.
+	DB *sql.DB
+	// Dialect adapts the statements to the SQL database. If nil, SQLite is
+	// used.
+	Dialect Dialect
+	// TxOptions are the options of the transactions begun by the
+	// Database, such as their isolation level. If nil, transactions are
+	// serializable, so that concurrent ones updating the same collection
+	// conflict rather than one of the updates being lost.
+	TxOptions *sql.TxOptions
+	// IsConflict reports whether an error of the driver is a conflict with
+	// a concurrent transaction, such as a serialization failure or a
+	// deadlock. Conflicts are returned wrapping pub.ErrTxConflict, so that
+	// the side-effect actor tries the transaction again. If nil, errors
+	// with a SQLState method returning "40001" or "40P01", as those of pgx
+	// have, are conflicts.
+	IsConflict func(err error) bool
+	// Hosts are the hosts of the IRIs owned by this server, such as
+	// "example.com". NewID creates IRIs on the first one.
+	Hosts []string
+	// Scheme is the protocol scheme of the IRIs created by NewID. If
+	// empty, "https" is used.
+	Scheme string
+}
+
+// Database is a pub.TxDatabase storing values in a SQL database. It is safe for
+// concurrent use.
+//
+// Lock and Unlock do nothing: the side-effect actor uses transactions with a
+// Database instead, and reads outside of them only see committed writes. Each
+// write made outside of a transaction is atomic on its own, and is tried again
+// if it conflicts with a concurrent transaction, but a read followed by a write
+// is not: applications updating a value, such as a collection, from what they
+// read must do both in a transaction begun with Begin, and try it again when
+// it fails with pub.ErrTxConflict.
+type Database struct {
+	store
+}
+
+var _ pub.TxDatabase = &Database{}
+
+// Tx is a pub.Tx begun by a Database.
+type Tx struct {
+	store
+	tx *sql.Tx
+}
+
+var _ pub.Tx = &Tx{}
+
+// querier runs statements, either directly on a sql.DB or within a sql.Tx.
+type querier interface {
+	ExecContext(c context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(c context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(c context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// store implements the reads and writes shared by a Database and a Tx.
+type store struct {
+	db         *sql.DB
+	q          querier
+	dialect    Dialect
+	txOpts     *sql.TxOptions
+	isConflict func(err error) bool
+	hosts      []string
+	scheme     string
+}
+
+// item is an item of an inbox or outbox at its position.
+type item struct {
+	position int64
+	id       *url.URL
+}
+
+// New returns a Database storing values in the SQL database. Its schema must
+// be brought up to date with Migrate before use.
+func New(cfg Config) *Database {
+	if cfg.Dialect == nil {
+		cfg.Dialect = SQLite
+	}
+	if cfg.TxOptions == nil {
+		cfg.TxOptions = &sql.TxOptions{Isolation: sql.LevelSerializable}
+	}
+	if cfg.IsConflict == nil {
+		cfg.IsConflict = isSQLStateConflict
+	}
+	if len(cfg.Scheme) == 0 {
+		cfg.Scheme = "https"
+	}
+	return &Database{
+		store: store{
+			db:         cfg.DB,
+			q:          cfg.DB,
+			dialect:    cfg.Dialect,
+			txOpts:     cfg.TxOptions,
+			isConflict: cfg.IsConflict,
+			hosts:      cfg.Hosts,
+			scheme:     cfg.Scheme,
+		},
+	}
+}
+
+// Lock does nothing, see Database.
+func (d *Database) Lock(c context.Context, id *url.URL) error {
+	return nil
+}
+
+// Unlock does nothing, see Database.
+func (d *Database) Unlock(c context.Context, id *url.URL) error {
+	return nil
+}
+
+// Begin starts a transaction with the configured options.
+func (d *Database) Begin(c context.Context) (pub.Tx, error) {
+	tx, err := d.db.BeginTx(c, d.txOpts)
+	if err != nil {
+		return nil, err
+	}
+	s := d.store
+	s.q = tx
+	return &Tx{store: s, tx: tx}, nil
+}
+
+// Commit commits the transaction.
+func (t *Tx) Commit(c context.Context) error {
+	return t.conflict(t.tx.Commit())
+}
+
+// Rollback aborts the transaction.
+func (t *Tx) Rollback(c context.Context) error {
+	return t.tx.Rollback()
+}
+
+// InboxContains determines whether the id is in the inbox.
+func (s store) InboxContains(c context.Context, inbox, id *url.URL) (contains bool, err error) {
+	var n int
+	err = s.queryRow(c, countItem, inbox.String(), id.String()).Scan(&n)
+	contains = n > 0
+	return
+}
+
+// AppendInbox adds the id to the inbox as its most recent item.
+func (s store) AppendInbox(c context.Context, inbox, id *url.URL) error {
+	return s.appendItem(c, inbox, id)
+}
+
+// InboxTotalItems returns the number of items in the inbox.
+func (s store) InboxTotalItems(c context.Context, inbox *url.URL) (n int, err error) {
+	err = s.queryRow(c, countItems, inbox.String()).Scan(&n)
+	return
+}
+
+// GetInboxPage returns a page of the ids in the inbox.
+func (s store) GetInboxPage(c context.Context, inbox *url.URL, q pub.PageQuery) (page pub.CollectionPage, err error) {
+	return s.getPage(c, inbox, q)
+}
+
+// Owns determines whether the IRI is on one of the configured hosts.
+func (s store) Owns(c context.Context, id *url.URL) (owns bool, err error) {
+	for _, h := range s.hosts {
+		if strings.EqualFold(id.Host, h) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ActorForOutbox returns the stored actor whose 'outbox' is the IRI.
+func (s store) ActorForOutbox(c context.Context, outboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	var actor string
+	err = s.queryRow(c, selectActorByOutbox, outboxIRI.String()).Scan(&actor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &pub.NotFoundError{Err: fmt.Errorf("sqldb: no actor has outbox %s", outboxIRI)}
+	} else if err != nil {
+		return
+	}
+	return url.Parse(actor)
+}
+
+// ActorForInbox returns the stored actor whose 'inbox' is the IRI.
+func (s store) ActorForInbox(c context.Context, inboxIRI *url.URL) (actorIRI *url.URL, err error) {
+	var actor string
+	var outbox sql.NullString
+	err = s.queryRow(c, selectActorByInbox, inboxIRI.String()).Scan(&actor, &outbox)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &pub.NotFoundError{Err: fmt.Errorf("sqldb: no actor has inbox %s", inboxIRI)}
+	} else if err != nil {
+		return
+	}
+	return url.Parse(actor)
+}
+
+// OutboxForInbox returns the 'outbox' of the stored actor whose 'inbox' is the
+// IRI.
+func (s store) OutboxForInbox(c context.Context, inboxIRI *url.URL) (outboxIRI *url.URL, err error) {
+	var actor string
+	var outbox sql.NullString
+	err = s.queryRow(c, selectActorByInbox, inboxIRI.String()).Scan(&actor, &outbox)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &pub.NotFoundError{Err: fmt.Errorf("sqldb: no actor has inbox %s", inboxIRI)}
+	} else if err != nil {
+		return
+	} else if !outbox.Valid {
+		return nil, &pub.NotFoundError{Err: fmt.Errorf("sqldb: actor %s has no outbox", actor)}
+	}
+	return url.Parse(outbox.String)
+}
+
+// InboxForActor returns the 'inbox' of the stored actor, or nil if the actor
+// is not stored.
+func (s store) InboxForActor(c context.Context, actorIRI *url.URL) (inboxIRI *url.URL, err error) {
+	var inbox, followers, following, liked sql.NullString
+	err = s.queryRow(c, selectActor, actorIRI.String()).Scan(&inbox, &followers, &following, &liked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil || !inbox.Valid {
+		return
+	}
+	return url.Parse(inbox.String)
+}
+
+// Exists determines whether a value with the id is stored.
+func (s store) Exists(c context.Context, id *url.URL) (exists bool, err error) {
+	var n int
+	err = s.queryRow(c, countObject, id.String()).Scan(&n)
+	exists = n > 0
+	return
+}
+
+// Get returns the stored value with the id, or pub.ErrNotFound.
+func (s store) Get(c context.Context, id *url.URL) (value vocab.Type, err error) {
+	var raw []byte
+	err = s.queryRow(c, selectObject, id.String()).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, pub.ErrNotFound
+	} else if err != nil {
+		return
+	}
+	var m map[string]interface{}
+	if err = json.Unmarshal(raw, &m); err != nil {
+		return
+	}
+	return streams.ToType(c, m)
+}
+
+// Create stores the value, replacing any with the same id.
+func (s store) Create(c context.Context, asType vocab.Type) error {
+	return s.put(c, asType)
+}
+
+// Update stores the value, replacing any with the same id.
+func (s store) Update(c context.Context, asType vocab.Type) error {
+	return s.put(c, asType)
+}
+
+// Delete removes the value with the id.
+func (s store) Delete(c context.Context, id *url.URL) error {
+	return s.atomically(c, func(s store) error {
+		return s.remove(c, id.String())
+	})
+}
+
+// AppendOutbox adds the id to the outbox as its most recent item.
+func (s store) AppendOutbox(c context.Context, outbox, id *url.URL) error {
+	return s.appendItem(c, outbox, id)
+}
+
+// OutboxTotalItems returns the number of items in the outbox.
+func (s store) OutboxTotalItems(c context.Context, outbox *url.URL) (n int, err error) {
+	err = s.queryRow(c, countItems, outbox.String()).Scan(&n)
+	return
+}
+
+// GetOutboxPage returns a page of the ids in the outbox.
+func (s store) GetOutboxPage(c context.Context, outbox *url.URL, q pub.PageQuery) (page pub.CollectionPage, err error) {
+	return s.getPage(c, outbox, q)
+}
+
+// NewID returns a random IRI on the first configured host, under a path named
+// after the value's type, such as "https://example.com/note/8f3a...".
+func (s store) NewID(c context.Context, t vocab.Type) (id *url.URL, err error) {
+	if len(s.hosts) == 0 {
+		return nil, fmt.Errorf("sqldb: no hosts configured to create ids on")
+	}
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	return &url.URL{
+		Scheme: s.scheme,
+		Host:   s.hosts[0],
+		Path:   path.Join("/", strings.ToLower(t.GetTypeName()), hex.EncodeToString(b)),
+	}, nil
+}
+
+// Followers returns the collection in the 'followers' of the stored actor.
+func (s store) Followers(c context.Context, actorIRI *url.URL) (followers vocab.ActivityStreamsCollection, err error) {
+	return s.actorCollection(c, actorIRI, "followers")
+}
+
+// Following returns the collection in the 'following' of the stored actor.
+func (s store) Following(c context.Context, actorIRI *url.URL) (following vocab.ActivityStreamsCollection, err error) {
+	return s.actorCollection(c, actorIRI, "following")
+}
+
+// Liked returns the collection in the 'liked' of the stored actor.
+func (s store) Liked(c context.Context, actorIRI *url.URL) (liked vocab.ActivityStreamsCollection, err error) {
+	return s.actorCollection(c, actorIRI, "liked")
+}
+
+// exec runs the statement with the parameter markers of the Dialect.
+func (s store) exec(c context.Context, query string, args ...interface{}) error {
+	_, err := s.q.ExecContext(c, rebind(s.dialect, query), args...)
+	return s.conflict(err)
+}
+
+// query runs the query with the parameter markers of the Dialect.
+func (s store) query(c context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := s.q.QueryContext(c, rebind(s.dialect, query), args...)
+	return rows, s.conflict(err)
+}
+
+// queryRow runs the query with the parameter markers of the Dialect.
+func (s store) queryRow(c context.Context, query string, args ...interface{}) row {
+	return row{Row: s.q.QueryRowContext(c, rebind(s.dialect, query), args...), s: s}
+}
+
+// row is the result of queryRow.
+type row struct {
+	*sql.Row
+	s store
+}
+
+// Scan copies the columns of the row into dest.
+func (r row) Scan(dest ...interface{}) error {
+	return r.s.conflict(r.Row.Scan(dest...))
+}
+
+// conflict returns the error wrapping pub.ErrTxConflict if it is a conflict
+// with a concurrent transaction, or the error otherwise.
+func (s store) conflict(err error) error {
+	if err != nil && s.isConflict(err) {
+		return &conflictError{err: err}
+	}
+	return err
+}
+
+// conflictError is an error of the driver reporting a conflict with a
+// concurrent transaction.
+type conflictError struct {
+	err error
+}
+
+func (e *conflictError) Error() string {
+	return e.err.Error()
+}
+
+func (e *conflictError) Unwrap() error {
+	return e.err
+}
+
+// Is makes the error satisfy errors.Is(err, pub.ErrTxConflict).
+func (e *conflictError) Is(target error) bool {
+	return target == pub.ErrTxConflict
+}
+
+// isSQLStateConflict determines whether the error has the SQLSTATE code of a
+// serialization failure or of a deadlock.
+func isSQLStateConflict(err error) bool {
+	var e sqlStater
+	if !errors.As(err, &e) {
+		return false
+	}
+	code := e.SQLState()
+	return code == "40001" || code == "40P01"
+}
+
+// atomically calls f with a store whose statements run in one transaction,
+// which is the store's own if it already is in one. Otherwise, the transaction
+// is tried again if it conflicts with a concurrent one.
+func (s store) atomically(c context.Context, f func(s store) error) (err error) {
+	if s.q != s.db {
+		return f(s)
+	}
+	for i := 0; i < maxConflictAttempts; i++ {
+		if err = s.transaction(c, f); !errors.Is(err, pub.ErrTxConflict) {
+			return
+		}
+	}
+	return
+}
+
+// transaction calls f with a store whose statements run in a new transaction,
+// which is committed if f succeeds and rolled back otherwise.
+func (s store) transaction(c context.Context, f func(s store) error) error {
+	tx, err := s.db.BeginTx(c, s.txOpts)
+	if err != nil {
+		return s.conflict(err)
+	}
+	s.q = tx
+	if err = f(s); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return s.conflict(tx.Commit())
+}
+
+// put stores the value by its id, indexing it if it is an actor or a
+// collection.
+func (s store) put(c context.Context, t vocab.Type) error {
+	id, err := pub.GetId(t)
+	if err != nil {
+		return err
+	}
+	m, err := streams.Serialize(t)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	k := id.String()
+	return s.atomically(c, func(s store) error {
+		if err := s.remove(c, k); err != nil {
+			return err
+		}
+		if err := s.exec(c, insertObject, k, string(raw)); err != nil {
+			return err
+		}
+		inbox, outbox := stringProperty(m, "inbox"), stringProperty(m, "outbox")
+		if inbox.Valid || outbox.Valid {
+			err := s.exec(c, insertActor, k, inbox, outbox,
+				stringProperty(m, "followers"),
+				stringProperty(m, "following"),
+				stringProperty(m, "liked"))
+			if err != nil {
+				return err
+			}
+		}
+		for i, member := range memberIds(m) {
+			if err := s.exec(c, insertMember, k, i, member); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// remove deletes the value with the id and its index entries.
+func (s store) remove(c context.Context, id string) error {
+	if err := s.exec(c, deleteObject, id); err != nil {
+		return err
+	}
+	if err := s.exec(c, deleteActor, id); err != nil {
+		return err
+	}
+	return s.exec(c, deleteMembers, id)
+}
+
+// appendItem adds the id to the inbox or outbox after its most recent item.
+//
+// An append losing the race for the next position to a concurrent one fails on
+// the primary key of gofed_items, and is attempted again, seeing the winner's
+// item once it is committed. Within a transaction, each attempt is made after
+// a savepoint, so that a failed one does not abort the transaction, unless it
+// failed by conflicting with a concurrent transaction.
+func (s store) appendItem(c context.Context, box, id *url.URL) (err error) {
+	inTx := s.q != s.db
+	for i := 0; i < maxAppendAttempts; i++ {
+		if inTx {
+			if err = s.exec(c, savepointAppend); err != nil {
+				return
+			}
+		}
+		if err = s.exec(c, appendItem, box.String(), id.String(), box.String()); err == nil {
+			if inTx {
+				return s.exec(c, releaseAppend)
+			}
+			return
+		}
+		if inTx {
+			if errors.Is(err, pub.ErrTxConflict) {
+				// The transaction is tried again as a whole.
+				return
+			}
+			if rerr := s.exec(c, rollbackAppend); rerr != nil {
+				return rerr
+			}
+		}
+	}
+	return
+}
+
+// actorCollection returns the collection named by the property of the stored
+// actor, with its indexed members as items.
+func (s store) actorCollection(c context.Context, actorIRI *url.URL, property string) (vocab.ActivityStreamsCollection, error) {
+	var inbox, followers, following, liked sql.NullString
+	err := s.queryRow(c, selectActor, actorIRI.String()).Scan(&inbox, &followers, &following, &liked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &pub.NotFoundError{Err: fmt.Errorf("sqldb: actor %s not found", actorIRI)}
+	} else if err != nil {
+		return nil, err
+	}
+	iri := map[string]sql.NullString{
+		"followers": followers,
+		"following": following,
+		"liked":     liked,
+	}[property]
+	if !iri.Valid {
+		return nil, fmt.Errorf("sqldb: actor %s has no %s collection", actorIRI, property)
+	}
+	id, err := url.Parse(iri.String)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.query(c, selectMembers, id.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := streams.NewActivityStreamsItemsProperty()
+	for rows.Next() {
+		var member string
+		if err = rows.Scan(&member); err != nil {
+			return nil, err
+		}
+		var m *url.URL
+		if m, err = url.Parse(member); err != nil {
+			return nil, err
+		}
+		items.AppendIRI(m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, s.conflict(err)
+	}
+	col := streams.NewActivityStreamsCollection()
+	idProp := streams.NewJSONLDIdProperty()
+	idProp.Set(id)
+	col.SetJSONLDId(idProp)
+	col.SetActivityStreamsItems(items)
+	return col, nil
+}
+
+// getPage returns the page of the ids in the inbox or outbox selected by the
+// query.
+func (s store) getPage(c context.Context, box *url.URL, q pub.PageQuery) (page pub.CollectionPage, err error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = math.MaxInt32 - 1
+	}
+	var pos int64
+	switch {
+	case q.Last:
+		return s.pageAfter(c, box, 0, limit, false)
+	case strings.HasPrefix(q.Cursor, afterCursor):
+		if pos, err = strconv.ParseInt(strings.TrimPrefix(q.Cursor, afterCursor), 10, 64); err != nil {
+			err = &pub.MalformedError{Err: fmt.Errorf("sqldb: malformed cursor %q: %w", q.Cursor, err)}
+			return
+		}
+		return s.pageAfter(c, box, pos, limit, true)
+	case strings.HasPrefix(q.Cursor, beforeCursor):
+		if pos, err = strconv.ParseInt(strings.TrimPrefix(q.Cursor, beforeCursor), 10, 64); err != nil {
+			err = &pub.MalformedError{Err: fmt.Errorf("sqldb: malformed cursor %q: %w", q.Cursor, err)}
+			return
+		}
+		return s.pageBefore(c, box, pos, limit, true)
+	case len(q.Cursor) == 0:
+		return s.pageBefore(c, box, math.MaxInt64, limit, false)
+	default:
+		err = &pub.MalformedError{Err: fmt.Errorf("sqldb: unknown cursor %q", q.Cursor)}
+		return
+	}
+}
+
+// pageBefore returns the page of the most recent items older than the
+// position. The page links to a previous one if there may be items more recent
+// than the position.
+func (s store) pageBefore(c context.Context, box *url.URL, pos int64, limit int, newer bool) (page pub.CollectionPage, err error) {
+	var items []item
+	if items, err = s.queryItems(c, selectItemsBefore, box, pos, limit+1); err != nil {
+		return
+	}
+	if len(items) > limit {
+		items = items[:limit]
+		page.Next = beforeCursor + strconv.FormatInt(items[limit-1].position, 10)
+	}
+	if newer {
+		newest := pos - 1
+		if len(items) > 0 {
+			newest = items[0].position
+		}
+		page.Prev = afterCursor + strconv.FormatInt(newest, 10)
+	}
+	for _, it := range items {
+		page.Items = append(page.Items, it.id)
+	}
+	return
+}
+
+// pageAfter returns the page of the oldest items more recent than the
+// position, most recent first. The page links to a next one if there may be
+// items older than the position.
+func (s store) pageAfter(c context.Context, box *url.URL, pos int64, limit int, older bool) (page pub.CollectionPage, err error) {
+	var items []item
+	if items, err = s.queryItems(c, selectItemsAfter, box, pos, limit+1); err != nil {
+		return
+	}
+	if len(items) > limit {
+		items = items[:limit]
+		page.Prev = afterCursor + strconv.FormatInt(items[limit-1].position, 10)
+	}
+	if older {
+		oldest := pos + 1
+		if len(items) > 0 {
+			oldest = items[0].position
+		}
+		page.Next = beforeCursor + strconv.FormatInt(oldest, 10)
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		page.Items = append(page.Items, items[i].id)
+	}
+	return
+}
+
+// queryItems returns the items of the inbox or outbox selected by the query
+// from the position, in the query's order.
+func (s store) queryItems(c context.Context, query string, box *url.URL, pos int64, limit int) (items []item, err error) {
+	var rows *sql.Rows
+	if rows, err = s.query(c, query, box.String(), pos, limit); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var it item
+		var id string
+		if err = rows.Scan(&it.position, &id); err != nil {
+			return
+		}
+		if it.id, err = url.Parse(id); err != nil {
+			return
+		}
+		items = append(items, it)
+	}
+	err = s.conflict(rows.Err())
+	return
+}
+
+// stringProperty returns the property of the serialized value if it is an
+// IRI, or NULL.
+func stringProperty(m map[string]interface{}, name string) sql.NullString {
+	s, ok := m[name].(string)
+	return sql.NullString{String: s, Valid: ok}
+}
+
+// memberIds returns the ids of the items of a serialized collection.
+func memberIds(m map[string]interface{}) (ids []string) {
+	for _, name := range []string{"items", "orderedItems"} {
+		switch v := m[name].(type) {
+		case []interface{}:
+			for _, e := range v {
+				if id, ok := memberId(e); ok {
+					ids = append(ids, id)
+				}
+			}
+		default:
+			if id, ok := memberId(v); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return
+}
+
+// memberId returns the id of a serialized item, which is either an IRI or an
+// embedded value.
+func memberId(v interface{}) (id string, ok bool) {
+	switch e := v.(type) {
+	case string:
+		return e, true
+	case map[string]interface{}:
+		id, ok = e["id"].(string)
+	}
+	return
+}
@@ -0,0 +1,233 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/go-fed/activity/pub"
+	"github.com/go-fed/activity/pub/pubtest"
+	"github.com/go-fed/activity/streams"
+	"github.com/go-fed/activity/streams/vocab"
+)
+
+var (
+	// testInbox and testOutbox are the boxes of an actor owned by the
+	// Database.
+	testInbox  = &url.URL{Scheme: "https", Host: "example.com", Path: "/addison/inbox"}
+	testOutbox = &url.URL{Scheme: "https", Host: "example.com", Path: "/addison/outbox"}
+	// testNoteIRI is the IRI of a Note owned by the Database.
+	testNoteIRI = &url.URL{Scheme: "https", Host: "example.com", Path: "/note/1"}
+)
+
+// activityIRI returns the IRI of an activity of another server, which
+// assertItems expects by its suffix.
+func activityIRI(suffix string) *url.URL {
+	return &url.URL{Scheme: "https", Host: "other.example.com", Path: "/activity/" + suffix}
+}
+
+// newDatabase returns a migrated Database on a new stub database named after
+// the test.
+func newDatabase(t *testing.T) (*Database, *sql.DB) {
+	db, err := sql.Open(stubDriverName, t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := New(Config{DB: db, Hosts: []string{"example.com"}})
+	if err := d.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return d, db
+}
+
+// TestMigrate tests applying the migrations.
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	t.Run("AppliesMissingMigrationsOnce", func(t *testing.T) {
+		d, db := newDatabase(t)
+		if err := d.Migrate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		var version int
+		if err := db.QueryRow(countMigrations).Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		if version != len(migrations) {
+			t.Fatalf("got version %d, want %d", version, len(migrations))
+		}
+	})
+	t.Run("RebindsPlaceholders", func(t *testing.T) {
+		got := rebind(Postgres, insertActor)
+		want := `INSERT INTO gofed_actors (iri, inbox, outbox, followers, following, liked) VALUES ($1, $2, $3, $4, $5, $6)`
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	})
+}
+
+// TestDatabase tests the behaviors of the Database beyond the conformance
+// suite of pub.Database.
+func TestDatabase(t *testing.T) {
+	ctx := context.Background()
+	t.Run("RejectsMalformedCursors", func(t *testing.T) {
+		d, _ := newDatabase(t)
+		for _, cursor := range []string{"bogus", beforeCursor + "x", afterCursor + "x"} {
+			if _, err := d.GetInboxPage(ctx, testInbox, pub.PageQuery{Cursor: cursor}); pub.ErrorStatusCode(err) != 400 {
+				t.Fatalf("got %v for cursor %q, want a malformed cursor", err, cursor)
+			}
+		}
+	})
+	t.Run("RetriesAppendLosingRace", func(t *testing.T) {
+		d, _ := newDatabase(t)
+		stub.dbs[t.Name()].appendConflicts = 2
+		if err := d.AppendOutbox(ctx, testOutbox, activityIRI("1")); err != nil {
+			t.Fatal(err)
+		}
+		tx, err := d.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stub.dbs[t.Name()].appendConflicts = 2
+		if err := tx.AppendOutbox(ctx, testOutbox, activityIRI("2")); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+		page, err := d.GetOutboxPage(ctx, testOutbox, pub.PageQuery{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertItems(t, page, "2", "1")
+	})
+	t.Run("MarksConflicts", func(t *testing.T) {
+		d, _ := newDatabase(t)
+		stub.dbs[t.Name()].commitConflicts = 1
+		tx, err := d.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(ctx); !errors.Is(err, pub.ErrTxConflict) {
+			t.Fatalf("got %v, want a conflict", err)
+		}
+		// Writes outside of transactions are tried again.
+		stub.dbs[t.Name()].commitConflicts = maxConflictAttempts - 1
+		if err := d.Delete(ctx, testNoteIRI); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("SerializesConcurrentCollectionUpdates", func(t *testing.T) {
+		d, _ := newDatabase(t)
+		followersIRI := &url.URL{Scheme: "https", Host: "example.com", Path: "/addison/followers"}
+		followers := streams.NewActivityStreamsCollection()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(followersIRI)
+		followers.SetJSONLDId(id)
+		if err := d.Create(ctx, followers); err != nil {
+			t.Fatal(err)
+		}
+		stub.dbs[t.Name()].commitConflicts = 3
+		// follow adds the follower in a transaction, trying it again
+		// until it does not conflict.
+		follow := func(follower *url.URL) error {
+			for {
+				tx, err := d.Begin(ctx)
+				if err != nil {
+					return err
+				}
+				v, err := tx.Get(ctx, followersIRI)
+				if err != nil {
+					tx.Rollback(ctx)
+					return err
+				}
+				// Let the other updates read the collection too.
+				runtime.Gosched()
+				col := v.(vocab.ActivityStreamsCollection)
+				items := col.GetActivityStreamsItems()
+				if items == nil {
+					items = streams.NewActivityStreamsItemsProperty()
+					col.SetActivityStreamsItems(items)
+				}
+				items.AppendIRI(follower)
+				if err = tx.Update(ctx, col); err != nil {
+					tx.Rollback(ctx)
+					return err
+				}
+				if err = tx.Commit(ctx); !errors.Is(err, pub.ErrTxConflict) {
+					return err
+				}
+			}
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := follow(activityIRI(strconv.Itoa(i))); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		v, err := d.Get(ctx, followersIRI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := v.(vocab.ActivityStreamsCollection).GetActivityStreamsItems().Len(); n != 10 {
+			t.Fatalf("got %d followers, want 10", n)
+		}
+	})
+	t.Run("RollsBackTransactions", func(t *testing.T) {
+		d, _ := newDatabase(t)
+		tx, err := d.Begin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		note := streams.NewActivityStreamsNote()
+		id := streams.NewJSONLDIdProperty()
+		id.Set(testNoteIRI)
+		note.SetJSONLDId(id)
+		if err := tx.Create(ctx, note); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.AppendOutbox(ctx, testOutbox, testNoteIRI); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Rollback(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if exists, _ := d.Exists(ctx, testNoteIRI); exists {
+			t.Fatalf("note exists after rollback")
+		}
+		if n, _ := d.OutboxTotalItems(ctx, testOutbox); n != 0 {
+			t.Fatalf("got %d outbox items after rollback, want none", n)
+		}
+	})
+}
+
+// TestDatabaseSuite runs the conformance suite of pub.Database.
+func TestDatabaseSuite(t *testing.T) {
+	pubtest.RunDatabaseSuite(t, func(t *testing.T) pub.Database {
+		d, _ := newDatabase(t)
+		return d
+	})
+}
+
+// assertItems fails the test if the page does not hold the activities with the
+// suffixes, in order.
+func assertItems(t *testing.T, page pub.CollectionPage, suffixes ...string) {
+	t.Helper()
+	if len(page.Items) != len(suffixes) {
+		t.Fatalf("got %d items, want %d", len(page.Items), len(suffixes))
+	}
+	for i, s := range suffixes {
+		if want := "https://other.example.com/activity/" + s; page.Items[i].String() != want {
+			t.Fatalf("got item %d %s, want %s", i, page.Items[i], want)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -35,10 +36,14 @@ func isSuccess(code int) bool {
 // requests if needed, and facilitating the traffic between this server and
 // another.
 //
-// The transport is exclusively used to issue requests on behalf of an actor,
-// and is never sending requests on behalf of the server in general.
+// The transport is exclusively used to issue requests on behalf of an actor.
+// Requests on behalf of the server in general are issued on behalf of its
+// InstanceActor, if there is one.
 //
 // It may be reused multiple times, but never concurrently.
+//
+// Failures to reach a peer, or unsuccessful responses from it, should be
+// returned as a RemoteError.
 type Transport interface {
 	// Dereference fetches the ActivityStreams object located at this IRI
 	// with a GET request.
@@ -110,6 +115,18 @@ func NewHttpSigTransport(
 // Dereference sends a GET request signed with an HTTP Signature to obtain an
 // ActivityStreams value.
 func (h HttpSigTransport) Dereference(c context.Context, iri *url.URL) ([]byte, error) {
+	return h.dereference(c, iri, -1)
+}
+
+// DereferenceLimit is Dereference, reading at most maxBytes of the response.
+// Larger responses are not read further, and a RemoteError is returned.
+func (h HttpSigTransport) DereferenceLimit(c context.Context, iri *url.URL, maxBytes int64) ([]byte, error) {
+	return h.dereference(c, iri, maxBytes)
+}
+
+// dereference fetches the ActivityStreams value, reading at most maxBytes of
+// the response unless it is negative.
+func (h HttpSigTransport) dereference(c context.Context, iri *url.URL, maxBytes int64) ([]byte, error) {
 	req, err := http.NewRequest("GET", iri.String(), nil)
 	if err != nil {
 		return nil, err
@@ -128,13 +145,30 @@ func (h HttpSigTransport) Dereference(c context.Context, iri *url.URL) ([]byte,
 	}
 	resp, err := h.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, &RemoteError{IRI: iri, Err: err}
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GET request to %s failed (%d): %s", iri.String(), resp.StatusCode, resp.Status)
+		return nil, &RemoteError{
+			IRI:        iri,
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("GET request to %s failed (%d): %s", iri.String(), resp.StatusCode, resp.Status),
+		}
+	}
+	if maxBytes < 0 {
+		return ioutil.ReadAll(resp.Body)
 	}
-	return ioutil.ReadAll(resp.Body)
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	} else if int64(len(b)) > maxBytes {
+		return nil, &RemoteError{
+			IRI:        iri,
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("%s is larger than %d bytes", iri, maxBytes),
+		}
+	}
+	return b, nil
 }
 
 // Deliver sends a POST request with an HTTP Signature.
@@ -157,11 +191,15 @@ func (h HttpSigTransport) Deliver(c context.Context, b []byte, to *url.URL) erro
 	}
 	resp, err := h.client.Do(req)
 	if err != nil {
-		return err
+		return &RemoteError{IRI: to, Err: err}
 	}
 	defer resp.Body.Close()
 	if !isSuccess(resp.StatusCode) {
-		return fmt.Errorf("POST request to %s failed (%d): %s", to.String(), resp.StatusCode, resp.Status)
+		return &RemoteError{
+			IRI:        to,
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("POST request to %s failed (%d): %s", to.String(), resp.StatusCode, resp.Status),
+		}
 	}
 	return nil
 }
@@ -192,7 +230,9 @@ outer:
 		}
 	}
 	if len(errs) > 0 {
-		return fmt.Errorf("batch deliver had at least one failure: %s", strings.Join(errs, "; "))
+		return &RemoteError{
+			Err: fmt.Errorf("batch deliver had at least one failure: %s", strings.Join(errs, "; ")),
+		}
 	}
 	return nil
 }
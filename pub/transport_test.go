@@ -2,6 +2,7 @@ package pub
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -52,7 +53,8 @@ func TestHttpSigTransportDereference(t *testing.T) {
 		// Run & Verify
 		b, err := tp.Dereference(ctx, mustParse(testNoteId1))
 		assertEqual(t, len(b), 0)
-		assertEqual(t, err, testErr)
+		assertEqual(t, errors.Is(err, testErr), true)
+		assertEqual(t, ErrorStatusCode(err), http.StatusBadGateway)
 	})
 	t.Run("Dereferences", func(t *testing.T) {
 		// Setup
@@ -78,6 +80,23 @@ func TestHttpSigTransportDereference(t *testing.T) {
 		assertByteEqual(t, b, testRespBody)
 		assertEqual(t, err, nil)
 	})
+	t.Run("StopsReadingPastLimit", func(t *testing.T) {
+		// Setup
+		ctl := gomock.NewController(t)
+		defer ctl.Finish()
+		tp, c, hc, gs, _ := httpSigSetupFn(ctl)
+		respR := httptest.NewRecorder()
+		respR.Write(testRespBody)
+		resp := respR.Result()
+		// Mock
+		c.EXPECT().Now().Return(now())
+		gs.EXPECT().SignRequest(testPrivKey, testPubKeyId, gomock.Any(), nil)
+		hc.EXPECT().Do(gomock.Any()).Return(resp, nil)
+		// Run & Verify
+		b, err := tp.DereferenceLimit(ctx, mustParse(testNoteId1), int64(len(testRespBody)-1))
+		assertEqual(t, len(b), 0)
+		assertEqual(t, ErrorStatusCode(err), http.StatusBadGateway)
+	})
 }
 
 func TestHttpSigTransportDeliver(t *testing.T) {
@@ -95,7 +114,8 @@ func TestHttpSigTransportDeliver(t *testing.T) {
 		hc.EXPECT().Do(gomock.Any()).Return(resp, testErr)
 		// Run & Verify
 		err := tp.Deliver(ctx, testRespBody, mustParse(testNoteId1))
-		assertEqual(t, err, testErr)
+		assertEqual(t, errors.Is(err, testErr), true)
+		assertEqual(t, ErrorStatusCode(err), http.StatusBadGateway)
 	})
 	t.Run("Delivers", func(t *testing.T) {
 		// Setup
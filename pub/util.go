@@ -6,7 +6,6 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/go-fed/activity/streams"
 	"github.com/go-fed/activity/streams/vocab"
@@ -16,17 +15,6 @@ import (
 	"time"
 )
 
-var (
-	// ErrObjectRequired indicates the activity needs its object property
-	// set. Can be returned by DelegateActor's PostInbox or PostOutbox so a
-	// Bad Request response is set.
-	ErrObjectRequired = errors.New("object property required on the provided activity")
-	// ErrTargetRequired indicates the activity needs its target property
-	// set. Can be returned by DelegateActor's PostInbox or PostOutbox so a
-	// Bad Request response is set.
-	ErrTargetRequired = errors.New("target property required on the provided activity")
-)
-
 // activityStreamsMediaTypes contains all of the accepted ActivityStreams media
 // types. Generated at init time.
 var activityStreamsMediaTypes []string
@@ -76,10 +64,14 @@ func isActivityPubPost(r *http.Request) bool {
 	return r.Method == "POST" && headerIsActivityPubMediaType(r.Header.Get(contentTypeHeader))
 }
 
-// isActivityPubGet returns true if the request is a GET request that has the
-// ActivityStreams content type header
+// isActivityPubGet returns true if the request is a GET request whose Accept
+// header prefers the ActivityStreams representation over a web page.
 func isActivityPubGet(r *http.Request) bool {
-	return r.Method == "GET" && headerIsActivityPubMediaType(r.Header.Get(acceptHeader))
+	if r.Method != "GET" {
+		return false
+	}
+	mediaType, ok := negotiateGet(r, true)
+	return ok && IsActivityStreamsMediaType(mediaType)
 }
 
 // dedupeOrderedItems deduplicates the 'orderedItems' within an ordered
@@ -132,9 +124,11 @@ const (
 )
 
 // addResponseHeaders sets headers needed in the HTTP response, such but not
-// limited to the Content-Type, Date, and Digest headers.
+// limited to the Content-Type, Date, Digest, and Vary headers.
 func addResponseHeaders(h http.Header, c Clock, responseContent []byte) {
 	h.Set(contentTypeHeader, contentTypeHeaderValue)
+	// The same IRI may be served as a web page.
+	addVaryAccept(h)
 	// RFC 7231 §7.1.1.2
 	h.Set(dateHeader, c.Now().UTC().Format("Mon, 02 Jan 2006 15:04:05")+" GMT")
 	// RFC 3230 and RFC 5843
@@ -166,7 +160,7 @@ func ToId(i IdProperty) (*url.URL, error) {
 	} else if i.IsIRI() {
 		return i.GetIRI(), nil
 	}
-	return nil, fmt.Errorf("cannot determine id of activitystreams property")
+	return nil, malformedf("cannot determine id of activitystreams property")
 }
 
 // GetId will attempt to find the 'id' property or, if it happens to be a
@@ -182,7 +176,7 @@ func GetId(t vocab.Type) (*url.URL, error) {
 			return href.Get(), nil
 		}
 	}
-	return nil, fmt.Errorf("cannot determine id of activitystreams value")
+	return nil, malformedf("cannot determine id of activitystreams value")
 }
 
 // getInboxForwardingValues obtains the 'inReplyTo', 'object', 'target', and
@@ -447,7 +441,7 @@ func mustHaveActivityOriginMatchObjects(a Activity) error {
 			return err
 		}
 		if originHost != iri.Host {
-			return fmt.Errorf("object %q: not in activity origin", iri)
+			return forbiddenf("object %q: not in activity origin", iri)
 		}
 	}
 	return nil
@@ -545,7 +539,7 @@ func normalizeRecipients(a vocab.ActivityStreamsCreate) error {
 		objsTo[i] = make(map[string]*url.URL)
 		var oTo vocab.ActivityStreamsToProperty
 		if tr, ok := iter.GetType().(toer); !ok {
-			return fmt.Errorf("the Create object at %d has no 'to' property", i)
+			return malformedf("the Create object at %d has no 'to' property", i)
 		} else {
 			oTo = tr.GetActivityStreamsTo()
 			if oTo == nil {
@@ -564,7 +558,7 @@ func normalizeRecipients(a vocab.ActivityStreamsCreate) error {
 		objsBto[i] = make(map[string]*url.URL)
 		var oBto vocab.ActivityStreamsBtoProperty
 		if tr, ok := iter.GetType().(btoer); !ok {
-			return fmt.Errorf("the Create object at %d has no 'bto' property", i)
+			return malformedf("the Create object at %d has no 'bto' property", i)
 		} else {
 			oBto = tr.GetActivityStreamsBto()
 			if oBto == nil {
@@ -583,7 +577,7 @@ func normalizeRecipients(a vocab.ActivityStreamsCreate) error {
 		objsCc[i] = make(map[string]*url.URL)
 		var oCc vocab.ActivityStreamsCcProperty
 		if tr, ok := iter.GetType().(ccer); !ok {
-			return fmt.Errorf("the Create object at %d has no 'cc' property", i)
+			return malformedf("the Create object at %d has no 'cc' property", i)
 		} else {
 			oCc = tr.GetActivityStreamsCc()
 			if oCc == nil {
@@ -602,7 +596,7 @@ func normalizeRecipients(a vocab.ActivityStreamsCreate) error {
 		objsBcc[i] = make(map[string]*url.URL)
 		var oBcc vocab.ActivityStreamsBccProperty
 		if tr, ok := iter.GetType().(bccer); !ok {
-			return fmt.Errorf("the Create object at %d has no 'bcc' property", i)
+			return malformedf("the Create object at %d has no 'bcc' property", i)
 		} else {
 			oBcc = tr.GetActivityStreamsBcc()
 			if oBcc == nil {
@@ -621,7 +615,7 @@ func normalizeRecipients(a vocab.ActivityStreamsCreate) error {
 		objsAudience[i] = make(map[string]*url.URL)
 		var oAudience vocab.ActivityStreamsAudienceProperty
 		if tr, ok := iter.GetType().(audiencer); !ok {
-			return fmt.Errorf("the Create object at %d has no 'audience' property", i)
+			return malformedf("the Create object at %d has no 'audience' property", i)
 		} else {
 			oAudience = tr.GetActivityStreamsAudience()
 			if oAudience == nil {
@@ -786,7 +780,7 @@ func mustHaveActivityActorsMatchObjectActors(c context.Context,
 		}
 		ac, ok := t.(actorer)
 		if !ok {
-			return fmt.Errorf("cannot verify actors: object value has no 'actor' property")
+			return malformedf("cannot verify actors: object value has no 'actor' property")
 		}
 		objActors := ac.GetActivityStreamsActor()
 		for iter := objActors.Begin(); iter != objActors.End(); iter = iter.Next() {
@@ -795,7 +789,7 @@ func mustHaveActivityActorsMatchObjectActors(c context.Context,
 				return err
 			}
 			if !activityActorMap[id.String()] {
-				return fmt.Errorf("activity does not have all actors from its object's actors")
+				return forbiddenf("activity does not have all actors from its object's actors")
 			}
 		}
 	}
@@ -5,11 +5,12 @@ import (
 )
 
 const (
-	// Version string, used in the User-Agent
-	version = "v1.0.0"
+	// Version is the version of the go-fed/activity library, used in the
+	// User-Agent.
+	Version = "v1.0.0"
 )
 
 // goFedUserAgent returns the user agent string for the go-fed library.
 func goFedUserAgent() string {
-	return fmt.Sprintf("(go-fed/activity %s)", version)
+	return fmt.Sprintf("(go-fed/activity %s)", Version)
 }
@@ -0,0 +1,190 @@
+package webfinger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// maxResourceBytes is the largest Resource document read from another server.
+const maxResourceBytes = 1 << 20
+
+// Client resolves accounts on other servers to the IRIs of their actors.
+//
+// Successful lookups are cached for a fixed duration. It is safe for concurrent
+// use.
+type Client struct {
+	client   pub.HttpClient
+	appAgent string
+	clock    pub.Clock
+	ttl      time.Duration
+	mu       sync.Mutex
+	cache    map[string]cacheEntry
+}
+
+// cacheEntry is a cached Resource.
+type cacheEntry struct {
+	res     *Resource
+	expires time.Time
+}
+
+// NewClient returns a Client issuing requests through the HTTP client, and
+// caching the Resources it obtains for the ttl.
+//
+// The appAgent is sent as the User-Agent of the requests.
+func NewClient(client pub.HttpClient, appAgent string, clock pub.Clock, ttl time.Duration) *Client {
+	return &Client{
+		client:   client,
+		appAgent: appAgent,
+		clock:    clock,
+		ttl:      ttl,
+		cache:    make(map[string]cacheEntry),
+	}
+}
+
+// ResolveActor returns the IRI of the actor of the account, given in any form
+// accepted by ParseAccount.
+func (cl *Client) ResolveActor(c context.Context, account string) (*url.URL, error) {
+	res, err := cl.Lookup(c, account)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := res.ActorLink()
+	if !ok {
+		return nil, fmt.Errorf("webfinger: %s has no ActivityStreams self link", res.Subject)
+	}
+	return url.Parse(l.Href)
+}
+
+// Lookup obtains the Resource of the account, given in any form accepted by
+// ParseAccount.
+//
+// The host of the account may delegate to another host, such as a server on a
+// subdomain responding with a subject on the parent domain. The subject is
+// then looked up on its own host, which must respond with the same subject, so
+// that a server is unable to claim accounts on hosts that do not agree.
+func (cl *Client) Lookup(c context.Context, account string) (*Resource, error) {
+	acct, err := ParseAccount(account)
+	if err != nil {
+		return nil, err
+	}
+	if res, ok := cl.cached(acct.String()); ok {
+		return res, nil
+	}
+	res, err := cl.fetch(c, acct)
+	if err != nil {
+		return nil, err
+	}
+	subject, err := ParseAccount(res.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if subject.Host != acct.Host {
+		// Verify the subject's host agrees.
+		res, err = cl.fetch(c, subject)
+		if err != nil {
+			return nil, err
+		}
+		if roundTrip, err := ParseAccount(res.Subject); err != nil {
+			return nil, err
+		} else if !sameAccount(roundTrip, subject) {
+			return nil, fmt.Errorf("webfinger: %s does not round-trip, %s responded with %s", acct, subject.Host, res.Subject)
+		}
+	} else if !sameAccount(subject, acct) {
+		return nil, fmt.Errorf("webfinger: %s responded with subject %s", acct, res.Subject)
+	}
+	cl.store(acct.String(), res)
+	if !sameAccount(subject, acct) {
+		cl.store(subject.String(), res)
+	}
+	return res, nil
+}
+
+// sameAccount determines whether the accounts are the same, ignoring the case
+// of their usernames. The hosts are already lower case.
+func sameAccount(a, b Account) bool {
+	return a.Host == b.Host && strings.EqualFold(a.Username, b.Username)
+}
+
+// fetch requests the Resource of the account from its host.
+func (cl *Client) fetch(c context.Context, acct Account) (*Resource, error) {
+	u := &url.URL{
+		Scheme:   "https",
+		Host:     acct.Host,
+		Path:     WellKnownPath,
+		RawQuery: url.Values{resourceQueryParam: []string{acct.String()}}.Encode(),
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(c)
+	req.Header.Set("Accept", ContentType)
+	req.Header.Set("User-Agent", cl.appAgent)
+	resp, err := cl.client.Do(req)
+	if err != nil {
+		return nil, &pub.RemoteError{IRI: u, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &pub.RemoteError{
+			IRI:        u,
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("webfinger: GET request to %s failed (%d): %s", u, resp.StatusCode, resp.Status),
+		}
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResourceBytes+1))
+	if err != nil {
+		return nil, &pub.RemoteError{IRI: u, StatusCode: resp.StatusCode, Err: err}
+	} else if len(b) > maxResourceBytes {
+		return nil, &pub.RemoteError{
+			IRI:        u,
+			StatusCode: resp.StatusCode,
+			Err:        fmt.Errorf("webfinger: response from %s exceeds %d bytes", u, maxResourceBytes),
+		}
+	}
+	res := &Resource{}
+	if err = json.Unmarshal(b, res); err != nil {
+		return nil, &pub.RemoteError{IRI: u, StatusCode: resp.StatusCode, Err: err}
+	}
+	return res, nil
+}
+
+// cached returns the unexpired Resource cached for the account.
+func (cl *Client) cached(acct string) (*Resource, bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	e, ok := cl.cache[acct]
+	if !ok {
+		return nil, false
+	} else if !cl.clock.Now().Before(e.expires) {
+		delete(cl.cache, acct)
+		return nil, false
+	}
+	return e.res, true
+}
+
+// store caches the Resource for the account, removing expired entries.
+func (cl *Client) store(acct string, res *Resource) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	now := cl.clock.Now()
+	for k, e := range cl.cache {
+		if !now.Before(e.expires) {
+			delete(cl.cache, k)
+		}
+	}
+	cl.cache[acct] = cacheEntry{
+		res:     res,
+		expires: now.Add(cl.ttl),
+	}
+}
@@ -0,0 +1,144 @@
+package webfinger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-fed/activity/pub"
+)
+
+// testClock is a pub.Clock returning a settable time.
+type testClock struct {
+	now time.Time
+}
+
+// Now returns the set time.
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+// testHttpClient serves requests with the handler of their host, counting
+// them.
+type testHttpClient struct {
+	hosts    map[string]http.Handler
+	requests int
+}
+
+// Do serves the request with the handler of its host.
+func (c *testHttpClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests++
+	h, ok := c.hosts[req.URL.Host]
+	if !ok {
+		return nil, errors.New("unknown host")
+	}
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp.Result(), nil
+}
+
+// TestClient tests resolving accounts on other servers.
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	setupFn := func() (*Client, *testHttpClient, *testClock) {
+		hc := &testHttpClient{
+			hosts: map[string]http.Handler{
+				"example.com": NewHandler(testResolver{
+					acct:  Account{Username: "addison", Host: "example.com"},
+					actor: "https://social.example.com/addison",
+				}),
+				"social.example.com": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					// Delegates its accounts to the parent domain.
+					w.Write([]byte(`{"subject":"acct:addison@example.com","links":[{"rel":"self","type":"application/activity+json","href":"https://social.example.com/addison"}]}`))
+				}),
+				"social.shouting.example": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{"subject":"acct:addison@shouting.example","links":[{"rel":"self","type":"application/activity+json","href":"https://social.shouting.example/addison"}]}`))
+				}),
+				"shouting.example": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					// Responds with the subject in different case.
+					w.Write([]byte(`{"subject":"acct:ADDISON@SHOUTING.EXAMPLE","links":[{"rel":"self","type":"application/activity+json","href":"https://social.shouting.example/addison"}]}`))
+				}),
+				"large.example": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{"subject":"acct:sam@large.example","aliases":["`))
+					w.Write(bytes.Repeat([]byte("a"), maxResourceBytes))
+					w.Write([]byte(`"]}`))
+				}),
+				"evil.example": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte(`{"subject":"acct:sam@example.com","links":[{"rel":"self","type":"application/activity+json","href":"https://evil.example/sam"}]}`))
+				}),
+			},
+		}
+		clock := &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+		return NewClient(hc, "myApp", clock, time.Hour), hc, clock
+	}
+	t.Run("ResolvesActor", func(t *testing.T) {
+		cl, _, _ := setupFn()
+		iri, err := cl.ResolveActor(ctx, "@addison@example.com")
+		if err != nil {
+			t.Fatal(err)
+		} else if iri.String() != "https://social.example.com/addison" {
+			t.Fatalf("got %s", iri)
+		}
+	})
+	t.Run("FollowsSubjectToItsHost", func(t *testing.T) {
+		cl, hc, _ := setupFn()
+		iri, err := cl.ResolveActor(ctx, "addison@social.example.com")
+		if err != nil {
+			t.Fatal(err)
+		} else if iri.String() != "https://social.example.com/addison" {
+			t.Fatalf("got %s", iri)
+		} else if hc.requests != 2 {
+			t.Fatalf("got %d requests, want 2", hc.requests)
+		}
+	})
+	t.Run("RejectsSubjectThatDoesNotRoundTrip", func(t *testing.T) {
+		cl, _, _ := setupFn()
+		if _, err := cl.ResolveActor(ctx, "sam@evil.example"); err == nil {
+			t.Fatal("resolved an account claimed by another host")
+		}
+	})
+	t.Run("IgnoresCaseOfSubject", func(t *testing.T) {
+		cl, _, _ := setupFn()
+		iri, err := cl.ResolveActor(ctx, "addison@social.shouting.example")
+		if err != nil {
+			t.Fatal(err)
+		} else if iri.String() != "https://social.shouting.example/addison" {
+			t.Fatalf("got %s", iri)
+		}
+	})
+	t.Run("RejectsOversizedResource", func(t *testing.T) {
+		cl, _, _ := setupFn()
+		if _, err := cl.ResolveActor(ctx, "sam@large.example"); err == nil {
+			t.Fatal("read a resource larger than the limit")
+		}
+	})
+	t.Run("CachesUntilExpiry", func(t *testing.T) {
+		cl, hc, clock := setupFn()
+		for i := 0; i < 2; i++ {
+			if _, err := cl.ResolveActor(ctx, "addison@example.com"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if hc.requests != 1 {
+			t.Fatalf("got %d requests, want 1", hc.requests)
+		}
+		clock.now = clock.now.Add(time.Hour)
+		if _, err := cl.ResolveActor(ctx, "addison@example.com"); err != nil {
+			t.Fatal(err)
+		} else if hc.requests != 2 {
+			t.Fatalf("got %d requests, want 2", hc.requests)
+		}
+	})
+	t.Run("ReturnsRemoteErrorForUnknownAccount", func(t *testing.T) {
+		cl, _, _ := setupFn()
+		_, err := cl.ResolveActor(ctx, "sam@example.com")
+		var re *pub.RemoteError
+		if !errors.As(err, &re) || re.StatusCode != http.StatusNotFound {
+			t.Fatalf("got %v, want RemoteError with status 404", err)
+		}
+	})
+}
@@ -0,0 +1,7 @@
+// Package webfinger implements the WebFinger protocol, RFC 7033, as used to
+// look up ActivityPub actors by account names such as "addison@example.com".
+//
+// NewHandler serves the "/.well-known/webfinger" endpoint for the accounts on
+// this server, and a Client resolves the accounts on other servers to the IRIs
+// of their actors.
+package webfinger
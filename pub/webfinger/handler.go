@@ -0,0 +1,105 @@
+package webfinger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// resourceQueryParam is the query parameter of the account looked up.
+	resourceQueryParam = "resource"
+	// relQueryParam is the query parameter restricting the links in the
+	// response to the given relations.
+	relQueryParam = "rel"
+)
+
+// AccountResolver maps the accounts on this server to their actors.
+type AccountResolver interface {
+	// ActorForAccount returns the IRI of the actor of the account, and
+	// other IRIs identifying it such as its profile page.
+	//
+	// Returns a nil actorIRI and no error if the account does not exist,
+	// including when its host is not served by this server.
+	ActorForAccount(c context.Context, a Account) (actorIRI *url.URL, aliases []*url.URL, err error)
+}
+
+// NewHandler creates an http.Handler serving WellKnownPath for the accounts on
+// this server.
+//
+// Only "acct:" resources are supported. Responds with http.StatusBadRequest
+// for a missing or malformed resource, http.StatusNotFound for unknown
+// accounts, and http.StatusInternalServerError if the AccountResolver fails.
+func NewHandler(r AccountResolver) http.Handler {
+	return &handler{resolver: r}
+}
+
+// handler is the http.Handler returned by NewHandler.
+type handler struct {
+	resolver AccountResolver
+}
+
+// ServeHTTP responds with the Resource of the requested account.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	resource := q.Get(resourceQueryParam)
+	if len(resource) == 0 {
+		http.Error(w, "webfinger: resource query parameter required", http.StatusBadRequest)
+		return
+	}
+	acct, err := ParseAccount(resource)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	actorIRI, aliases, err := h.resolver.ActorForAccount(r.Context(), acct)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	} else if actorIRI == nil {
+		http.NotFound(w, r)
+		return
+	}
+	res := Resource{
+		Subject: acct.String(),
+		Aliases: []string{actorIRI.String()},
+	}
+	for _, alias := range aliases {
+		res.Aliases = append(res.Aliases, alias.String())
+	}
+	self := Link{
+		Rel:  SelfRel,
+		Type: ActivityStreamsType,
+		Href: actorIRI.String(),
+	}
+	if rels, ok := q[relQueryParam]; !ok || contains(rels, SelfRel) {
+		res.Links = append(res.Links, self)
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	// Permit browser-based clients on other hosts, as recommended by RFC
+	// 7033.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// contains determines whether the value is one of the entries.
+func contains(entries []string, v string) bool {
+	for _, e := range entries {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
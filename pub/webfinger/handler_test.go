@@ -0,0 +1,116 @@
+package webfinger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// testResolver is an AccountResolver of a single account.
+type testResolver struct {
+	acct    Account
+	actor   string
+	aliases []string
+}
+
+// ActorForAccount returns the actor if the account matches.
+func (r testResolver) ActorForAccount(c context.Context, a Account) (*url.URL, []*url.URL, error) {
+	if a != r.acct {
+		return nil, nil, nil
+	}
+	var aliases []*url.URL
+	for _, alias := range r.aliases {
+		aliases = append(aliases, mustParse(alias))
+	}
+	return mustParse(r.actor), aliases, nil
+}
+
+// mustParse parses the IRI, panicking on failure.
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// TestHandler tests serving accounts on this server.
+func TestHandler(t *testing.T) {
+	h := NewHandler(testResolver{
+		acct:    Account{Username: "addison", Host: "example.com"},
+		actor:   "https://example.com/addison",
+		aliases: []string{"https://example.com/@addison"},
+	})
+	serve := func(target string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		h.ServeHTTP(resp, httptest.NewRequest("GET", target, nil))
+		return resp
+	}
+	t.Run("ServesAccount", func(t *testing.T) {
+		resp := serve("https://example.com/.well-known/webfinger?resource=acct:addison@example.com")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusOK)
+		}
+		if ct := resp.Header().Get("Content-Type"); ct != ContentType {
+			t.Fatalf("got content type %q, want %q", ct, ContentType)
+		}
+		var res Resource
+		if err := json.Unmarshal(resp.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Subject != "acct:addison@example.com" {
+			t.Fatalf("got subject %q", res.Subject)
+		}
+		if len(res.Aliases) != 2 || res.Aliases[1] != "https://example.com/@addison" {
+			t.Fatalf("got aliases %v", res.Aliases)
+		}
+		if l, ok := res.ActorLink(); !ok || l.Href != "https://example.com/addison" {
+			t.Fatalf("got links %v", res.Links)
+		}
+	})
+	t.Run("FiltersLinksByRel", func(t *testing.T) {
+		resp := serve("https://example.com/.well-known/webfinger?resource=acct:addison@example.com&rel=http://webfinger.net/rel/profile-page")
+		var res Resource
+		if err := json.Unmarshal(resp.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Links) != 0 {
+			t.Fatalf("got links %v, want none", res.Links)
+		}
+	})
+	t.Run("RejectsMissingResource", func(t *testing.T) {
+		if resp := serve("https://example.com/.well-known/webfinger"); resp.Code != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusBadRequest)
+		}
+	})
+	t.Run("RejectsMalformedResource", func(t *testing.T) {
+		if resp := serve("https://example.com/.well-known/webfinger?resource=acct:addison"); resp.Code != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusBadRequest)
+		}
+	})
+	t.Run("ReturnsNotFoundForUnknownAccount", func(t *testing.T) {
+		if resp := serve("https://example.com/.well-known/webfinger?resource=acct:sam@example.com"); resp.Code != http.StatusNotFound {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusNotFound)
+		}
+	})
+}
+
+// TestParseAccount tests parsing the forms of an account.
+func TestParseAccount(t *testing.T) {
+	want := Account{Username: "addison", Host: "example.com"}
+	for _, s := range []string{"acct:addison@example.com", "addison@example.com", "@addison@Example.com"} {
+		if got, err := ParseAccount(s); err != nil {
+			t.Errorf("ParseAccount(%q) failed: %v", s, err)
+		} else if got != want {
+			t.Errorf("ParseAccount(%q) = %v, want %v", s, got, want)
+		}
+	}
+	for _, s := range []string{"addison", "addison@", "@example.com", "addison@example.com/x"} {
+		if _, err := ParseAccount(s); err == nil {
+			t.Errorf("ParseAccount(%q) succeeded, want error", s)
+		}
+	}
+}
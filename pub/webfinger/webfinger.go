@@ -0,0 +1,90 @@
+package webfinger
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// WellKnownPath is the path of the WebFinger endpoint.
+	WellKnownPath = "/.well-known/webfinger"
+	// ContentType is the media type of WebFinger responses.
+	ContentType = "application/jrd+json"
+	// SelfRel is the relation of the link to the actor of an account.
+	SelfRel = "self"
+	// ActivityStreamsType is the media type of the link to the actor of an
+	// account.
+	ActivityStreamsType = "application/activity+json"
+	// ldActivityStreamsType is the other media type a link to the actor
+	// of an account may have.
+	ldActivityStreamsType = "application/ld+json; profile=\"https://www.w3.org/ns/activitystreams\""
+	// acctScheme is the scheme of account resources.
+	acctScheme = "acct:"
+)
+
+// Link is a link in a WebFinger response.
+type Link struct {
+	// Rel is the relation of the link, such as "self".
+	Rel string `json:"rel"`
+	// Type is the media type of the linked resource.
+	Type string `json:"type,omitempty"`
+	// Href is the IRI of the linked resource.
+	Href string `json:"href,omitempty"`
+	// Template is an IRI template of the linked resource, used instead of
+	// Href by some relations.
+	Template string `json:"template,omitempty"`
+}
+
+// Resource is a WebFinger response, the JSON Resource Descriptor of an account.
+type Resource struct {
+	// Subject is the account, such as "acct:addison@example.com".
+	Subject string `json:"subject"`
+	// Aliases are other IRIs identifying the account, such as the IRI of
+	// its profile page.
+	Aliases []string `json:"aliases,omitempty"`
+	// Links are the links of the account.
+	Links []Link `json:"links,omitempty"`
+}
+
+// ActorLink returns the "self" link to the ActivityStreams actor of the
+// account, and false if there is none.
+func (r *Resource) ActorLink() (Link, bool) {
+	for _, l := range r.Links {
+		if l.Rel == SelfRel && len(l.Href) > 0 && (l.Type == ActivityStreamsType || l.Type == ldActivityStreamsType) {
+			return l, true
+		}
+	}
+	return Link{}, false
+}
+
+// Account is a user on a host, such as "addison@example.com".
+type Account struct {
+	// Username is the name of the user on the host.
+	Username string
+	// Host is the host of the server, including its port if it is not the
+	// default one.
+	Host string
+}
+
+// ParseAccount parses an account in any of the "acct:addison@example.com",
+// "addison@example.com", or "@addison@example.com" forms.
+func ParseAccount(s string) (a Account, err error) {
+	acct := strings.TrimPrefix(strings.TrimPrefix(s, acctScheme), "@")
+	i := strings.LastIndex(acct, "@")
+	if i <= 0 || i == len(acct)-1 {
+		err = fmt.Errorf("webfinger: account %q is not of the form user@host", s)
+		return
+	}
+	a.Username = acct[:i]
+	a.Host = strings.ToLower(acct[i+1:])
+	if strings.ContainsAny(a.Host, "/?#@") {
+		err = fmt.Errorf("webfinger: account %q has an invalid host", s)
+		return
+	}
+	return
+}
+
+// String returns the account as an "acct:" resource.
+func (a Account) String() string {
+	return acctScheme + a.Username + "@" + a.Host
+}